@@ -0,0 +1,245 @@
+// Package apperrors defines the errors handlers report and how they are
+// rendered, so every error response has the same shape:
+//
+//	{"error": "User not found", "code": "not_found", "requestId": "..."}
+package apperrors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Machine-readable error codes. Clients should branch on these rather than
+// on messages.
+const (
+	CodeBadRequest      = "bad_request"
+	CodeValidation      = "validation_failed"
+	CodeUnauthorized    = "unauthorized"
+	CodeForbidden       = "forbidden"
+	CodeNotFound        = "not_found"
+	CodeConflict        = "conflict"
+	CodePrecondition    = "precondition_failed"
+	CodeMediaType       = "unsupported_media_type"
+	CodeTooManyRequests = "too_many_requests"
+	CodeUnavailable     = "unavailable"
+	CodeInternal        = "internal"
+)
+
+// FieldError describes one invalid field of a request body.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Fields  []FieldError
+	// Meta is merged into the response body, e.g. retryAfter.
+	Meta map[string]interface{}
+	// Err is the underlying cause. It is logged, never sent to clients.
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithCode replaces the generic code with a more specific one.
+func (e *Error) WithCode(code string) *Error {
+	e.Code = code
+	return e
+}
+
+func (e *Error) With(key string, value interface{}) *Error {
+	if e.Meta == nil {
+		e.Meta = make(map[string]interface{})
+	}
+	e.Meta[key] = value
+	return e
+}
+
+func New(httpStatus int, code, message string) *Error {
+	return &Error{Status: httpStatus, Code: code, Message: message}
+}
+
+func BadRequest(message string) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, message)
+}
+
+func Unauthorized(message string) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, message)
+}
+
+func Forbidden(message string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, message)
+}
+
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, message)
+}
+
+func Conflict(message string) *Error {
+	return New(http.StatusConflict, CodeConflict, message)
+}
+
+// PreconditionFailed reports a stale If-Match ETag.
+func PreconditionFailed(message string) *Error {
+	return New(http.StatusPreconditionFailed, CodePrecondition, message)
+}
+
+func TooManyRequests(message string) *Error {
+	return New(http.StatusTooManyRequests, CodeTooManyRequests, message)
+}
+
+func Unavailable(err error, message string) *Error {
+	e := New(http.StatusServiceUnavailable, CodeUnavailable, message)
+	e.Err = err
+	return e
+}
+
+// Internal wraps an unexpected failure. Transient backend failures such as
+// Firestore timeouts become Unavailable so clients know to retry.
+func Internal(err error, message string) *Error {
+	if err != nil && temporary(err) {
+		return Unavailable(err, "Service temporarily unavailable, please try again")
+	}
+	e := New(http.StatusInternalServerError, CodeInternal, message)
+	e.Err = err
+	return e
+}
+
+// temporary reports whether err is a transient backend failure.
+func temporary(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true
+	}
+	return false
+}
+
+// FromFirestore maps a failed call on a single document: a missing document
+// becomes NotFound, a failed precondition (If-Match) PreconditionFailed and
+// anything else Internal (or Unavailable). Errors that are already typed
+// pass through.
+func FromFirestore(err error, notFound, message string) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	switch status.Code(err) {
+	case codes.NotFound:
+		return NotFound(notFound)
+	case codes.FailedPrecondition:
+		return PreconditionFailed("The resource has been modified, reload it and try again")
+	}
+	return Internal(err, message)
+}
+
+func UnsupportedMediaType(message string) *Error {
+	return New(http.StatusUnsupportedMediaType, CodeMediaType, message)
+}
+
+// ValidationFailed reports invalid fields found outside of binding.
+func ValidationFailed(fields ...FieldError) *Error {
+	e := New(http.StatusBadRequest, CodeValidation, "Request validation failed")
+	e.Fields = fields
+	return e
+}
+
+// Validation converts a binding error into field-level details.
+func Validation(err error) *Error {
+	var (
+		validationErrs validator.ValidationErrors
+		typeErr        *json.UnmarshalTypeError
+		syntaxErr      *json.SyntaxError
+	)
+
+	switch {
+	case errors.As(err, &validationErrs):
+		fields := make([]FieldError, 0, len(validationErrs))
+		for _, fe := range validationErrs {
+			fields = append(fields, FieldError{
+				Field:   jsonFieldName(fe),
+				Rule:    fe.Tag(),
+				Message: fieldMessage(fe),
+			})
+		}
+		return ValidationFailed(fields...)
+	case errors.As(err, &typeErr):
+		return ValidationFailed(FieldError{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Message: fmt.Sprintf("must be of type %s", typeErr.Type),
+		})
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return BadRequest("Malformed JSON body")
+	case errors.Is(err, io.EOF):
+		return BadRequest("Request body is required")
+	default:
+		return BadRequest(err.Error())
+	}
+}
+
+func init() {
+	// Report JSON names ("displayName") rather than Go field names
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	}
+}
+
+// jsonFieldName drops the request type from the validator namespace
+// ("SignUpRequest.email" becomes "email").
+func jsonFieldName(fe validator.FieldError) string {
+	if _, rest, found := strings.Cut(fe.Namespace(), "."); found {
+		return rest
+	}
+	return fe.Field()
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min":
+		return "must be at least " + fe.Param()
+	case "max":
+		return "must be at most " + fe.Param()
+	case "oneof":
+		return "must be one of " + fe.Param()
+	default:
+		return "failed the " + fe.Tag() + " check"
+	}
+}
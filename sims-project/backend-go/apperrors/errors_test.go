@@ -0,0 +1,114 @@
+package apperrors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin/binding"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestFromFirestore(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"not found", status.Error(codes.NotFound, "no document"), http.StatusNotFound, CodeNotFound},
+		{"stale update time", status.Error(codes.FailedPrecondition, "update time mismatch"), http.StatusPreconditionFailed, CodePrecondition},
+		{"unavailable", status.Error(codes.Unavailable, "connection reset"), http.StatusServiceUnavailable, CodeUnavailable},
+		{"aborted transaction", status.Error(codes.Aborted, "contention"), http.StatusServiceUnavailable, CodeUnavailable},
+		{"deadline", fmt.Errorf("reading: %w", context.DeadlineExceeded), http.StatusServiceUnavailable, CodeUnavailable},
+		{"permission denied", status.Error(codes.PermissionDenied, "rules"), http.StatusInternalServerError, CodeInternal},
+		{"already typed", Conflict("Duplicate"), http.StatusConflict, CodeConflict},
+		{"wrapped typed", fmt.Errorf("transaction: %w", Forbidden("No")), http.StatusForbidden, CodeForbidden},
+	}
+	for _, tt := range tests {
+		err := FromFirestore(tt.err, "User not found", "Failed to fetch user")
+		if err.Status != tt.status || err.Code != tt.code {
+			t.Errorf("%s: FromFirestore = %d %s, want %d %s", tt.name, err.Status, err.Code, tt.status, tt.code)
+		}
+	}
+
+	if err := FromFirestore(status.Error(codes.NotFound, "no document"), "User not found", "Failed"); err.Message != "User not found" {
+		t.Errorf("not found message = %q", err.Message)
+	}
+	cause := status.Error(codes.Internal, "boom")
+	if err := FromFirestore(cause, "User not found", "Failed to fetch user"); !errors.Is(err, cause) || err.Message != "Failed to fetch user" {
+		t.Errorf("internal error = %v, want to wrap the cause", err)
+	}
+}
+
+type validationRequest struct {
+	Email       string `json:"email" binding:"required,email"`
+	DisplayName string `json:"displayName" binding:"min=2"`
+	Role        string `json:"role" binding:"oneof=teacher student"`
+	Address     struct {
+		City string `json:"city" binding:"required"`
+	} `json:"address"`
+}
+
+func TestValidation(t *testing.T) {
+	var req validationRequest
+	req.Email, req.DisplayName, req.Role = "not-an-email", "A", "admin"
+	err := Validation(binding.Validator.ValidateStruct(&req))
+	if err.Status != http.StatusBadRequest || err.Code != CodeValidation {
+		t.Fatalf("Validation = %d %s", err.Status, err.Code)
+	}
+
+	want := []FieldError{
+		{Field: "email", Rule: "email", Message: "must be a valid email address"},
+		{Field: "displayName", Rule: "min", Message: "must be at least 2"},
+		{Field: "role", Rule: "oneof", Message: "must be one of teacher student"},
+		{Field: "address.city", Rule: "required", Message: "is required"},
+	}
+	if len(err.Fields) != len(want) {
+		t.Fatalf("Fields = %+v, want %+v", err.Fields, want)
+	}
+	for i, field := range err.Fields {
+		if field != want[i] {
+			t.Errorf("field %d = %+v, want %+v", i, field, want[i])
+		}
+	}
+}
+
+func TestValidationBodyErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		code  string
+		field string
+	}{
+		{"malformed", `{"email":`, CodeBadRequest, ""},
+		{"syntax", `{"email" "a"}`, CodeBadRequest, ""},
+		{"empty", ``, CodeBadRequest, ""},
+		{"wrong type", `{"email": 5}`, CodeValidation, "email"},
+	}
+	for _, tt := range tests {
+		var req validationRequest
+		err := Validation(binding.JSON.BindBody([]byte(tt.body), &req))
+		if err.Code != tt.code {
+			t.Errorf("%s: code = %s, want %s (%v)", tt.name, err.Code, tt.code, err)
+			continue
+		}
+		if tt.field != "" && (len(err.Fields) != 1 || err.Fields[0].Field != tt.field || err.Fields[0].Rule != "type") {
+			t.Errorf("%s: Fields = %+v, want a type error on %s", tt.name, err.Fields, tt.field)
+		}
+	}
+}
+
+func TestErrorMessageHidesCauseFromClients(t *testing.T) {
+	err := Internal(errors.New("dial tcp 10.0.0.1:443: refused"), "Failed to fetch user")
+	if err.Message != "Failed to fetch user" {
+		t.Errorf("Message = %q", err.Message)
+	}
+	if !strings.Contains(err.Error(), "refused") {
+		t.Errorf("Error() = %q, want the cause for logs", err.Error())
+	}
+}
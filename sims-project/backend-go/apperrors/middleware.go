@@ -0,0 +1,83 @@
+package apperrors
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+
+	"github.com/gin-gonic/gin"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID tags every request with an ID, reusing a sane incoming one so
+// IDs can be correlated across a proxy, and echoes it in the response.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			buf := make([]byte, 8)
+			rand.Read(buf)
+			id = hex.EncodeToString(buf)
+		}
+
+		c.Set("requestId", id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		if !(r == '-' || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')) {
+			return false
+		}
+	}
+	return true
+}
+
+// Handler renders the last error recorded with c.Error as the response.
+// Handlers report errors with c.Error and return; middleware use Abort.
+func Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		var appErr *Error
+		if !errors.As(c.Errors.Last().Err, &appErr) {
+			appErr = Internal(c.Errors.Last().Err, "Internal server error")
+		}
+
+		requestID := c.GetString("requestId")
+		if appErr.Status >= 500 {
+			log.Printf("[%s] %s %s: %v", requestID, c.Request.Method, c.Request.URL.Path, appErr)
+		}
+
+		body := gin.H{
+			"error":     appErr.Message,
+			"code":      appErr.Code,
+			"requestId": requestID,
+		}
+		if len(appErr.Fields) > 0 {
+			body["details"] = appErr.Fields
+		}
+		for key, value := range appErr.Meta {
+			body[key] = value
+		}
+
+		c.JSON(appErr.Status, body)
+	}
+}
+
+// Abort records err and stops the handler chain.
+func Abort(c *gin.Context, err error) {
+	c.Error(err)
+	c.Abort()
+}
@@ -0,0 +1,136 @@
+package apperrors
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func serve(handler gin.HandlerFunc, requestID string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestID(), Handler())
+	router.GET("/test", handler)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/test", nil)
+	if requestID != "" {
+		req.Header.Set(RequestIDHeader, requestID)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		body   map[string]interface{}
+	}{
+		{
+			"typed error",
+			NotFound("User not found"),
+			http.StatusNotFound,
+			map[string]interface{}{"error": "User not found", "code": CodeNotFound},
+		},
+		{
+			"meta merged into the body",
+			TooManyRequests("Slow down").With("retryAfter", 30),
+			http.StatusTooManyRequests,
+			map[string]interface{}{"error": "Slow down", "code": CodeTooManyRequests, "retryAfter": float64(30)},
+		},
+		{
+			"untyped error hidden",
+			errors.New("firestore: secret detail"),
+			http.StatusInternalServerError,
+			map[string]interface{}{"error": "Internal server error", "code": CodeInternal},
+		},
+		{
+			"field details",
+			ValidationFailed(FieldError{Field: "amount", Rule: "min", Message: "must be at least 1"}),
+			http.StatusBadRequest,
+			map[string]interface{}{"error": "Request validation failed", "code": CodeValidation,
+				"details": []interface{}{map[string]interface{}{"field": "amount", "rule": "min", "message": "must be at least 1"}}},
+		},
+	}
+	for _, tt := range tests {
+		w := serve(func(c *gin.Context) { c.Error(tt.err) }, "req-1")
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+		}
+
+		var body map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		tt.body["requestId"] = "req-1"
+		if len(body) != len(tt.body) {
+			t.Errorf("%s: body = %v, want %v", tt.name, body, tt.body)
+		}
+		for key, want := range tt.body {
+			got, _ := json.Marshal(body[key])
+			expected, _ := json.Marshal(want)
+			if string(got) != string(expected) {
+				t.Errorf("%s: %s = %s, want %s", tt.name, key, got, expected)
+			}
+		}
+	}
+}
+
+func TestHandlerLeavesWrittenResponses(t *testing.T) {
+	w := serve(func(c *gin.Context) {
+		c.String(http.StatusAccepted, "partial")
+		c.Error(Internal(nil, "late failure"))
+	}, "")
+	if w.Code != http.StatusAccepted || w.Body.String() != "partial" {
+		t.Errorf("response = %d %q", w.Code, w.Body.String())
+	}
+
+	w = serve(func(c *gin.Context) { c.Status(http.StatusNoContent) }, "")
+	if w.Code != http.StatusNoContent {
+		t.Errorf("no error: status = %d", w.Code)
+	}
+}
+
+func TestAbort(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Handler(), func(c *gin.Context) { Abort(c, Unauthorized("User not authenticated")) })
+	reached := false
+	router.GET("/test", func(c *gin.Context) { reached = true })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil))
+	if reached || w.Code != http.StatusUnauthorized {
+		t.Errorf("reached = %v, status = %d", reached, w.Code)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		sent string
+		kept bool
+	}{
+		{"abc-123_DEF", true},
+		{"", false},
+		{"has space", false},
+		{"<script>", false},
+		{strings.Repeat("a", 65), false},
+	}
+	for _, tt := range tests {
+		w := serve(func(c *gin.Context) { c.Error(BadRequest("bad")) }, tt.sent)
+		id := w.Header().Get(RequestIDHeader)
+		if (id == tt.sent) != tt.kept || id == "" {
+			t.Errorf("sent %q: %s = %q, kept = %v", tt.sent, RequestIDHeader, id, tt.kept)
+		}
+		if !strings.Contains(w.Body.String(), `"requestId":"`+id+`"`) {
+			t.Errorf("sent %q: body %s does not carry the request ID", tt.sent, w.Body.String())
+		}
+	}
+}
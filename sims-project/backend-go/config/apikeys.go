@@ -0,0 +1,214 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sims-backend-go/apperrors"
+	"sims-backend-go/models"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// APIKeyPrefix marks API keys so they can be told apart from ID tokens
+	// in the Authorization header.
+	APIKeyPrefix = "sims_"
+	APIKeyHeader = "X-API-Key"
+	// APIKeyRole is the role claim of requests authenticated by an API key.
+	// Their permissions come from the key's scopes, not from the role.
+	APIKeyRole = "api_key"
+)
+
+// apiKeyForbidden lists permissions never granted to API keys, so a leaked
+// key cannot create more keys, widen role permissions or take over user
+// accounts. Keys skip two-factor step-up, which guards these for users.
+var apiKeyForbidden = map[string]bool{
+	PermAPIKeysWrite:     true,
+	PermPermissionsWrite: true,
+	PermUsersWrite:       true,
+	PermUsersMFAReset:    true,
+	PermInvitationsWrite: true,
+	PermSessionsRevoke:   true,
+}
+
+func IsAPIKeyPermission(permission string) bool {
+	return IsValidPermission(permission) && !apiKeyForbidden[permission]
+}
+
+// HashAPIKey returns the document ID an API key is stored under.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(key)))
+	return hex.EncodeToString(sum[:])
+}
+
+var errAPIKeyNotFound = errors.New("api key not found")
+
+type apiKeyEntry struct {
+	key       models.APIKey
+	fetchedAt time.Time
+	touchedAt time.Time
+}
+
+// apiKeyCache avoids a Firestore read per machine request. Revocations made
+// through this instance take effect immediately; others after the TTL.
+type apiKeyCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*apiKeyEntry
+}
+
+var apiKeys = &apiKeyCache{
+	ttl:     30 * time.Second,
+	entries: make(map[string]*apiKeyEntry),
+}
+
+// lastUsedInterval throttles last-used writes for busy keys.
+const lastUsedInterval = time.Minute
+
+func (kc *apiKeyCache) get(ctx context.Context, id string) (models.APIKey, error) {
+	kc.mu.Lock()
+	entry, ok := kc.entries[id]
+	ttl := kc.ttl
+	kc.mu.Unlock()
+	if ok && time.Since(entry.fetchedAt) < ttl {
+		return entry.key, nil
+	}
+
+	if FirebaseApp == nil {
+		return models.APIKey{}, errAPIKeyNotFound
+	}
+
+	client, err := FirebaseApp.Firestore(ctx)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	defer client.Close()
+
+	doc, err := client.Collection("api_keys").Doc(id).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return models.APIKey{}, errAPIKeyNotFound
+		}
+		return models.APIKey{}, err
+	}
+
+	var key models.APIKey
+	doc.DataTo(&key)
+	key.ID = doc.Ref.ID
+
+	kc.mu.Lock()
+	if len(kc.entries) > 10000 {
+		kc.entries = make(map[string]*apiKeyEntry)
+	}
+	touchedAt := time.Time{}
+	if ok {
+		touchedAt = entry.touchedAt
+	}
+	kc.entries[id] = &apiKeyEntry{key: key, fetchedAt: time.Now(), touchedAt: touchedAt}
+	kc.mu.Unlock()
+
+	return key, nil
+}
+
+// touch records when and from where a key was last used, at most once per
+// lastUsedInterval. The write happens in the background so it never slows
+// down the request.
+func (kc *apiKeyCache) touch(id, ip string) {
+	now := time.Now()
+
+	kc.mu.Lock()
+	entry, ok := kc.entries[id]
+	if !ok || now.Sub(entry.touchedAt) < lastUsedInterval {
+		kc.mu.Unlock()
+		return
+	}
+	entry.touchedAt = now
+	kc.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		client, err := FirebaseApp.Firestore(ctx)
+		if err != nil {
+			log.Printf("Warning: failed to record API key usage: %v", err)
+			return
+		}
+		defer client.Close()
+
+		_, err = client.Collection("api_keys").Doc(id).Set(ctx, map[string]interface{}{
+			"lastUsedAt": now,
+			"lastUsedIp": ip,
+		}, firestore.MergeAll)
+		if err != nil {
+			log.Printf("Warning: failed to record API key usage: %v", err)
+		}
+	}()
+}
+
+func (kc *apiKeyCache) invalidate(id string) {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+
+	delete(kc.entries, id)
+}
+
+// InvalidateAPIKey makes this instance re-read the key on its next use.
+func InvalidateAPIKey(id string) {
+	apiKeys.invalidate(id)
+}
+
+// apiKeyFromRequest returns the API key sent in X-API-Key or as a bearer
+// token carrying the API key prefix.
+func apiKeyFromRequest(c *gin.Context) string {
+	if key := c.GetHeader(APIKeyHeader); key != "" {
+		return key
+	}
+	if bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok && strings.HasPrefix(bearer, APIKeyPrefix) {
+		return bearer
+	}
+	return ""
+}
+
+// authenticateAPIKey sets a synthetic token for the key so handlers and
+// audit logging treat machine clients like users identified as apikey:{id}.
+func authenticateAPIKey(c *gin.Context, rawKey string) {
+	key, err := apiKeys.get(c.Request.Context(), HashAPIKey(rawKey))
+	if err == errAPIKeyNotFound {
+		apperrors.Abort(c, apperrors.Unauthorized("Invalid API key"))
+		return
+	}
+	if err != nil {
+		log.Printf("API key lookup failed: %v", err)
+		apperrors.Abort(c, apperrors.Unavailable(err, "Unable to verify API key"))
+		return
+	}
+
+	if key.Status != "active" || time.Now().After(key.ExpiresAt) {
+		apperrors.Abort(c, apperrors.Unauthorized("API key has been revoked or has expired"))
+		return
+	}
+
+	apiKeys.touch(key.ID, c.ClientIP())
+
+	c.Set("user", &auth.Token{
+		UID: "apikey:" + key.ID,
+		Claims: map[string]interface{}{
+			"role":     APIKeyRole,
+			"apiKeyId": key.ID,
+			"name":     key.Name,
+		},
+	})
+	c.Set("apiKey", key)
+	c.Next()
+}
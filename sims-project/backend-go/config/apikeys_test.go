@@ -0,0 +1,146 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sims-backend-go/apperrors"
+	"sims-backend-go/models"
+	"testing"
+	"time"
+
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+)
+
+func TestIsAPIKeyPermission(t *testing.T) {
+	tests := []struct {
+		permission string
+		want       bool
+	}{
+		{PermPaymentsRead, true},
+		{PermPaymentsWrite, true},
+		{PermAttendanceWrite, true},
+		{PermUsersRead, true},
+		{PermAPIKeysWrite, false},
+		{PermPermissionsWrite, false},
+		{PermUsersWrite, false},
+		{PermUsersMFAReset, false},
+		{PermInvitationsWrite, false},
+		{PermSessionsRevoke, false},
+		{"payments:everything", false},
+	}
+	for _, tt := range tests {
+		if got := IsAPIKeyPermission(tt.permission); got != tt.want {
+			t.Errorf("IsAPIKeyPermission(%s) = %v, want %v", tt.permission, got, tt.want)
+		}
+	}
+}
+
+func TestPrincipalPermissionsAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/api/payments", nil)
+	c.Set("apiKey", models.APIKey{
+		ID: "key1",
+		// Keys stored before a scope was forbidden lose it
+		Permissions: []string{PermPaymentsWrite, PermUsersWrite, PermAttendanceRead, "unknown:scope", PermAPIKeysWrite},
+	})
+	token := &auth.Token{UID: "apikey:key1", Claims: map[string]interface{}{"role": APIKeyRole}}
+
+	permissions, err := PrincipalPermissions(c, token)
+	if err != nil {
+		t.Fatalf("PrincipalPermissions: %v", err)
+	}
+	if want := []string{PermAttendanceRead, PermPaymentsWrite}; !reflect.DeepEqual(permissions, want) {
+		t.Errorf("PrincipalPermissions = %v, want %v", permissions, want)
+	}
+}
+
+func TestAPIKeyFromRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   string
+	}{
+		{"header", APIKeyHeader, "sims_abc", "sims_abc"},
+		{"bearer with prefix", "Authorization", "Bearer sims_abc", "sims_abc"},
+		{"ID token", "Authorization", "Bearer eyJhbGciOi", ""},
+		{"basic auth", "Authorization", "Basic sims_abc", ""},
+		{"none", "", "", ""},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/api/payments", nil)
+		if tt.header != "" {
+			c.Request.Header.Set(tt.header, tt.value)
+		}
+		if got := apiKeyFromRequest(c); got != tt.want {
+			t.Errorf("%s: apiKeyFromRequest = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHashAPIKeyTrimsSpace(t *testing.T) {
+	if HashAPIKey(" sims_abc\n") != HashAPIKey("sims_abc") {
+		t.Error("surrounding whitespace changes the key hash")
+	}
+	if HashAPIKey("sims_abc") == HashAPIKey("sims_abd") {
+		t.Error("different keys share a hash")
+	}
+}
+
+// cacheAPIKey stores key as if it had just been read and used, so
+// authenticateAPIKey neither reads nor writes Firestore.
+func cacheAPIKey(t *testing.T, rawKey string, key models.APIKey) {
+	t.Helper()
+	now := time.Now()
+	apiKeys.mu.Lock()
+	apiKeys.entries[HashAPIKey(rawKey)] = &apiKeyEntry{key: key, fetchedAt: now, touchedAt: now}
+	apiKeys.mu.Unlock()
+	t.Cleanup(func() { InvalidateAPIKey(HashAPIKey(rawKey)) })
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	storeRolePermissions(t, map[string][]string{})
+	future := time.Now().Add(time.Hour)
+	cacheAPIKey(t, "sims_active", models.APIKey{ID: "active", Status: "active", ExpiresAt: future,
+		Permissions: []string{PermPaymentsRead, PermUsersWrite}})
+	cacheAPIKey(t, "sims_revoked", models.APIKey{ID: "revoked", Status: "revoked", ExpiresAt: future,
+		Permissions: []string{PermPaymentsRead}})
+	cacheAPIKey(t, "sims_expired", models.APIKey{ID: "expired", Status: "active", ExpiresAt: time.Now().Add(-time.Minute),
+		Permissions: []string{PermPaymentsRead}})
+
+	router := gin.New()
+	router.Use(apperrors.Handler())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/api/payments", AuthMiddleware(), RequirePermission(PermPaymentsRead), ok)
+	router.POST("/api/payments", AuthMiddleware(), RequirePermission(PermPaymentsWrite), ok)
+	router.POST("/api/users", AuthMiddleware(), RequirePermission(PermUsersWrite), ok)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		key    string
+		want   int
+	}{
+		{"granted scope", "GET", "/api/payments", "sims_active", http.StatusOK},
+		{"missing scope", "POST", "/api/payments", "sims_active", http.StatusForbidden},
+		{"scope forbidden to keys", "POST", "/api/users", "sims_active", http.StatusForbidden},
+		{"revoked key", "GET", "/api/payments", "sims_revoked", http.StatusUnauthorized},
+		{"expired key", "GET", "/api/payments", "sims_expired", http.StatusUnauthorized},
+		{"unknown key", "GET", "/api/payments", "sims_unknown", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tt.method, tt.target, nil)
+		req.Header.Set(APIKeyHeader, tt.key)
+		router.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
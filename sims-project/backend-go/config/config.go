@@ -0,0 +1,487 @@
+package config
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sims-backend-go/models"
+	"sims-backend-go/services"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultConfigFile = "config.yaml"
+
+type FirebaseConfig struct {
+	Enabled           bool   `yaml:"enabled" json:"enabled"`
+	ProjectID         string `yaml:"projectId" json:"projectId"`
+	CredentialsFile   string `yaml:"credentialsFile" json:"credentialsFile"`
+	CredentialsBase64 string `yaml:"credentialsBase64" json:"credentialsBase64"`
+	// WebAPIKey is used for password sign-in through the Auth REST API
+	WebAPIKey string `yaml:"webApiKey" json:"webApiKey"`
+}
+
+type MailConfig struct {
+	Driver    string `yaml:"driver" json:"driver"` // log, file, smtp
+	From      string `yaml:"from" json:"from"`
+	OutputDir string `yaml:"outputDir" json:"outputDir"`
+	// ActionURL is where Firebase action links continue to (the frontend)
+	ActionURL    string `yaml:"actionUrl" json:"actionUrl"`
+	SMTPHost     string `yaml:"smtpHost" json:"smtpHost"`
+	SMTPPort     int    `yaml:"smtpPort" json:"smtpPort"`
+	SMTPUsername string `yaml:"smtpUsername" json:"smtpUsername"`
+	SMTPPassword string `yaml:"smtpPassword" json:"smtpPassword"`
+}
+
+// SchoolConfig is printed in the header of generated documents such as
+// payment receipts.
+type SchoolConfig struct {
+	Name    string `yaml:"name" json:"name"`
+	Address string `yaml:"address" json:"address"`
+	Phone   string `yaml:"phone" json:"phone"`
+}
+
+// NewMailer builds the sender selected by Driver.
+func (mc MailConfig) NewMailer() services.Mailer {
+	switch mc.Driver {
+	case "smtp":
+		return &services.SMTPMailer{
+			Host:     mc.SMTPHost,
+			Port:     mc.SMTPPort,
+			Username: mc.SMTPUsername,
+			Password: mc.SMTPPassword,
+			From:     mc.From,
+		}
+	case "file":
+		return &services.LogMailer{Dir: mc.OutputDir, From: mc.From}
+	default:
+		return &services.LogMailer{From: mc.From}
+	}
+}
+
+type Config struct {
+	Port           string                  `yaml:"port" json:"port"`
+	GinMode        string                  `yaml:"ginMode" json:"ginMode"`
+	Environment    string                  `yaml:"environment" json:"environment"` // development, staging, production, test
+	Firebase       FirebaseConfig          `yaml:"firebase" json:"firebase"`
+	CORS           CORSConfig              `yaml:"cors" json:"cors"`
+	RateLimit      RateLimitConfig         `yaml:"rateLimit" json:"rateLimit"`
+	PasswordPolicy services.PasswordPolicy `yaml:"passwordPolicy" json:"passwordPolicy"`
+	Mail           MailConfig              `yaml:"mail" json:"mail"`
+	School         SchoolConfig            `yaml:"school" json:"school"`
+	// SessionCacheSeconds bounds how long a revocation made on another
+	// instance can go unnoticed by this one.
+	SessionCacheSeconds int `yaml:"sessionCacheSeconds" json:"sessionCacheSeconds"`
+	// PermissionCacheSeconds bounds how long a role permission change made
+	// on another instance can go unnoticed by this one.
+	PermissionCacheSeconds int `yaml:"permissionCacheSeconds" json:"permissionCacheSeconds"`
+	// TrustedProxies lists proxy IPs/CIDRs allowed to set X-Forwarded-For.
+	// Empty means the connection address is used as the client IP.
+	TrustedProxies []string      `yaml:"trustedProxies" json:"trustedProxies"`
+	MFA            MFAConfig     `yaml:"mfa" json:"mfa"`
+	Gateway        GatewayConfig `yaml:"gateway" json:"gateway"`
+	// DefaultCurrency applies to payments and fee schedules created
+	// without a currency.
+	DefaultCurrency string `yaml:"defaultCurrency" json:"defaultCurrency"`
+}
+
+// AppConfig is the configuration loaded at startup.
+var AppConfig = defaultConfig()
+
+func defaultConfig() *Config {
+	return &Config{
+		Port:        "8080",
+		GinMode:     "release",
+		Environment: "production",
+		Firebase: FirebaseConfig{
+			Enabled:         true,
+			CredentialsFile: "firebase-service-account.json",
+		},
+		CORS: CORSConfig{
+			AllowCredentials: true,
+			MaxAgeSeconds:    43200,
+		},
+		PasswordPolicy:         services.DefaultPasswordPolicy,
+		SessionCacheSeconds:    30,
+		PermissionCacheSeconds: 60,
+		DefaultCurrency:        "IDR",
+		School: SchoolConfig{
+			Name: "SIMS",
+		},
+		Mail: MailConfig{
+			Driver:    "log",
+			From:      "SIMS <no-reply@localhost>",
+			OutputDir: "tmp/mail",
+			SMTPPort:  587,
+		},
+		Gateway: GatewayConfig{
+			ChargeExpiryHours: 24,
+		},
+		MFA: MFAConfig{
+			Issuer:        "SIMS",
+			StepUpMinutes: 10,
+			RequiredRoles: []string{"admin", "treasurer"},
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:                  true,
+			IPRequestsPerMinute:      20,
+			IPBurst:                  10,
+			AccountRequestsPerMinute: 5,
+			AccountBurst:             5,
+			LockoutThreshold:         5,
+			LockoutMinutes:           15,
+		},
+	}
+}
+
+// LoadConfig builds the configuration from defaults, an optional YAML file
+// and environment variables, in increasing order of precedence.
+func LoadConfig() (*Config, error) {
+	cfg := defaultConfig()
+
+	path := os.Getenv("CONFIG_FILE")
+	required := path != ""
+	if path == "" {
+		path = defaultConfigFile
+	}
+	if err := cfg.loadFile(path, required); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	if len(cfg.CORS.AllowedOrigins) == 0 {
+		cfg.CORS.AllowedOrigins = defaultCORSOrigins(cfg.Environment)
+		if len(cfg.CORS.AllowedOrigins) == 0 {
+			log.Printf("Warning: no CORS origins configured for %s, browser requests will be rejected", cfg.Environment)
+		}
+	}
+
+	if cfg.Firebase.Enabled && cfg.Firebase.WebAPIKey == "" {
+		log.Println("Warning: FIREBASE_WEB_API_KEY is not set, password verification will be unavailable")
+	}
+
+	if cfg.MFA.EncryptionKey == "" && (cfg.Environment == "development" || cfg.Environment == "test") {
+		cfg.MFA.EncryptionKey = ephemeralMFAKey()
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func (cfg *Config) loadFile(path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !required {
+			return nil
+		}
+		return fmt.Errorf("reading config file %s: %w", path, err)
+	}
+
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func (cfg *Config) loadEnv() error {
+	if v := os.Getenv("PORT"); v != "" {
+		cfg.Port = v
+	}
+	if v := os.Getenv("GIN_MODE"); v != "" {
+		cfg.GinMode = v
+	}
+	if v := os.Getenv("NODE_ENV"); v != "" {
+		cfg.Environment = v
+		// Development runs without Firebase unless explicitly enabled
+		if v == "development" {
+			cfg.Firebase.Enabled = false
+		}
+	}
+
+	if v := os.Getenv("USE_FIREBASE"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("USE_FIREBASE: invalid boolean %q", v)
+		}
+		cfg.Firebase.Enabled = enabled
+	}
+
+	if v := os.Getenv("FIREBASE_PROJECT_ID"); v != "" {
+		cfg.Firebase.ProjectID = v
+	}
+	if v := os.Getenv("FIREBASE_CREDENTIALS_FILE"); v != "" {
+		cfg.Firebase.CredentialsFile = v
+	}
+	if v := os.Getenv("FIREBASE_CREDENTIALS_BASE64"); v != "" {
+		cfg.Firebase.CredentialsBase64 = v
+	}
+	if v := os.Getenv("FIREBASE_WEB_API_KEY"); v != "" {
+		cfg.Firebase.WebAPIKey = v
+	}
+
+	// CORS_ORIGIN is the legacy name shared with the Node backend
+	if v := os.Getenv("ALLOWED_ORIGINS"); v != "" {
+		cfg.CORS.AllowedOrigins = splitList(v)
+	} else if v := os.Getenv("CORS_ORIGIN"); v != "" {
+		cfg.CORS.AllowedOrigins = splitList(v)
+	}
+	if v := os.Getenv("CORS_ALLOW_CREDENTIALS"); v != "" {
+		allow, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("CORS_ALLOW_CREDENTIALS: invalid boolean %q", v)
+		}
+		cfg.CORS.AllowCredentials = allow
+	}
+
+	if v := os.Getenv("RATE_LIMIT_ENABLED"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("RATE_LIMIT_ENABLED: invalid boolean %q", v)
+		}
+		cfg.RateLimit.Enabled = enabled
+	}
+	if v := os.Getenv("SESSION_CACHE_SECONDS"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("SESSION_CACHE_SECONDS: invalid number %q", v)
+		}
+		cfg.SessionCacheSeconds = seconds
+	}
+	if v := os.Getenv("PERMISSION_CACHE_SECONDS"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("PERMISSION_CACHE_SECONDS: invalid number %q", v)
+		}
+		cfg.PermissionCacheSeconds = seconds
+	}
+	if v := os.Getenv("DEFAULT_CURRENCY"); v != "" {
+		cfg.DefaultCurrency = v
+	}
+	if v := os.Getenv("SCHOOL_NAME"); v != "" {
+		cfg.School.Name = v
+	}
+	if v := os.Getenv("SCHOOL_ADDRESS"); v != "" {
+		cfg.School.Address = v
+	}
+	if v := os.Getenv("SCHOOL_PHONE"); v != "" {
+		cfg.School.Phone = v
+	}
+	if v := os.Getenv("MAIL_DRIVER"); v != "" {
+		cfg.Mail.Driver = v
+	}
+	if v := os.Getenv("MAIL_FROM"); v != "" {
+		cfg.Mail.From = v
+	}
+	if v := os.Getenv("MAIL_OUTPUT_DIR"); v != "" {
+		cfg.Mail.OutputDir = v
+	}
+	if v := os.Getenv("MAIL_ACTION_URL"); v != "" {
+		cfg.Mail.ActionURL = v
+	}
+	if v := os.Getenv("SMTP_HOST"); v != "" {
+		cfg.Mail.SMTPHost = v
+	}
+	if v := os.Getenv("SMTP_PORT"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("SMTP_PORT: invalid number %q", v)
+		}
+		cfg.Mail.SMTPPort = port
+	}
+	if v := os.Getenv("SMTP_USERNAME"); v != "" {
+		cfg.Mail.SMTPUsername = v
+	}
+	if v := os.Getenv("SMTP_PASSWORD"); v != "" {
+		cfg.Mail.SMTPPassword = v
+	}
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		cfg.TrustedProxies = splitList(v)
+	}
+	if v := os.Getenv("PAYMENT_GATEWAY"); v != "" {
+		cfg.Gateway.Driver = v
+	}
+	if v := os.Getenv("GATEWAY_WEBHOOK_SECRET"); v != "" {
+		cfg.Gateway.WebhookSecret = v
+	}
+	if v := os.Getenv("MIDTRANS_SERVER_KEY"); v != "" {
+		cfg.Gateway.MidtransServerKey = v
+	}
+	if v := os.Getenv("MIDTRANS_PRODUCTION"); v != "" {
+		production, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("MIDTRANS_PRODUCTION: invalid boolean %q", v)
+		}
+		cfg.Gateway.MidtransProduction = production
+	}
+	if v := os.Getenv("GATEWAY_CHARGE_EXPIRY_HOURS"); v != "" {
+		hours, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("GATEWAY_CHARGE_EXPIRY_HOURS: invalid number %q", v)
+		}
+		cfg.Gateway.ChargeExpiryHours = hours
+	}
+	if v := os.Getenv("MFA_ENCRYPTION_KEY"); v != "" {
+		cfg.MFA.EncryptionKey = v
+	}
+	if v := os.Getenv("MFA_STEP_UP_MINUTES"); v != "" {
+		minutes, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("MFA_STEP_UP_MINUTES: invalid number %q", v)
+		}
+		cfg.MFA.StepUpMinutes = minutes
+	}
+
+	return nil
+}
+
+// Validate reports every configuration problem at once so operators can fix
+// them in a single pass.
+func (cfg *Config) Validate() error {
+	var errs []error
+
+	if port, err := strconv.Atoi(cfg.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("port: %q is not a valid TCP port", cfg.Port))
+	}
+
+	switch cfg.GinMode {
+	case "debug", "release", "test":
+	default:
+		errs = append(errs, fmt.Errorf("ginMode: must be one of debug, release, test (got %q)", cfg.GinMode))
+	}
+
+	switch cfg.Environment {
+	case "development", "staging", "production", "test":
+	default:
+		errs = append(errs, fmt.Errorf("environment: must be one of development, staging, production, test (got %q)", cfg.Environment))
+	}
+
+	// Base64 credentials take precedence over the file path
+	if cfg.Firebase.Enabled {
+		switch {
+		case cfg.Firebase.CredentialsBase64 != "":
+			if _, err := cfg.Firebase.credentialsJSON(); err != nil {
+				errs = append(errs, fmt.Errorf("firebase.credentialsBase64: %w", err))
+			}
+		case cfg.Firebase.CredentialsFile != "":
+			if _, err := os.Stat(cfg.Firebase.CredentialsFile); err != nil {
+				errs = append(errs, fmt.Errorf("firebase.credentialsFile: %w", err))
+			}
+		default:
+			errs = append(errs, errors.New("firebase: credentialsFile or credentialsBase64 is required when Firebase is enabled"))
+		}
+	}
+
+	for _, origin := range cfg.CORS.AllowedOrigins {
+		if err := validateOriginPattern(origin); err != nil {
+			errs = append(errs, fmt.Errorf("cors.allowedOrigins: %w", err))
+		}
+		if origin == "*" && cfg.CORS.AllowCredentials {
+			errs = append(errs, errors.New("cors: \"*\" cannot be combined with allowCredentials, list the origins explicitly"))
+		}
+	}
+
+	if rl := cfg.RateLimit; rl.Enabled {
+		if rl.IPRequestsPerMinute <= 0 || rl.IPBurst <= 0 ||
+			rl.AccountRequestsPerMinute <= 0 || rl.AccountBurst <= 0 {
+			errs = append(errs, errors.New("rateLimit: request rates and bursts must be positive"))
+		}
+		if rl.LockoutThreshold <= 0 || rl.LockoutMinutes <= 0 {
+			errs = append(errs, errors.New("rateLimit: lockoutThreshold and lockoutMinutes must be positive"))
+		}
+	}
+
+	switch cfg.Mail.Driver {
+	case "log", "file":
+		// Both would leave password reset links readable by anyone with
+		// access to the server instead of mailing them
+		if cfg.Environment == "production" {
+			errs = append(errs, fmt.Errorf("mail.driver: %s is not allowed in production; set MAIL_DRIVER=smtp with SMTP_HOST and MAIL_FROM, or NODE_ENV=development to run locally", cfg.Mail.Driver))
+		}
+		if cfg.Mail.Driver == "file" && cfg.Mail.OutputDir == "" {
+			errs = append(errs, errors.New("mail.outputDir: required for the file driver"))
+		}
+	case "smtp":
+		if cfg.Mail.SMTPHost == "" || cfg.Mail.SMTPPort <= 0 {
+			errs = append(errs, errors.New("mail: smtpHost and smtpPort are required for the smtp driver"))
+		}
+		if cfg.Mail.From == "" {
+			errs = append(errs, errors.New("mail.from: required for the smtp driver"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("mail.driver: must be one of log, file, smtp (got %q)", cfg.Mail.Driver))
+	}
+
+	if cfg.SessionCacheSeconds < 0 {
+		errs = append(errs, errors.New("sessionCacheSeconds: must not be negative"))
+	}
+	if cfg.PermissionCacheSeconds < 0 {
+		errs = append(errs, errors.New("permissionCacheSeconds: must not be negative"))
+	}
+
+	if !models.IsValidCurrency(cfg.DefaultCurrency) {
+		errs = append(errs, fmt.Errorf("defaultCurrency: unsupported currency %q", cfg.DefaultCurrency))
+	}
+
+	if cfg.PasswordPolicy.MinLength < 6 {
+		errs = append(errs, errors.New("passwordPolicy.minLength: must be at least 6 (Firebase minimum)"))
+	}
+
+	errs = append(errs, cfg.MFA.validate()...)
+	errs = append(errs, cfg.Gateway.validate(cfg.Environment)...)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// credentialsJSON decodes the base64 service account and checks it is JSON.
+func (fc FirebaseConfig) credentialsJSON() ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(fc.CredentialsBase64))
+	if err != nil {
+		return nil, fmt.Errorf("not valid base64: %w", err)
+	}
+	if !json.Valid(data) {
+		return nil, errors.New("decoded value is not valid JSON")
+	}
+	return data, nil
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "[REDACTED]"
+}
+
+// Redacted returns a copy of the configuration that is safe to log.
+func (cfg *Config) Redacted() Config {
+	out := *cfg
+	out.Firebase.CredentialsBase64 = redact(cfg.Firebase.CredentialsBase64)
+	out.Firebase.WebAPIKey = redact(cfg.Firebase.WebAPIKey)
+	out.Mail.SMTPPassword = redact(cfg.Mail.SMTPPassword)
+	out.MFA.EncryptionKey = redact(cfg.MFA.EncryptionKey)
+	out.Gateway.WebhookSecret = redact(cfg.Gateway.WebhookSecret)
+	out.Gateway.MidtransServerKey = redact(cfg.Gateway.MidtransServerKey)
+	return out
+}
+
+func (cfg *Config) String() string {
+	data, err := json.MarshalIndent(cfg.Redacted(), "", "  ")
+	if err != nil {
+		return fmt.Sprintf("<config: %v>", err)
+	}
+	return string(data)
+}
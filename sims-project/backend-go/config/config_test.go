@@ -0,0 +1,157 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mailErrors returns the mail settings Validate complains about.
+func mailErrors(cfg *Config) []string {
+	err := cfg.Validate()
+	if err == nil {
+		return nil
+	}
+	var found []string
+	for _, line := range strings.Split(err.Error(), "\n") {
+		if strings.HasPrefix(line, "mail") {
+			found = append(found, line)
+		}
+	}
+	return found
+}
+
+func TestValidateMailDriver(t *testing.T) {
+	tests := []struct {
+		name        string
+		environment string
+		mail        MailConfig
+		valid       bool
+	}{
+		{"log in development", "development", MailConfig{Driver: "log"}, true},
+		{"file in staging", "staging", MailConfig{Driver: "file", OutputDir: "tmp/mail"}, true},
+		{"file without directory", "staging", MailConfig{Driver: "file"}, false},
+		{"log in production", "production", MailConfig{Driver: "log"}, false},
+		{"file in production", "production", MailConfig{Driver: "file", OutputDir: "tmp/mail"}, false},
+		{"smtp in production", "production", MailConfig{Driver: "smtp", SMTPHost: "smtp.example.com", SMTPPort: 587, From: "SIMS <no-reply@example.com>"}, true},
+		{"smtp without host", "production", MailConfig{Driver: "smtp", SMTPPort: 587, From: "SIMS <no-reply@example.com>"}, false},
+		{"smtp without sender", "production", MailConfig{Driver: "smtp", SMTPHost: "smtp.example.com", SMTPPort: 587}, false},
+		{"unknown driver", "development", MailConfig{Driver: "sendmail"}, false},
+	}
+	for _, tt := range tests {
+		cfg := defaultConfig()
+		cfg.Environment = tt.environment
+		cfg.Mail = tt.mail
+		if errs := mailErrors(cfg); (len(errs) == 0) != tt.valid {
+			t.Errorf("%s: mail errors %v, want valid %v", tt.name, errs, tt.valid)
+		}
+	}
+}
+
+func TestDefaultMailDriverNamesSettings(t *testing.T) {
+	errs := mailErrors(defaultConfig())
+	if len(errs) != 1 {
+		t.Fatalf("default configuration mail errors = %v, want one", errs)
+	}
+	for _, setting := range []string{"MAIL_DRIVER=smtp", "SMTP_HOST", "MAIL_FROM", "NODE_ENV=development"} {
+		if !strings.Contains(errs[0], setting) {
+			t.Errorf("error %q does not mention %s", errs[0], setting)
+		}
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := "port: \"9000\"\nginMode: debug\nenvironment: development\nfirebase:\n  enabled: false\ncors:\n  allowedOrigins:\n    - https://sims.example.com\nschool:\n  name: SMA Contoh\n"
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("PORT", "9100")
+	t.Setenv("CORS_ORIGIN", "https://legacy.example.com")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	// Environment variables override the file, the file the defaults
+	if cfg.Port != "9100" || cfg.GinMode != "debug" || cfg.School.Name != "SMA Contoh" || cfg.DefaultCurrency != "IDR" {
+		t.Errorf("cfg = {port %s, ginMode %s, school %s, currency %s}", cfg.Port, cfg.GinMode, cfg.School.Name, cfg.DefaultCurrency)
+	}
+	if len(cfg.CORS.AllowedOrigins) != 1 || cfg.CORS.AllowedOrigins[0] != "https://legacy.example.com" {
+		t.Errorf("allowed origins = %v", cfg.CORS.AllowedOrigins)
+	}
+	// Development gets a throwaway MFA key instead of failing
+	if _, err := cfg.MFA.Key(); err != nil {
+		t.Errorf("development MFA key: %v", err)
+	}
+}
+
+func TestLoadConfigDevelopmentDefaults(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("NODE_ENV", "development")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.Firebase.Enabled {
+		t.Error("development enables Firebase without USE_FIREBASE")
+	}
+	if len(cfg.CORS.AllowedOrigins) == 0 {
+		t.Error("development has no default CORS origins")
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want []string
+	}{
+		{"invalid boolean", map[string]string{"USE_FIREBASE": "maybe"}, []string{"USE_FIREBASE"}},
+		{"invalid number", map[string]string{"SESSION_CACHE_SECONDS": "soon"}, []string{"SESSION_CACHE_SECONDS"}},
+		{"missing file", map[string]string{"CONFIG_FILE": "/nonexistent/config.yaml"}, []string{"/nonexistent/config.yaml"}},
+		{
+			name: "every problem at once",
+			env:  map[string]string{"NODE_ENV": "development", "PORT": "99999", "GIN_MODE": "verbose", "ALLOWED_ORIGINS": "*"},
+			want: []string{"port:", "ginMode:", "allowCredentials"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", "")
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			_, err := LoadConfig()
+			if err == nil {
+				t.Fatal("LoadConfig succeeded")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %s", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigStringRedactsSecrets(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Firebase.WebAPIKey = "web-api-key"
+	cfg.Mail.SMTPPassword = "smtp-password"
+	cfg.MFA.EncryptionKey = "mfa-key"
+	cfg.Gateway.MidtransServerKey = "midtrans-key"
+
+	out := cfg.String()
+	for _, secret := range []string{"web-api-key", "smtp-password", "mfa-key", "midtrans-key"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("String() leaks %s", secret)
+		}
+	}
+	if cfg.Mail.SMTPPassword != "smtp-password" {
+		t.Error("Redacted modified the configuration")
+	}
+}
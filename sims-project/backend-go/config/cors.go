@@ -0,0 +1,186 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/publicsuffix"
+)
+
+type CORSConfig struct {
+	// AllowedOrigins holds exact origins ("https://sims.example.com") or
+	// patterns with a single "*" in a subdomain label
+	// ("https://*.staging.example.com", "https://sims-*-team.vercel.app").
+	AllowedOrigins   []string `yaml:"allowedOrigins" json:"allowedOrigins"`
+	AllowCredentials bool     `yaml:"allowCredentials" json:"allowCredentials"`
+	MaxAgeSeconds    int      `yaml:"maxAgeSeconds" json:"maxAgeSeconds"`
+}
+
+const (
+	corsAllowMethods  = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+	corsAllowHeaders  = "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Accept, Cache-Control, X-Requested-With, X-Step-Up-Token, X-API-Key, X-Request-ID, If-Match"
+	corsExposeHeaders = "Content-Length, X-Request-ID, Retry-After, ETag"
+)
+
+// defaultCORSOrigins are used when no origins are configured. Staging and
+// production must list their frontends.
+func defaultCORSOrigins(environment string) []string {
+	switch environment {
+	case "development", "test":
+		return []string{
+			"http://localhost:5173",
+			"http://localhost:3000",
+			"http://127.0.0.1:5173",
+		}
+	default:
+		return nil
+	}
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func validateOriginPattern(pattern string) error {
+	if pattern == "*" {
+		return nil
+	}
+	if !strings.HasPrefix(pattern, "http://") && !strings.HasPrefix(pattern, "https://") {
+		return fmt.Errorf("%q must start with http:// or https://", pattern)
+	}
+	if strings.Count(pattern, "*") > 1 {
+		return fmt.Errorf("%q may contain at most one wildcard", pattern)
+	}
+	if strings.HasSuffix(pattern, "/") {
+		return fmt.Errorf("%q must not end with a slash", pattern)
+	}
+
+	prefix, suffix, found := strings.Cut(strings.ToLower(pattern), "*")
+	if !found {
+		return nil
+	}
+	_, hostPrefix, _ := strings.Cut(prefix, "://")
+	if strings.ContainsAny(hostPrefix, ":/@") || strings.ContainsAny(suffix, "/@") {
+		return fmt.Errorf("%q must have its wildcard in the host", pattern)
+	}
+
+	// The wildcard matches within one label; the labels after it must form
+	// at least a registrable domain, or anyone registering a name under the
+	// same public suffix (example.*, *.vercel.app) would be allowed
+	host, _, _ := strings.Cut(suffix, ":")
+	labelSuffix, parent, _ := strings.Cut(host, ".")
+	if _, err := publicsuffix.EffectiveTLDPlusOne(parent); parent != "" && err == nil {
+		return nil
+	}
+
+	// Hosting platforms such as vercel.app register their domain as a
+	// private public suffix and name deployments "<project>-<hash>-<team>".
+	// There the wildcard must sit between a literal prefix and suffix, as in
+	// sims-*-team.vercel.app, so it only covers one team's previews
+	labelPrefix := hostPrefix[strings.LastIndex(hostPrefix, ".")+1:]
+	if ps, icann := publicsuffix.PublicSuffix(parent); ps == parent && !icann && strings.Contains(parent, ".") &&
+		labelPrefix != "" && labelSuffix != "" {
+		return nil
+	}
+	return fmt.Errorf("%q must have its wildcard in a subdomain of a registrable domain, or between a literal prefix and suffix on a hosting platform domain such as https://sims-*-team.vercel.app", pattern)
+}
+
+func isHostChar(r rune) bool {
+	return r == '-' || (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9')
+}
+
+// matchOrigin reports whether origin matches an exact origin or a pattern
+// with a single wildcard. The wildcard only spans the characters of one host
+// label so it can never match another domain, scheme or port.
+func matchOrigin(pattern, origin string) bool {
+	origin = strings.ToLower(origin)
+	pattern = strings.ToLower(pattern)
+
+	if pattern == "*" {
+		return true
+	}
+
+	prefix, suffix, found := strings.Cut(pattern, "*")
+	if !found {
+		return origin == pattern
+	}
+
+	if len(origin) <= len(prefix)+len(suffix) ||
+		!strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+		return false
+	}
+
+	middle := origin[len(prefix) : len(origin)-len(suffix)]
+	for _, r := range middle {
+		if !isHostChar(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (cc CORSConfig) originAllowed(origin string) bool {
+	for _, pattern := range cc.AllowedOrigins {
+		if matchOrigin(pattern, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func CORSMiddleware(cc CORSConfig) gin.HandlerFunc {
+	maxAge := strconv.Itoa(cc.MaxAgeSeconds)
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		c.Writer.Header().Add("Vary", "Origin")
+
+		// Same-origin and non-browser requests carry no Origin header
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		preflight := c.Request.Method == http.MethodOptions &&
+			c.GetHeader("Access-Control-Request-Method") != ""
+
+		if !cc.originAllowed(origin) {
+			log.Printf("CORS: rejected origin %q for %s %s", origin, c.Request.Method, c.Request.URL.Path)
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			// Without CORS headers the browser will block the response
+			c.Next()
+			return
+		}
+
+		c.Header("Access-Control-Allow-Origin", origin)
+		if cc.AllowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if preflight {
+			c.Header("Access-Control-Allow-Methods", corsAllowMethods)
+			c.Header("Access-Control-Allow-Headers", corsAllowHeaders)
+			if cc.MaxAgeSeconds > 0 {
+				c.Header("Access-Control-Max-Age", maxAge)
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Header("Access-Control-Expose-Headers", corsExposeHeaders)
+		c.Next()
+	}
+}
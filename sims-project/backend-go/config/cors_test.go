@@ -0,0 +1,151 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidateOriginPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		valid   bool
+	}{
+		{"*", true},
+		{"https://sims.example.com", true},
+		{"http://localhost:5173", true},
+		{"https://*.example.com", true},
+		{"https://*.staging.example.com:8443", true},
+		{"https://app-*.staging.example.com", true},
+		{"https://*.sekolah.sch.id", true},
+		{"https://sims-*-team.vercel.app", true},
+		{"https://sims-git-*-team.vercel.app", true},
+		{"https://preview.sims-*-team.vercel.app", true},
+		{"sims.example.com", false},
+		{"ftp://sims.example.com", false},
+		{"https://sims.example.com/", false},
+		{"https://*.*.example.com", false},
+		{"https://*.vercel.app", false},
+		{"https://sims-*.vercel.app", false},
+		{"https://*-team.vercel.app", false},
+		{"https://sims-*-team.co.id", false},
+		{"https://sims-*-team.com", false},
+		{"http://a-*-b.localhost", false},
+		{"https://*.com", false},
+		{"https://*.co.id", false},
+		{"https://app.example.*", false},
+		{"https://example.*.com", false},
+		{"https://example.com:*", false},
+		{"http://*.localhost", false},
+		{"https://*@example.com", false},
+	}
+	for _, tt := range tests {
+		err := validateOriginPattern(tt.pattern)
+		if (err == nil) != tt.valid {
+			t.Errorf("validateOriginPattern(%q) = %v, want valid %v", tt.pattern, err, tt.valid)
+		}
+	}
+}
+
+func TestMatchOrigin(t *testing.T) {
+	tests := []struct {
+		pattern string
+		origin  string
+		want    bool
+	}{
+		{"*", "https://anything.example.org", true},
+		{"https://sims.example.com", "https://sims.example.com", true},
+		{"https://sims.example.com", "https://SIMS.example.com", true},
+		{"https://sims.example.com", "http://sims.example.com", false},
+		{"https://sims.example.com", "https://sims.example.com:8443", false},
+		{"https://*.example.com", "https://app.example.com", true},
+		{"https://*.example.com", "https://a-1.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://x.evil.example.com", false},
+		{"https://*.example.com", "https://evil.com/.example.com", false},
+		{"https://*.example.com", "https://evil.com#.example.com", false},
+		{"https://*.example.com", "https://app.example.com:8443", false},
+		{"https://*.example.com", "http://app.example.com", false},
+		{"https://app-*.example.com", "https://app-pr-12.example.com", true},
+		{"https://app-*.example.com", "https://app-x.evil.example.com", false},
+		{"https://app-*.example.com", "https://api-1.example.com", false},
+		{"https://sims-*-team.vercel.app", "https://sims-k3j2h1-team.vercel.app", true},
+		{"https://sims-*-team.vercel.app", "https://sims-git-main-team.vercel.app", true},
+		{"https://sims-*-team.vercel.app", "https://sims-x.evil-team.vercel.app", false},
+		{"https://sims-*-team.vercel.app", "https://sims-x-evil.vercel.app", false},
+		{"https://sims-*-team.vercel.app", "https://evil-x-team.vercel.app", false},
+	}
+	for _, tt := range tests {
+		if got := matchOrigin(tt.pattern, tt.origin); got != tt.want {
+			t.Errorf("matchOrigin(%q, %q) = %v, want %v", tt.pattern, tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultCORSOrigins(t *testing.T) {
+	if origins := defaultCORSOrigins("development"); len(origins) == 0 {
+		t.Error("development should default to localhost origins")
+	}
+	for _, environment := range []string{"staging", "production"} {
+		if origins := defaultCORSOrigins(environment); len(origins) != 0 {
+			t.Errorf("%s should have no default origins, got %v", environment, origins)
+		}
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(CORSMiddleware(CORSConfig{
+		AllowedOrigins:   []string{"https://sims.example.com"},
+		AllowCredentials: true,
+		MaxAgeSeconds:    600,
+	}))
+	r.GET("/api/ping", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name        string
+		method      string
+		origin      string
+		preflight   bool
+		wantStatus  int
+		wantAllowed bool
+	}{
+		{"allowed request", http.MethodGet, "https://sims.example.com", false, http.StatusOK, true},
+		{"rejected request", http.MethodGet, "https://evil.example.com", false, http.StatusOK, false},
+		{"no origin", http.MethodGet, "", false, http.StatusOK, false},
+		{"allowed preflight", http.MethodOptions, "https://sims.example.com", true, http.StatusNoContent, true},
+		{"rejected preflight", http.MethodOptions, "https://evil.example.com", true, http.StatusForbidden, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/ping", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			allowOrigin := w.Header().Get("Access-Control-Allow-Origin")
+			if tt.wantAllowed && allowOrigin != tt.origin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", allowOrigin, tt.origin)
+			}
+			if !tt.wantAllowed && allowOrigin != "" {
+				t.Errorf("Access-Control-Allow-Origin = %q, want none", allowOrigin)
+			}
+			if tt.wantAllowed && w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+				t.Error("Access-Control-Allow-Credentials missing")
+			}
+		})
+	}
+}
@@ -2,13 +2,14 @@ package config
 
 import (
 	"context"
+	"fmt"
 	"log"
-	"os"
+	"sims-backend-go/apperrors"
 
 	firebase "firebase.google.com/go"
 	"firebase.google.com/go/auth"
-	"google.golang.org/api/option"
 	"github.com/gin-gonic/gin"
+	"google.golang.org/api/option"
 )
 
 var (
@@ -16,56 +17,61 @@ var (
 	AuthClient  *auth.Client
 )
 
-func InitializeFirebase() {
+func InitializeFirebase(cfg *Config) error {
 	ctx := context.Background()
 
 	// Check if we should use Firebase
-	if os.Getenv("NODE_ENV") == "development" && os.Getenv("USE_FIREBASE") != "true" {
+	if !cfg.Firebase.Enabled {
 		log.Println("Running in development mode without Firebase authentication")
-		return
+		return nil
 	}
 
 	// Initialize Firebase
-	opt := option.WithCredentialsFile("firebase-service-account.json")
-	app, err := firebase.NewApp(ctx, nil, opt)
+	var opt option.ClientOption
+	if cfg.Firebase.CredentialsBase64 != "" {
+		credentials, err := cfg.Firebase.credentialsJSON()
+		if err != nil {
+			return fmt.Errorf("decoding firebase credentials: %w", err)
+		}
+		opt = option.WithCredentialsJSON(credentials)
+	} else {
+		opt = option.WithCredentialsFile(cfg.Firebase.CredentialsFile)
+	}
+
+	var firebaseConfig *firebase.Config
+	if cfg.Firebase.ProjectID != "" {
+		firebaseConfig = &firebase.Config{ProjectID: cfg.Firebase.ProjectID}
+	}
+
+	app, err := firebase.NewApp(ctx, firebaseConfig, opt)
 	if err != nil {
-		log.Fatalf("error initializing app: %v", err)
+		return fmt.Errorf("error initializing app: %w", err)
 	}
 
 	// Initialize Auth client
 	authClient, err := app.Auth(ctx)
 	if err != nil {
-		log.Fatalf("error initializing auth client: %v", err)
+		return fmt.Errorf("error initializing auth client: %w", err)
 	}
 
 	FirebaseApp = app
 	AuthClient = authClient
 
 	log.Println("Firebase Admin SDK initialized successfully")
+	return nil
 }
 
-func CORSMiddleware() gin.HandlerFunc {
+func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", os.Getenv("CORS_ORIGIN"))
-		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
+		// Machine clients authenticate with an API key instead
+		if apiKey := apiKeyFromRequest(c); apiKey != "" {
+			authenticateAPIKey(c, apiKey)
 			return
 		}
 
-		c.Next()
-	}
-}
-
-func AuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(401, gin.H{"error": "Access token required"})
-			c.Abort()
+			apperrors.Abort(c, apperrors.Unauthorized("Access token required"))
 			return
 		}
 
@@ -74,64 +80,30 @@ func AuthMiddleware() gin.HandlerFunc {
 		if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
 			tokenString = authHeader[7:]
 		} else {
-			c.JSON(401, gin.H{"error": "Invalid token format"})
-			c.Abort()
+			apperrors.Abort(c, apperrors.Unauthorized("Invalid token format"))
 			return
 		}
 
 		// Verify token
-		token, err := AuthClient.VerifyIDToken(context.Background(), tokenString)
+		token, err := AuthClient.VerifyIDToken(c.Request.Context(), tokenString)
 		if err != nil {
-			c.JSON(403, gin.H{"error": "Invalid or expired token"})
-			c.Abort()
+			apperrors.Abort(c, apperrors.Forbidden("Invalid or expired token"))
 			return
 		}
 
-		// Store user info in context
-		c.Set("user", token)
-		c.Next()
-	}
-}
-
-func RoleMiddleware(allowedRoles ...string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		user, exists := c.Get("user")
-		if !exists {
-			c.JSON(401, gin.H{"error": "User not authenticated"})
-			c.Abort()
-			return
-		}
-
-		token := user.(*auth.Token)
-		role := token.Claims["role"]
-
-		if role == nil {
-			// Default role for backward compatibility
-			role = "student"
-		}
-
-		roleStr, ok := role.(string)
-		if !ok {
-			c.JSON(403, gin.H{"error": "Invalid role format"})
-			c.Abort()
+		// Reject tokens of signed-out or disabled users
+		revoked, err := tokenRevoked(c.Request.Context(), token)
+		if err != nil {
+			apperrors.Abort(c, apperrors.Unavailable(err, "Unable to verify session"))
 			return
 		}
-
-		// Check if user role is allowed
-		allowed := false
-		for _, allowedRole := range allowedRoles {
-			if roleStr == allowedRole {
-				allowed = true
-				break
-			}
-		}
-
-		if !allowed {
-			c.JSON(403, gin.H{"error": "Insufficient permissions"})
-			c.Abort()
+		if revoked {
+			apperrors.Abort(c, apperrors.Unauthorized("Session has been revoked, please sign in again"))
 			return
 		}
 
+		// Store user info in context
+		c.Set("user", token)
 		c.Next()
 	}
 }
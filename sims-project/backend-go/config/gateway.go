@@ -0,0 +1,58 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sims-backend-go/services"
+)
+
+type GatewayConfig struct {
+	// Driver selects the online payment provider: "" (disabled), fake,
+	// midtrans.
+	Driver string `yaml:"driver" json:"driver"`
+	// WebhookSecret signs notifications of the fake driver.
+	WebhookSecret     string `yaml:"webhookSecret" json:"webhookSecret"`
+	MidtransServerKey string `yaml:"midtransServerKey" json:"midtransServerKey"`
+	// MidtransProduction switches from the sandbox to the live API.
+	MidtransProduction bool `yaml:"midtransProduction" json:"midtransProduction"`
+	// ChargeExpiryHours is how long payment links and virtual accounts
+	// stay payable when the request does not say.
+	ChargeExpiryHours int `yaml:"chargeExpiryHours" json:"chargeExpiryHours"`
+}
+
+// NewGateway builds the provider selected by Driver, or nil when online
+// payments are disabled.
+func (gc GatewayConfig) NewGateway() services.PaymentGateway {
+	switch gc.Driver {
+	case "fake":
+		return &services.FakeGateway{Secret: gc.WebhookSecret}
+	case "midtrans":
+		return services.NewMidtransGateway(gc.MidtransServerKey, gc.MidtransProduction)
+	default:
+		return nil
+	}
+}
+
+func (gc GatewayConfig) validate(environment string) []error {
+	var errs []error
+	switch gc.Driver {
+	case "":
+	case "fake":
+		if environment == "production" {
+			errs = append(errs, errors.New("gateway.driver: fake is not allowed in production"))
+		}
+		if gc.WebhookSecret == "" {
+			errs = append(errs, errors.New("gateway.webhookSecret: required for the fake driver"))
+		}
+	case "midtrans":
+		if gc.MidtransServerKey == "" {
+			errs = append(errs, errors.New("gateway.midtransServerKey: required for the midtrans driver"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("gateway.driver: must be empty or one of fake, midtrans (got %q)", gc.Driver))
+	}
+	if gc.ChargeExpiryHours <= 0 {
+		errs = append(errs, errors.New("gateway.chargeExpiryHours: must be positive"))
+	}
+	return errs
+}
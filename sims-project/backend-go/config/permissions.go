@@ -0,0 +1,324 @@
+package config
+
+import (
+	"context"
+	"log"
+	"sims-backend-go/apperrors"
+	"sims-backend-go/models"
+	"sort"
+	"sync"
+	"time"
+
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	PermUsersRead         = "users:read"
+	PermUsersWrite        = "users:write"
+	PermUsersMFAReset     = "users:mfa_reset"
+	PermInvitationsWrite  = "invitations:write"
+	PermSessionsRevoke    = "sessions:revoke"
+	PermAuditRead         = "audit:read"
+	PermHealthDetailed    = "health:detailed"
+	PermPermissionsWrite  = "permissions:write"
+	PermAPIKeysWrite      = "api_keys:write"
+	PermClassesRead       = "classes:read"
+	PermClassesWrite      = "classes:write"
+	PermAttendanceRead    = "attendance:read"
+	PermAttendanceWrite   = "attendance:write"
+	PermGradesRead        = "grades:read"
+	PermGradesWrite       = "grades:write"
+	PermPaymentsRead      = "payments:read"
+	PermPaymentsWrite     = "payments:write"
+	PermPaymentsReconcile = "payments:reconcile"
+	PermFeesRead          = "fees:read"
+	PermFeesWrite         = "fees:write"
+	PermWaiversRequest    = "waivers:request"
+	PermWaiversApprove    = "waivers:approve"
+	PermLateFeesWaive     = "late_fees:waive"
+	PermRefundsRequest    = "refunds:request"
+	PermRefundsApprove    = "refunds:approve"
+)
+
+// Permissions is the registry of every permission checked by the API.
+var Permissions = map[string]string{
+	PermUsersRead:         "List and view user accounts",
+	PermUsersWrite:        "Create, update and delete user accounts",
+	PermUsersMFAReset:     "Reset another user's two-factor enrollment",
+	PermInvitationsWrite:  "Create, list and revoke signup invitations",
+	PermSessionsRevoke:    "Force logout of users or roles",
+	PermAuditRead:         "Read the audit trail",
+	PermHealthDetailed:    "View detailed health information",
+	PermPermissionsWrite:  "Change role permissions",
+	PermAPIKeysWrite:      "Create, list, rotate and revoke API keys",
+	PermClassesRead:       "List and view classes",
+	PermClassesWrite:      "Create, update and delete classes",
+	PermAttendanceRead:    "List and view attendance records",
+	PermAttendanceWrite:   "Create, update and delete attendance records",
+	PermGradesRead:        "List and view grades",
+	PermGradesWrite:       "Create, update and delete grades",
+	PermPaymentsRead:      "List and view payments",
+	PermPaymentsWrite:     "Create, update and delete payments",
+	PermPaymentsReconcile: "Import bank statements and confirm transfers against payments",
+	PermFeesRead:          "List and view fee schedules and preview their generation",
+	PermFeesWrite:         "Manage fee schedules, discount rules and late fee policies and generate payments from them",
+	PermWaiversRequest:    "Request one-off waivers of payments",
+	PermWaiversApprove:    "Approve or reject waivers requested by another role",
+	PermLateFeesWaive:     "Waive late fees charged on overdue payments",
+	PermRefundsRequest:    "Request refunds of money received for payments",
+	PermRefundsApprove:    "Approve or reject refunds requested by another role",
+}
+
+// SuperuserRole holds every permission and cannot be edited, so admins can
+// never lock themselves out.
+const SuperuserRole = "admin"
+
+// DefaultRolePermissions applies to roles without a stored mapping.
+var DefaultRolePermissions = map[string][]string{
+	"vice_principal":  {PermUsersRead, PermUsersWrite, PermClassesRead, PermClassesWrite, PermPaymentsRead, PermWaiversApprove, PermRefundsApprove},
+	"teacher":         {PermAttendanceRead, PermAttendanceWrite, PermGradesRead, PermGradesWrite},
+	"exam_supervisor": {PermGradesRead, PermGradesWrite},
+	"treasurer":       {PermPaymentsRead, PermPaymentsWrite, PermPaymentsReconcile, PermFeesRead, PermFeesWrite, PermWaiversRequest, PermRefundsRequest},
+	"student":         {},
+	"parent":          {},
+	"school_health":   {},
+}
+
+func IsValidPermission(permission string) bool {
+	_, ok := Permissions[permission]
+	return ok
+}
+
+// TokenRole returns the role claim of token, defaulting to student for
+// accounts created before roles were assigned.
+func TokenRole(token *auth.Token) string {
+	role, ok := token.Claims["role"].(string)
+	if !ok || role == "" {
+		return "student"
+	}
+	return role
+}
+
+// SetUserRole stores role in the custom claims RequirePermission reads,
+// keeping any other claims. When the role changes, the user's sessions are
+// revoked so tokens carrying the old role stop working. It returns the
+// previous role claim and whether it changed.
+func SetUserRole(ctx context.Context, uid, role string) (string, bool, error) {
+	record, err := AuthClient.GetUser(ctx, uid)
+	if err != nil {
+		return "", false, err
+	}
+
+	previous, _ := record.CustomClaims["role"].(string)
+	if previous == role {
+		return previous, false, nil
+	}
+
+	claims := make(map[string]interface{}, len(record.CustomClaims)+1)
+	for key, value := range record.CustomClaims {
+		claims[key] = value
+	}
+	claims["role"] = role
+	if err := AuthClient.SetCustomUserClaims(ctx, uid, claims); err != nil {
+		return previous, false, err
+	}
+
+	if err := RevokeSessions(ctx, uid); err != nil {
+		return previous, true, err
+	}
+	return previous, true, nil
+}
+
+// permissionCache holds the role mappings stored in the role_permissions
+// collection so RequirePermission does not read Firestore on every request.
+type permissionCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	roles     map[string][]string
+	fetchedAt time.Time
+}
+
+var rolePermissions = &permissionCache{ttl: time.Minute}
+
+// SetPermissionCacheTTL sets how long role mappings are cached. Changes made
+// through this instance take effect immediately.
+func SetPermissionCacheTTL(ttl time.Duration) {
+	rolePermissions.mu.Lock()
+	defer rolePermissions.mu.Unlock()
+
+	rolePermissions.ttl = ttl
+}
+
+func (pc *permissionCache) load(ctx context.Context) (map[string][]string, error) {
+	pc.mu.Lock()
+	roles, fetchedAt, ttl := pc.roles, pc.fetchedAt, pc.ttl
+	pc.mu.Unlock()
+
+	if roles != nil && time.Since(fetchedAt) < ttl {
+		return roles, nil
+	}
+
+	// Without Firebase (development) only the defaults apply
+	if FirebaseApp == nil {
+		return map[string][]string{}, nil
+	}
+
+	client, err := FirebaseApp.Firestore(ctx)
+	if err != nil {
+		return pc.stale(roles, err)
+	}
+	defer client.Close()
+
+	stored := make(map[string][]string)
+	iter := client.Collection("role_permissions").Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return pc.stale(roles, err)
+		}
+
+		var mapping models.RolePermissions
+		doc.DataTo(&mapping)
+		stored[doc.Ref.ID] = mapping.Permissions
+	}
+
+	pc.mu.Lock()
+	pc.roles = stored
+	pc.fetchedAt = time.Now()
+	pc.mu.Unlock()
+
+	return stored, nil
+}
+
+// stale keeps serving the last known mappings during a Firestore outage
+// rather than falling back to defaults an admin may have narrowed.
+func (pc *permissionCache) stale(roles map[string][]string, err error) (map[string][]string, error) {
+	if roles != nil {
+		log.Printf("Warning: using cached role permissions: %v", err)
+		return roles, nil
+	}
+	return nil, err
+}
+
+func (pc *permissionCache) invalidate() {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	pc.roles = nil
+}
+
+// InvalidateRolePermissions makes this instance reload role mappings on the
+// next request.
+func InvalidateRolePermissions() {
+	rolePermissions.invalidate()
+}
+
+// RolePermissionsFor returns the effective permissions of role, sorted, and
+// whether they come from a stored mapping rather than the defaults.
+func RolePermissionsFor(ctx context.Context, role string) ([]string, bool, error) {
+	if role == SuperuserRole {
+		all := make([]string, 0, len(Permissions))
+		for permission := range Permissions {
+			all = append(all, permission)
+		}
+		sort.Strings(all)
+		return all, false, nil
+	}
+
+	stored, err := rolePermissions.load(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	permissions, custom := stored[role]
+	if !custom {
+		permissions = DefaultRolePermissions[role]
+	}
+
+	// Drop permissions that are no longer registered
+	effective := make([]string, 0, len(permissions))
+	for _, permission := range permissions {
+		if IsValidPermission(permission) {
+			effective = append(effective, permission)
+		}
+	}
+	sort.Strings(effective)
+	return effective, custom, nil
+}
+
+// PrincipalPermissions returns the effective permissions of the request's
+// caller: the scopes of its API key, or otherwise those of its role.
+func PrincipalPermissions(c *gin.Context, token *auth.Token) ([]string, error) {
+	if value, ok := c.Get("apiKey"); ok {
+		key := value.(models.APIKey)
+		scopes := make([]string, 0, len(key.Permissions))
+		for _, permission := range key.Permissions {
+			if IsAPIKeyPermission(permission) {
+				scopes = append(scopes, permission)
+			}
+		}
+		sort.Strings(scopes)
+		return scopes, nil
+	}
+
+	permissions, _, err := RolePermissionsFor(c.Request.Context(), TokenRole(token))
+	return permissions, err
+}
+
+// CanGrantRole reports whether a caller holding permissions may give role
+// to an account. Nobody can hand out a permission they do not hold, so only
+// admins can grant admin.
+func CanGrantRole(ctx context.Context, permissions []string, role string) (bool, error) {
+	required, _, err := RolePermissionsFor(ctx, role)
+	if err != nil {
+		return false, err
+	}
+
+	held := make(map[string]bool, len(permissions))
+	for _, permission := range permissions {
+		held[permission] = true
+	}
+	for _, permission := range required {
+		if !held[permission] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func RequirePermission(permission string) gin.HandlerFunc {
+	if !IsValidPermission(permission) {
+		log.Fatalf("RequirePermission: unknown permission %q", permission)
+	}
+
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			apperrors.Abort(c, apperrors.Unauthorized("User not authenticated"))
+			return
+		}
+
+		token := user.(*auth.Token)
+		permissions, err := PrincipalPermissions(c, token)
+		if err != nil {
+			log.Printf("Failed to load role permissions: %v", err)
+			apperrors.Abort(c, apperrors.Unavailable(err, "Unable to verify permissions"))
+			return
+		}
+
+		for _, granted := range permissions {
+			if granted == permission {
+				c.Next()
+				return
+			}
+		}
+
+		apperrors.Abort(c, apperrors.Forbidden("Insufficient permissions").With("permission", permission))
+	}
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sims-backend-go/apperrors"
+	"sort"
+	"testing"
+	"time"
+
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// storeRolePermissions primes the permission cache as if roles had been
+// read from the role_permissions collection.
+func storeRolePermissions(t *testing.T, roles map[string][]string) {
+	t.Helper()
+	rolePermissions.mu.Lock()
+	rolePermissions.roles = roles
+	rolePermissions.fetchedAt = time.Now()
+	rolePermissions.mu.Unlock()
+	t.Cleanup(InvalidateRolePermissions)
+}
+
+func TestRolePermissionsFor(t *testing.T) {
+	storeRolePermissions(t, map[string][]string{
+		// Mappings stored before a permission was removed keep it
+		"treasurer": {PermPaymentsWrite, "payments:export", PermPaymentsRead},
+		"librarian": {},
+	})
+
+	tests := []struct {
+		role   string
+		want   []string
+		custom bool
+	}{
+		{"teacher", []string{PermAttendanceRead, PermAttendanceWrite, PermGradesRead, PermGradesWrite}, false},
+		{"treasurer", []string{PermPaymentsRead, PermPaymentsWrite}, true},
+		{"librarian", []string{}, true},
+		{"student", []string{}, false},
+		{"unknown", []string{}, false},
+	}
+	for _, tt := range tests {
+		permissions, custom, err := RolePermissionsFor(context.Background(), tt.role)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.role, err)
+		}
+		if !reflect.DeepEqual(permissions, tt.want) || custom != tt.custom {
+			t.Errorf("RolePermissionsFor(%s) = %v, %v, want %v, %v", tt.role, permissions, custom, tt.want, tt.custom)
+		}
+	}
+}
+
+func TestRolePermissionsForSuperuser(t *testing.T) {
+	// A stored mapping cannot narrow the superuser
+	storeRolePermissions(t, map[string][]string{SuperuserRole: {PermUsersRead}})
+
+	permissions, custom, err := RolePermissionsFor(context.Background(), SuperuserRole)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if custom || len(permissions) != len(Permissions) || !sort.StringsAreSorted(permissions) {
+		t.Errorf("RolePermissionsFor(admin) = %v, %v, want every permission, sorted", permissions, custom)
+	}
+}
+
+func TestPrincipalPermissionsRole(t *testing.T) {
+	storeRolePermissions(t, map[string][]string{"teacher": {PermGradesRead}})
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		claims map[string]interface{}
+		want   []string
+	}{
+		{map[string]interface{}{"role": "teacher"}, []string{PermGradesRead}},
+		{map[string]interface{}{"role": "exam_supervisor"}, []string{PermGradesRead, PermGradesWrite}},
+		// Accounts without a role claim are students
+		{map[string]interface{}{}, []string{}},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/api/grades", nil)
+
+		permissions, err := PrincipalPermissions(c, &auth.Token{UID: "uid-1", Claims: tt.claims})
+		if err != nil {
+			t.Fatalf("%v: %v", tt.claims, err)
+		}
+		if !reflect.DeepEqual(permissions, tt.want) {
+			t.Errorf("PrincipalPermissions(%v) = %v, want %v", tt.claims, permissions, tt.want)
+		}
+	}
+}
+
+func TestCanGrantRole(t *testing.T) {
+	storeRolePermissions(t, map[string][]string{"librarian": {PermClassesRead}})
+	admin, _, _ := RolePermissionsFor(context.Background(), SuperuserRole)
+	vicePrincipal := DefaultRolePermissions["vice_principal"]
+
+	tests := []struct {
+		name        string
+		permissions []string
+		role        string
+		want        bool
+	}{
+		{"admin grants admin", admin, SuperuserRole, true},
+		{"admin grants teacher", admin, "teacher", true},
+		{"vice principal grants admin", vicePrincipal, SuperuserRole, false},
+		{"vice principal grants vice principal", vicePrincipal, "vice_principal", true},
+		{"vice principal grants student", vicePrincipal, "student", true},
+		{"vice principal grants teacher", vicePrincipal, "teacher", false},
+		{"vice principal grants treasurer", vicePrincipal, "treasurer", false},
+		{"stored mapping", vicePrincipal, "librarian", true},
+		{"no permissions grants stored mapping", nil, "librarian", false},
+	}
+	for _, tt := range tests {
+		granted, err := CanGrantRole(context.Background(), tt.permissions, tt.role)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if granted != tt.want {
+			t.Errorf("%s: CanGrantRole = %v, want %v", tt.name, granted, tt.want)
+		}
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	storeRolePermissions(t, map[string][]string{})
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name string
+		user *auth.Token
+		want int
+	}{
+		{"granted", &auth.Token{UID: "uid-1", Claims: map[string]interface{}{"role": "teacher"}}, http.StatusOK},
+		{"not granted", &auth.Token{UID: "uid-1", Claims: map[string]interface{}{"role": "treasurer"}}, http.StatusForbidden},
+		{"not authenticated", nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		_, router := gin.CreateTestContext(w)
+		router.Use(apperrors.Handler(), func(c *gin.Context) {
+			if tt.user != nil {
+				c.Set("user", tt.user)
+			}
+		})
+		router.GET("/api/attendance", RequirePermission(PermAttendanceWrite), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/api/attendance", nil))
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
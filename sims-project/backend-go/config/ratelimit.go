@@ -0,0 +1,283 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"sims-backend-go/apperrors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RateLimitConfig struct {
+	Enabled                  bool `yaml:"enabled" json:"enabled"`
+	IPRequestsPerMinute      int  `yaml:"ipRequestsPerMinute" json:"ipRequestsPerMinute"`
+	IPBurst                  int  `yaml:"ipBurst" json:"ipBurst"`
+	AccountRequestsPerMinute int  `yaml:"accountRequestsPerMinute" json:"accountRequestsPerMinute"`
+	AccountBurst             int  `yaml:"accountBurst" json:"accountBurst"`
+	LockoutThreshold         int  `yaml:"lockoutThreshold" json:"lockoutThreshold"`
+	LockoutMinutes           int  `yaml:"lockoutMinutes" json:"lockoutMinutes"`
+}
+
+func (rc RateLimitConfig) IPRate() Rate {
+	return Rate{PerMinute: rc.IPRequestsPerMinute, Burst: rc.IPBurst}
+}
+
+func (rc RateLimitConfig) AccountRate() Rate {
+	return Rate{PerMinute: rc.AccountRequestsPerMinute, Burst: rc.AccountBurst}
+}
+
+// Rate describes a token bucket refilled at PerMinute tokens per minute and
+// holding at most Burst tokens.
+type Rate struct {
+	PerMinute int
+	Burst     int
+}
+
+// RateLimitStore keeps token buckets. The in-memory store is enough for a
+// single instance; a shared store (e.g. Redis) can be plugged in when the
+// service is scaled out.
+type RateLimitStore interface {
+	// Allow takes one token from the bucket identified by key. When the
+	// bucket is empty it returns false and how long until a token is free.
+	Allow(key string, rate Rate, now time.Time) (bool, time.Duration)
+}
+
+type bucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+const bucketIdleTTL = 30 * time.Minute
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*bucket)}
+}
+
+func (s *MemoryRateLimitStore) Allow(key string, rate Rate, now time.Time) (bool, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	perSecond := float64(rate.PerMinute) / 60
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rate.Burst), lastSeen: now}
+		s.buckets[key] = b
+	} else {
+		elapsed := now.Sub(b.lastSeen).Seconds()
+		b.tokens = math.Min(float64(rate.Burst), b.tokens+elapsed*perSecond)
+		b.lastSeen = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+	return false, wait
+}
+
+// sweep drops idle buckets so the map does not grow without bound.
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < bucketIdleTTL {
+		return
+	}
+	for key, b := range s.buckets {
+		if now.Sub(b.lastSeen) > bucketIdleTTL {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+// KeyFunc extracts the identity a rate limit applies to. An empty key skips
+// the limit for that request.
+type KeyFunc func(c *gin.Context) string
+
+func ClientIPKey(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+// JSONFieldKey keys requests by a field of the JSON body (e.g. "email") while
+// leaving the body readable for the handler.
+func JSONFieldKey(field string) KeyFunc {
+	return func(c *gin.Context) string {
+		if c.Request.Body == nil {
+			return ""
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+		c.Request.Body.Close()
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			return ""
+		}
+
+		var payload map[string]interface{}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return ""
+		}
+
+		value, _ := payload[field].(string)
+		return strings.ToLower(strings.TrimSpace(value))
+	}
+}
+
+func abortTooManyRequests(c *gin.Context, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	apperrors.Abort(c, apperrors.TooManyRequests("Too many requests, please try again later").With("retryAfter", seconds))
+}
+
+func RateLimitMiddleware(store RateLimitStore, scope string, rate Rate, keyFunc KeyFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !AppConfig.RateLimit.Enabled || rate.PerMinute <= 0 {
+			c.Next()
+			return
+		}
+
+		key := keyFunc(c)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		allowed, retryAfter := store.Allow(scope+":"+key, rate, time.Now())
+		if !allowed {
+			abortTooManyRequests(c, retryAfter)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Lockout blocks a key after too many consecutive failures, e.g. invalid
+// signup invitation codes from the same client.
+type Lockout struct {
+	mu        sync.Mutex
+	threshold int
+	duration  time.Duration
+	entries   map[string]*lockoutEntry
+	lastSweep time.Time
+}
+
+type lockoutEntry struct {
+	failures    int
+	lockedUntil time.Time
+	lastFailure time.Time
+}
+
+func NewLockout(threshold int, duration time.Duration) *Lockout {
+	return &Lockout{
+		threshold: threshold,
+		duration:  duration,
+		entries:   make(map[string]*lockoutEntry),
+	}
+}
+
+// Locked returns how long the key remains locked, or zero.
+func (l *Lockout) Locked(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.entries[key]
+	if !ok {
+		return 0
+	}
+	if remaining := time.Until(entry.lockedUntil); remaining > 0 {
+		return remaining
+	}
+	if entry.failures == 0 {
+		delete(l.entries, key)
+	}
+	return 0
+}
+
+// Fail records a failure and returns the lock duration if the key is now
+// locked.
+func (l *Lockout) Fail(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	entry, ok := l.entries[key]
+	if !ok || now.Sub(entry.lastFailure) > l.duration {
+		entry = &lockoutEntry{}
+		l.entries[key] = entry
+	}
+
+	entry.failures++
+	entry.lastFailure = now
+	if l.threshold > 0 && entry.failures >= l.threshold {
+		entry.failures = 0
+		entry.lockedUntil = now.Add(l.duration)
+		return l.duration
+	}
+	return 0
+}
+
+// sweep drops keys that are neither locked nor have a recent failure, which
+// Fail would forget anyway, so keys staying under the threshold do not
+// accumulate.
+func (l *Lockout) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.duration {
+		return
+	}
+	for key, entry := range l.entries {
+		if now.After(entry.lockedUntil) && now.Sub(entry.lastFailure) > l.duration {
+			delete(l.entries, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+func (l *Lockout) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.entries, key)
+}
+
+// AbortLocked responds with 429 when key is locked out.
+func (l *Lockout) AbortLocked(c *gin.Context, key string) bool {
+	if remaining := l.Locked(key); remaining > 0 {
+		abortTooManyRequests(c, remaining)
+		return true
+	}
+	return false
+}
+
+// SignupLockout tracks invalid signup invitation codes per client IP.
+var SignupLockout = NewLockout(5, 15*time.Minute)
+
+// PasswordLockout tracks wrong current passwords per user on password change.
+var PasswordLockout = NewLockout(5, 15*time.Minute)
+
+// ConfigureLockouts applies the configured threshold and duration to the
+// signup, password and second factor lockouts.
+func ConfigureLockouts(rc RateLimitConfig) {
+	duration := time.Duration(rc.LockoutMinutes) * time.Minute
+	SignupLockout = NewLockout(rc.LockoutThreshold, duration)
+	PasswordLockout = NewLockout(rc.LockoutThreshold, duration)
+	MFALockout = NewLockout(rc.LockoutThreshold, duration)
+}
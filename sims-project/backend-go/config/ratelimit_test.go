@@ -0,0 +1,68 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockout(t *testing.T) {
+	l := NewLockout(3, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		if locked := l.Fail("ip"); locked != 0 {
+			t.Fatalf("failure %d locked the key", i+1)
+		}
+	}
+	if remaining := l.Locked("ip"); remaining != 0 {
+		t.Fatalf("Locked = %v below the threshold", remaining)
+	}
+
+	if locked := l.Fail("ip"); locked != time.Minute {
+		t.Fatalf("third failure: locked = %v, want %v", locked, time.Minute)
+	}
+	if remaining := l.Locked("ip"); remaining <= 0 {
+		t.Fatal("key not locked after reaching the threshold")
+	}
+	if remaining := l.Locked("other"); remaining != 0 {
+		t.Errorf("other key locked for %v", remaining)
+	}
+
+	l.Reset("ip")
+	if remaining := l.Locked("ip"); remaining != 0 {
+		t.Errorf("Locked = %v after Reset", remaining)
+	}
+}
+
+func TestLockoutSweepsIdleKeys(t *testing.T) {
+	l := NewLockout(5, time.Minute)
+	now := time.Now()
+
+	l.entries["idle"] = &lockoutEntry{failures: 1, lastFailure: now.Add(-2 * time.Minute)}
+	l.entries["recent"] = &lockoutEntry{failures: 1, lastFailure: now.Add(-10 * time.Second)}
+	l.entries["locked"] = &lockoutEntry{lastFailure: now.Add(-2 * time.Minute), lockedUntil: now.Add(time.Minute)}
+
+	l.sweep(now)
+
+	if _, ok := l.entries["idle"]; ok {
+		t.Error("idle key was not swept")
+	}
+	for _, key := range []string{"recent", "locked"} {
+		if _, ok := l.entries[key]; !ok {
+			t.Errorf("%s key was swept", key)
+		}
+	}
+}
+
+func TestConfigureLockouts(t *testing.T) {
+	defer func(signup, password, mfa *Lockout) {
+		SignupLockout, PasswordLockout, MFALockout = signup, password, mfa
+	}(SignupLockout, PasswordLockout, MFALockout)
+
+	ConfigureLockouts(RateLimitConfig{LockoutThreshold: 2, LockoutMinutes: 30})
+
+	for name, l := range map[string]*Lockout{"signup": SignupLockout, "password": PasswordLockout, "mfa": MFALockout} {
+		if l.threshold != 2 || l.duration != 30*time.Minute {
+			t.Errorf("%s lockout: threshold %d, duration %v", name, l.threshold, l.duration)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"firebase.google.com/go/auth"
+)
+
+func TestTokenRevoked(t *testing.T) {
+	validAfter := time.Date(2025, 1, 10, 8, 0, 0, 500*int(time.Millisecond), time.UTC)
+	signIn := validAfter.Add(-time.Hour).Unix()
+
+	tests := []struct {
+		name     string
+		disabled bool
+		issuedAt time.Time
+		want     bool
+	}{
+		{"issued before revocation", false, validAfter.Add(-time.Second), true},
+		{"issued in the revocation second", false, validAfter.Truncate(time.Second), false},
+		{"issued after revocation", false, validAfter.Add(time.Minute), false},
+		{"disabled account", true, validAfter.Add(time.Minute), true},
+	}
+	for _, tt := range tests {
+		sessions.mu.Lock()
+		sessions.entries["uid-1"] = sessionState{validAfter: validAfter, disabled: tt.disabled, fetchedAt: time.Now()}
+		sessions.mu.Unlock()
+
+		// A refreshed token keeps the original sign-in time, so only
+		// IssuedAt tells whether it predates the revocation
+		token := &auth.Token{UID: "uid-1", AuthTime: signIn, IssuedAt: tt.issuedAt.Unix()}
+		revoked, err := tokenRevoked(context.Background(), token)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if revoked != tt.want {
+			t.Errorf("%s: revoked = %v, want %v", tt.name, revoked, tt.want)
+		}
+	}
+	sessions.invalidate("uid-1")
+}
+
+func TestSessionCacheInvalidate(t *testing.T) {
+	sessions.mu.Lock()
+	sessions.entries["uid-2"] = sessionState{fetchedAt: time.Now()}
+	sessions.mu.Unlock()
+
+	sessions.invalidate("uid-2")
+
+	sessions.mu.Lock()
+	_, cached := sessions.entries["uid-2"]
+	sessions.mu.Unlock()
+	if cached {
+		t.Error("invalidate kept the cached session state")
+	}
+}
@@ -3,10 +3,12 @@ package main
 import (
 	"log"
 	"os"
+	"sims-backend-go/apperrors"
 	"sims-backend-go/config"
 	"sims-backend-go/routes"
+	"sims-backend-go/services"
+	"time"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
@@ -17,115 +19,348 @@ func main() {
 		log.Println("Warning: .env file not found, using system environment variables")
 	}
 
+	// Load and validate configuration
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	config.AppConfig = cfg
+	log.Printf("Configuration loaded:\n%s", cfg)
+
 	// Initialize Firebase
-	if err := config.InitializeFirebase(); err != nil {
-		log.Fatal("Failed to initialize Firebase:", err)
+	if err := config.InitializeFirebase(cfg); err != nil {
+		log.Fatal("Failed to initialize Firebase: ", err)
 	}
 
-	// Set Gin mode
-	gin.SetMode(gin.ReleaseMode)
-	if os.Getenv("GIN_MODE") == "debug" {
-		gin.SetMode(gin.DebugMode)
+	// One-off data migrations instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigration(cfg, os.Args[2:])
+		return
+	}
+	if config.FirebaseApp != nil {
+		migrateOnStartup(cfg)
+	}
+
+	// Identity provider and password policy
+	if cfg.Firebase.Enabled {
+		services.Identity = services.NewFirebaseIdentityProvider(cfg.Firebase.WebAPIKey)
+	}
+	services.Passwords = cfg.PasswordPolicy
+	services.Mail = cfg.Mail.NewMailer()
+	services.Gateway = cfg.Gateway.NewGateway()
+	config.SetSessionCacheTTL(time.Duration(cfg.SessionCacheSeconds) * time.Second)
+	config.SetPermissionCacheTTL(time.Duration(cfg.PermissionCacheSeconds) * time.Second)
+
+	// Two-factor authentication
+	mfaKey, err := cfg.MFA.Key()
+	if err != nil {
+		log.Fatal("Invalid MFA encryption key: ", err)
+	}
+	if err := services.ConfigureMFA(mfaKey, cfg.MFA.Issuer, cfg.MFA.StepUpTTL()); err != nil {
+		log.Fatal("Failed to configure MFA: ", err)
 	}
 
+	// Set Gin mode
+	gin.SetMode(cfg.GinMode)
+
 	// Initialize Gin router
 	r := gin.Default()
 
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatal("Invalid trusted proxies: ", err)
+	}
+
+	// Request IDs and uniform error responses
+	r.Use(apperrors.RequestID(), apperrors.Handler())
+	r.NoRoute(func(c *gin.Context) {
+		c.Error(apperrors.NotFound("Route not found"))
+	})
+
 	// CORS middleware
-	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"*"}, // In production, specify your frontend URL
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization", "accept", "origin", "Cache-Control", "X-Requested-With"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-	}))
+	r.Use(config.CORSMiddleware(cfg.CORS))
 
-	// Health check endpoint
-	r.GET("/api/health", routes.HealthCheck)
+	// Rate limiting for public auth routes
+	config.ConfigureLockouts(cfg.RateLimit)
+	limiterStore := config.NewMemoryRateLimitStore()
+	perIP := config.RateLimitMiddleware(limiterStore, "auth-ip", cfg.RateLimit.IPRate(), config.ClientIPKey)
+	perAccount := config.RateLimitMiddleware(limiterStore, "auth-account", cfg.RateLimit.AccountRate(), config.JSONFieldKey("email"))
+
+	// Health check endpoints
+	health := r.Group("/api/health")
+	{
+		health.GET("", routes.HealthCheck)
+		health.GET("/live", routes.LivenessCheck)
+		health.GET("/ready", routes.ReadinessCheck)
+	}
 
 	// Auth routes (public)
 	auth := r.Group("/api/auth")
 	{
-		auth.POST("/verify", routes.VerifyToken)
-		auth.POST("/login", routes.Login)
-		auth.POST("/logout", routes.Logout)
-		auth.POST("/signup", routes.SignUp)
+		auth.POST("/verify", perIP, routes.VerifyToken)
+		auth.POST("/login", perIP, perAccount, routes.Login)
+		auth.POST("/refresh", perIP, routes.RefreshToken)
+		auth.POST("/signup", perIP, perAccount, routes.SignUp)
+		auth.POST("/password-reset", perIP, perAccount, routes.RequestPasswordReset)
 	}
 
+	// Payment gateway notifications (public, verified by signature)
+	r.POST("/api/webhooks/payments", routes.PaymentWebhook)
+
 	// Protected routes
 	api := r.Group("/api")
-	api.Use(config.FirebaseAuthMiddleware())
+	api.Use(config.AuthMiddleware())
 	{
+		// Detailed health information
+		api.GET("/health/detailed", config.RequirePermission(config.PermHealthDetailed), routes.DetailedHealthCheck)
+
 		// Auth routes (protected)
 		authProtected := api.Group("/auth")
 		{
 			authProtected.GET("/profile", routes.GetProfile)
 			authProtected.PUT("/profile", routes.UpdateProfile)
 			authProtected.POST("/change-password", routes.ChangePassword)
+			authProtected.POST("/logout", routes.Logout)
+			authProtected.GET("/login-history", routes.GetLoginHistory)
+			authProtected.POST("/send-verification", routes.SendVerification)
+			authProtected.GET("/verification-status", routes.GetVerificationStatus)
+			authProtected.GET("/permissions", routes.GetMyPermissions)
+			authProtected.GET("/accounts", routes.GetMyAccounts)
+
+			// Two-factor authentication
+			authProtected.GET("/mfa", routes.GetMFAStatus)
+			authProtected.POST("/mfa/enroll", routes.EnrollMFA)
+			authProtected.POST("/mfa/activate", routes.ActivateMFA)
+			authProtected.POST("/mfa/verify", routes.VerifyMFA)
+			authProtected.POST("/mfa/recovery-codes", routes.RegenerateRecoveryCodes)
+			authProtected.POST("/mfa/disable", routes.DisableMFA)
 		}
 
-		// User management (admin/vice_principal)
+		// User management (step-up required)
 		users := api.Group("/users")
-		users.Use(config.RoleMiddleware("admin", "vice_principal"))
+		users.Use(config.RequireStepUp())
 		{
-			users.GET("", routes.GetUsers)
-			users.POST("", routes.CreateUser)
-			users.GET("/:id", routes.GetUser)
-			users.PUT("/:id", routes.UpdateUser)
-			users.DELETE("/:id", routes.DeleteUser)
+			usersRead := config.RequirePermission(config.PermUsersRead)
+			usersWrite := config.RequirePermission(config.PermUsersWrite)
+
+			users.GET("", usersRead, routes.GetUsers)
+			users.POST("", usersWrite, routes.CreateUser)
+			users.GET("/:id", usersRead, routes.GetUser)
+			users.PUT("/:id", usersWrite, routes.UpdateUser)
+			users.PATCH("/:id", usersWrite, routes.PatchUser)
+			users.DELETE("/:id", usersWrite, routes.DeleteUser)
+			users.POST("/:id/setup-link", usersWrite, routes.SendAccountSetupLink)
+			users.GET("/verifications/pending", usersRead, routes.GetPendingVerifications)
+			users.DELETE("/:id/mfa", config.RequirePermission(config.PermUsersMFAReset), routes.ResetUserMFA)
 		}
 
-		// Class management (admin/vice_principal)
+		// Invitations
+		invitations := api.Group("/invitations")
+		invitations.Use(config.RequirePermission(config.PermInvitationsWrite))
+		{
+			invitations.GET("", routes.GetInvitations)
+			invitations.POST("", routes.CreateInvitation)
+			invitations.DELETE("/:id", routes.RevokeInvitation)
+		}
+
+		// Force logout of a user or a whole role
+		api.POST("/sessions/revoke", config.RequirePermission(config.PermSessionsRevoke), routes.RevokeSessions)
+
+		// Audit trail
+		api.GET("/audit-logs", config.RequirePermission(config.PermAuditRead), routes.GetAuditLogs)
+
+		// API keys for machine clients (step-up required)
+		apiKeys := api.Group("/api-keys")
+		apiKeys.Use(config.RequirePermission(config.PermAPIKeysWrite), config.RequireStepUp())
+		{
+			apiKeys.GET("", routes.GetAPIKeys)
+			apiKeys.POST("", routes.CreateAPIKey)
+			apiKeys.POST("/:id/rotate", routes.RotateAPIKey)
+			apiKeys.DELETE("/:id", routes.RevokeAPIKey)
+		}
+
+		// Role permission mappings
+		permissions := api.Group("/permissions")
+		permissions.Use(config.RequirePermission(config.PermPermissionsWrite))
+		{
+			permissions.GET("", routes.GetRolePermissions)
+			permissions.PUT("/roles/:role", routes.UpdateRolePermissions)
+			permissions.DELETE("/roles/:role", routes.ResetRolePermissions)
+		}
+
+		// Class management
 		classes := api.Group("/classes")
-		classes.Use(config.RoleMiddleware("admin", "vice_principal"))
 		{
-			classes.GET("", routes.GetClasses)
-			classes.POST("", routes.CreateClass)
-			classes.GET("/:id", routes.GetClass)
-			classes.PUT("/:id", routes.UpdateClass)
-			classes.DELETE("/:id", routes.DeleteClass)
+			classesRead := config.RequirePermission(config.PermClassesRead)
+			classesWrite := config.RequirePermission(config.PermClassesWrite)
+
+			classes.GET("", classesRead, routes.GetClasses)
+			classes.POST("", classesWrite, routes.CreateClass)
+			classes.GET("/:id", classesRead, routes.GetClass)
+			classes.PUT("/:id", classesWrite, routes.UpdateClass)
+			classes.PATCH("/:id", classesWrite, routes.PatchClass)
+			classes.DELETE("/:id", classesWrite, routes.DeleteClass)
 		}
 
-		// Attendance management (admin/teacher)
+		// Attendance management
 		attendance := api.Group("/attendance")
-		attendance.Use(config.RoleMiddleware("admin", "teacher"))
 		{
-			attendance.GET("", routes.GetAttendance)
-			attendance.POST("", routes.CreateAttendance)
-			attendance.GET("/:id", routes.GetAttendanceRecord)
-			attendance.PUT("/:id", routes.UpdateAttendance)
-			attendance.DELETE("/:id", routes.DeleteAttendance)
+			attendanceRead := config.RequirePermission(config.PermAttendanceRead)
+			attendanceWrite := config.RequirePermission(config.PermAttendanceWrite)
+
+			attendance.GET("", attendanceRead, routes.GetAttendance)
+			attendance.POST("", attendanceWrite, routes.CreateAttendance)
+			attendance.GET("/:id", attendanceRead, routes.GetAttendanceRecord)
+			attendance.PUT("/:id", attendanceWrite, routes.UpdateAttendance)
+			attendance.PATCH("/:id", attendanceWrite, routes.PatchAttendance)
+			attendance.DELETE("/:id", attendanceWrite, routes.DeleteAttendance)
 		}
 
-		// Grade management (admin/teacher/exam_supervisor)
+		// Grade management
 		grades := api.Group("/grades")
-		grades.Use(config.RoleMiddleware("admin", "teacher", "exam_supervisor"))
 		{
-			grades.GET("", routes.GetGrades)
-			grades.POST("", routes.CreateGrade)
-			grades.GET("/:id", routes.GetGrade)
-			grades.PUT("/:id", routes.UpdateGrade)
-			grades.DELETE("/:id", routes.DeleteGrade)
+			gradesRead := config.RequirePermission(config.PermGradesRead)
+			gradesWrite := config.RequirePermission(config.PermGradesWrite)
+
+			grades.GET("", gradesRead, routes.GetGrades)
+			grades.POST("", gradesWrite, routes.CreateGrade)
+			grades.GET("/:id", gradesRead, routes.GetGrade)
+			grades.PUT("/:id", gradesWrite, routes.UpdateGrade)
+			grades.PATCH("/:id", gradesWrite, routes.PatchGrade)
+			grades.DELETE("/:id", gradesWrite, routes.DeleteGrade)
 		}
 
-		// Payment management (admin/treasurer)
+		// Payment management (step-up required for changes)
 		payments := api.Group("/payments")
-		payments.Use(config.RoleMiddleware("admin", "treasurer"))
 		{
-			payments.GET("", routes.GetPayments)
-			payments.POST("", routes.CreatePayment)
-			payments.GET("/:id", routes.GetPayment)
-			payments.PUT("/:id", routes.UpdatePayment)
-			payments.DELETE("/:id", routes.DeletePayment)
+			paymentsRead := config.RequirePermission(config.PermPaymentsRead)
+			paymentsWrite := config.RequirePermission(config.PermPaymentsWrite)
+			stepUp := config.RequireStepUp()
+
+			payments.GET("", paymentsRead, routes.GetPayments)
+			payments.GET("/stats", paymentsRead, routes.GetPaymentStats)
+			payments.POST("", paymentsWrite, stepUp, routes.CreatePayment)
+			payments.GET("/:id", paymentsRead, routes.GetPayment)
+			payments.PUT("/:id", paymentsWrite, stepUp, routes.UpdatePayment)
+			payments.PATCH("/:id", paymentsWrite, stepUp, routes.PatchPayment)
+			payments.DELETE("/:id", paymentsWrite, stepUp, routes.DeletePayment)
+			payments.GET("/:id/receipt", paymentsRead, routes.GetPaymentReceipt)
+			payments.POST("/:id/receipt/print", paymentsWrite, routes.PrintPaymentReceipt)
+			payments.GET("/:id/transactions", paymentsRead, routes.GetPaymentTransactions)
+			payments.POST("/:id/transactions", paymentsWrite, stepUp, routes.RecordPaymentTransaction)
+			payments.PUT("/:id/installments", paymentsWrite, stepUp, routes.SetInstallmentPlan)
+			payments.DELETE("/:id/installments", paymentsWrite, stepUp, routes.DeleteInstallmentPlan)
+			payments.GET("/:id/charges", paymentsRead, routes.GetPaymentCharges)
+			payments.POST("/:id/charges", paymentsWrite, stepUp, routes.CreatePaymentCharge)
+			payments.GET("/:id/waivers", paymentsRead, routes.GetPaymentWaivers)
+			payments.POST("/:id/waivers", config.RequirePermission(config.PermWaiversRequest), routes.RequestPaymentWaiver)
+			payments.GET("/:id/refunds", paymentsRead, routes.GetPaymentRefunds)
+			payments.POST("/:id/refunds", config.RequirePermission(config.PermRefundsRequest), routes.RequestPaymentRefund)
 		}
-	}
 
-	// Get port from environment or default to 8080
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+		// Waivers take effect once approved by a second role
+		waivers := api.Group("/waivers")
+		{
+			waiversApprove := config.RequirePermission(config.PermWaiversApprove)
+
+			waivers.GET("", config.RequirePermission(config.PermPaymentsRead), routes.GetWaivers)
+			waivers.POST("/:id/approve", waiversApprove, config.RequireStepUp(), routes.ApproveWaiver)
+			waivers.POST("/:id/reject", waiversApprove, routes.RejectWaiver)
+		}
+
+		// Student accounts, visible to the student, their parent and
+		// payments:read
+		students := api.Group("/students")
+		{
+			students.GET("/:id/ledger", routes.GetStudentLedger)
+			students.GET("/:id/statement", routes.GetStudentStatement)
+		}
+
+		// Refunds take effect once approved by a second role
+		refunds := api.Group("/refunds")
+		{
+			refundsApprove := config.RequirePermission(config.PermRefundsApprove)
+
+			refunds.GET("", config.RequirePermission(config.PermPaymentsRead), routes.GetRefunds)
+			refunds.POST("/:id/approve", refundsApprove, config.RequireStepUp(), routes.ApproveRefund)
+			refunds.POST("/:id/reject", refundsApprove, routes.RejectRefund)
+		}
+
+		// Late fees on overdue payments; assessment can run from a scheduler
+		// with an API key
+		lateFees := api.Group("/late-fees")
+		{
+			lateFees.POST("/preview", config.RequirePermission(config.PermPaymentsRead), routes.PreviewLateFees)
+			lateFees.POST("/assess", config.RequirePermission(config.PermPaymentsWrite), routes.AssessLateFees)
+			lateFees.POST("/:id/waive", config.RequirePermission(config.PermLateFeesWaive), config.RequireStepUp(), routes.WaiveLateFee)
+		}
+
+		lateFeePolicies := api.Group("/late-fee-policies")
+		{
+			feesRead := config.RequirePermission(config.PermFeesRead)
+			feesWrite := config.RequirePermission(config.PermFeesWrite)
+
+			lateFeePolicies.GET("", feesRead, routes.GetLateFeePolicies)
+			lateFeePolicies.GET("/:paymentType", feesRead, routes.GetLateFeePolicy)
+			lateFeePolicies.PUT("/:paymentType", feesWrite, routes.PutLateFeePolicy)
+			lateFeePolicies.DELETE("/:paymentType", feesWrite, routes.DeleteLateFeePolicy)
+		}
+
+		// Bank statement reconciliation (step-up required to confirm)
+		reconciliation := api.Group("/reconciliation")
+		{
+			paymentsRead := config.RequirePermission(config.PermPaymentsRead)
+			reconcile := config.RequirePermission(config.PermPaymentsReconcile)
+			stepUp := config.RequireStepUp()
+
+			reconciliation.GET("/statements", paymentsRead, routes.GetBankStatements)
+			reconciliation.POST("/statements", reconcile, routes.ImportBankStatement)
+			reconciliation.GET("/statements/:id", paymentsRead, routes.GetBankStatement)
+			reconciliation.POST("/statements/:id/confirm", reconcile, stepUp, routes.ConfirmBankStatement)
+			reconciliation.GET("/lines", paymentsRead, routes.GetStatementLines)
+			reconciliation.POST("/lines/:id/confirm", reconcile, stepUp, routes.ConfirmStatementLine)
+			reconciliation.POST("/lines/:id/ignore", reconcile, routes.IgnoreStatementLine)
+		}
+
+		// Discount and scholarship rules applied by fee generation
+		discountRules := api.Group("/discount-rules")
+		{
+			feesRead := config.RequirePermission(config.PermFeesRead)
+			feesWrite := config.RequirePermission(config.PermFeesWrite)
+
+			discountRules.GET("", feesRead, routes.GetDiscountRules)
+			discountRules.POST("", feesWrite, routes.CreateDiscountRule)
+			discountRules.GET("/:id", feesRead, routes.GetDiscountRule)
+			discountRules.PUT("/:id", feesWrite, routes.UpdateDiscountRule)
+			discountRules.PATCH("/:id", feesWrite, routes.PatchDiscountRule)
+			discountRules.DELETE("/:id", feesWrite, routes.DeleteDiscountRule)
+		}
+
+		// Webhooks received from the payment gateway
+		gatewayEvents := api.Group("/gateway-events")
+		gatewayEvents.Use(config.RequirePermission(config.PermPaymentsWrite))
+		{
+			gatewayEvents.GET("", routes.GetGatewayEvents)
+			gatewayEvents.POST("/:id/replay", config.RequireStepUp(), routes.ReplayGatewayEvent)
+		}
+
+		// Fee schedules generate pending payments per period
+		feeSchedules := api.Group("/fee-schedules")
+		{
+			feesRead := config.RequirePermission(config.PermFeesRead)
+			feesWrite := config.RequirePermission(config.PermFeesWrite)
+			stepUp := config.RequireStepUp()
+
+			feeSchedules.GET("", feesRead, routes.GetFeeSchedules)
+			feeSchedules.POST("", feesWrite, routes.CreateFeeSchedule)
+			feeSchedules.GET("/:id", feesRead, routes.GetFeeSchedule)
+			feeSchedules.PUT("/:id", feesWrite, routes.UpdateFeeSchedule)
+			feeSchedules.PATCH("/:id", feesWrite, routes.PatchFeeSchedule)
+			feeSchedules.DELETE("/:id", feesWrite, routes.DeleteFeeSchedule)
+			feeSchedules.POST("/:id/preview", feesRead, routes.PreviewFeeGeneration)
+			feeSchedules.POST("/:id/generate", feesWrite, stepUp, routes.GenerateFees)
+		}
 	}
 
-	log.Printf("Server starting on port %s", port)
-	log.Fatal(r.Run(":" + port))
+	log.Printf("Server starting on port %s", cfg.Port)
+	log.Fatal(r.Run(":" + cfg.Port))
 }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"sims-backend-go/config"
+	"sims-backend-go/migrations"
+)
+
+// runMigration runs a one-off data migration by name, e.g.
+// `./main migrate money -dry-run`.
+func runMigration(cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		log.Fatal("Usage: migrate <money> [-dry-run]")
+	}
+	name := args[0]
+
+	flags := flag.NewFlagSet("migrate "+name, flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "report what would change without writing")
+	flags.Parse(args[1:])
+
+	if config.FirebaseApp == nil {
+		log.Fatal("Migrations need Firebase, set USE_FIREBASE=true")
+	}
+
+	ctx := context.Background()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		log.Fatal("Failed to connect to database: ", err)
+	}
+	defer client.Close()
+
+	switch name {
+	case "money":
+		report, err := migrations.Money(ctx, client, cfg.DefaultCurrency, *dryRun)
+		if err != nil {
+			log.Fatal("Money migration failed: ", err)
+		}
+		log.Printf("Money migration finished (dry run: %t): %s", *dryRun, report)
+	default:
+		log.Fatalf("Unknown migration %q", name)
+	}
+}
+
+// migrateOnStartup converts data written by older versions before the
+// server accepts requests, since handlers read every amount as minor
+// units. A failed migration stops the server rather than serve amounts
+// 100 times too small.
+func migrateOnStartup(cfg *config.Config) {
+	ctx := context.Background()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		log.Fatal("Failed to connect to database: ", err)
+	}
+	defer client.Close()
+
+	done, err := migrations.Completed(ctx, client, migrations.MoneyMigration)
+	if err != nil {
+		log.Fatal("Failed to check migrations: ", err)
+	}
+	if done {
+		return
+	}
+
+	log.Println("Converting amounts to minor units before serving")
+	report, err := migrations.Money(ctx, client, cfg.DefaultCurrency, false)
+	if err != nil {
+		log.Fatal("Money migration failed, not serving: ", err)
+	}
+	log.Printf("Money migration finished: %s", report)
+}
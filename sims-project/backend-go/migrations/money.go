@@ -0,0 +1,237 @@
+// Package migrations holds one-off data migrations run from the command
+// line, e.g. `./main migrate money -dry-run`, or by the server before it
+// starts serving.
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sims-backend-go/models"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Firestore limits a batch to 500 writes.
+const batchSize = 500
+
+// MoneyMigration names the money migration in the migrations collection,
+// which records migrations that ran to completion.
+const MoneyMigration = "money"
+
+// Completed reports whether the named migration has run to completion.
+func Completed(ctx context.Context, client *firestore.Client, name string) (bool, error) {
+	_, err := client.Collection("migrations").Doc(name).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func markCompleted(ctx context.Context, client *firestore.Client, name string, report fmt.Stringer) error {
+	_, err := client.Collection("migrations").Doc(name).Set(ctx, map[string]interface{}{
+		"completedAt": time.Now(),
+		"report":      report.String(),
+	})
+	return err
+}
+
+// MoneyReport counts the documents converted per collection.
+type MoneyReport struct {
+	Payments     int
+	Transactions int
+	FeeSchedules int
+	Skipped      int
+}
+
+func (r MoneyReport) String() string {
+	return fmt.Sprintf("payments=%d transactions=%d feeSchedules=%d alreadyMigrated=%d", r.Payments, r.Transactions, r.FeeSchedules, r.Skipped)
+}
+
+// Money converts amounts stored as float64 major units to int64 minor units
+// and fills in missing currencies. Converted documents are marked with
+// minorUnits, so running it again only touches documents written by older
+// versions.
+func Money(ctx context.Context, client *firestore.Client, defaultCurrency string, dryRun bool) (MoneyReport, error) {
+	var report MoneyReport
+	batch := &batcher{client: client, dryRun: dryRun}
+
+	// Transactions take the currency of their payment
+	currencies := make(map[string]string)
+
+	iter := client.Collection("payments").Documents(ctx)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return report, err
+		}
+
+		data := doc.Data()
+		currency := documentCurrency(data, defaultCurrency)
+		currencies[doc.Ref.ID] = currency
+		if migrated(data) {
+			report.Skipped++
+			continue
+		}
+
+		updates := []firestore.Update{
+			{Path: "currency", Value: currency},
+			{Path: "amount", Value: toMinorUnits(data["amount"], currency)},
+			{Path: "paidAmount", Value: toMinorUnits(data["paidAmount"], currency)},
+			{Path: "minorUnits", Value: true},
+		}
+		if installments, ok := data["installments"].([]interface{}); ok {
+			converted := make([]interface{}, len(installments))
+			for i, raw := range installments {
+				installment, _ := raw.(map[string]interface{})
+				copied := make(map[string]interface{}, len(installment))
+				for key, value := range installment {
+					copied[key] = value
+				}
+				copied["amount"] = toMinorUnits(installment["amount"], currency)
+				copied["paidAmount"] = toMinorUnits(installment["paidAmount"], currency)
+				converted[i] = copied
+			}
+			updates = append(updates, firestore.Update{Path: "installments", Value: converted})
+		}
+
+		if err := batch.update(ctx, doc, updates); err != nil {
+			return report, err
+		}
+		report.Payments++
+	}
+
+	iter = client.CollectionGroup("transactions").Documents(ctx)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return report, err
+		}
+
+		data := doc.Data()
+		if migrated(data) {
+			report.Skipped++
+			continue
+		}
+
+		currency, ok := currencies[doc.Ref.Parent.Parent.ID]
+		if !ok {
+			currency = documentCurrency(data, defaultCurrency)
+		}
+		if err := batch.update(ctx, doc, []firestore.Update{
+			{Path: "currency", Value: currency},
+			{Path: "amount", Value: toMinorUnits(data["amount"], currency)},
+			{Path: "minorUnits", Value: true},
+		}); err != nil {
+			return report, err
+		}
+		report.Transactions++
+	}
+
+	iter = client.Collection("fee_schedules").Documents(ctx)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return report, err
+		}
+
+		data := doc.Data()
+		if migrated(data) {
+			report.Skipped++
+			continue
+		}
+
+		currency := documentCurrency(data, defaultCurrency)
+		if err := batch.update(ctx, doc, []firestore.Update{
+			{Path: "currency", Value: currency},
+			{Path: "amount", Value: toMinorUnits(data["amount"], currency)},
+			{Path: "minorUnits", Value: true},
+		}); err != nil {
+			return report, err
+		}
+		report.FeeSchedules++
+	}
+
+	if err := batch.flush(ctx); err != nil || dryRun {
+		return report, err
+	}
+	return report, markCompleted(ctx, client, MoneyMigration, report)
+}
+
+func migrated(data map[string]interface{}) bool {
+	done, _ := data["minorUnits"].(bool)
+	return done
+}
+
+func documentCurrency(data map[string]interface{}, defaultCurrency string) string {
+	currency, _ := data["currency"].(string)
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return defaultCurrency
+	}
+	if !models.IsValidCurrency(currency) {
+		log.Printf("Warning: unsupported currency %q, converting with two decimals", currency)
+	}
+	return currency
+}
+
+// toMinorUnits converts a legacy major unit amount, which Firestore returns
+// as float64 or, for whole numbers written by other clients, int64.
+func toMinorUnits(value interface{}, currency string) int64 {
+	switch amount := value.(type) {
+	case float64:
+		return models.MinorUnits(amount, currency)
+	case int64:
+		return models.MinorUnits(float64(amount), currency)
+	default:
+		return 0
+	}
+}
+
+// batcher groups updates into batches. Each update is conditional on the
+// document not having changed since it was read.
+type batcher struct {
+	client  *firestore.Client
+	dryRun  bool
+	batch   *firestore.WriteBatch
+	pending int
+}
+
+func (b *batcher) update(ctx context.Context, doc *firestore.DocumentSnapshot, updates []firestore.Update) error {
+	if b.dryRun {
+		return nil
+	}
+	if b.batch == nil {
+		b.batch = b.client.Batch()
+	}
+	b.batch.Update(doc.Ref, updates, firestore.LastUpdateTime(doc.UpdateTime))
+	b.pending++
+	if b.pending == batchSize {
+		return b.flush(ctx)
+	}
+	return nil
+}
+
+func (b *batcher) flush(ctx context.Context) error {
+	if b.batch == nil {
+		return nil
+	}
+	_, err := b.batch.Commit(ctx)
+	b.batch = nil
+	b.pending = 0
+	return err
+}
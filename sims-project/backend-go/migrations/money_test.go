@@ -0,0 +1,45 @@
+package migrations
+
+import "testing"
+
+func TestToMinorUnits(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		currency string
+		want     int64
+	}{
+		{float64(150000), "IDR", 15000000},
+		{150000.5, "IDR", 15000050},
+		{19.99, "USD", 1999},
+		{0.29, "USD", 29},
+		{int64(150000), "IDR", 15000000},
+		{float64(500), "JPY", 500},
+		{nil, "IDR", 0},
+		{"150000", "IDR", 0},
+	}
+	for _, tt := range tests {
+		if got := toMinorUnits(tt.value, tt.currency); got != tt.want {
+			t.Errorf("toMinorUnits(%v, %s) = %d, want %d", tt.value, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestDocumentCurrency(t *testing.T) {
+	tests := []struct {
+		data map[string]interface{}
+		want string
+	}{
+		{map[string]interface{}{}, "IDR"},
+		{map[string]interface{}{"currency": ""}, "IDR"},
+		{map[string]interface{}{"currency": " usd "}, "USD"},
+		{map[string]interface{}{"currency": "JPY"}, "JPY"},
+	}
+	for _, tt := range tests {
+		if got := documentCurrency(tt.data, "IDR"); got != tt.want {
+			t.Errorf("documentCurrency(%v) = %s, want %s", tt.data, got, tt.want)
+		}
+	}
+	if !migrated(map[string]interface{}{"minorUnits": true}) || migrated(map[string]interface{}{}) {
+		t.Error("migrated does not follow the minorUnits flag")
+	}
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// APIKey is stored under api_keys/{sha256(key)}. The key itself is only
+// returned once, when created or rotated.
+type APIKey struct {
+	ID          string     `json:"id" firestore:"id"`
+	Name        string     `json:"name" firestore:"name"`
+	Prefix      string     `json:"prefix" firestore:"prefix"` // first characters, to recognize the key
+	Permissions []string   `json:"permissions" firestore:"permissions"`
+	Status      string     `json:"status" firestore:"status"` // active, revoked
+	CreatedBy   string     `json:"createdBy" firestore:"createdBy"`
+	ExpiresAt   time.Time  `json:"expiresAt" firestore:"expiresAt"`
+	LastUsedAt  *time.Time `json:"lastUsedAt" firestore:"lastUsedAt"`
+	LastUsedIP  string     `json:"lastUsedIp" firestore:"lastUsedIp"`
+	RotatedFrom string     `json:"rotatedFrom" firestore:"rotatedFrom"`
+	RotatedTo   string     `json:"rotatedTo" firestore:"rotatedTo"`
+	RevokedBy   string     `json:"revokedBy" firestore:"revokedBy"`
+	RevokedAt   *time.Time `json:"revokedAt" firestore:"revokedAt"`
+	CreatedAt   time.Time  `json:"createdAt" firestore:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt" firestore:"updatedAt"`
+}
+
+type APIKeyCreateRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	Permissions   []string `json:"permissions" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expiresInDays" binding:"omitempty,min=1,max=365"`
+}
+
+// APIKeyRotateRequest keeps the old key working for GraceHours so clients
+// can be switched over without downtime.
+type APIKeyRotateRequest struct {
+	GraceHours int `json:"graceHours" binding:"omitempty,min=0,max=168"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type AuditLog struct {
+	ID         string                 `json:"id" firestore:"id"`
+	Action     string                 `json:"action" firestore:"action"` // e.g. invitation.create, invitation.use
+	ActorID    string                 `json:"actorId" firestore:"actorId"`
+	ActorEmail string                 `json:"actorEmail" firestore:"actorEmail"`
+	TargetType string                 `json:"targetType" firestore:"targetType"`
+	TargetID   string                 `json:"targetId" firestore:"targetId"`
+	Details    map[string]interface{} `json:"details" firestore:"details"`
+	IPAddress  string                 `json:"ipAddress" firestore:"ipAddress"`
+	CreatedAt  time.Time              `json:"createdAt" firestore:"createdAt"`
+}
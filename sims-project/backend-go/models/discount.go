@@ -0,0 +1,89 @@
+package models
+
+import "time"
+
+// DiscountRule reduces the payments generated from fee schedules. Every
+// condition that is set must hold; empty conditions match all students.
+type DiscountRule struct {
+	ID              string    `json:"id" firestore:"id"`
+	Name            string    `json:"name" firestore:"name"`
+	Description     string    `json:"description" firestore:"description"`
+	Kind            string    `json:"kind" firestore:"kind"` // discount, scholarship
+	Type            string    `json:"type" firestore:"type"` // percentage, fixed
+	Percent         int       `json:"percent" firestore:"percent"`
+	Amount          int64     `json:"amount" firestore:"amount"` // minor units of Currency, fixed rules only
+	Currency        string    `json:"currency" firestore:"currency"`
+	StudentIDs      []string  `json:"studentIds" firestore:"studentIds"`
+	MinSiblingOrder int       `json:"minSiblingOrder" firestore:"minSiblingOrder"` // 2 = second child of a family and younger
+	PaymentTypes    []string  `json:"paymentTypes" firestore:"paymentTypes"`
+	AcademicYear    string    `json:"academicYear" firestore:"academicYear"`
+	IsActive        bool      `json:"isActive" firestore:"isActive"`
+	CreatedBy       string    `json:"createdBy" firestore:"createdBy"`
+	CreatedAt       time.Time `json:"createdAt" firestore:"createdAt"`
+	UpdatedAt       time.Time `json:"updatedAt" firestore:"updatedAt"`
+}
+
+type DiscountRuleCreateRequest struct {
+	Name            string   `json:"name" binding:"required"`
+	Description     string   `json:"description"`
+	Kind            string   `json:"kind" binding:"required,oneof=discount scholarship"`
+	Type            string   `json:"type" binding:"required,oneof=percentage fixed"`
+	Percent         int      `json:"percent" binding:"required_if=Type percentage,omitempty,min=1,max=100"`
+	Amount          int64    `json:"amount" binding:"required_if=Type fixed,omitempty,gt=0"`
+	Currency        string   `json:"currency"`
+	StudentIDs      []string `json:"studentIds" binding:"max=500"`
+	MinSiblingOrder int      `json:"minSiblingOrder" binding:"omitempty,min=2,max=10"`
+	PaymentTypes    []string `json:"paymentTypes" binding:"max=20"`
+	AcademicYear    string   `json:"academicYear"`
+}
+
+// DiscountRuleUpdateRequest cannot change kind, type or currency; create a
+// new rule instead.
+type DiscountRuleUpdateRequest struct {
+	Name            *string   `json:"name"`
+	Description     *string   `json:"description"`
+	Percent         *int      `json:"percent" binding:"omitempty,min=1,max=100"`
+	Amount          *int64    `json:"amount" binding:"omitempty,gt=0"`
+	StudentIDs      *[]string `json:"studentIds" binding:"omitempty,max=500"`
+	MinSiblingOrder *int      `json:"minSiblingOrder" binding:"omitempty,min=2,max=10"`
+	PaymentTypes    *[]string `json:"paymentTypes" binding:"omitempty,max=20"`
+	AcademicYear    *string   `json:"academicYear"`
+	IsActive        *bool     `json:"isActive"`
+}
+
+// PaymentAdjustment is one reduction of a payment's gross amount.
+type PaymentAdjustment struct {
+	Kind        string `json:"kind" firestore:"kind"`         // discount, scholarship, waiver
+	SourceID    string `json:"sourceId" firestore:"sourceId"` // discount rule or waiver
+	Description string `json:"description" firestore:"description"`
+	Amount      int64  `json:"amount" firestore:"amount"`
+}
+
+// PaymentWaiver is a one-off reduction of a payment, stored at
+// payment_waivers/{id}. It takes effect once someone with a different role
+// than the requester approves it.
+type PaymentWaiver struct {
+	ID            string     `json:"id" firestore:"id"`
+	PaymentID     string     `json:"paymentId" firestore:"paymentId"`
+	StudentID     string     `json:"studentId" firestore:"studentId"`
+	Amount        int64      `json:"amount" firestore:"amount"`
+	Currency      string     `json:"currency" firestore:"currency"`
+	Reason        string     `json:"reason" firestore:"reason"`
+	Status        string     `json:"status" firestore:"status"` // pending, approved, rejected
+	RequestedBy   string     `json:"requestedBy" firestore:"requestedBy"`
+	RequestedRole string     `json:"requestedRole" firestore:"requestedRole"`
+	ReviewedBy    string     `json:"reviewedBy,omitempty" firestore:"reviewedBy,omitempty"`
+	ReviewedRole  string     `json:"reviewedRole,omitempty" firestore:"reviewedRole,omitempty"`
+	ReviewNote    string     `json:"reviewNote,omitempty" firestore:"reviewNote,omitempty"`
+	ReviewedAt    *time.Time `json:"reviewedAt,omitempty" firestore:"reviewedAt,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt" firestore:"createdAt"`
+}
+
+type PaymentWaiverCreateRequest struct {
+	Amount int64  `json:"amount" binding:"required,gt=0"`
+	Reason string `json:"reason" binding:"required"`
+}
+
+type PaymentWaiverReviewRequest struct {
+	Note string `json:"note"`
+}
@@ -0,0 +1,93 @@
+package models
+
+import "time"
+
+// FeeSchedule describes a recurring fee charged to every student of the
+// targeted grade levels or classes, e.g. monthly SPP tuition.
+type FeeSchedule struct {
+	ID           string    `json:"id" firestore:"id"`
+	Name         string    `json:"name" firestore:"name"`
+	Description  string    `json:"description" firestore:"description"`
+	PaymentType  string    `json:"paymentType" firestore:"paymentType"`
+	Amount       int64     `json:"amount" firestore:"amount"` // minor units of Currency
+	Currency     string    `json:"currency" firestore:"currency"`
+	Frequency    string    `json:"frequency" firestore:"frequency"` // monthly, semester, once
+	DueDay       int       `json:"dueDay" firestore:"dueDay"`       // day of month for monthly fees
+	Grades       []string  `json:"grades" firestore:"grades"`
+	ClassIDs     []string  `json:"classIds" firestore:"classIds"`
+	AcademicYear string    `json:"academicYear" firestore:"academicYear"`
+	Semester     string    `json:"semester" firestore:"semester"`
+	IsActive     bool      `json:"isActive" firestore:"isActive"`
+	MinorUnits   bool      `json:"-" firestore:"minorUnits"`
+	CreatedBy    string    `json:"createdBy" firestore:"createdBy"`
+	CreatedAt    time.Time `json:"createdAt" firestore:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt" firestore:"updatedAt"`
+}
+
+type FeeScheduleCreateRequest struct {
+	Name         string   `json:"name" binding:"required"`
+	Description  string   `json:"description"`
+	PaymentType  string   `json:"paymentType" binding:"required"`
+	Amount       int64    `json:"amount" binding:"required,gt=0"`
+	Currency     string   `json:"currency"`
+	Frequency    string   `json:"frequency" binding:"required,oneof=monthly semester once"`
+	DueDay       int      `json:"dueDay" binding:"omitempty,min=1,max=28"`
+	Grades       []string `json:"grades" binding:"max=30"`
+	ClassIDs     []string `json:"classIds"`
+	AcademicYear string   `json:"academicYear" binding:"required"`
+	Semester     string   `json:"semester"`
+}
+
+type FeeScheduleUpdateRequest struct {
+	Name         *string   `json:"name"`
+	Description  *string   `json:"description"`
+	PaymentType  *string   `json:"paymentType"`
+	Amount       *int64    `json:"amount" binding:"omitempty,gt=0"`
+	DueDay       *int      `json:"dueDay" binding:"omitempty,min=1,max=28"`
+	Grades       *[]string `json:"grades" binding:"omitempty,max=30"`
+	ClassIDs     *[]string `json:"classIds"`
+	AcademicYear *string   `json:"academicYear"`
+	Semester     *string   `json:"semester"`
+	IsActive     *bool     `json:"isActive"`
+}
+
+// FeeGenerateRequest selects the period to bill. Monthly schedules use
+// YYYY-MM, semester schedules the semester name; one-off fees need none.
+type FeeGenerateRequest struct {
+	Period   string     `json:"period"`
+	DueDate  *time.Time `json:"dueDate"`
+	Semester string     `json:"semester"`
+}
+
+// FeeGenerationItem is one payment a generation run creates or found
+// already created for the period.
+type FeeGenerationItem struct {
+	PaymentID   string              `json:"paymentId"`
+	StudentID   string              `json:"studentId"`
+	StudentName string              `json:"studentName"`
+	ClassID     string              `json:"classId"`
+	GrossAmount int64               `json:"grossAmount"`
+	Amount      int64               `json:"amount"` // after discounts
+	Adjustments []PaymentAdjustment `json:"adjustments,omitempty"`
+	Exists      bool                `json:"exists"`
+}
+
+type FeeGenerationSkip struct {
+	StudentID string `json:"studentId"`
+	ClassID   string `json:"classId"`
+	Reason    string `json:"reason"`
+}
+
+type FeeGenerationResult struct {
+	ScheduleID    string              `json:"scheduleId"`
+	Period        string              `json:"period"`
+	DueDate       time.Time           `json:"dueDate"`
+	DryRun        bool                `json:"dryRun"`
+	Items         []FeeGenerationItem `json:"items"`
+	Skipped       []FeeGenerationSkip `json:"skipped"`
+	Created       int                 `json:"created"`
+	Existing      int                 `json:"existing"`
+	Currency      string              `json:"currency"`
+	TotalAmount   int64               `json:"totalAmount"`
+	TotalDiscount int64               `json:"totalDiscount"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// PaymentCharge is a payment link or virtual account opened at the online
+// payment gateway, stored at payment_charges/{orderId}. The order ID is what
+// the gateway sends back in its webhooks.
+type PaymentCharge struct {
+	ID            string     `json:"id" firestore:"id"` // order ID
+	PaymentID     string     `json:"paymentId" firestore:"paymentId"`
+	StudentID     string     `json:"studentId" firestore:"studentId"`
+	Provider      string     `json:"provider" firestore:"provider"`
+	ProviderRef   string     `json:"providerRef" firestore:"providerRef"`
+	Method        string     `json:"method" firestore:"method"` // link, virtual_account
+	Amount        int64      `json:"amount" firestore:"amount"`
+	Currency      string     `json:"currency" firestore:"currency"`
+	PaymentURL    string     `json:"paymentUrl,omitempty" firestore:"paymentUrl,omitempty"`
+	VANumber      string     `json:"vaNumber,omitempty" firestore:"vaNumber,omitempty"`
+	Bank          string     `json:"bank,omitempty" firestore:"bank,omitempty"`
+	Status        string     `json:"status" firestore:"status"` // pending, paid, expired, failed
+	ExpiresAt     time.Time  `json:"expiresAt" firestore:"expiresAt"`
+	PaidAt        *time.Time `json:"paidAt" firestore:"paidAt"`
+	PaidAmount    int64      `json:"paidAmount" firestore:"paidAmount"`
+	Overpayment   int64      `json:"overpayment" firestore:"overpayment"` // received but not applied to the payment
+	TransactionID string     `json:"transactionId,omitempty" firestore:"transactionId,omitempty"`
+	CreatedBy     string     `json:"createdBy" firestore:"createdBy"`
+	CreatedAt     time.Time  `json:"createdAt" firestore:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt" firestore:"updatedAt"`
+}
+
+type PaymentChargeCreateRequest struct {
+	Method         string `json:"method" binding:"required,oneof=link virtual_account"`
+	Bank           string `json:"bank" binding:"required_if=Method virtual_account,omitempty,oneof=bca bni bri permata cimb"`
+	ExpiresInHours int    `json:"expiresInHours" binding:"omitempty,min=1,max=720"`
+}
+
+// GatewayEvent is a webhook as received, stored at gateway_events/{id}
+// where the ID is derived from the provider's event ID, so redeliveries
+// land on the same document. Body and headers are kept verbatim so the
+// event can be verified and replayed later.
+type GatewayEvent struct {
+	ID          string            `json:"id" firestore:"id"`
+	Provider    string            `json:"provider" firestore:"provider"`
+	EventID     string            `json:"eventId" firestore:"eventId"`
+	OrderID     string            `json:"orderId" firestore:"orderId"`
+	Status      string            `json:"status" firestore:"status"`
+	Amount      int64             `json:"amount" firestore:"amount"`
+	Currency    string            `json:"currency" firestore:"currency"`
+	Body        string            `json:"body" firestore:"body"`
+	Headers     map[string]string `json:"headers" firestore:"headers"`
+	Deliveries  int               `json:"deliveries" firestore:"deliveries"`
+	ReceivedAt  time.Time         `json:"receivedAt" firestore:"receivedAt"`
+	ProcessedAt *time.Time        `json:"processedAt" firestore:"processedAt"`
+	Result      string            `json:"result" firestore:"result"` // paid, duplicate, ignored, pending, expired, failed, currency_mismatch
+	Error       string            `json:"error,omitempty" firestore:"error,omitempty"`
+}
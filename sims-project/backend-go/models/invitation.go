@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+type Invitation struct {
+	ID             string     `json:"id" firestore:"id"`
+	Email          string     `json:"email" firestore:"email"`
+	Role           string     `json:"role" firestore:"role"`
+	Status         string     `json:"status" firestore:"status"` // pending, used, revoked
+	InvitedBy      string     `json:"invitedBy" firestore:"invitedBy"`
+	InvitedByEmail string     `json:"invitedByEmail" firestore:"invitedByEmail"`
+	ExpiresAt      time.Time  `json:"expiresAt" firestore:"expiresAt"`
+	UsedBy         string     `json:"usedBy" firestore:"usedBy"`
+	UsedAt         *time.Time `json:"usedAt" firestore:"usedAt"`
+	RevokedBy      string     `json:"revokedBy" firestore:"revokedBy"`
+	RevokedAt      *time.Time `json:"revokedAt" firestore:"revokedAt"`
+	CreatedAt      time.Time  `json:"createdAt" firestore:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt" firestore:"updatedAt"`
+}
+
+type InvitationCreateRequest struct {
+	Email          string `json:"email" binding:"required,email"`
+	Role           string `json:"role" binding:"required"`
+	ExpiresInHours int    `json:"expiresInHours" binding:"omitempty,min=1,max=720"`
+}
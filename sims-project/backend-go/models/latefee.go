@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// LateFeePolicy charges a penalty on overdue payments of one payment type,
+// stored at late_fee_policies/{paymentType}.
+type LateFeePolicy struct {
+	PaymentType string    `json:"paymentType" firestore:"paymentType"`
+	Description string    `json:"description" firestore:"description"`
+	Type        string    `json:"type" firestore:"type"`       // flat, percentage
+	Amount      int64     `json:"amount" firestore:"amount"`   // minor units of Currency, flat policies only
+	Percent     int       `json:"percent" firestore:"percent"` // of the outstanding balance
+	Currency    string    `json:"currency" firestore:"currency"`
+	GraceDays   int       `json:"graceDays" firestore:"graceDays"`
+	MaxAmount   int64     `json:"maxAmount" firestore:"maxAmount"` // cap per penalty, 0 for none
+	IsActive    bool      `json:"isActive" firestore:"isActive"`
+	UpdatedBy   string    `json:"updatedBy" firestore:"updatedBy"`
+	UpdatedAt   time.Time `json:"updatedAt" firestore:"updatedAt"`
+}
+
+type LateFeePolicyRequest struct {
+	Description string `json:"description"`
+	Type        string `json:"type" binding:"required,oneof=flat percentage"`
+	Amount      int64  `json:"amount" binding:"required_if=Type flat,omitempty,gt=0"`
+	Percent     int    `json:"percent" binding:"required_if=Type percentage,omitempty,min=1,max=100"`
+	Currency    string `json:"currency"`
+	GraceDays   int    `json:"graceDays" binding:"min=0,max=365"`
+	MaxAmount   int64  `json:"maxAmount" binding:"min=0"`
+	IsActive    *bool  `json:"isActive"`
+}
+
+// LateFeeAssessRequest evaluates payments as of a moment, now by default.
+type LateFeeAssessRequest struct {
+	AsOf *time.Time `json:"asOf"`
+}
+
+// LateFeeItem is one payment an assessment marks overdue, charges a late
+// fee for, or both.
+type LateFeeItem struct {
+	PaymentID     string    `json:"paymentId"`
+	StudentID     string    `json:"studentId"`
+	PaymentType   string    `json:"paymentType"`
+	DueDate       time.Time `json:"dueDate"`
+	Balance       int64     `json:"balance"`
+	Currency      string    `json:"currency"`
+	MarkOverdue   bool      `json:"markOverdue"`
+	LateFeeID     string    `json:"lateFeeId,omitempty"`
+	LateFeeAmount int64     `json:"lateFeeAmount,omitempty"`
+	GraceUntil    time.Time `json:"graceUntil"`
+}
+
+type LateFeeAssessment struct {
+	AsOf          time.Time     `json:"asOf"`
+	DryRun        bool          `json:"dryRun"`
+	Items         []LateFeeItem `json:"items"`
+	MarkedOverdue int           `json:"markedOverdue"`
+	Charged       int           `json:"charged"`
+}
+
+type LateFeeWaiveRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
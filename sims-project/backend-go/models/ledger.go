@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// LedgerEntry is one movement on a student's account. Debits raise what
+// is owed (charges, late fees, refunds paid out); credits lower it
+// (receipts, discounts, scholarships, waivers, cancellations).
+type LedgerEntry struct {
+	Date          time.Time `json:"date"`
+	Type          string    `json:"type"` // charge, late_fee, discount, scholarship, waiver, receipt, refund, cancellation
+	PaymentID     string    `json:"paymentId"`
+	TransactionID string    `json:"transactionId,omitempty"`
+	Description   string    `json:"description"`
+	Reference     string    `json:"reference,omitempty"`
+	Debit         int64     `json:"debit"`
+	Credit        int64     `json:"credit"`
+	Balance       int64     `json:"balance"` // running, after this entry
+}
+
+// StudentLedger is a student's account in one currency. Entries before
+// From are summed into the opening balance.
+type StudentLedger struct {
+	StudentID      string        `json:"studentId"`
+	StudentName    string        `json:"studentName"`
+	StudentNumber  string        `json:"studentNumber,omitempty"`
+	Currency       string        `json:"currency"`
+	From           *time.Time    `json:"from,omitempty"`
+	To             *time.Time    `json:"to,omitempty"`
+	OpeningBalance int64         `json:"openingBalance"`
+	TotalDebit     int64         `json:"totalDebit"`
+	TotalCredit    int64         `json:"totalCredit"`
+	ClosingBalance int64         `json:"closingBalance"`
+	Entries        []LedgerEntry `json:"entries"`
+	Outstanding    []Payment     `json:"outstanding"` // open payments as of now
+	GeneratedAt    time.Time     `json:"generatedAt"`
+}
+
+// StudentAccount summarises what a student owes, for dashboards.
+type StudentAccount struct {
+	StudentID   string `json:"studentId"`
+	StudentName string `json:"studentName"`
+	Currency    string `json:"currency"`
+	Outstanding int64  `json:"outstanding"`
+	Overdue     int64  `json:"overdue"`
+	Payments    int    `json:"payments"` // open payments
+}
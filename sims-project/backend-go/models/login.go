@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+type LoginHistory struct {
+	ID        string    `json:"id" firestore:"id"`
+	UserID    string    `json:"userId" firestore:"userId"`
+	Email     string    `json:"email" firestore:"email"`
+	Method    string    `json:"method" firestore:"method"` // password, refresh
+	IPAddress string    `json:"ipAddress" firestore:"ipAddress"`
+	UserAgent string    `json:"userAgent" firestore:"userAgent"`
+	CreatedAt time.Time `json:"createdAt" firestore:"createdAt"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
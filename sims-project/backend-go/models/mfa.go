@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// MFAEnrollment is stored under mfa/{uid}. Secrets are encrypted and
+// recovery codes are stored as SHA-256 hashes; none of them leave the server.
+type MFAEnrollment struct {
+	UserID         string     `json:"userId" firestore:"userId"`
+	Enabled        bool       `json:"enabled" firestore:"enabled"`
+	Secret         string     `json:"-" firestore:"secret"`
+	PendingSecret  string     `json:"-" firestore:"pendingSecret"`
+	RecoveryCodes  []string   `json:"-" firestore:"recoveryCodes"`
+	LastUsedStep   int64      `json:"-" firestore:"lastUsedStep"`
+	EnrolledAt     *time.Time `json:"enrolledAt" firestore:"enrolledAt"`
+	LastVerifiedAt *time.Time `json:"lastVerifiedAt" firestore:"lastVerifiedAt"`
+	UpdatedAt      time.Time  `json:"updatedAt" firestore:"updatedAt"`
+}
+
+type MFAActivateRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// MFAVerifyRequest takes either an authenticator code or a recovery code.
+type MFAVerifyRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
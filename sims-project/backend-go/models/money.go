@@ -0,0 +1,88 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Currencies lists the supported ISO 4217 codes with the number of digits
+// of their minor unit. Amounts are stored as integers in that unit, so
+// Rp 150.000 is 15000000 and USD 12.50 is 1250.
+var Currencies = map[string]int{
+	"IDR": 2,
+	"USD": 2,
+	"EUR": 2,
+	"SGD": 2,
+	"MYR": 2,
+	"AUD": 2,
+	"JPY": 0,
+}
+
+func IsValidCurrency(code string) bool {
+	_, ok := Currencies[code]
+	return ok
+}
+
+func currencyExponent(currency string) int {
+	if exponent, ok := Currencies[currency]; ok {
+		return exponent
+	}
+	return 2
+}
+
+// MinorUnits converts an amount in major units, as stored before amounts
+// became integers, to minor units.
+func MinorUnits(amount float64, currency string) int64 {
+	return int64(math.Round(amount * math.Pow10(currencyExponent(currency))))
+}
+
+// FormatAmount renders minor units as a decimal amount in major units,
+// e.g. 15000000 IDR as "150000.00".
+func FormatAmount(amount int64, currency string) string {
+	exponent := currencyExponent(currency)
+	if exponent == 0 {
+		return strconv.FormatInt(amount, 10)
+	}
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	unit := int64(math.Pow10(exponent))
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/unit, exponent, amount%unit)
+}
+
+// ParseAmount converts a decimal amount in major units such as "150000.00"
+// to minor units without going through floating point. More fractional
+// digits than the currency has are rejected unless they are zeros.
+func ParseAmount(s, currency string) (int64, error) {
+	exponent := currencyExponent(currency)
+
+	negative := strings.HasPrefix(s, "-")
+	whole, fraction, _ := strings.Cut(strings.TrimPrefix(s, "-"), ".")
+	fraction = strings.TrimRight(fraction, "0")
+	if whole == "" || len(fraction) > exponent || !isDigits(whole) || !isDigits(fraction) {
+		return 0, fmt.Errorf("invalid %s amount %q", currency, s)
+	}
+
+	amount, err := strconv.ParseInt(whole+fraction+strings.Repeat("0", exponent-len(fraction)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s amount %q", currency, s)
+	}
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
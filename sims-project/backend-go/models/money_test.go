@@ -0,0 +1,95 @@
+package models
+
+import "testing"
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		input    string
+		currency string
+		want     int64
+		valid    bool
+	}{
+		{"150000.00", "IDR", 15000000, true},
+		{"150000", "IDR", 15000000, true},
+		{"12.5", "USD", 1250, true},
+		{"12.50", "USD", 1250, true},
+		{"12.500", "USD", 1250, true},
+		{"0.01", "USD", 1, true},
+		{"1.", "USD", 100, true},
+		{"-12.34", "USD", -1234, true},
+		{"500", "JPY", 500, true},
+		{"500.00", "JPY", 500, true},
+		{"500.5", "JPY", 0, false},
+		{"12.345", "USD", 0, false},
+		{".5", "USD", 0, false},
+		{"", "USD", 0, false},
+		{"-", "USD", 0, false},
+		{"+5", "USD", 0, false},
+		{"1,000.00", "USD", 0, false},
+		{"1e3", "USD", 0, false},
+		{"12.3.4", "USD", 0, false},
+		{"99999999999999999999", "USD", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.input, tt.currency)
+		if (err == nil) != tt.valid {
+			t.Errorf("ParseAmount(%q, %s) error = %v, want valid %v", tt.input, tt.currency, err, tt.valid)
+			continue
+		}
+		if tt.valid && got != tt.want {
+			t.Errorf("ParseAmount(%q, %s) = %d, want %d", tt.input, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		currency string
+		want     string
+	}{
+		{15000000, "IDR", "150000.00"},
+		{1250, "USD", "12.50"},
+		{5, "USD", "0.05"},
+		{0, "USD", "0.00"},
+		{-1234, "USD", "-12.34"},
+		{-5, "USD", "-0.05"},
+		{500, "JPY", "500"},
+		{1250, "XXX", "12.50"},
+	}
+	for _, tt := range tests {
+		if got := FormatAmount(tt.amount, tt.currency); got != tt.want {
+			t.Errorf("FormatAmount(%d, %s) = %q, want %q", tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestFormatParseRoundTrip(t *testing.T) {
+	for currency := range Currencies {
+		for _, amount := range []int64{0, 1, 99, 100, 123456789, -42} {
+			got, err := ParseAmount(FormatAmount(amount, currency), currency)
+			if err != nil || got != amount {
+				t.Errorf("%s %d: round trip gave %d, %v", currency, amount, got, err)
+			}
+		}
+	}
+}
+
+func TestMinorUnits(t *testing.T) {
+	tests := []struct {
+		amount   float64
+		currency string
+		want     int64
+	}{
+		{150000, "IDR", 15000000},
+		{12.5, "USD", 1250},
+		{0.29, "USD", 29},
+		{19.99, "USD", 1999},
+		{500, "JPY", 500},
+	}
+	for _, tt := range tests {
+		if got := MinorUnits(tt.amount, tt.currency); got != tt.want {
+			t.Errorf("MinorUnits(%v, %s) = %d, want %d", tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
@@ -3,27 +3,40 @@ package models
 import "time"
 
 type Payment struct {
-	ID            string    `json:"id" firestore:"id"`
-	StudentID     string    `json:"studentId" firestore:"studentId"`
-	Amount        float64   `json:"amount" firestore:"amount"`
-	Currency      string    `json:"currency" firestore:"currency"`
-	Description   string    `json:"description" firestore:"description"`
-	PaymentType   string    `json:"paymentType" firestore:"paymentType"` // tuition, activity, book, uniform, etc.
-	Status        string    `json:"status" firestore:"status"` // pending, paid, overdue, cancelled
-	DueDate       time.Time `json:"dueDate" firestore:"dueDate"`
-	PaidDate      *time.Time `json:"paidDate" firestore:"paidDate"`
-	PaymentMethod string    `json:"paymentMethod" firestore:"paymentMethod"` // cash, transfer, online
-	Reference     string    `json:"reference" firestore:"reference"`
-	ProcessedBy   string    `json:"processedBy" firestore:"processedBy"`
-	AcademicYear  string    `json:"academicYear" firestore:"academicYear"`
-	Semester      string    `json:"semester" firestore:"semester"`
-	CreatedAt     time.Time `json:"createdAt" firestore:"createdAt"`
-	UpdatedAt     time.Time `json:"updatedAt" firestore:"updatedAt"`
+	ID             string              `json:"id" firestore:"id"`
+	StudentID      string              `json:"studentId" firestore:"studentId"`
+	Amount         int64               `json:"amount" firestore:"amount"` // minor units of Currency, after adjustments
+	GrossAmount    int64               `json:"grossAmount,omitempty" firestore:"grossAmount,omitempty"`
+	Adjustments    []PaymentAdjustment `json:"adjustments,omitempty" firestore:"adjustments,omitempty"`
+	Currency       string              `json:"currency" firestore:"currency"`
+	Description    string              `json:"description" firestore:"description"`
+	PaymentType    string              `json:"paymentType" firestore:"paymentType"` // tuition, activity, book, uniform, etc.
+	Status         string              `json:"status" firestore:"status"`           // pending, partially_paid, paid, overdue, cancelled, refunded
+	DueDate        time.Time           `json:"dueDate" firestore:"dueDate"`
+	PaidDate       *time.Time          `json:"paidDate" firestore:"paidDate"`
+	PaidAmount     int64               `json:"paidAmount" firestore:"paidAmount"` // net of refunds
+	RefundedAmount int64               `json:"refundedAmount,omitempty" firestore:"refundedAmount,omitempty"`
+	Balance        int64               `json:"balance" firestore:"-"` // computed when read
+	Installments   []Installment       `json:"installments,omitempty" firestore:"installments,omitempty"`
+	PaymentMethod  string              `json:"paymentMethod" firestore:"paymentMethod"` // cash, transfer, online
+	Reference      string              `json:"reference" firestore:"reference"`
+	ProcessedBy    string              `json:"processedBy" firestore:"processedBy"`
+	AcademicYear   string              `json:"academicYear" firestore:"academicYear"`
+	Semester       string              `json:"semester" firestore:"semester"`
+	FeeScheduleID  string              `json:"feeScheduleId,omitempty" firestore:"feeScheduleId,omitempty"`
+	Period         string              `json:"period,omitempty" firestore:"period,omitempty"`
+	ReceiptNumber  string              `json:"receiptNumber,omitempty" firestore:"receiptNumber,omitempty"`
+	LateFeeID      string              `json:"lateFeeId,omitempty" firestore:"lateFeeId,omitempty"`   // penalty charged for this payment
+	LateFeeFor     string              `json:"lateFeeFor,omitempty" firestore:"lateFeeFor,omitempty"` // payment this penalty is for
+	MinorUnits     bool                `json:"-" firestore:"minorUnits"`
+	CreatedAt      time.Time           `json:"createdAt" firestore:"createdAt"`
+	UpdatedAt      time.Time           `json:"updatedAt" firestore:"updatedAt"`
 }
 
 type PaymentCreateRequest struct {
 	StudentID     string    `json:"studentId" binding:"required"`
-	Amount        float64   `json:"amount" binding:"required"`
+	Amount        int64     `json:"amount" binding:"required,gt=0"`
+	Currency      string    `json:"currency"`
 	Description   string    `json:"description" binding:"required"`
 	PaymentType   string    `json:"paymentType" binding:"required"`
 	DueDate       time.Time `json:"dueDate" binding:"required"`
@@ -33,23 +46,131 @@ type PaymentCreateRequest struct {
 }
 
 type PaymentUpdateRequest struct {
-	Amount        *float64   `json:"amount"`
+	Amount        *int64     `json:"amount" binding:"omitempty,gt=0"`
 	Description   *string    `json:"description"`
 	PaymentType   *string    `json:"paymentType"`
-	Status        *string    `json:"status"`
+	Status        *string    `json:"status" binding:"omitempty,oneof=pending overdue cancelled"`
 	DueDate       *time.Time `json:"dueDate"`
 	PaidDate      *time.Time `json:"paidDate"`
 	PaymentMethod *string    `json:"paymentMethod"`
 	Reference     *string    `json:"reference"`
 }
 
+// PaymentTransitions lists the statuses a payment may move to from each
+// status. A paid payment can only be refunded; cancelled and refunded
+// payments are final. Refunds and amount changes may also reopen a payment
+// to the status its paid amount implies, which is not listed here.
+var PaymentTransitions = map[string][]string{
+	"pending":        {"partially_paid", "paid", "overdue", "cancelled"},
+	"overdue":        {"partially_paid", "paid", "pending", "cancelled", "refunded"},
+	"partially_paid": {"paid", "overdue", "refunded"},
+	"paid":           {"refunded"},
+	"cancelled":      {},
+	"refunded":       {},
+}
+
+// CanTransitionPayment reports whether a payment may move from one status
+// to another. Staying in the same status is always allowed.
+func CanTransitionPayment(from, to string) bool {
+	if from == to {
+		return true
+	}
+	for _, allowed := range PaymentTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Outstanding returns the amount still owed on the payment.
+func (p *Payment) Outstanding() int64 {
+	return p.Amount - p.PaidAmount
+}
+
+// SettledStatus is the status implied by the amount paid so far.
+func (p *Payment) SettledStatus() string {
+	switch {
+	case p.Outstanding() <= 0:
+		// Includes payments waived in full
+		return "paid"
+	case p.PaidAmount <= 0:
+		return "pending"
+	default:
+		return "partially_paid"
+	}
+}
+
+// Installment is one scheduled part of a payment. Receipts are allocated to
+// installments in due date order.
+type Installment struct {
+	Number     int       `json:"number" firestore:"number"`
+	Amount     int64     `json:"amount" firestore:"amount"`
+	DueDate    time.Time `json:"dueDate" firestore:"dueDate"`
+	PaidAmount int64     `json:"paidAmount" firestore:"paidAmount"`
+	Status     string    `json:"status" firestore:"status"` // pending, partially_paid, paid
+}
+
+// InstallmentPlanRequest splits a payment either into explicit parts or
+// into count equal monthly parts starting at firstDueDate.
+type InstallmentPlanRequest struct {
+	Installments []InstallmentRequest `json:"installments" binding:"omitempty,min=2,max=24,dive"`
+	Count        int                  `json:"count" binding:"omitempty,min=2,max=24"`
+	FirstDueDate *time.Time           `json:"firstDueDate"`
+}
+
+type InstallmentRequest struct {
+	Amount  int64     `json:"amount" binding:"required,gt=0"`
+	DueDate time.Time `json:"dueDate" binding:"required"`
+}
+
+// PaymentTransaction records one receipt against a payment, stored at
+// payments/{paymentId}/transactions/{id}. Transactions are never changed;
+// money paid back is recorded as a refund entry with a negative amount.
+type PaymentTransaction struct {
+	ID          string    `json:"id" firestore:"id"`
+	PaymentID   string    `json:"paymentId" firestore:"paymentId"`
+	StudentID   string    `json:"studentId" firestore:"studentId"`
+	Kind        string    `json:"kind,omitempty" firestore:"kind,omitempty"` // refund, empty for receipts
+	Amount      int64     `json:"amount" firestore:"amount"`
+	Reverses    string    `json:"reverses,omitempty" firestore:"reverses,omitempty"` // receipt a refund pays back
+	RefundID    string    `json:"refundId,omitempty" firestore:"refundId,omitempty"`
+	Currency    string    `json:"currency" firestore:"currency"`
+	Method      string    `json:"method" firestore:"method"` // cash, transfer, online
+	Reference   string    `json:"reference" firestore:"reference"`
+	Note        string    `json:"note" firestore:"note"`
+	ProcessedBy string    `json:"processedBy" firestore:"processedBy"`
+	ReceivedAt  time.Time `json:"receivedAt" firestore:"receivedAt"`
+	MinorUnits  bool      `json:"-" firestore:"minorUnits"`
+	CreatedAt   time.Time `json:"createdAt" firestore:"createdAt"`
+}
+
+type PaymentTransactionCreateRequest struct {
+	Amount     int64      `json:"amount" binding:"required,gt=0"`
+	Method     string     `json:"method" binding:"required,oneof=cash transfer online"`
+	Reference  string     `json:"reference"`
+	Note       string     `json:"note"`
+	ReceivedAt *time.Time `json:"receivedAt"`
+}
+
+// PaymentStats aggregates payments of one currency. Cancelled and refunded
+// payments are left out of the totals; pending and overdue amounts are
+// what is still owed.
 type PaymentStats struct {
-	TotalAmount     float64 `json:"totalAmount"`
-	PaidAmount      float64 `json:"paidAmount"`
-	PendingAmount   float64 `json:"pendingAmount"`
-	OverdueAmount   float64 `json:"overdueAmount"`
-	TotalPayments   int     `json:"totalPayments"`
-	PaidPayments    int     `json:"paidPayments"`
-	PendingPayments int     `json:"pendingPayments"`
-	OverduePayments int     `json:"overduePayments"`
+	Currency              string `json:"currency"`
+	TotalAmount           int64  `json:"totalAmount"`
+	PaidAmount            int64  `json:"paidAmount"`
+	PendingAmount         int64  `json:"pendingAmount"`
+	OverdueAmount         int64  `json:"overdueAmount"`
+	TotalPayments         int    `json:"totalPayments"`
+	PaidPayments          int    `json:"paidPayments"`
+	PendingPayments       int    `json:"pendingPayments"`
+	PartiallyPaidPayments int    `json:"partiallyPaidPayments"`
+	OverduePayments       int    `json:"overduePayments"`
+	LateFeeAmount         int64  `json:"lateFeeAmount"` // charged, after waivers
+	LateFeePaidAmount     int64  `json:"lateFeePaidAmount"`
+	LateFeeWaivedAmount   int64  `json:"lateFeeWaivedAmount"`
+	LateFeePayments       int    `json:"lateFeePayments"`
+	RefundedAmount        int64  `json:"refundedAmount"`
+	RefundedPayments      int    `json:"refundedPayments"`
 }
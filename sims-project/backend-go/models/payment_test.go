@@ -0,0 +1,56 @@
+package models
+
+import "testing"
+
+func TestCanTransitionPayment(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{"pending", "pending", true},
+		{"pending", "partially_paid", true},
+		{"pending", "paid", true},
+		{"pending", "overdue", true},
+		{"pending", "cancelled", true},
+		{"pending", "refunded", false},
+		{"overdue", "pending", true},
+		{"overdue", "refunded", true},
+		{"partially_paid", "paid", true},
+		{"partially_paid", "refunded", true},
+		{"partially_paid", "pending", false},
+		{"partially_paid", "cancelled", false},
+		{"paid", "refunded", true},
+		{"paid", "pending", false},
+		{"paid", "partially_paid", false},
+		{"paid", "overdue", false},
+		{"paid", "cancelled", false},
+		{"cancelled", "pending", false},
+		{"cancelled", "paid", false},
+		{"refunded", "paid", false},
+		{"refunded", "pending", false},
+		{"unknown", "paid", false},
+	}
+	for _, tt := range tests {
+		if got := CanTransitionPayment(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransitionPayment(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestSettledStatus(t *testing.T) {
+	tests := []struct {
+		amount, paid int64
+		want         string
+	}{
+		{1000, 0, "pending"},
+		{1000, 400, "partially_paid"},
+		{1000, 1000, "paid"},
+		{0, 0, "paid"},
+	}
+	for _, tt := range tests {
+		payment := Payment{Amount: tt.amount, PaidAmount: tt.paid}
+		if got := payment.SettledStatus(); got != tt.want {
+			t.Errorf("amount %d, paid %d: SettledStatus = %s, want %s", tt.amount, tt.paid, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// RolePermissions is stored under role_permissions/{role} and overrides the
+// default permissions of that role.
+type RolePermissions struct {
+	Role        string    `json:"role" firestore:"role"`
+	Permissions []string  `json:"permissions" firestore:"permissions"`
+	UpdatedBy   string    `json:"updatedBy" firestore:"updatedBy"`
+	UpdatedAt   time.Time `json:"updatedAt" firestore:"updatedAt"`
+}
+
+type RolePermissionsUpdateRequest struct {
+	Permissions []string `json:"permissions" binding:"required"`
+}
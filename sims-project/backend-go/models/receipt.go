@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Receipt tracks the receipt issued for a paid payment, stored at
+// receipts/{paymentId}. Numbers come from receipt_counters/{year} and are
+// gap-free per academic year.
+type Receipt struct {
+	PaymentID     string     `json:"paymentId" firestore:"paymentId"`
+	Number        string     `json:"number" firestore:"number"`
+	AcademicYear  string     `json:"academicYear" firestore:"academicYear"`
+	Sequence      int64      `json:"sequence" firestore:"sequence"`
+	IssuedAt      time.Time  `json:"issuedAt" firestore:"issuedAt"`
+	Prints        int        `json:"prints" firestore:"prints"`
+	LastPrintedAt *time.Time `json:"lastPrintedAt" firestore:"lastPrintedAt"`
+	LastPrintedBy string     `json:"lastPrintedBy" firestore:"lastPrintedBy"`
+}
+
+type ReceiptCounter struct {
+	AcademicYear string    `json:"academicYear" firestore:"academicYear"`
+	Last         int64     `json:"last" firestore:"last"`
+	UpdatedAt    time.Time `json:"updatedAt" firestore:"updatedAt"`
+}
@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+// BankStatement is an imported bank statement file, stored at
+// bank_statements/{id}. Its lines are stored in statement_lines.
+type BankStatement struct {
+	ID         string    `json:"id" firestore:"id"`
+	FileName   string    `json:"fileName" firestore:"fileName"`
+	Format     string    `json:"format" firestore:"format"` // csv, mt940
+	Account    string    `json:"account" firestore:"account"`
+	Currency   string    `json:"currency" firestore:"currency"`
+	Lines      int       `json:"lines" firestore:"lines"`
+	Duplicates int       `json:"duplicates" firestore:"duplicates"` // already imported with an earlier file
+	Debits     int       `json:"debits" firestore:"debits"`         // outgoing, not imported
+	Matched    int       `json:"matched" firestore:"matched"`
+	Review     int       `json:"review" firestore:"review"`
+	Unmatched  int       `json:"unmatched" firestore:"unmatched"`
+	Confirmed  int       `json:"confirmed" firestore:"confirmed"`
+	ImportedBy string    `json:"importedBy" firestore:"importedBy"`
+	ImportedAt time.Time `json:"importedAt" firestore:"importedAt"`
+}
+
+// StatementLine is one incoming transfer, stored at statement_lines/{id}.
+// The ID is a fingerprint of the line, so importing overlapping statements
+// does not create the same transfer twice.
+type StatementLine struct {
+	ID            string           `json:"id" firestore:"id"`
+	StatementID   string           `json:"statementId" firestore:"statementId"`
+	LineNumber    int              `json:"lineNumber" firestore:"lineNumber"`
+	Date          time.Time        `json:"date" firestore:"date"`
+	Amount        int64            `json:"amount" firestore:"amount"`
+	Currency      string           `json:"currency" firestore:"currency"`
+	Reference     string           `json:"reference" firestore:"reference"`
+	Description   string           `json:"description" firestore:"description"`
+	Name          string           `json:"name" firestore:"name"`
+	BankRef       string           `json:"bankRef" firestore:"bankRef"`
+	Status        string           `json:"status" firestore:"status"` // matched, review, unmatched, confirmed, ignored
+	PaymentID     string           `json:"paymentId,omitempty" firestore:"paymentId,omitempty"`
+	Candidates    []MatchCandidate `json:"candidates" firestore:"candidates"`
+	TransactionID string           `json:"transactionId,omitempty" firestore:"transactionId,omitempty"`
+	ResolvedBy    string           `json:"resolvedBy,omitempty" firestore:"resolvedBy,omitempty"`
+	ResolvedAt    *time.Time       `json:"resolvedAt,omitempty" firestore:"resolvedAt,omitempty"`
+	Note          string           `json:"note,omitempty" firestore:"note,omitempty"`
+	CreatedAt     time.Time        `json:"createdAt" firestore:"createdAt"`
+}
+
+// MatchCandidate is an open payment the line may be paying for.
+type MatchCandidate struct {
+	PaymentID string   `json:"paymentId" firestore:"paymentId"`
+	StudentID string   `json:"studentId" firestore:"studentId"`
+	Balance   int64    `json:"balance" firestore:"balance"`
+	Score     int      `json:"score" firestore:"score"`
+	Reasons   []string `json:"reasons" firestore:"reasons"` // reference, amount, installment, student
+}
+
+// StatementLineConfirmRequest applies a line to a payment. Without a
+// payment ID the suggested match is confirmed.
+type StatementLineConfirmRequest struct {
+	PaymentID string `json:"paymentId"`
+	Note      string `json:"note"`
+}
+
+type StatementLineIgnoreRequest struct {
+	Note string `json:"note" binding:"required"`
+}
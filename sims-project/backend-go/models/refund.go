@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// PaymentRefund pays money received for a payment back to the payer,
+// stored at payment_refunds/{id}. Like waivers it takes effect once someone
+// with a different role than the requester approves it; approval records a
+// refund entry in the payment's transactions.
+type PaymentRefund struct {
+	ID            string     `json:"id" firestore:"id"`
+	PaymentID     string     `json:"paymentId" firestore:"paymentId"`
+	StudentID     string     `json:"studentId" firestore:"studentId"`
+	Amount        int64      `json:"amount" firestore:"amount"`
+	Currency      string     `json:"currency" firestore:"currency"`
+	Method        string     `json:"method" firestore:"method"`   // cash, transfer
+	Account       string     `json:"account" firestore:"account"` // where a transfer is sent
+	Reason        string     `json:"reason" firestore:"reason"`
+	TransactionID string     `json:"transactionId,omitempty" firestore:"transactionId,omitempty"`
+	CancelPayment bool       `json:"cancelPayment" firestore:"cancelPayment"`
+	Status        string     `json:"status" firestore:"status"` // pending, approved, rejected
+	RequestedBy   string     `json:"requestedBy" firestore:"requestedBy"`
+	RequestedRole string     `json:"requestedRole" firestore:"requestedRole"`
+	ReviewedBy    string     `json:"reviewedBy,omitempty" firestore:"reviewedBy,omitempty"`
+	ReviewedRole  string     `json:"reviewedRole,omitempty" firestore:"reviewedRole,omitempty"`
+	ReviewNote    string     `json:"reviewNote,omitempty" firestore:"reviewNote,omitempty"`
+	ReviewedAt    *time.Time `json:"reviewedAt,omitempty" firestore:"reviewedAt,omitempty"`
+	ReversalID    string     `json:"reversalId,omitempty" firestore:"reversalId,omitempty"` // refund entry in the payment's transactions
+	CreatedAt     time.Time  `json:"createdAt" firestore:"createdAt"`
+}
+
+// PaymentRefundCreateRequest refunds part of what was paid, or with
+// cancelPayment everything, closing the payment as refunded. The amount
+// defaults to everything paid when cancelling.
+type PaymentRefundCreateRequest struct {
+	Amount        int64  `json:"amount" binding:"required_without=CancelPayment,omitempty,gt=0"`
+	Method        string `json:"method" binding:"required,oneof=cash transfer"`
+	Account       string `json:"account" binding:"required_if=Method transfer"`
+	Reason        string `json:"reason" binding:"required"`
+	TransactionID string `json:"transactionId"`
+	CancelPayment bool   `json:"cancelPayment"`
+}
+
+type PaymentRefundReviewRequest struct {
+	Note string `json:"note"`
+}
@@ -0,0 +1,6 @@
+package models
+
+type RevokeSessionsRequest struct {
+	UserID string `json:"userId"`
+	Role   string `json:"role"`
+}
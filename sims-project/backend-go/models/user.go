@@ -2,6 +2,26 @@ package models
 
 import "time"
 
+var ValidRoles = []string{
+	"admin",
+	"teacher",
+	"student",
+	"parent",
+	"vice_principal",
+	"treasurer",
+	"exam_supervisor",
+	"school_health",
+}
+
+func IsValidRole(role string) bool {
+	for _, r := range ValidRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
 type User struct {
 	ID               string     `json:"id" firestore:"id"`
 	Email            string     `json:"email" firestore:"email"`
@@ -16,6 +36,7 @@ type User struct {
 	StudentID        string     `json:"studentId" firestore:"studentId"`
 	ClassID          string     `json:"classId" firestore:"classId"`
 	ParentID         string     `json:"parentId" firestore:"parentId"`
+	InvitedBy        string     `json:"invitedBy" firestore:"invitedBy"`
 	IsActive         bool       `json:"isActive" firestore:"isActive"`
 	LastLogin        *time.Time `json:"lastLogin" firestore:"lastLogin"`
 	CreatedAt        time.Time  `json:"createdAt" firestore:"createdAt"`
@@ -78,9 +99,8 @@ type UpdateProfileRequest struct {
 }
 
 type SignUpRequest struct {
-	Email       string `json:"email" binding:"required,email"`
-	Password    string `json:"password" binding:"required,min=6"`
-	DisplayName string `json:"displayName" binding:"required"`
-	Role        string `json:"role" binding:"required"`
-	SecretKey   string `json:"secretKey" binding:"required"`
+	Email          string `json:"email" binding:"required,email"`
+	Password       string `json:"password" binding:"required"`
+	DisplayName    string `json:"displayName" binding:"required"`
+	InvitationCode string `json:"invitationCode" binding:"required"`
 }
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+type EmailVerification struct {
+	ID         string     `json:"id" firestore:"id"`
+	UserID     string     `json:"userId" firestore:"userId"`
+	Email      string     `json:"email" firestore:"email"`
+	Status     string     `json:"status" firestore:"status"` // pending, verified
+	SendCount  int        `json:"sendCount" firestore:"sendCount"`
+	LastSentAt *time.Time `json:"lastSentAt" firestore:"lastSentAt"`
+	VerifiedAt *time.Time `json:"verifiedAt" firestore:"verifiedAt"`
+	UpdatedAt  time.Time  `json:"updatedAt" firestore:"updatedAt"`
+}
+
+type PasswordResetRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
@@ -0,0 +1,297 @@
+package routes
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"sims-backend-go/apperrors"
+	"sims-backend-go/config"
+	"sims-backend-go/models"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+)
+
+const defaultAPIKeyTTL = 90 * 24 * time.Hour
+
+var errAPIKeyNotActive = errors.New("api key is not active")
+
+// generateAPIKey returns a new key and the prefix shown in listings.
+func generateAPIKey() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	key := config.APIKeyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	return key, key[:len(config.APIKeyPrefix)+8], nil
+}
+
+// validateAPIKeyScopes returns the scopes that cannot be granted to a key.
+func validateAPIKeyScopes(permissions []string) []string {
+	var invalid []string
+	for _, permission := range permissions {
+		if !config.IsAPIKeyPermission(permission) {
+			invalid = append(invalid, permission)
+		}
+	}
+	return invalid
+}
+
+func GetAPIKeys(c *gin.Context) {
+	ctx := c.Request.Context()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	query := client.Collection("api_keys").Query
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status", "==", status)
+	}
+
+	iter := query.OrderBy("createdAt", firestore.Desc).Documents(ctx)
+	var keys []models.APIKey
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			c.Error(apperrors.Internal(err, "Failed to fetch API keys"))
+			return
+		}
+
+		var key models.APIKey
+		doc.DataTo(&key)
+		key.ID = doc.Ref.ID
+		keys = append(keys, key)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"apiKeys": keys})
+}
+
+// CreateAPIKey issues a key for a machine client. The key is only returned
+// in this response; only its hash is stored.
+func CreateAPIKey(c *gin.Context) {
+	var req models.APIKeyCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	if invalid := validateAPIKeyScopes(req.Permissions); len(invalid) > 0 {
+		c.Error(apperrors.BadRequest("Permissions not available to API keys").With("invalid", invalid))
+		return
+	}
+
+	user, _ := c.Get("user")
+	token := user.(*auth.Token)
+
+	ttl := defaultAPIKeyTTL
+	if req.ExpiresInDays > 0 {
+		ttl = time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	}
+
+	ctx := c.Request.Context()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	rawKey, key, err := createAPIKey(ctx, client, models.APIKey{
+		Name:        req.Name,
+		Permissions: req.Permissions,
+		CreatedBy:   token.UID,
+		ExpiresAt:   time.Now().Add(ttl),
+	})
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to create API key"))
+		return
+	}
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "api_key.create",
+		TargetType: "api_key",
+		TargetID:   key.ID,
+		Details: map[string]interface{}{
+			"name":        key.Name,
+			"permissions": key.Permissions,
+			"expiresAt":   key.ExpiresAt,
+		},
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"apiKey": key,
+		"key":    rawKey,
+	})
+}
+
+func createAPIKey(ctx context.Context, client *firestore.Client, key models.APIKey) (string, models.APIKey, error) {
+	rawKey, prefix, err := generateAPIKey()
+	if err != nil {
+		return "", key, err
+	}
+
+	now := time.Now()
+	key.ID = config.HashAPIKey(rawKey)
+	key.Prefix = prefix
+	key.Status = "active"
+	key.CreatedAt = now
+	key.UpdatedAt = now
+
+	if _, err := client.Collection("api_keys").Doc(key.ID).Create(ctx, key); err != nil {
+		return "", key, err
+	}
+	return rawKey, key, nil
+}
+
+// RotateAPIKey issues a replacement with the same name and scopes. The old
+// key stops working after the grace period (immediately by default).
+func RotateAPIKey(c *gin.Context) {
+	keyID := c.Param("id")
+
+	var req models.APIKeyRotateRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	user, _ := c.Get("user")
+	token := user.(*auth.Token)
+
+	ctx := c.Request.Context()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	doc, err := client.Collection("api_keys").Doc(keyID).Get(ctx)
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "API key not found", "Failed to fetch API key"))
+		return
+	}
+
+	var old models.APIKey
+	doc.DataTo(&old)
+	old.ID = keyID
+
+	now := time.Now()
+	if old.Status != "active" || now.After(old.ExpiresAt) {
+		c.Error(apperrors.Conflict("Only active API keys can be rotated"))
+		return
+	}
+
+	// The replacement keeps the lifetime of the original key
+	rawKey, key, err := createAPIKey(ctx, client, models.APIKey{
+		Name:        old.Name,
+		Permissions: old.Permissions,
+		CreatedBy:   token.UID,
+		ExpiresAt:   now.Add(old.ExpiresAt.Sub(old.CreatedAt)),
+		RotatedFrom: old.ID,
+	})
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to create API key"))
+		return
+	}
+
+	update := map[string]interface{}{
+		"rotatedTo": key.ID,
+		"updatedAt": now,
+	}
+	if req.GraceHours > 0 {
+		update["expiresAt"] = now.Add(time.Duration(req.GraceHours) * time.Hour)
+	} else {
+		update["status"] = "revoked"
+		update["revokedBy"] = token.UID
+		update["revokedAt"] = now
+	}
+	if _, err := client.Collection("api_keys").Doc(old.ID).Set(ctx, update, firestore.MergeAll); err != nil {
+		c.Error(apperrors.Internal(err, "Failed to retire the old API key"))
+		return
+	}
+	config.InvalidateAPIKey(old.ID)
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "api_key.rotate",
+		TargetType: "api_key",
+		TargetID:   old.ID,
+		Details: map[string]interface{}{
+			"name":       old.Name,
+			"newKeyId":   key.ID,
+			"graceHours": req.GraceHours,
+		},
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"apiKey": key,
+		"key":    rawKey,
+	})
+}
+
+func RevokeAPIKey(c *gin.Context) {
+	keyID := c.Param("id")
+
+	user, _ := c.Get("user")
+	token := user.(*auth.Token)
+
+	ctx := c.Request.Context()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	docRef := client.Collection("api_keys").Doc(keyID)
+	var key models.APIKey
+
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(docRef)
+		if err != nil {
+			return err
+		}
+		doc.DataTo(&key)
+		if key.Status != "active" {
+			return errAPIKeyNotActive
+		}
+
+		now := time.Now()
+		key.Status = "revoked"
+		key.RevokedBy = token.UID
+		key.RevokedAt = &now
+		key.UpdatedAt = now
+		return tx.Set(docRef, key)
+	})
+	if err == errAPIKeyNotActive {
+		c.Error(apperrors.Conflict("API key is already revoked"))
+		return
+	}
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "API key not found", "Failed to fetch API key"))
+		return
+	}
+	config.InvalidateAPIKey(keyID)
+
+	key.ID = keyID
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "api_key.revoke",
+		TargetType: "api_key",
+		TargetID:   keyID,
+		Details:    map[string]interface{}{"name": key.Name},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"apiKey": key})
+}
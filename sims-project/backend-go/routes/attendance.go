@@ -2,10 +2,12 @@ package routes
 
 import (
 	"net/http"
+	"sims-backend-go/apperrors"
 	"sims-backend-go/models"
 	"time"
 
 	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
 	"github.com/gin-gonic/gin"
 	"google.golang.org/api/iterator"
 )
@@ -14,7 +16,7 @@ func GetAttendance(c *gin.Context) {
 	ctx := c.Request.Context()
 	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
 		return
 	}
 	defer client.Close()
@@ -29,7 +31,7 @@ func GetAttendance(c *gin.Context) {
 			break
 		}
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attendance"})
+			c.Error(apperrors.Internal(err, "Failed to fetch attendance"))
 			return
 		}
 
@@ -45,14 +47,14 @@ func GetAttendance(c *gin.Context) {
 func CreateAttendance(c *gin.Context) {
 	var req models.AttendanceCreateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperrors.Validation(err))
 		return
 	}
 
 	ctx := c.Request.Context()
 	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
 		return
 	}
 	defer client.Close()
@@ -60,7 +62,7 @@ func CreateAttendance(c *gin.Context) {
 	// Get user from context for teacher ID
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		c.Error(apperrors.Unauthorized("User not authenticated"))
 		return
 	}
 
@@ -80,11 +82,12 @@ func CreateAttendance(c *gin.Context) {
 
 	docRef, _, err := client.Collection("attendance").Add(ctx, record)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create attendance record"})
+		c.Error(apperrors.Internal(err, "Failed to create attendance record"))
 		return
 	}
 
 	record.ID = docRef.ID
+	setLocation(c, record.ID)
 	c.JSON(http.StatusCreated, gin.H{"attendance": record})
 }
 
@@ -94,14 +97,14 @@ func GetAttendanceRecord(c *gin.Context) {
 	ctx := c.Request.Context()
 	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
 		return
 	}
 	defer client.Close()
 
 	doc, err := client.Collection("attendance").Doc(recordID).Get(ctx)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Attendance record not found"})
+		c.Error(apperrors.FromFirestore(err, "Attendance record not found", "Failed to fetch attendance record"))
 		return
 	}
 
@@ -109,26 +112,33 @@ func GetAttendanceRecord(c *gin.Context) {
 	doc.DataTo(&record)
 	record.ID = doc.Ref.ID
 
+	setETag(c, doc)
 	c.JSON(http.StatusOK, gin.H{"attendance": record})
 }
 
 func UpdateAttendance(c *gin.Context) {
-	recordID := c.Param("id")
-
 	var req models.AttendanceUpdateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperrors.Validation(err))
 		return
 	}
 
-	ctx := c.Request.Context()
-	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	applyAttendanceUpdate(c, attendanceUpdateData(req))
+}
+
+// PatchAttendance applies a JSON Merge Patch; null removes an optional field.
+func PatchAttendance(c *gin.Context) {
+	var req models.AttendanceUpdateRequest
+	cleared, err := bindMergePatch(c, &req, models.AttendanceCreateRequest{})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(err)
 		return
 	}
-	defer client.Close()
 
+	applyAttendanceUpdate(c, withCleared(attendanceUpdateData(req), cleared))
+}
+
+func attendanceUpdateData(req models.AttendanceUpdateRequest) map[string]interface{} {
 	// Prepare update data
 	updateData := map[string]interface{}{
 		"updatedAt": time.Now(),
@@ -144,13 +154,31 @@ func UpdateAttendance(c *gin.Context) {
 		updateData["date"] = *req.Date
 	}
 
-	_, err = client.Collection("attendance").Doc(recordID).Update(ctx, updateData)
+	return updateData
+}
+
+func applyAttendanceUpdate(c *gin.Context, updateData map[string]interface{}) {
+	recordID := c.Param("id")
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	doc, err := updateDocument(c, client.Collection("attendance").Doc(recordID), updateData)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update attendance record"})
+		c.Error(apperrors.FromFirestore(err, "Attendance record not found", "Failed to update attendance record"))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Attendance record updated successfully"})
+	var record models.Attendance
+	doc.DataTo(&record)
+	record.ID = doc.Ref.ID
+
+	c.JSON(http.StatusOK, gin.H{"attendance": record})
 }
 
 func DeleteAttendance(c *gin.Context) {
@@ -159,14 +187,14 @@ func DeleteAttendance(c *gin.Context) {
 	ctx := c.Request.Context()
 	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
 		return
 	}
 	defer client.Close()
 
 	_, err = client.Collection("attendance").Doc(recordID).Delete(ctx)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete attendance record"})
+		c.Error(apperrors.Internal(err, "Failed to delete attendance record"))
 		return
 	}
 
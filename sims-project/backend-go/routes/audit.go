@@ -0,0 +1,79 @@
+package routes
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sims-backend-go/apperrors"
+	"sims-backend-go/models"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+)
+
+// recordAudit appends an entry to the audit_logs collection. The actor
+// defaults to the authenticated user of the request. Failures are logged
+// rather than returned so auditing never breaks the main operation.
+func recordAudit(ctx context.Context, client *firestore.Client, c *gin.Context, entry models.AuditLog) {
+	if entry.ActorID == "" {
+		if user, exists := c.Get("user"); exists {
+			token := user.(*auth.Token)
+			entry.ActorID = token.UID
+			entry.ActorEmail, _ = token.Claims["email"].(string)
+		}
+	}
+	entry.IPAddress = c.ClientIP()
+	entry.CreatedAt = time.Now()
+
+	if _, _, err := client.Collection("audit_logs").Add(ctx, entry); err != nil {
+		log.Printf("Warning: failed to record audit log %s for %s/%s: %v", entry.Action, entry.TargetType, entry.TargetID, err)
+	}
+}
+
+func GetAuditLogs(c *gin.Context) {
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	query := client.Collection("audit_logs").Query
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action", "==", action)
+	}
+	if targetType := c.Query("targetType"); targetType != "" {
+		query = query.Where("targetType", "==", targetType)
+	}
+	if targetID := c.Query("targetId"); targetID != "" {
+		query = query.Where("targetId", "==", targetID)
+	}
+	if actorID := c.Query("actorId"); actorID != "" {
+		query = query.Where("actorId", "==", actorID)
+	}
+
+	iter := query.OrderBy("createdAt", firestore.Desc).Limit(500).Documents(ctx)
+	var logs []models.AuditLog
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			c.Error(apperrors.Internal(err, "Failed to fetch audit logs"))
+			return
+		}
+
+		var entry models.AuditLog
+		doc.DataTo(&entry)
+		entry.ID = doc.Ref.ID
+		logs = append(logs, entry)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"auditLogs": logs})
+}
@@ -1,28 +1,25 @@
 package routes
 
 import (
+	"context"
+	"log"
 	"net/http"
-	"os"
+	"sims-backend-go/apperrors"
 	"sims-backend-go/config"
 	"sims-backend-go/models"
+	"sims-backend-go/services"
 	"time"
 
+	"cloud.google.com/go/firestore"
 	"firebase.google.com/go/auth"
 	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
 )
 
-func HealthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"status":    "healthy",
-		"timestamp": time.Now().Format(time.RFC3339),
-		"uptime":    "N/A", // Could implement uptime tracking
-	})
-}
-
 func VerifyToken(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		c.Error(apperrors.Unauthorized("User not authenticated"))
 		return
 	}
 
@@ -32,7 +29,7 @@ func VerifyToken(c *gin.Context) {
 	ctx := c.Request.Context()
 	client, err := config.FirebaseApp.Firestore(ctx)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
 		return
 	}
 	defer client.Close()
@@ -53,30 +50,208 @@ func VerifyToken(c *gin.Context) {
 	})
 }
 
+// respondSignInError maps identity provider errors to HTTP responses.
+func respondSignInError(c *gin.Context, err error) {
+	switch err {
+	case services.ErrInvalidCredentials:
+		c.Error(apperrors.Unauthorized("Invalid email or password"))
+	case services.ErrInvalidRefreshToken:
+		c.Error(apperrors.Unauthorized("Invalid or expired refresh token"))
+	case services.ErrUserDisabled:
+		c.Error(apperrors.Forbidden("Account is disabled"))
+	case services.ErrTooManyAttempts:
+		c.Error(apperrors.TooManyRequests("Too many attempts, please try again later"))
+	default:
+		c.Error(apperrors.Unavailable(err, "Authentication service unavailable"))
+	}
+}
+
+// recordLogin appends to the login_history collection. Failures are logged
+// so history problems never block a sign-in.
+func recordLogin(ctx context.Context, client *firestore.Client, c *gin.Context, uid, email, method string) {
+	entry := models.LoginHistory{
+		UserID:    uid,
+		Email:     email,
+		Method:    method,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		CreatedAt: time.Now(),
+	}
+
+	if _, _, err := client.Collection("login_history").Add(ctx, entry); err != nil {
+		log.Printf("Warning: failed to record login history for %s: %v", uid, err)
+	}
+}
+
 func Login(c *gin.Context) {
 	var req models.LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	ctx := c.Request.Context()
+	result, err := services.Identity.SignInWithPassword(ctx, req.Email, req.Password)
+	if err != nil {
+		respondSignInError(c, err)
+		return
+	}
+
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	userData, err := signInUser(ctx, client, result.UID)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
-	// In Firebase, login is typically handled on the frontend
-	// This endpoint can be used for custom authentication logic
+	recordLogin(ctx, client, c, result.UID, result.Email, "password")
+
 	c.JSON(http.StatusOK, gin.H{
-		"message":  "Use Firebase Auth on frontend for login",
-		"redirect": "/dashboard",
+		"uid":          result.UID,
+		"email":        result.Email,
+		"role":         userData.Role,
+		"profile":      userData,
+		"idToken":      result.IDToken,
+		"refreshToken": result.RefreshToken,
+		"expiresIn":    int(result.ExpiresIn.Seconds()),
 	})
 }
 
+// signInUser loads the profile of a user who signed in or refreshed a
+// token, rejects inactive accounts and records the login time.
+func signInUser(ctx context.Context, client *firestore.Client, uid string) (models.User, error) {
+	userRef := client.Collection("users").Doc(uid)
+	userDoc, err := userRef.Get(ctx)
+	if err != nil {
+		return models.User{}, apperrors.FromFirestore(err, "User profile not found", "Failed to fetch user profile")
+	}
+
+	var userData models.User
+	userDoc.DataTo(&userData)
+	userData.ID = uid
+
+	if !userData.IsActive {
+		return userData, apperrors.Forbidden("Account is inactive")
+	}
+
+	now := time.Now()
+	_, err = userRef.Set(ctx, map[string]interface{}{"lastLogin": now}, firestore.MergeAll)
+	if err != nil {
+		log.Printf("Warning: failed to update last login for %s: %v", uid, err)
+	}
+	userData.LastLogin = &now
+	return userData, nil
+}
+
+func RefreshToken(c *gin.Context) {
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	ctx := c.Request.Context()
+	result, err := services.Identity.RefreshIDToken(ctx, req.RefreshToken)
+	if err != nil {
+		respondSignInError(c, err)
+		return
+	}
+
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	// Deactivating an account must also stop its existing sessions
+	if _, err := signInUser(ctx, client, result.UID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	recordLogin(ctx, client, c, result.UID, result.Email, "refresh")
+
+	c.JSON(http.StatusOK, gin.H{
+		"uid":          result.UID,
+		"idToken":      result.IDToken,
+		"refreshToken": result.RefreshToken,
+		"expiresIn":    int(result.ExpiresIn.Seconds()),
+	})
+}
+
+func GetLoginHistory(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+
+	ctx := c.Request.Context()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	iter := client.Collection("login_history").
+		Where("userId", "==", token.UID).
+		OrderBy("createdAt", firestore.Desc).
+		Limit(50).
+		Documents(ctx)
+	var history []models.LoginHistory
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			c.Error(apperrors.Internal(err, "Failed to fetch login history"))
+			return
+		}
+
+		var entry models.LoginHistory
+		doc.DataTo(&entry)
+		entry.ID = doc.Ref.ID
+		history = append(history, entry)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"loginHistory": history})
+}
+
 func Logout(c *gin.Context) {
-	// In Firebase, logout is typically handled on the client side
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+
+	// Firebase can only revoke all refresh tokens of a user, so this signs
+	// the user out on every device
+	if err := config.RevokeSessions(c.Request.Context(), token.UID); err != nil {
+		c.Error(apperrors.Internal(err, "Failed to log out"))
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
 
 func GetProfile(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		c.Error(apperrors.Unauthorized("User not authenticated"))
 		return
 	}
 
@@ -85,20 +260,21 @@ func GetProfile(c *gin.Context) {
 	ctx := c.Request.Context()
 	client, err := config.FirebaseApp.Firestore(ctx)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
 		return
 	}
 	defer client.Close()
 
 	userDoc, err := client.Collection("users").Doc(token.UID).Get(ctx)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User profile not found"})
+		c.Error(apperrors.FromFirestore(err, "User profile not found", "Failed to fetch user profile"))
 		return
 	}
 
 	var userData models.User
 	userDoc.DataTo(&userData)
 
+	setETag(c, userDoc)
 	c.JSON(http.StatusOK, gin.H{
 		"uid":       token.UID,
 		"email":     token.Claims["email"],
@@ -112,7 +288,7 @@ func GetProfile(c *gin.Context) {
 func UpdateProfile(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		c.Error(apperrors.Unauthorized("User not authenticated"))
 		return
 	}
 
@@ -120,14 +296,14 @@ func UpdateProfile(c *gin.Context) {
 
 	var req models.UpdateProfileRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperrors.Validation(err))
 		return
 	}
 
 	ctx := c.Request.Context()
 	client, err := config.FirebaseApp.Firestore(ctx)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
 		return
 	}
 	defer client.Close()
@@ -154,9 +330,9 @@ func UpdateProfile(c *gin.Context) {
 	}
 
 	// Update Firestore
-	_, err = client.Collection("users").Doc(token.UID).Update(ctx, updateData)
+	doc, err := updateDocument(c, client.Collection("users").Doc(token.UID), updateData)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		c.Error(apperrors.FromFirestore(err, "User profile not found", "Failed to update profile"))
 		return
 	}
 
@@ -169,13 +345,19 @@ func UpdateProfile(c *gin.Context) {
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Profile updated successfully"})
+	var profile models.User
+	doc.DataTo(&profile)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Profile updated successfully",
+		"profile": profile,
+	})
 }
 
 func ChangePassword(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		c.Error(apperrors.Unauthorized("User not authenticated"))
 		return
 	}
 
@@ -183,39 +365,106 @@ func ChangePassword(c *gin.Context) {
 
 	var req models.ChangePasswordRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperrors.Validation(err))
 		return
 	}
 
+	email, _ := token.Claims["email"].(string)
+	if email == "" {
+		c.Error(apperrors.BadRequest("Account has no email/password sign-in"))
+		return
+	}
+
+	if req.NewPassword == req.CurrentPassword {
+		c.Error(apperrors.BadRequest("New password must be different from the current password"))
+		return
+	}
+	if err := services.Passwords.Validate(req.NewPassword, email); err != nil {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	// A stolen ID token must not be enough to guess the current password
+	if config.PasswordLockout.AbortLocked(c, token.UID) {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	// Verify the current password with the identity provider
+	result, err := services.Identity.SignInWithPassword(ctx, email, req.CurrentPassword)
+	switch {
+	case err == services.ErrInvalidCredentials || (err == nil && result.UID != token.UID):
+		config.PasswordLockout.Fail(token.UID)
+		c.Error(apperrors.Forbidden("Current password is incorrect"))
+		return
+	case err == services.ErrTooManyAttempts:
+		c.Error(apperrors.TooManyRequests("Too many attempts, please try again later"))
+		return
+	case err != nil:
+		c.Error(apperrors.Unavailable(err, "Unable to verify current password"))
+		return
+	}
+	config.PasswordLockout.Reset(token.UID)
+
 	// Update password in Firebase Auth
-	_, err := config.AuthClient.UpdateUser(c.Request.Context(), token.UID, (&auth.UserToUpdate{}).Password(req.NewPassword))
+	_, err = config.AuthClient.UpdateUser(ctx, token.UID, (&auth.UserToUpdate{}).Password(req.NewPassword))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		c.Error(apperrors.Internal(err, "Failed to change password"))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+	// Sign out every other session that may hold the old credentials
+	if err := config.RevokeSessions(ctx, token.UID); err != nil {
+		log.Printf("Warning: failed to revoke refresh tokens for %s: %v", token.UID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Password changed successfully",
+		"reauthRequired": true,
+	})
 }
 
 func SignUp(c *gin.Context) {
 	var req models.SignUpRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperrors.Validation(err))
 		return
 	}
 
-	// Validate secret key
-	expectedSecretKey := os.Getenv("SIGNUP_SECRET_KEY")
-	if expectedSecretKey == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server configuration error"})
+	if err := services.Passwords.Validate(req.Password, req.Email); err != nil {
+		c.Error(apperrors.Validation(err))
 		return
 	}
-	if req.SecretKey != expectedSecretKey {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid secret key"})
+
+	// Reject clients locked out after repeated invalid invitation codes
+	clientIP := c.ClientIP()
+	if config.SignupLockout.AbortLocked(c, clientIP) {
 		return
 	}
 
 	ctx := c.Request.Context()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	// Consume the invitation; it decides the role of the new account
+	invitation, err := consumeInvitation(ctx, client, req.InvitationCode, req.Email)
+	if err == errInvalidInvitation {
+		if locked := config.SignupLockout.Fail(clientIP); locked > 0 {
+			log.Printf("Signup locked for %s after repeated invalid invitation codes", clientIP)
+		}
+		c.Error(apperrors.Forbidden("Invalid or expired invitation code"))
+		return
+	}
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to verify invitation"))
+		return
+	}
+	config.SignupLockout.Reset(clientIP)
 
 	// Create user in Firebase Auth
 	params := (&auth.UserToCreate{}).
@@ -226,24 +475,22 @@ func SignUp(c *gin.Context) {
 
 	userRecord, err := config.AuthClient.CreateUser(ctx, params)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user: " + err.Error()})
-		return
-	}
-
-	// Save user data to Firestore
-	client, err := config.FirebaseApp.Firestore(ctx)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		releaseInvitation(ctx, client, invitation.ID)
+		if auth.IsEmailAlreadyExists(err) {
+			c.Error(apperrors.Conflict("Email is already registered"))
+			return
+		}
+		c.Error(apperrors.Internal(err, "Failed to create user"))
 		return
 	}
-	defer client.Close()
 
 	now := time.Now()
 	userData := models.User{
 		ID:          userRecord.UID,
 		Email:       req.Email,
 		DisplayName: req.DisplayName,
-		Role:        req.Role,
+		Role:        invitation.Role,
+		InvitedBy:   invitation.InvitedBy,
 		IsActive:    true,
 		CreatedAt:   now,
 		UpdatedAt:   now,
@@ -253,13 +500,41 @@ func SignUp(c *gin.Context) {
 	if err != nil {
 		// If Firestore save fails, try to delete the created user from Auth
 		config.AuthClient.DeleteUser(ctx, userRecord.UID)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save user data"})
+		releaseInvitation(ctx, client, invitation.ID)
+		c.Error(apperrors.Internal(err, "Failed to save user data"))
 		return
 	}
 
+	// RequirePermission reads the role from the ID token claims
+	err = config.AuthClient.SetCustomUserClaims(ctx, userRecord.UID, map[string]interface{}{"role": invitation.Role})
+	if err != nil {
+		log.Printf("Warning: failed to set role claim for %s: %v", userRecord.UID, err)
+	}
+
+	if err := completeInvitation(ctx, client, invitation.ID, userRecord.UID); err != nil {
+		log.Printf("Warning: failed to link invitation %s to %s: %v", invitation.ID, userRecord.UID, err)
+	}
+
+	if err := sendVerificationEmail(ctx, client, userRecord.UID, req.Email); err != nil {
+		log.Printf("Warning: failed to send verification email to %s: %v", userRecord.UID, err)
+	}
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "invitation.use",
+		ActorID:    userRecord.UID,
+		ActorEmail: req.Email,
+		TargetType: "invitation",
+		TargetID:   invitation.ID,
+		Details: map[string]interface{}{
+			"role":      invitation.Role,
+			"invitedBy": invitation.InvitedBy,
+		},
+	})
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "User created successfully",
 		"uid":     userRecord.UID,
 		"email":   userRecord.Email,
+		"role":    invitation.Role,
 	})
 }
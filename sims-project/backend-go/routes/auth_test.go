@@ -0,0 +1,84 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sims-backend-go/apperrors"
+	"sims-backend-go/models"
+	"sims-backend-go/services"
+	"testing"
+	"time"
+)
+
+func TestRespondSignInError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{services.ErrInvalidCredentials, http.StatusUnauthorized, apperrors.CodeUnauthorized},
+		{services.ErrInvalidRefreshToken, http.StatusUnauthorized, apperrors.CodeUnauthorized},
+		{services.ErrUserDisabled, http.StatusForbidden, apperrors.CodeForbidden},
+		{services.ErrTooManyAttempts, http.StatusTooManyRequests, apperrors.CodeTooManyRequests},
+		{errors.New("connection reset"), http.StatusServiceUnavailable, apperrors.CodeUnavailable},
+	}
+	for _, tt := range tests {
+		c, _ := testContext(http.MethodPost, "/api/auth/login", "", "")
+		respondSignInError(c, tt.err)
+		if len(c.Errors) != 1 {
+			t.Fatalf("%v: %d errors recorded", tt.err, len(c.Errors))
+		}
+		var appErr *apperrors.Error
+		if !errors.As(c.Errors[0].Err, &appErr) || appErr.Status != tt.status || appErr.Code != tt.code {
+			t.Errorf("%v: got %v, want %d %s", tt.err, c.Errors[0].Err, tt.status, tt.code)
+		}
+	}
+}
+
+func TestSignInUser(t *testing.T) {
+	client := emulatorClient(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		user   *models.User
+		code   string
+		logged bool
+	}{
+		{"active", &models.User{Email: "guru@sekolah.sch.id", Role: "teacher", IsActive: true}, "", true},
+		{"inactive", &models.User{Email: "lama@sekolah.sch.id", Role: "teacher"}, apperrors.CodeForbidden, false},
+		{"no profile", nil, apperrors.CodeNotFound, false},
+	}
+	for i, tt := range tests {
+		uid := "signin-" + time.Now().Format("150405.000000") + "-" + string(rune('a'+i))
+		ref := client.Collection("users").Doc(uid)
+		if tt.user != nil {
+			if _, err := ref.Set(ctx, *tt.user); err != nil {
+				t.Fatal(err)
+			}
+			defer ref.Delete(ctx)
+		}
+
+		user, err := signInUser(ctx, client, uid)
+		if got := errorCode(err); got != tt.code {
+			t.Errorf("%s: error code %q, want %q", tt.name, got, tt.code)
+			continue
+		}
+		if !tt.logged {
+			continue
+		}
+		if user.ID != uid || user.LastLogin == nil {
+			t.Errorf("%s: user = %+v", tt.name, user)
+		}
+		doc, err := ref.Get(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var stored models.User
+		doc.DataTo(&stored)
+		if stored.LastLogin == nil {
+			t.Errorf("%s: lastLogin not stored", tt.name)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"net/http"
+	"sims-backend-go/apperrors"
 	"sims-backend-go/models"
 	"time"
 
@@ -14,7 +15,7 @@ func GetClasses(c *gin.Context) {
 	ctx := c.Request.Context()
 	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
 		return
 	}
 	defer client.Close()
@@ -29,7 +30,7 @@ func GetClasses(c *gin.Context) {
 			break
 		}
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch classes"})
+			c.Error(apperrors.Internal(err, "Failed to fetch classes"))
 			return
 		}
 
@@ -45,14 +46,14 @@ func GetClasses(c *gin.Context) {
 func CreateClass(c *gin.Context) {
 	var req models.ClassCreateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperrors.Validation(err))
 		return
 	}
 
 	ctx := c.Request.Context()
 	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
 		return
 	}
 	defer client.Close()
@@ -73,11 +74,12 @@ func CreateClass(c *gin.Context) {
 
 	docRef, _, err := client.Collection("classes").Add(ctx, class)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create class"})
+		c.Error(apperrors.Internal(err, "Failed to create class"))
 		return
 	}
 
 	class.ID = docRef.ID
+	setLocation(c, class.ID)
 	c.JSON(http.StatusCreated, gin.H{"class": class})
 }
 
@@ -87,14 +89,14 @@ func GetClass(c *gin.Context) {
 	ctx := c.Request.Context()
 	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
 		return
 	}
 	defer client.Close()
 
 	doc, err := client.Collection("classes").Doc(classID).Get(ctx)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Class not found"})
+		c.Error(apperrors.FromFirestore(err, "Class not found", "Failed to fetch class"))
 		return
 	}
 
@@ -102,26 +104,33 @@ func GetClass(c *gin.Context) {
 	doc.DataTo(&class)
 	class.ID = doc.Ref.ID
 
+	setETag(c, doc)
 	c.JSON(http.StatusOK, gin.H{"class": class})
 }
 
 func UpdateClass(c *gin.Context) {
-	classID := c.Param("id")
-
 	var req models.ClassUpdateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperrors.Validation(err))
 		return
 	}
 
-	ctx := c.Request.Context()
-	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	applyClassUpdate(c, classUpdateData(req))
+}
+
+// PatchClass applies a JSON Merge Patch; null removes an optional field.
+func PatchClass(c *gin.Context) {
+	var req models.ClassUpdateRequest
+	cleared, err := bindMergePatch(c, &req, models.ClassCreateRequest{})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(err)
 		return
 	}
-	defer client.Close()
 
+	applyClassUpdate(c, withCleared(classUpdateData(req), cleared))
+}
+
+func classUpdateData(req models.ClassUpdateRequest) map[string]interface{} {
 	// Prepare update data
 	updateData := map[string]interface{}{
 		"updatedAt": time.Now(),
@@ -149,13 +158,31 @@ func UpdateClass(c *gin.Context) {
 		updateData["isActive"] = *req.IsActive
 	}
 
-	_, err = client.Collection("classes").Doc(classID).Update(ctx, updateData)
+	return updateData
+}
+
+func applyClassUpdate(c *gin.Context, updateData map[string]interface{}) {
+	classID := c.Param("id")
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	doc, err := updateDocument(c, client.Collection("classes").Doc(classID), updateData)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update class"})
+		c.Error(apperrors.FromFirestore(err, "Class not found", "Failed to update class"))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Class updated successfully"})
+	var class models.Class
+	doc.DataTo(&class)
+	class.ID = doc.Ref.ID
+
+	c.JSON(http.StatusOK, gin.H{"class": class})
 }
 
 func DeleteClass(c *gin.Context) {
@@ -164,14 +191,14 @@ func DeleteClass(c *gin.Context) {
 	ctx := c.Request.Context()
 	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
 		return
 	}
 	defer client.Close()
 
 	_, err = client.Collection("classes").Doc(classID).Delete(ctx)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete class"})
+		c.Error(apperrors.Internal(err, "Failed to delete class"))
 		return
 	}
 
@@ -0,0 +1,70 @@
+package routes
+
+import (
+	"sims-backend-go/apperrors"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+)
+
+// etag derives a strong ETag from the document's last update time, which
+// Firestore changes on every write.
+func etag(doc *firestore.DocumentSnapshot) string {
+	return `"` + strconv.FormatInt(doc.UpdateTime.UnixNano(), 36) + `"`
+}
+
+func setETag(c *gin.Context, doc *firestore.DocumentSnapshot) {
+	c.Header("ETag", etag(doc))
+}
+
+// ifMatch turns the If-Match header into a Firestore precondition so the
+// write fails when the document changed after the client read it. Without
+// the header the write is unconditional.
+func ifMatch(c *gin.Context) ([]firestore.Precondition, error) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	switch {
+	case header == "":
+		return nil, nil
+	case header == "*":
+		return []firestore.Precondition{firestore.Exists}, nil
+	case strings.Contains(header, ","):
+		return nil, apperrors.BadRequest("If-Match must contain a single ETag")
+	}
+
+	// Weak validators never match for If-Match (RFC 9110 strong comparison)
+	nanos, err := strconv.ParseInt(strings.Trim(header, `"`), 36, 64)
+	if !strings.HasPrefix(header, `"`) || err != nil {
+		return nil, apperrors.PreconditionFailed("The resource has been modified, reload it and try again")
+	}
+
+	return []firestore.Precondition{firestore.LastUpdateTime(time.Unix(0, nanos))}, nil
+}
+
+// updateDocument applies data to ref honoring If-Match and returns the
+// updated document, setting its new ETag on the response.
+func updateDocument(c *gin.Context, ref *firestore.DocumentRef, data map[string]interface{}) (*firestore.DocumentSnapshot, error) {
+	preconditions, err := ifMatch(c)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make([]firestore.Update, 0, len(data))
+	for path, value := range data {
+		updates = append(updates, firestore.Update{Path: path, Value: value})
+	}
+
+	ctx := c.Request.Context()
+	if _, err := ref.Update(ctx, updates, preconditions...); err != nil {
+		return nil, err
+	}
+
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	setETag(c, doc)
+	return doc, nil
+}
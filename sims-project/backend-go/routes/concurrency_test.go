@@ -0,0 +1,95 @@
+package routes
+
+import (
+	"context"
+	"reflect"
+	"sims-backend-go/apperrors"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+func TestIfMatch(t *testing.T) {
+	updated := time.Unix(1736496000, 123456789)
+	current := etag(&firestore.DocumentSnapshot{UpdateTime: updated})
+
+	tests := []struct {
+		name   string
+		header string
+		want   []firestore.Precondition
+		code   string
+	}{
+		{"no header", "", nil, ""},
+		{"any version", "*", []firestore.Precondition{firestore.Exists}, ""},
+		{"current ETag", current, []firestore.Precondition{firestore.LastUpdateTime(updated)}, ""},
+		{"surrounding space", " " + current + " ", []firestore.Precondition{firestore.LastUpdateTime(updated)}, ""},
+		{"weak ETag", "W/" + current, nil, apperrors.CodePrecondition},
+		{"unquoted", "abc", nil, apperrors.CodePrecondition},
+		{"not an ETag of ours", `"not-base36!"`, nil, apperrors.CodePrecondition},
+		{"several ETags", current + `, "abc"`, nil, apperrors.CodeBadRequest},
+	}
+	for _, tt := range tests {
+		c, _ := testContext("PATCH", "/api/users/u1", "admin-1", "admin")
+		if tt.header != "" {
+			c.Request.Header.Set("If-Match", tt.header)
+		}
+
+		preconditions, err := ifMatch(c)
+		if code := errorCode(err); code != tt.code {
+			t.Errorf("%s: error = %v, want code %q", tt.name, err, tt.code)
+			continue
+		}
+		if !reflect.DeepEqual(preconditions, tt.want) {
+			t.Errorf("%s: preconditions = %v, want %v", tt.name, preconditions, tt.want)
+		}
+	}
+}
+
+func TestSetETag(t *testing.T) {
+	c, w := testContext("GET", "/api/users/u1", "admin-1", "admin")
+	first := &firestore.DocumentSnapshot{UpdateTime: time.Date(2025, 1, 10, 8, 0, 0, 1, time.UTC)}
+	setETag(c, first)
+	if got := w.Header().Get("ETag"); got != etag(first) || got[0] != '"' || got[len(got)-1] != '"' {
+		t.Errorf("ETag = %q, want the strong ETag %q", got, etag(first))
+	}
+
+	// Any write moves the update time, and with it the ETag
+	second := &firestore.DocumentSnapshot{UpdateTime: first.UpdateTime.Add(time.Nanosecond)}
+	if etag(first) == etag(second) {
+		t.Error("ETag did not change with the update time")
+	}
+}
+
+func TestUpdateDocumentIfMatch(t *testing.T) {
+	client := emulatorClient(t)
+	ctx := context.Background()
+	ref := client.Collection("concurrency_test").Doc("doc-" + time.Now().Format("150405.000000000"))
+	if _, err := ref.Set(ctx, map[string]interface{}{"name": "first"}); err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Delete(ctx)
+
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := etag(doc)
+
+	c, w := testContext("PATCH", "/api/test", "admin-1", "admin")
+	c.Request.Header.Set("If-Match", read)
+	if _, err := updateDocument(c, ref, map[string]interface{}{"name": "second"}); err != nil {
+		t.Fatalf("update with the current ETag: %v", err)
+	}
+	if w.Header().Get("ETag") == read {
+		t.Error("response ETag not updated")
+	}
+
+	// A second writer holding the same, now stale, ETag loses
+	c, _ = testContext("PATCH", "/api/test", "admin-2", "admin")
+	c.Request.Header.Set("If-Match", read)
+	_, err = updateDocument(c, ref, map[string]interface{}{"name": "third"})
+	if code := apperrors.FromFirestore(err, "not found", "failed").Code; code != apperrors.CodePrecondition {
+		t.Errorf("stale ETag: err = %v, want %s", err, apperrors.CodePrecondition)
+	}
+}
@@ -0,0 +1,444 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"sims-backend-go/apperrors"
+	"sims-backend-go/models"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+)
+
+func GetDiscountRules(c *gin.Context) {
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	query := client.Collection("discount_rules").Query
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind", "==", kind)
+	}
+	if studentID := c.Query("studentId"); studentID != "" {
+		query = query.Where("studentIds", "array-contains", studentID)
+	}
+
+	iter := query.Documents(ctx)
+	rules := []models.DiscountRule{}
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			c.Error(apperrors.Internal(err, "Failed to fetch discount rules"))
+			return
+		}
+
+		var rule models.DiscountRule
+		doc.DataTo(&rule)
+		rule.ID = doc.Ref.ID
+		rules = append(rules, rule)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"discountRules": rules})
+}
+
+func CreateDiscountRule(c *gin.Context) {
+	var req models.DiscountRuleCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	currency, err := resolveCurrency(req.Currency)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	rule := models.DiscountRule{
+		Name:            req.Name,
+		Description:     req.Description,
+		Kind:            req.Kind,
+		Type:            req.Type,
+		Currency:        currency,
+		StudentIDs:      req.StudentIDs,
+		MinSiblingOrder: req.MinSiblingOrder,
+		PaymentTypes:    req.PaymentTypes,
+		AcademicYear:    req.AcademicYear,
+		IsActive:        true,
+		CreatedBy:       token.UID,
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
+	}
+	if rule.Type == "percentage" {
+		rule.Percent = req.Percent
+	} else {
+		rule.Amount = req.Amount
+	}
+
+	docRef, _, err := client.Collection("discount_rules").Add(ctx, rule)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to create discount rule"))
+		return
+	}
+
+	rule.ID = docRef.ID
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "discount_rule.create",
+		TargetType: "discount_rule",
+		TargetID:   rule.ID,
+		Details: map[string]interface{}{
+			"name":    rule.Name,
+			"kind":    rule.Kind,
+			"type":    rule.Type,
+			"percent": rule.Percent,
+			"amount":  rule.Amount,
+		},
+	})
+
+	setLocation(c, rule.ID)
+	c.JSON(http.StatusCreated, gin.H{"discountRule": rule})
+}
+
+func GetDiscountRule(c *gin.Context) {
+	ruleID := c.Param("id")
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	doc, err := client.Collection("discount_rules").Doc(ruleID).Get(ctx)
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Discount rule not found", "Failed to fetch discount rule"))
+		return
+	}
+
+	var rule models.DiscountRule
+	doc.DataTo(&rule)
+	rule.ID = doc.Ref.ID
+
+	setETag(c, doc)
+	c.JSON(http.StatusOK, gin.H{"discountRule": rule})
+}
+
+func UpdateDiscountRule(c *gin.Context) {
+	var req models.DiscountRuleUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	applyDiscountRuleUpdate(c, discountRuleUpdateData(req))
+}
+
+// PatchDiscountRule applies a JSON Merge Patch; null removes an optional
+// condition.
+func PatchDiscountRule(c *gin.Context) {
+	var req models.DiscountRuleUpdateRequest
+	cleared, err := bindMergePatch(c, &req, models.DiscountRuleCreateRequest{})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	applyDiscountRuleUpdate(c, withCleared(discountRuleUpdateData(req), cleared))
+}
+
+func discountRuleUpdateData(req models.DiscountRuleUpdateRequest) map[string]interface{} {
+	updateData := map[string]interface{}{
+		"updatedAt": time.Now(),
+	}
+
+	if req.Name != nil {
+		updateData["name"] = *req.Name
+	}
+	if req.Description != nil {
+		updateData["description"] = *req.Description
+	}
+	if req.Percent != nil {
+		updateData["percent"] = *req.Percent
+	}
+	if req.Amount != nil {
+		updateData["amount"] = *req.Amount
+	}
+	if req.StudentIDs != nil {
+		updateData["studentIds"] = *req.StudentIDs
+	}
+	if req.MinSiblingOrder != nil {
+		updateData["minSiblingOrder"] = *req.MinSiblingOrder
+	}
+	if req.PaymentTypes != nil {
+		updateData["paymentTypes"] = *req.PaymentTypes
+	}
+	if req.AcademicYear != nil {
+		updateData["academicYear"] = *req.AcademicYear
+	}
+	if req.IsActive != nil {
+		updateData["isActive"] = *req.IsActive
+	}
+
+	return updateData
+}
+
+func applyDiscountRuleUpdate(c *gin.Context, updateData map[string]interface{}) {
+	ruleID := c.Param("id")
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	ref := client.Collection("discount_rules").Doc(ruleID)
+	current, err := ref.Get(ctx)
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Discount rule not found", "Failed to update discount rule"))
+		return
+	}
+	var existing models.DiscountRule
+	current.DataTo(&existing)
+
+	// The value must fit the rule's type
+	_, percent := updateData["percent"]
+	_, amount := updateData["amount"]
+	switch {
+	case existing.Type == "percentage" && amount:
+		c.Error(apperrors.ValidationFailed(apperrors.FieldError{Field: "amount", Rule: "excluded_if", Message: "percentage rules take percent"}))
+		return
+	case existing.Type == "fixed" && percent:
+		c.Error(apperrors.ValidationFailed(apperrors.FieldError{Field: "percent", Rule: "excluded_if", Message: "fixed rules take amount"}))
+		return
+	}
+
+	doc, err := updateDocument(c, ref, updateData)
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Discount rule not found", "Failed to update discount rule"))
+		return
+	}
+
+	var rule models.DiscountRule
+	doc.DataTo(&rule)
+	rule.ID = doc.Ref.ID
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "discount_rule.update",
+		TargetType: "discount_rule",
+		TargetID:   rule.ID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"discountRule": rule})
+}
+
+// DeleteDiscountRule removes the rule. Adjustments already applied to
+// payments are kept.
+func DeleteDiscountRule(c *gin.Context) {
+	ruleID := c.Param("id")
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	_, err = client.Collection("discount_rules").Doc(ruleID).Delete(ctx)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to delete discount rule"))
+		return
+	}
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "discount_rule.delete",
+		TargetType: "discount_rule",
+		TargetID:   ruleID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Discount rule deleted successfully"})
+}
+
+// loadDiscountRules returns the active rules that can apply to payments of
+// the schedule, percentage rules first.
+func loadDiscountRules(ctx context.Context, client *firestore.Client, schedule models.FeeSchedule) ([]models.DiscountRule, error) {
+	iter := client.Collection("discount_rules").Where("isActive", "==", true).Documents(ctx)
+	var rules []models.DiscountRule
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var rule models.DiscountRule
+		doc.DataTo(&rule)
+		rule.ID = doc.Ref.ID
+
+		if rule.AcademicYear != "" && rule.AcademicYear != schedule.AcademicYear {
+			continue
+		}
+		if len(rule.PaymentTypes) > 0 && !containsString(rule.PaymentTypes, schedule.PaymentType) {
+			continue
+		}
+		if rule.Type == "fixed" && rule.Currency != schedule.Currency {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Type != rules[j].Type {
+			return rules[i].Type == "percentage"
+		}
+		return rules[i].Name < rules[j].Name
+	})
+	return rules, nil
+}
+
+// discountAdjustments applies the rules matching the student to a gross
+// amount. Percentages are taken of the gross amount and add up; fixed
+// amounts follow. The total never exceeds the gross amount.
+func discountAdjustments(rules []models.DiscountRule, studentID string, siblingOrder int, gross int64) []models.PaymentAdjustment {
+	var adjustments []models.PaymentAdjustment
+	remaining := gross
+
+	for _, rule := range rules {
+		if len(rule.StudentIDs) > 0 && !containsString(rule.StudentIDs, studentID) {
+			continue
+		}
+		if rule.MinSiblingOrder > 0 && siblingOrder < rule.MinSiblingOrder {
+			continue
+		}
+
+		amount := rule.Amount
+		if rule.Type == "percentage" {
+			amount = gross * int64(rule.Percent) / 100
+		}
+		amount = min(amount, remaining)
+		if amount <= 0 {
+			continue
+		}
+		remaining -= amount
+
+		adjustments = append(adjustments, models.PaymentAdjustment{
+			Kind:        rule.Kind,
+			SourceID:    rule.ID,
+			Description: rule.Name,
+			Amount:      amount,
+		})
+	}
+	return adjustments
+}
+
+func totalAdjustments(adjustments []models.PaymentAdjustment) int64 {
+	var total int64
+	for _, adjustment := range adjustments {
+		total += adjustment.Amount
+	}
+	return total
+}
+
+// siblingOrders numbers the active students of each family, oldest first,
+// so the second child gets 2. Students without a parent count as 1.
+func siblingOrders(ctx context.Context, client *firestore.Client, students map[string]models.User) (map[string]int, error) {
+	orders := make(map[string]int, len(students))
+	var parentIDs []string
+	seen := make(map[string]bool)
+	for studentID, student := range students {
+		orders[studentID] = 1
+		if student.ParentID != "" && !seen[student.ParentID] {
+			seen[student.ParentID] = true
+			parentIDs = append(parentIDs, student.ParentID)
+		}
+	}
+
+	// Firestore allows 30 values in an "in" filter
+	for start := 0; start < len(parentIDs); start += 30 {
+		chunk := parentIDs[start:min(start+30, len(parentIDs))]
+		iter := client.Collection("users").Where("parentId", "in", chunk).Documents(ctx)
+
+		families := make(map[string][]models.User)
+		for {
+			doc, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			var sibling models.User
+			doc.DataTo(&sibling)
+			sibling.ID = doc.Ref.ID
+			if sibling.Role == "student" && sibling.IsActive {
+				families[sibling.ParentID] = append(families[sibling.ParentID], sibling)
+			}
+		}
+
+		for _, family := range families {
+			sort.SliceStable(family, func(i, j int) bool {
+				a, b := family[i], family[j]
+				switch {
+				case a.DateOfBirth != nil && b.DateOfBirth != nil && !a.DateOfBirth.Equal(*b.DateOfBirth):
+					return a.DateOfBirth.Before(*b.DateOfBirth)
+				case (a.DateOfBirth == nil) != (b.DateOfBirth == nil):
+					return a.DateOfBirth != nil
+				case !a.CreatedAt.Equal(b.CreatedAt):
+					return a.CreatedAt.Before(b.CreatedAt)
+				default:
+					return a.ID < b.ID
+				}
+			})
+			for i, sibling := range family {
+				if _, ok := orders[sibling.ID]; ok {
+					orders[sibling.ID] = i + 1
+				}
+			}
+		}
+	}
+	return orders, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package routes
+
+import (
+	"sims-backend-go/models"
+	"testing"
+)
+
+func TestDiscountAdjustments(t *testing.T) {
+	sibling := models.DiscountRule{ID: "sibling", Name: "Sibling", Kind: "discount", Type: "percentage", Percent: 10, MinSiblingOrder: 2}
+	scholarship := models.DiscountRule{ID: "scholar", Name: "Scholarship", Kind: "scholarship", Type: "fixed", Amount: 500000, StudentIDs: []string{"s1"}}
+	full := models.DiscountRule{ID: "full", Name: "Full", Kind: "scholarship", Type: "percentage", Percent: 100}
+
+	tests := []struct {
+		name    string
+		rules   []models.DiscountRule
+		student string
+		order   int
+		gross   int64
+		want    []int64
+	}{
+		{"no rules", nil, "s1", 1, 1000000, nil},
+		{"first child", []models.DiscountRule{sibling}, "s1", 1, 1000000, nil},
+		{"second child", []models.DiscountRule{sibling}, "s1", 2, 1000000, []int64{100000}},
+		{"third child", []models.DiscountRule{sibling}, "s1", 3, 1000000, []int64{100000}},
+		{"listed student", []models.DiscountRule{scholarship}, "s1", 1, 1000000, []int64{500000}},
+		{"other student", []models.DiscountRule{scholarship}, "s2", 1, 1000000, nil},
+		{"percentage of gross, not of the remainder", []models.DiscountRule{scholarship, sibling}, "s1", 2, 1000000, []int64{500000, 100000}},
+		{"fixed capped at remainder", []models.DiscountRule{sibling, scholarship}, "s1", 2, 550000, []int64{55000, 495000}},
+		{"nothing left after full scholarship", []models.DiscountRule{full, sibling, scholarship}, "s1", 2, 1000000, []int64{1000000}},
+		{"percentage rounds down", []models.DiscountRule{sibling}, "s1", 2, 999, []int64{99}},
+		{"too small to discount", []models.DiscountRule{sibling}, "s1", 2, 9, nil},
+	}
+	for _, tt := range tests {
+		adjustments := discountAdjustments(tt.rules, tt.student, tt.order, tt.gross)
+		if len(adjustments) != len(tt.want) {
+			t.Errorf("%s: got %+v, want amounts %v", tt.name, adjustments, tt.want)
+			continue
+		}
+		for i, adjustment := range adjustments {
+			if adjustment.Amount != tt.want[i] {
+				t.Errorf("%s: adjustment %d = %d, want %d", tt.name, i, adjustment.Amount, tt.want[i])
+			}
+		}
+		if total := totalAdjustments(adjustments); total > tt.gross {
+			t.Errorf("%s: adjustments total %d exceed gross %d", tt.name, total, tt.gross)
+		}
+	}
+}
+
+func TestDiscountAdjustmentsSource(t *testing.T) {
+	rule := models.DiscountRule{ID: "scholar", Name: "Scholarship", Kind: "scholarship", Type: "fixed", Amount: 500000}
+	adjustments := discountAdjustments([]models.DiscountRule{rule}, "s1", 1, 1000000)
+	want := models.PaymentAdjustment{Kind: "scholarship", SourceID: "scholar", Description: "Scholarship", Amount: 500000}
+	if len(adjustments) != 1 || adjustments[0] != want {
+		t.Errorf("adjustments = %+v, want [%+v]", adjustments, want)
+	}
+}
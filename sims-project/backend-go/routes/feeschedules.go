@@ -0,0 +1,603 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sims-backend-go/apperrors"
+	"sims-backend-go/models"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// feePeriodPattern keeps periods usable inside payment document IDs.
+var feePeriodPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+func GetFeeSchedules(c *gin.Context) {
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	iter := client.Collection("fee_schedules").Documents(ctx)
+	var schedules []models.FeeSchedule
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			c.Error(apperrors.Internal(err, "Failed to fetch fee schedules"))
+			return
+		}
+
+		var schedule models.FeeSchedule
+		doc.DataTo(&schedule)
+		schedule.ID = doc.Ref.ID
+		schedules = append(schedules, schedule)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"feeSchedules": schedules})
+}
+
+func CreateFeeSchedule(c *gin.Context) {
+	var req models.FeeScheduleCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	var invalid []apperrors.FieldError
+	if len(req.Grades) == 0 && len(req.ClassIDs) == 0 {
+		invalid = append(invalid, apperrors.FieldError{Field: "grades", Rule: "required_without", Message: "grades or classIds is required"})
+	}
+	if req.Frequency == "monthly" && req.DueDay == 0 {
+		invalid = append(invalid, apperrors.FieldError{Field: "dueDay", Rule: "required", Message: "is required for monthly fees"})
+	}
+	if len(invalid) > 0 {
+		c.Error(apperrors.ValidationFailed(invalid...))
+		return
+	}
+
+	currency, err := resolveCurrency(req.Currency)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	schedule := models.FeeSchedule{
+		Name:         req.Name,
+		Description:  req.Description,
+		PaymentType:  req.PaymentType,
+		Amount:       req.Amount,
+		Currency:     currency,
+		Frequency:    req.Frequency,
+		DueDay:       req.DueDay,
+		Grades:       req.Grades,
+		ClassIDs:     req.ClassIDs,
+		AcademicYear: req.AcademicYear,
+		Semester:     req.Semester,
+		IsActive:     true,
+		MinorUnits:   true,
+		CreatedBy:    token.UID,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	docRef, _, err := client.Collection("fee_schedules").Add(ctx, schedule)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to create fee schedule"))
+		return
+	}
+
+	schedule.ID = docRef.ID
+	setLocation(c, schedule.ID)
+	c.JSON(http.StatusCreated, gin.H{"feeSchedule": schedule})
+}
+
+func GetFeeSchedule(c *gin.Context) {
+	scheduleID := c.Param("id")
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	doc, err := client.Collection("fee_schedules").Doc(scheduleID).Get(ctx)
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Fee schedule not found", "Failed to fetch fee schedule"))
+		return
+	}
+
+	var schedule models.FeeSchedule
+	doc.DataTo(&schedule)
+	schedule.ID = doc.Ref.ID
+
+	setETag(c, doc)
+	c.JSON(http.StatusOK, gin.H{"feeSchedule": schedule})
+}
+
+func UpdateFeeSchedule(c *gin.Context) {
+	var req models.FeeScheduleUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	applyFeeScheduleUpdate(c, feeScheduleUpdateData(req))
+}
+
+// PatchFeeSchedule applies a JSON Merge Patch; null removes an optional field.
+func PatchFeeSchedule(c *gin.Context) {
+	var req models.FeeScheduleUpdateRequest
+	cleared, err := bindMergePatch(c, &req, models.FeeScheduleCreateRequest{})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	applyFeeScheduleUpdate(c, withCleared(feeScheduleUpdateData(req), cleared))
+}
+
+func feeScheduleUpdateData(req models.FeeScheduleUpdateRequest) map[string]interface{} {
+	updateData := map[string]interface{}{
+		"updatedAt": time.Now(),
+	}
+
+	if req.Name != nil {
+		updateData["name"] = *req.Name
+	}
+	if req.Description != nil {
+		updateData["description"] = *req.Description
+	}
+	if req.PaymentType != nil {
+		updateData["paymentType"] = *req.PaymentType
+	}
+	if req.Amount != nil {
+		updateData["amount"] = *req.Amount
+	}
+	if req.DueDay != nil {
+		updateData["dueDay"] = *req.DueDay
+	}
+	if req.Grades != nil {
+		updateData["grades"] = *req.Grades
+	}
+	if req.ClassIDs != nil {
+		updateData["classIds"] = *req.ClassIDs
+	}
+	if req.AcademicYear != nil {
+		updateData["academicYear"] = *req.AcademicYear
+	}
+	if req.Semester != nil {
+		updateData["semester"] = *req.Semester
+	}
+	if req.IsActive != nil {
+		updateData["isActive"] = *req.IsActive
+	}
+
+	return updateData
+}
+
+func applyFeeScheduleUpdate(c *gin.Context, updateData map[string]interface{}) {
+	scheduleID := c.Param("id")
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	doc, err := updateDocument(c, client.Collection("fee_schedules").Doc(scheduleID), updateData)
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Fee schedule not found", "Failed to update fee schedule"))
+		return
+	}
+
+	var schedule models.FeeSchedule
+	doc.DataTo(&schedule)
+	schedule.ID = doc.Ref.ID
+
+	c.JSON(http.StatusOK, gin.H{"feeSchedule": schedule})
+}
+
+// DeleteFeeSchedule removes the schedule. Payments it already generated are
+// kept.
+func DeleteFeeSchedule(c *gin.Context) {
+	scheduleID := c.Param("id")
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	_, err = client.Collection("fee_schedules").Doc(scheduleID).Delete(ctx)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to delete fee schedule"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Fee schedule deleted successfully"})
+}
+
+// PreviewFeeGeneration shows the payments GenerateFees would create for a
+// period without writing anything.
+func PreviewFeeGeneration(c *gin.Context) {
+	runFeeGeneration(c, true)
+}
+
+// GenerateFees creates a pending payment for every enrolled student of the
+// schedule. Payment IDs are derived from schedule, period and student, so
+// running it again for the same period only fills in missing payments.
+func GenerateFees(c *gin.Context) {
+	runFeeGeneration(c, false)
+}
+
+func runFeeGeneration(c *gin.Context, dryRun bool) {
+	scheduleID := c.Param("id")
+
+	var req models.FeeGenerateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	doc, err := client.Collection("fee_schedules").Doc(scheduleID).Get(ctx)
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Fee schedule not found", "Failed to fetch fee schedule"))
+		return
+	}
+
+	var schedule models.FeeSchedule
+	doc.DataTo(&schedule)
+	schedule.ID = doc.Ref.ID
+
+	if !schedule.IsActive {
+		c.Error(apperrors.BadRequest("Fee schedule is inactive"))
+		return
+	}
+
+	period, dueDate, semester, err := resolveFeePeriod(schedule, req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	result, err := planFeeGeneration(ctx, client, schedule, period, dueDate)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to plan fee generation"))
+		return
+	}
+	result.DryRun = dryRun
+
+	if dryRun {
+		c.JSON(http.StatusOK, gin.H{"generation": result})
+		return
+	}
+
+	processedBy := ""
+	if user, exists := c.Get("user"); exists {
+		processedBy = user.(*auth.Token).UID
+	}
+
+	result.Created = 0
+	result.TotalAmount = 0
+	result.TotalDiscount = 0
+	for i := range result.Items {
+		item := &result.Items[i]
+		if item.Exists {
+			continue
+		}
+
+		now := time.Now()
+		payment := models.Payment{
+			StudentID:     item.StudentID,
+			Amount:        item.Amount,
+			Currency:      schedule.Currency,
+			Description:   feeDescription(schedule, period),
+			PaymentType:   schedule.PaymentType,
+			Status:        "pending",
+			DueDate:       dueDate,
+			ProcessedBy:   processedBy,
+			AcademicYear:  schedule.AcademicYear,
+			Semester:      semester,
+			FeeScheduleID: schedule.ID,
+			Period:        period,
+			MinorUnits:    true,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		if len(item.Adjustments) > 0 {
+			payment.GrossAmount = item.GrossAmount
+			payment.Adjustments = item.Adjustments
+		}
+		// Fully covered by a scholarship
+		if payment.Amount == 0 {
+			payment.Status = payment.SettledStatus()
+			payment.PaidDate = &now
+		}
+
+		_, err := client.Collection("payments").Doc(item.PaymentID).Create(ctx, payment)
+		if status.Code(err) == codes.AlreadyExists {
+			// Created by a concurrent run
+			item.Exists = true
+			result.Existing++
+			continue
+		}
+		if err != nil {
+			c.Error(apperrors.Internal(err, "Failed to create payments, retrying is safe"))
+			return
+		}
+
+		result.Created++
+		result.TotalAmount += item.Amount
+		result.TotalDiscount += item.GrossAmount - item.Amount
+	}
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "fee_schedule.generate",
+		TargetType: "fee_schedule",
+		TargetID:   schedule.ID,
+		Details: map[string]interface{}{
+			"period":        period,
+			"created":       result.Created,
+			"existing":      result.Existing,
+			"totalDiscount": result.TotalDiscount,
+		},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"generation": result})
+}
+
+// resolveFeePeriod validates the requested period for the schedule's
+// frequency and returns it with the due date and semester of the payments.
+func resolveFeePeriod(schedule models.FeeSchedule, req models.FeeGenerateRequest) (string, time.Time, string, error) {
+	semester := req.Semester
+	if semester == "" {
+		semester = schedule.Semester
+	}
+
+	switch schedule.Frequency {
+	case "monthly":
+		month, err := time.Parse("2006-01", req.Period)
+		if err != nil {
+			return "", time.Time{}, "", apperrors.ValidationFailed(apperrors.FieldError{Field: "period", Rule: "format", Message: "must be a month in YYYY-MM format"})
+		}
+		if req.DueDate == nil && schedule.DueDay > 0 {
+			return req.Period, time.Date(month.Year(), month.Month(), schedule.DueDay, 0, 0, 0, 0, time.UTC), semester, nil
+		}
+	case "semester":
+		if !feePeriodPattern.MatchString(req.Period) {
+			return "", time.Time{}, "", apperrors.ValidationFailed(apperrors.FieldError{Field: "period", Rule: "format", Message: "must be the semester name (letters, digits, - and _)"})
+		}
+		semester = req.Period
+	default:
+		if req.Period != "" && req.Period != "once" {
+			return "", time.Time{}, "", apperrors.ValidationFailed(apperrors.FieldError{Field: "period", Rule: "format", Message: "must be empty for one-off fees"})
+		}
+		req.Period = "once"
+	}
+
+	if req.DueDate == nil {
+		return "", time.Time{}, "", apperrors.ValidationFailed(apperrors.FieldError{Field: "dueDate", Rule: "required", Message: "is required for " + schedule.Frequency + " fees"})
+	}
+	return req.Period, *req.DueDate, semester, nil
+}
+
+func feeDescription(schedule models.FeeSchedule, period string) string {
+	if period == "once" {
+		return schedule.Name
+	}
+	return schedule.Name + " " + period
+}
+
+func feePaymentID(scheduleID, period, studentID string) string {
+	return fmt.Sprintf("fee_%s_%s_%s", scheduleID, period, studentID)
+}
+
+// planFeeGeneration lists the active students of the schedule's classes and
+// whether their payment for the period already exists.
+func planFeeGeneration(ctx context.Context, client *firestore.Client, schedule models.FeeSchedule, period string, dueDate time.Time) (*models.FeeGenerationResult, error) {
+	classes, err := feeScheduleClasses(ctx, client, schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.FeeGenerationResult{
+		ScheduleID: schedule.ID,
+		Period:     period,
+		DueDate:    dueDate,
+		Currency:   schedule.Currency,
+		Items:      []models.FeeGenerationItem{},
+		Skipped:    []models.FeeGenerationSkip{},
+	}
+
+	// A student listed in several targeted classes is billed once
+	classOf := make(map[string]string)
+	var studentIDs []string
+	for _, class := range classes {
+		for _, studentID := range class.Students {
+			if _, seen := classOf[studentID]; seen {
+				continue
+			}
+			classOf[studentID] = class.ID
+			studentIDs = append(studentIDs, studentID)
+		}
+	}
+	if len(studentIDs) == 0 {
+		return result, nil
+	}
+
+	userRefs := make([]*firestore.DocumentRef, len(studentIDs))
+	paymentRefs := make([]*firestore.DocumentRef, len(studentIDs))
+	for i, studentID := range studentIDs {
+		userRefs[i] = client.Collection("users").Doc(studentID)
+		paymentRefs[i] = client.Collection("payments").Doc(feePaymentID(schedule.ID, period, studentID))
+	}
+
+	users, err := client.GetAll(ctx, userRefs)
+	if err != nil {
+		return nil, err
+	}
+	payments, err := client.GetAll(ctx, paymentRefs)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := loadDiscountRules(ctx, client, schedule)
+	if err != nil {
+		return nil, err
+	}
+	students := make(map[string]models.User)
+	for i, studentID := range studentIDs {
+		if users[i].Exists() {
+			var student models.User
+			users[i].DataTo(&student)
+			students[studentID] = student
+		}
+	}
+	orders, err := siblingOrders(ctx, client, students)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, studentID := range studentIDs {
+		reason := ""
+		var student models.User
+		if users[i].Exists() {
+			users[i].DataTo(&student)
+		}
+		switch {
+		case !users[i].Exists():
+			reason = "user not found"
+		case student.Role != "student":
+			reason = "not a student"
+		case !student.IsActive:
+			reason = "inactive"
+		}
+		if reason != "" {
+			result.Skipped = append(result.Skipped, models.FeeGenerationSkip{StudentID: studentID, ClassID: classOf[studentID], Reason: reason})
+			continue
+		}
+
+		adjustments := discountAdjustments(rules, studentID, orders[studentID], schedule.Amount)
+		item := models.FeeGenerationItem{
+			PaymentID:   paymentRefs[i].ID,
+			StudentID:   studentID,
+			StudentName: student.DisplayName,
+			ClassID:     classOf[studentID],
+			GrossAmount: schedule.Amount,
+			Amount:      schedule.Amount - totalAdjustments(adjustments),
+			Adjustments: adjustments,
+			Exists:      payments[i].Exists(),
+		}
+		if item.Exists {
+			result.Existing++
+		} else {
+			result.Created++
+			result.TotalAmount += item.Amount
+			result.TotalDiscount += item.GrossAmount - item.Amount
+		}
+		result.Items = append(result.Items, item)
+	}
+
+	sort.Slice(result.Items, func(i, j int) bool {
+		if result.Items[i].ClassID != result.Items[j].ClassID {
+			return result.Items[i].ClassID < result.Items[j].ClassID
+		}
+		return result.Items[i].StudentName < result.Items[j].StudentName
+	})
+	return result, nil
+}
+
+// feeScheduleClasses returns the active classes targeted by the schedule,
+// either by ID or by grade level.
+func feeScheduleClasses(ctx context.Context, client *firestore.Client, schedule models.FeeSchedule) ([]models.Class, error) {
+	var classes []models.Class
+	seen := make(map[string]bool)
+	add := func(doc *firestore.DocumentSnapshot) {
+		if !doc.Exists() || seen[doc.Ref.ID] {
+			return
+		}
+		var class models.Class
+		doc.DataTo(&class)
+		class.ID = doc.Ref.ID
+		seen[class.ID] = true
+		if class.IsActive {
+			classes = append(classes, class)
+		}
+	}
+
+	if len(schedule.ClassIDs) > 0 {
+		refs := make([]*firestore.DocumentRef, len(schedule.ClassIDs))
+		for i, classID := range schedule.ClassIDs {
+			refs[i] = client.Collection("classes").Doc(classID)
+		}
+		docs, err := client.GetAll(ctx, refs)
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range docs {
+			add(doc)
+		}
+	}
+
+	if len(schedule.Grades) > 0 {
+		iter := client.Collection("classes").Where("grade", "in", schedule.Grades).Documents(ctx)
+		for {
+			doc, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			add(doc)
+		}
+	}
+
+	return classes, nil
+}
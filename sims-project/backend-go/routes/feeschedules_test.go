@@ -0,0 +1,134 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"sims-backend-go/apperrors"
+	"sims-backend-go/models"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestResolveFeePeriod(t *testing.T) {
+	due := date(2025, time.February, 20)
+	monthly := models.FeeSchedule{Frequency: "monthly", DueDay: 10, Semester: "ganjil"}
+	semester := models.FeeSchedule{Frequency: "semester", Semester: "ganjil"}
+	once := models.FeeSchedule{Frequency: "once", Semester: "ganjil"}
+
+	tests := []struct {
+		name     string
+		schedule models.FeeSchedule
+		req      models.FeeGenerateRequest
+		period   string
+		due      time.Time
+		semester string
+		field    string
+	}{
+		{"monthly on the due day", monthly, models.FeeGenerateRequest{Period: "2025-02"}, "2025-02", date(2025, time.February, 10), "ganjil", ""},
+		{"monthly with a due date", monthly, models.FeeGenerateRequest{Period: "2025-02", DueDate: &due, Semester: "genap"}, "2025-02", due, "genap", ""},
+		{"monthly without a due day", models.FeeSchedule{Frequency: "monthly"}, models.FeeGenerateRequest{Period: "2025-02"}, "", time.Time{}, "", "dueDate"},
+		{"monthly bad period", monthly, models.FeeGenerateRequest{Period: "2025-2"}, "", time.Time{}, "", "period"},
+		{"semester", semester, models.FeeGenerateRequest{Period: "genap", DueDate: &due}, "genap", due, "genap", ""},
+		{"semester bad period", semester, models.FeeGenerateRequest{Period: "genap/2025", DueDate: &due}, "", time.Time{}, "", "period"},
+		{"one-off", once, models.FeeGenerateRequest{DueDate: &due}, "once", due, "ganjil", ""},
+		{"one-off with a period", once, models.FeeGenerateRequest{Period: "2025-02", DueDate: &due}, "", time.Time{}, "", "period"},
+		{"one-off without a due date", once, models.FeeGenerateRequest{}, "", time.Time{}, "", "dueDate"},
+	}
+	for _, tt := range tests {
+		period, dueDate, sem, err := resolveFeePeriod(tt.schedule, tt.req)
+		if tt.field != "" {
+			var appErr *apperrors.Error
+			if errorCode(err) != apperrors.CodeValidation || !errors.As(err, &appErr) || appErr.Fields[0].Field != tt.field {
+				t.Errorf("%s: err = %v, want a validation error on %s", tt.name, err, tt.field)
+			}
+			continue
+		}
+		if err != nil || period != tt.period || !dueDate.Equal(tt.due) || sem != tt.semester {
+			t.Errorf("%s: got %q, %s, %q, %v, want %q, %s, %q", tt.name, period, dueDate, sem, err, tt.period, tt.due, tt.semester)
+		}
+	}
+}
+
+func TestFeePaymentID(t *testing.T) {
+	id := feePaymentID("spp", "2025-02", "s1")
+	if id != "fee_spp_2025-02_s1" {
+		t.Errorf("feePaymentID = %q", id)
+	}
+	// Re-running a generation must address the same documents
+	if feePaymentID("spp", "2025-02", "s1") != id {
+		t.Error("feePaymentID is not deterministic")
+	}
+	for _, other := range []string{feePaymentID("spp", "2025-03", "s1"), feePaymentID("spp", "2025-02", "s2"), feePaymentID("buku", "2025-02", "s1")} {
+		if other == id {
+			t.Errorf("%q collides with %q", other, id)
+		}
+	}
+}
+
+func TestFeeDescription(t *testing.T) {
+	schedule := models.FeeSchedule{Name: "SPP"}
+	if got := feeDescription(schedule, "2025-02"); got != "SPP 2025-02" {
+		t.Errorf("periodic: %q", got)
+	}
+	if got := feeDescription(schedule, "once"); got != "SPP" {
+		t.Errorf("one-off: %q", got)
+	}
+}
+
+func TestPlanFeeGeneration(t *testing.T) {
+	client := emulatorClient(t)
+	ctx := context.Background()
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+	id := func(name string) string { return name + "-" + suffix }
+
+	seed := map[string]map[string]interface{}{
+		"classes/" + id("7a"):  {"name": "7A", "isActive": true, "students": []string{id("ani"), id("budi"), id("guru"), id("lulus"), id("hilang")}},
+		"classes/" + id("7b"):  {"name": "7B", "isActive": true, "students": []string{id("budi"), id("citra")}},
+		"users/" + id("ani"):   {"displayName": "Ani", "role": "student", "isActive": true},
+		"users/" + id("budi"):  {"displayName": "Budi", "role": "student", "isActive": true},
+		"users/" + id("citra"): {"displayName": "Citra", "role": "student", "isActive": true},
+		"users/" + id("guru"):  {"displayName": "Guru", "role": "teacher", "isActive": true},
+		"users/" + id("lulus"): {"displayName": "Lulus", "role": "student", "isActive": false},
+		"payments/" + feePaymentID(id("spp"), "2025-02", id("ani")): {"studentId": id("ani")},
+	}
+	for path, data := range seed {
+		if _, err := client.Doc(path).Set(ctx, data); err != nil {
+			t.Fatal(err)
+		}
+		defer client.Doc(path).Delete(ctx)
+	}
+
+	schedule := models.FeeSchedule{ID: id("spp"), Name: "SPP", Amount: 50000000, Currency: "IDR", ClassIDs: []string{id("7a"), id("7b")}}
+	result, err := planFeeGeneration(ctx, client, schedule, "2025-02", date(2025, time.February, 10))
+	if err != nil {
+		t.Fatalf("planFeeGeneration: %v", err)
+	}
+
+	if result.Created != 2 || result.Existing != 1 || len(result.Items) != 3 {
+		t.Fatalf("result = %+v", result)
+	}
+	for _, item := range result.Items {
+		if item.PaymentID != feePaymentID(id("spp"), "2025-02", item.StudentID) {
+			t.Errorf("%s: PaymentID = %q", item.StudentName, item.PaymentID)
+		}
+		if exists := item.StudentID == id("ani"); item.Exists != exists {
+			t.Errorf("%s: Exists = %v, want %v", item.StudentName, item.Exists, exists)
+		}
+	}
+	// Budi is in both classes but billed once, under the first
+	if budi := result.Items[1]; budi.StudentID != id("budi") || budi.ClassID != id("7a") {
+		t.Errorf("items = %+v", result.Items)
+	}
+
+	reasons := map[string]string{}
+	for _, skip := range result.Skipped {
+		reasons[skip.StudentID] = skip.Reason
+	}
+	want := map[string]string{id("guru"): "not a student", id("lulus"): "inactive", id("hilang"): "user not found"}
+	for studentID, reason := range want {
+		if reasons[studentID] != reason {
+			t.Errorf("%s skipped as %q, want %q", studentID, reasons[studentID], reason)
+		}
+	}
+}
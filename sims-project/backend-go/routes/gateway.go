@@ -0,0 +1,556 @@
+package routes
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sims-backend-go/apperrors"
+	"sims-backend-go/config"
+	"sims-backend-go/models"
+	"sims-backend-go/services"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Webhook bodies are small JSON documents; anything bigger is not from the
+// gateway.
+const maxWebhookBytes = 64 << 10
+
+// Headers that are never stored with a webhook event.
+var skippedWebhookHeaders = map[string]bool{
+	"Authorization": true,
+	"Cookie":        true,
+}
+
+// gatewayOutcome describes what a webhook event did.
+type gatewayOutcome struct {
+	Result        string
+	PaymentID     string
+	TransactionID string
+	Amount        int64
+	Overpayment   int64
+}
+
+func paymentGateway() (services.PaymentGateway, error) {
+	if services.Gateway == nil {
+		return nil, apperrors.Unavailable(services.ErrGatewayUnavailable, "Online payments are not configured")
+	}
+	return services.Gateway, nil
+}
+
+// gatewayEventID maps a provider's event ID to a document ID.
+func gatewayEventID(provider, eventID string) string {
+	sum := sha256.Sum256([]byte(provider + "\x00" + eventID))
+	return hex.EncodeToString(sum[:16])
+}
+
+// GetPaymentCharges lists the payment links and virtual accounts opened for
+// a payment, newest first.
+func GetPaymentCharges(c *gin.Context) {
+	paymentID := c.Param("id")
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	iter := client.Collection("payment_charges").Where("paymentId", "==", paymentID).OrderBy("createdAt", firestore.Desc).Documents(ctx)
+	charges := []models.PaymentCharge{}
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			c.Error(apperrors.Internal(err, "Failed to fetch charges"))
+			return
+		}
+
+		var charge models.PaymentCharge
+		doc.DataTo(&charge)
+		charge.ID = doc.Ref.ID
+		charges = append(charges, charge)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"charges": charges})
+}
+
+// CreatePaymentCharge opens a payment link or virtual account for the
+// outstanding balance of a payment. The payment is settled when the
+// gateway's webhook reports the charge as paid.
+func CreatePaymentCharge(c *gin.Context) {
+	paymentID := c.Param("id")
+
+	var req models.PaymentChargeCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	gateway, err := paymentGateway()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	doc, err := client.Collection("payments").Doc(paymentID).Get(ctx)
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Payment not found", "Failed to fetch payment"))
+		return
+	}
+	payment := paymentFromDoc(doc)
+
+	if err := checkPaymentOpen(payment); err != nil {
+		c.Error(err)
+		return
+	}
+
+	hours := config.AppConfig.Gateway.ChargeExpiryHours
+	if req.ExpiresInHours > 0 {
+		hours = req.ExpiresInHours
+	}
+	now := time.Now()
+	ref := client.Collection("payment_charges").NewDoc()
+
+	chargeReq := services.ChargeRequest{
+		OrderID:     ref.ID,
+		Amount:      payment.Balance,
+		Currency:    payment.Currency,
+		Method:      req.Method,
+		Bank:        req.Bank,
+		Description: payment.Description,
+		ExpiresAt:   now.Add(time.Duration(hours) * time.Hour),
+	}
+	// The payer's details are best effort
+	if doc, err := client.Collection("users").Doc(payment.StudentID).Get(ctx); err == nil {
+		var student models.User
+		doc.DataTo(&student)
+		chargeReq.CustomerName = student.DisplayName
+		chargeReq.CustomerEmail = student.Email
+	}
+
+	result, err := gateway.CreateCharge(ctx, chargeReq)
+	switch {
+	case errors.Is(err, services.ErrUnsupportedCharge):
+		c.Error(apperrors.BadRequest("The payment gateway cannot collect this payment").With("currency", payment.Currency).With("method", req.Method))
+		return
+	case errors.Is(err, services.ErrGatewayUnavailable):
+		c.Error(apperrors.Unavailable(err, "Payment gateway unavailable, please try again"))
+		return
+	case err != nil:
+		c.Error(apperrors.Internal(err, "Failed to create charge"))
+		return
+	}
+
+	charge := models.PaymentCharge{
+		ID:          ref.ID,
+		PaymentID:   payment.ID,
+		StudentID:   payment.StudentID,
+		Provider:    gateway.Name(),
+		ProviderRef: result.ProviderRef,
+		Method:      req.Method,
+		Amount:      chargeReq.Amount,
+		Currency:    chargeReq.Currency,
+		PaymentURL:  result.PaymentURL,
+		VANumber:    result.VANumber,
+		Bank:        result.Bank,
+		Status:      services.ChargePending,
+		ExpiresAt:   result.ExpiresAt,
+		CreatedBy:   token.UID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if _, err := ref.Set(ctx, charge); err != nil {
+		c.Error(apperrors.Internal(err, "Failed to save charge"))
+		return
+	}
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "payment.charge",
+		TargetType: "payment",
+		TargetID:   payment.ID,
+		Details: map[string]interface{}{
+			"chargeId": charge.ID,
+			"provider": charge.Provider,
+			"method":   charge.Method,
+			"amount":   charge.Amount,
+		},
+	})
+
+	setLocation(c, charge.ID)
+	c.JSON(http.StatusCreated, gin.H{"charge": charge})
+}
+
+// PaymentWebhook receives notifications from the payment gateway. The
+// signature is verified before anything is stored. Every event is kept
+// verbatim in gateway_events, and redeliveries of a processed event are
+// acknowledged without being applied again.
+func PaymentWebhook(c *gin.Context) {
+	gateway, err := paymentGateway()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBytes))
+	if err != nil {
+		c.Error(apperrors.BadRequest("Webhook body is too large or unreadable"))
+		return
+	}
+
+	event, err := gateway.ParseWebhook(c.Request.Header, body)
+	if errors.Is(err, services.ErrInvalidSignature) {
+		c.Error(apperrors.Unauthorized("Invalid webhook signature"))
+		return
+	}
+	if err != nil {
+		c.Error(apperrors.BadRequest("Invalid webhook: " + err.Error()))
+		return
+	}
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	headers := make(map[string]string)
+	for name, values := range c.Request.Header {
+		if !skippedWebhookHeaders[name] && len(values) > 0 {
+			headers[name] = values[0]
+		}
+	}
+
+	now := time.Now()
+	ref := client.Collection("gateway_events").Doc(gatewayEventID(gateway.Name(), event.EventID))
+	record := models.GatewayEvent{
+		ID:         ref.ID,
+		Provider:   gateway.Name(),
+		EventID:    event.EventID,
+		OrderID:    event.OrderID,
+		Status:     event.Status,
+		Amount:     event.Amount,
+		Currency:   event.Currency,
+		Body:       string(body),
+		Headers:    headers,
+		Deliveries: 1,
+		ReceivedAt: now,
+	}
+
+	_, err = ref.Create(ctx, record)
+	switch {
+	case status.Code(err) == codes.AlreadyExists:
+		doc, err := ref.Get(ctx)
+		if err != nil {
+			c.Error(apperrors.Internal(err, "Failed to fetch webhook event"))
+			return
+		}
+		doc.DataTo(&record)
+		ref.Update(ctx, []firestore.Update{{Path: "deliveries", Value: firestore.Increment(1)}})
+		if record.ProcessedAt != nil {
+			c.JSON(http.StatusOK, gin.H{"status": "duplicate", "result": record.Result})
+			return
+		}
+		// An earlier delivery failed before it was processed
+	case err != nil:
+		c.Error(apperrors.Internal(err, "Failed to store webhook event"))
+		return
+	}
+
+	outcome, err := processGatewayEvent(ctx, client, c, ref, gateway.Name(), *event)
+	if err != nil {
+		// The gateway retries failed deliveries
+		c.Error(apperrors.Internal(err, "Failed to process webhook event"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "processed", "result": outcome.Result})
+}
+
+// GetGatewayEvents lists stored webhook events, newest first.
+func GetGatewayEvents(c *gin.Context) {
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	query := client.Collection("gateway_events").Query
+	if orderID := c.Query("orderId"); orderID != "" {
+		query = query.Where("orderId", "==", orderID)
+	}
+	if result := c.Query("result"); result != "" {
+		query = query.Where("result", "==", result)
+	}
+
+	iter := query.OrderBy("receivedAt", firestore.Desc).Limit(200).Documents(ctx)
+	events := []models.GatewayEvent{}
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			c.Error(apperrors.Internal(err, "Failed to fetch webhook events"))
+			return
+		}
+
+		var event models.GatewayEvent
+		doc.DataTo(&event)
+		event.ID = doc.Ref.ID
+		events = append(events, event)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
+
+// ReplayGatewayEvent verifies a stored webhook event again and applies it.
+// Events that were already applied are not applied twice, so replaying is
+// always safe.
+func ReplayGatewayEvent(c *gin.Context) {
+	gateway, err := paymentGateway()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	ref := client.Collection("gateway_events").Doc(c.Param("id"))
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Webhook event not found", "Failed to fetch webhook event"))
+		return
+	}
+
+	var record models.GatewayEvent
+	doc.DataTo(&record)
+	record.ID = doc.Ref.ID
+	if record.Provider != gateway.Name() {
+		c.Error(apperrors.Conflict("Event was received from another payment gateway").With("provider", record.Provider))
+		return
+	}
+
+	header := make(http.Header)
+	for name, value := range record.Headers {
+		header.Set(name, value)
+	}
+	event, err := gateway.ParseWebhook(header, []byte(record.Body))
+	if errors.Is(err, services.ErrInvalidSignature) {
+		c.Error(apperrors.Conflict("Stored event no longer passes signature verification"))
+		return
+	}
+	if err != nil {
+		c.Error(apperrors.BadRequest("Invalid webhook: " + err.Error()))
+		return
+	}
+
+	outcome, err := processGatewayEvent(ctx, client, c, ref, gateway.Name(), *event)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to process webhook event"))
+		return
+	}
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "gateway_event.replay",
+		TargetType: "gateway_event",
+		TargetID:   record.ID,
+		Details: map[string]interface{}{
+			"orderId": record.OrderID,
+			"result":  outcome.Result,
+		},
+	})
+
+	doc, err = ref.Get(ctx)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to fetch webhook event"))
+		return
+	}
+	doc.DataTo(&record)
+	c.JSON(http.StatusOK, gin.H{"event": record})
+}
+
+// processGatewayEvent applies a verified event and records the outcome on
+// its stored copy.
+func processGatewayEvent(ctx context.Context, client *firestore.Client, c *gin.Context, ref *firestore.DocumentRef, provider string, event services.GatewayEvent) (gatewayOutcome, error) {
+	outcome, err := applyGatewayEvent(ctx, client, provider, event)
+
+	now := time.Now()
+	updates := []firestore.Update{
+		{Path: "result", Value: outcome.Result},
+		{Path: "processedAt", Value: &now},
+		{Path: "error", Value: firestore.Delete},
+	}
+	if err != nil {
+		updates = []firestore.Update{{Path: "error", Value: err.Error()}}
+	}
+	if _, err := ref.Update(ctx, updates); err != nil {
+		log.Printf("Warning: failed to update webhook event %s: %v", ref.ID, err)
+	}
+	if err != nil {
+		return outcome, err
+	}
+
+	if outcome.TransactionID != "" {
+		recordAudit(ctx, client, c, models.AuditLog{
+			Action:     "payment.transaction",
+			ActorID:    "gateway:" + provider,
+			TargetType: "payment",
+			TargetID:   outcome.PaymentID,
+			Details: map[string]interface{}{
+				"transactionId": outcome.TransactionID,
+				"amount":        outcome.Amount,
+				"method":        "online",
+				"orderId":       event.OrderID,
+				"overpayment":   outcome.Overpayment,
+			},
+		})
+	}
+	return outcome, nil
+}
+
+// applyGatewayEvent updates the charge named by the event and, once it is
+// paid, records the money against its payment. The charge's status makes
+// this idempotent: a charge is only ever settled once.
+func applyGatewayEvent(ctx context.Context, client *firestore.Client, provider string, event services.GatewayEvent) (gatewayOutcome, error) {
+	chargeRef := client.Collection("payment_charges").Doc(event.OrderID)
+
+	var outcome gatewayOutcome
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		outcome = gatewayOutcome{}
+		now := time.Now()
+
+		doc, err := tx.Get(chargeRef)
+		if status.Code(err) == codes.NotFound {
+			// Not ours, e.g. another system sharing the merchant account
+			outcome.Result = "ignored"
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var charge models.PaymentCharge
+		doc.DataTo(&charge)
+		outcome.PaymentID = charge.PaymentID
+		switch {
+		case charge.Provider != provider:
+			outcome.Result = "ignored"
+			return nil
+		case charge.Status == services.ChargePaid:
+			outcome.Result = "duplicate"
+			return nil
+		}
+
+		switch event.Status {
+		case services.ChargePaid:
+		case services.ChargePending:
+			outcome.Result = services.ChargePending
+			return nil
+		default:
+			outcome.Result = event.Status
+			return tx.Update(chargeRef, []firestore.Update{
+				{Path: "status", Value: event.Status},
+				{Path: "updatedAt", Value: now},
+			})
+		}
+
+		if event.Currency != charge.Currency {
+			// Left for a person to look at
+			outcome.Result = "currency_mismatch"
+			return nil
+		}
+
+		paymentDoc, err := tx.Get(client.Collection("payments").Doc(charge.PaymentID))
+		if err != nil {
+			return err
+		}
+		payment := paymentFromDoc(paymentDoc)
+
+		// Money for a payment that was settled or closed meanwhile is
+		// kept on the charge as an overpayment to be refunded
+		var applied int64
+		if checkPaymentOpen(payment) == nil {
+			applied = min(event.Amount, payment.Balance)
+		}
+		outcome.Result = services.ChargePaid
+		outcome.Amount = applied
+		outcome.Overpayment = event.Amount - applied
+
+		paidAt := event.OccurredAt
+		if paidAt.IsZero() {
+			paidAt = now
+		}
+
+		chargeUpdates := []firestore.Update{
+			{Path: "status", Value: services.ChargePaid},
+			{Path: "paidAt", Value: &paidAt},
+			{Path: "paidAmount", Value: event.Amount},
+			{Path: "overpayment", Value: outcome.Overpayment},
+			{Path: "updatedAt", Value: now},
+		}
+		if applied > 0 {
+			txRef := client.Collection("payments").Doc(payment.ID).Collection("transactions").Doc("gw_" + charge.ID)
+			transaction := models.PaymentTransaction{
+				ID:          txRef.ID,
+				PaymentID:   payment.ID,
+				Amount:      applied,
+				Method:      "online",
+				Reference:   event.ProviderRef,
+				Note:        provider + " order " + charge.ID,
+				ProcessedBy: "gateway:" + provider,
+				ReceivedAt:  paidAt,
+				MinorUnits:  true,
+				CreatedAt:   now,
+			}
+			if err := applyTransaction(tx, client, payment, txRef, &transaction, now); err != nil {
+				return err
+			}
+			outcome.TransactionID = transaction.ID
+			chargeUpdates = append(chargeUpdates, firestore.Update{Path: "transactionId", Value: transaction.ID})
+		}
+		return tx.Update(chargeRef, chargeUpdates)
+	})
+	return outcome, err
+}
@@ -2,10 +2,12 @@ package routes
 
 import (
 	"net/http"
+	"sims-backend-go/apperrors"
 	"sims-backend-go/models"
 	"time"
 
 	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
 	"github.com/gin-gonic/gin"
 	"google.golang.org/api/iterator"
 )
@@ -14,7 +16,7 @@ func GetGrades(c *gin.Context) {
 	ctx := c.Request.Context()
 	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
 		return
 	}
 	defer client.Close()
@@ -29,7 +31,7 @@ func GetGrades(c *gin.Context) {
 			break
 		}
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch grades"})
+			c.Error(apperrors.Internal(err, "Failed to fetch grades"))
 			return
 		}
 
@@ -45,14 +47,14 @@ func GetGrades(c *gin.Context) {
 func CreateGrade(c *gin.Context) {
 	var req models.GradeCreateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperrors.Validation(err))
 		return
 	}
 
 	ctx := c.Request.Context()
 	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
 		return
 	}
 	defer client.Close()
@@ -60,7 +62,7 @@ func CreateGrade(c *gin.Context) {
 	// Get user from context for teacher ID
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		c.Error(apperrors.Unauthorized("User not authenticated"))
 		return
 	}
 
@@ -84,11 +86,12 @@ func CreateGrade(c *gin.Context) {
 
 	docRef, _, err := client.Collection("grades").Add(ctx, grade)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create grade"})
+		c.Error(apperrors.Internal(err, "Failed to create grade"))
 		return
 	}
 
 	grade.ID = docRef.ID
+	setLocation(c, grade.ID)
 	c.JSON(http.StatusCreated, gin.H{"grade": grade})
 }
 
@@ -98,14 +101,14 @@ func GetGrade(c *gin.Context) {
 	ctx := c.Request.Context()
 	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
 		return
 	}
 	defer client.Close()
 
 	doc, err := client.Collection("grades").Doc(gradeID).Get(ctx)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Grade not found"})
+		c.Error(apperrors.FromFirestore(err, "Grade not found", "Failed to fetch grade"))
 		return
 	}
 
@@ -113,26 +116,33 @@ func GetGrade(c *gin.Context) {
 	doc.DataTo(&grade)
 	grade.ID = doc.Ref.ID
 
+	setETag(c, doc)
 	c.JSON(http.StatusOK, gin.H{"grade": grade})
 }
 
 func UpdateGrade(c *gin.Context) {
-	gradeID := c.Param("id")
-
 	var req models.GradeUpdateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperrors.Validation(err))
 		return
 	}
 
-	ctx := c.Request.Context()
-	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	applyGradeUpdate(c, gradeUpdateData(req))
+}
+
+// PatchGrade applies a JSON Merge Patch; null removes an optional field.
+func PatchGrade(c *gin.Context) {
+	var req models.GradeUpdateRequest
+	cleared, err := bindMergePatch(c, &req, models.GradeCreateRequest{})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(err)
 		return
 	}
-	defer client.Close()
 
+	applyGradeUpdate(c, withCleared(gradeUpdateData(req), cleared))
+}
+
+func gradeUpdateData(req models.GradeUpdateRequest) map[string]interface{} {
 	// Prepare update data
 	updateData := map[string]interface{}{
 		"updatedAt": time.Now(),
@@ -157,13 +167,31 @@ func UpdateGrade(c *gin.Context) {
 		updateData["remarks"] = *req.Remarks
 	}
 
-	_, err = client.Collection("grades").Doc(gradeID).Update(ctx, updateData)
+	return updateData
+}
+
+func applyGradeUpdate(c *gin.Context, updateData map[string]interface{}) {
+	gradeID := c.Param("id")
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	doc, err := updateDocument(c, client.Collection("grades").Doc(gradeID), updateData)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update grade"})
+		c.Error(apperrors.FromFirestore(err, "Grade not found", "Failed to update grade"))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Grade updated successfully"})
+	var grade models.Grade
+	doc.DataTo(&grade)
+	grade.ID = doc.Ref.ID
+
+	c.JSON(http.StatusOK, gin.H{"grade": grade})
 }
 
 func DeleteGrade(c *gin.Context) {
@@ -172,14 +200,14 @@ func DeleteGrade(c *gin.Context) {
 	ctx := c.Request.Context()
 	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
 		return
 	}
 	defer client.Close()
 
 	_, err = client.Collection("grades").Doc(gradeID).Delete(ctx)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete grade"})
+		c.Error(apperrors.Internal(err, "Failed to delete grade"))
 		return
 	}
 
@@ -0,0 +1,193 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"sims-backend-go/config"
+	"sync"
+	"time"
+
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+)
+
+// Build information, overridden at build time with
+// -ldflags "-X sims-backend-go/routes.Version=... -X sims-backend-go/routes.Commit=..."
+var (
+	Version = "dev"
+	Commit  = "unknown"
+)
+
+var startTime = time.Now()
+
+const probeTimeout = 3 * time.Second
+
+type probeResult struct {
+	Status    string `json:"status"` // ok, error, skipped
+	LatencyMs int64  `json:"latencyMs"`
+	Error     string `json:"error,omitempty"`
+}
+
+func uptime() time.Duration {
+	return time.Since(startTime).Round(time.Second)
+}
+
+func buildInfo() gin.H {
+	return gin.H{
+		"version":   Version,
+		"commit":    Commit,
+		"goVersion": runtime.Version(),
+	}
+}
+
+func probeFirestore(ctx context.Context) probeResult {
+	if config.FirebaseApp == nil {
+		return probeResult{Status: "skipped"}
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		return probeResult{Status: "error", LatencyMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+	defer client.Close()
+
+	iter := client.Collection("users").Limit(1).Documents(ctx)
+	defer iter.Stop()
+	if _, err := iter.Next(); err != nil && err != iterator.Done {
+		return probeResult{Status: "error", LatencyMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+
+	return probeResult{Status: "ok", LatencyMs: time.Since(start).Milliseconds()}
+}
+
+func probeAuth(ctx context.Context) probeResult {
+	if config.AuthClient == nil {
+		return probeResult{Status: "skipped"}
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	// Looking up a user that cannot exist exercises credentials and
+	// connectivity without depending on any real account.
+	_, err := config.AuthClient.GetUser(ctx, "health-check-probe")
+	if err != nil && !auth.IsUserNotFound(err) {
+		return probeResult{Status: "error", LatencyMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	}
+
+	return probeResult{Status: "ok", LatencyMs: time.Since(start).Milliseconds()}
+}
+
+// runProbes checks all dependencies concurrently and reports whether the
+// service is ready to receive traffic.
+func runProbes(ctx context.Context) (map[string]probeResult, bool) {
+	var (
+		wg         sync.WaitGroup
+		storeProbe probeResult
+		authProbe  probeResult
+	)
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		storeProbe = probeFirestore(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		authProbe = probeAuth(ctx)
+	}()
+	wg.Wait()
+
+	checks := map[string]probeResult{
+		"firestore":    storeProbe,
+		"firebaseAuth": authProbe,
+	}
+
+	ready := true
+	for _, check := range checks {
+		if check.Status == "error" {
+			ready = false
+		}
+	}
+
+	return checks, ready
+}
+
+func HealthCheck(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "healthy",
+		"timestamp": time.Now().Format(time.RFC3339),
+		"uptime":    uptime().String(),
+		"build":     buildInfo(),
+	})
+}
+
+// LivenessCheck only reports that the process is serving requests; it must
+// not depend on external services so the orchestrator does not restart pods
+// during a Firestore outage.
+func LivenessCheck(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":        "alive",
+		"timestamp":     time.Now().Format(time.RFC3339),
+		"uptime":        uptime().String(),
+		"uptimeSeconds": int64(uptime().Seconds()),
+	})
+}
+
+func ReadinessCheck(c *gin.Context) {
+	checks, ready := runProbes(c.Request.Context())
+
+	status := http.StatusOK
+	state := "ready"
+	if !ready {
+		status = http.StatusServiceUnavailable
+		state = "not_ready"
+	}
+
+	c.JSON(status, gin.H{
+		"status":    state,
+		"timestamp": time.Now().Format(time.RFC3339),
+		"checks":    checks,
+	})
+}
+
+func DetailedHealthCheck(c *gin.Context) {
+	checks, ready := runProbes(c.Request.Context())
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	state := "healthy"
+	if !ready {
+		state = "degraded"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":        state,
+		"timestamp":     time.Now().Format(time.RFC3339),
+		"startedAt":     startTime.Format(time.RFC3339),
+		"uptime":        uptime().String(),
+		"uptimeSeconds": int64(uptime().Seconds()),
+		"build":         buildInfo(),
+		"environment":   config.AppConfig.Environment,
+		"checks":        checks,
+		"runtime": gin.H{
+			"goroutines": runtime.NumGoroutine(),
+			"cpus":       runtime.NumCPU(),
+		},
+		"memory": gin.H{
+			"alloc":      mem.Alloc,
+			"totalAlloc": mem.TotalAlloc,
+			"sys":        mem.Sys,
+			"heapInuse":  mem.HeapInuse,
+			"numGC":      mem.NumGC,
+		},
+	})
+}
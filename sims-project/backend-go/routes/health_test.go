@@ -0,0 +1,50 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"sims-backend-go/config"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHealthChecksWithoutFirebase(t *testing.T) {
+	defer func(cfg *config.Config) { config.AppConfig = cfg }(config.AppConfig)
+	config.AppConfig = &config.Config{Environment: "test"}
+
+	tests := []struct {
+		name    string
+		handler gin.HandlerFunc
+		status  string
+	}{
+		{"health", HealthCheck, "healthy"},
+		{"liveness", LivenessCheck, "alive"},
+		{"readiness", ReadinessCheck, "ready"},
+		{"detailed", DetailedHealthCheck, "healthy"},
+	}
+	for _, tt := range tests {
+		c, w := testContext(http.MethodGet, "/health", "", "")
+		tt.handler(c)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: status %d, want 200", tt.name, w.Code)
+			continue
+		}
+		var body struct {
+			Status string                 `json:"status"`
+			Checks map[string]probeResult `json:"checks"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if body.Status != tt.status {
+			t.Errorf("%s: status %q, want %q", tt.name, body.Status, tt.status)
+		}
+		for name, check := range body.Checks {
+			if check.Status != "skipped" {
+				t.Errorf("%s: check %s = %s, want skipped without Firebase", tt.name, name, check.Status)
+			}
+		}
+	}
+}
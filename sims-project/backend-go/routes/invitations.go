@@ -0,0 +1,288 @@
+package routes
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"sims-backend-go/apperrors"
+	"sims-backend-go/models"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const defaultInvitationTTL = 72 * time.Hour
+
+var (
+	errInvalidInvitation    = errors.New("invalid or expired invitation")
+	errInvitationNotPending = errors.New("invitation is not pending")
+)
+
+// generateInvitationCode returns a random code shown to the admin once.
+// Only its hash is stored.
+func generateInvitationCode() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf), nil
+}
+
+// hashInvitationCode normalizes user input (case, dashes, spaces) and
+// returns the document ID the invitation is stored under.
+func hashInvitationCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func GetInvitations(c *gin.Context) {
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	query := client.Collection("invitations").Query
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status", "==", status)
+	}
+
+	iter := query.OrderBy("createdAt", firestore.Desc).Documents(ctx)
+	var invitations []models.Invitation
+	now := time.Now()
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			c.Error(apperrors.Internal(err, "Failed to fetch invitations"))
+			return
+		}
+
+		var invitation models.Invitation
+		doc.DataTo(&invitation)
+		invitation.ID = doc.Ref.ID
+		if invitation.Status == "pending" && now.After(invitation.ExpiresAt) {
+			invitation.Status = "expired"
+		}
+		invitations = append(invitations, invitation)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invitations": invitations})
+}
+
+func CreateInvitation(c *gin.Context) {
+	var req models.InvitationCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	if !models.IsValidRole(req.Role) {
+		c.Error(apperrors.BadRequest("Invalid role"))
+		return
+	}
+
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	code, err := generateInvitationCode()
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to generate invitation code"))
+		return
+	}
+
+	ttl := defaultInvitationTTL
+	if req.ExpiresInHours > 0 {
+		ttl = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+
+	now := time.Now()
+	invitedByEmail, _ := token.Claims["email"].(string)
+	invitation := models.Invitation{
+		ID:             hashInvitationCode(code),
+		Email:          strings.ToLower(req.Email),
+		Role:           req.Role,
+		Status:         "pending",
+		InvitedBy:      token.UID,
+		InvitedByEmail: invitedByEmail,
+		ExpiresAt:      now.Add(ttl),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+
+	_, err = client.Collection("invitations").Doc(invitation.ID).Create(ctx, invitation)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to create invitation"))
+		return
+	}
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "invitation.create",
+		TargetType: "invitation",
+		TargetID:   invitation.ID,
+		Details: map[string]interface{}{
+			"email": invitation.Email,
+			"role":  invitation.Role,
+		},
+	})
+
+	// The plain code is only returned here; it cannot be recovered later
+	c.JSON(http.StatusCreated, gin.H{
+		"invitation": invitation,
+		"code":       code,
+	})
+}
+
+func RevokeInvitation(c *gin.Context) {
+	invitationID := c.Param("id")
+
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	docRef := client.Collection("invitations").Doc(invitationID)
+	var invitation models.Invitation
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(docRef)
+		if err != nil {
+			return err
+		}
+		doc.DataTo(&invitation)
+		if invitation.Status != "pending" {
+			return errInvitationNotPending
+		}
+
+		now := time.Now()
+		invitation.Status = "revoked"
+		invitation.RevokedBy = token.UID
+		invitation.RevokedAt = &now
+		invitation.UpdatedAt = now
+		return tx.Set(docRef, invitation)
+	})
+	if err == errInvitationNotPending {
+		c.Error(apperrors.Conflict("Only pending invitations can be revoked"))
+		return
+	}
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Invitation not found", "Failed to fetch invitation"))
+		return
+	}
+
+	invitation.ID = invitationID
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "invitation.revoke",
+		TargetType: "invitation",
+		TargetID:   invitationID,
+		Details: map[string]interface{}{
+			"email": invitation.Email,
+			"role":  invitation.Role,
+		},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"invitation": invitation})
+}
+
+// consumeInvitation atomically marks a pending invitation for email as used
+// and returns it. Any mismatch yields errInvalidInvitation so callers cannot
+// tell which check failed.
+func consumeInvitation(ctx context.Context, client *firestore.Client, code, email string) (models.Invitation, error) {
+	docRef := client.Collection("invitations").Doc(hashInvitationCode(code))
+
+	var invitation models.Invitation
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(docRef)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return errInvalidInvitation
+			}
+			return err
+		}
+		doc.DataTo(&invitation)
+
+		if err := useInvitation(&invitation, email, time.Now()); err != nil {
+			return err
+		}
+		return tx.Set(docRef, invitation)
+	})
+	invitation.ID = docRef.ID
+
+	return invitation, err
+}
+
+// useInvitation marks a pending, unexpired invitation for email as used.
+func useInvitation(invitation *models.Invitation, email string, now time.Time) error {
+	if invitation.Status != "pending" || now.After(invitation.ExpiresAt) ||
+		!strings.EqualFold(invitation.Email, email) {
+		return errInvalidInvitation
+	}
+
+	invitation.Status = "used"
+	invitation.UsedAt = &now
+	invitation.UpdatedAt = now
+	return nil
+}
+
+// completeInvitation links a consumed invitation to the account created from it.
+func completeInvitation(ctx context.Context, client *firestore.Client, invitationID, uid string) error {
+	_, err := client.Collection("invitations").Doc(invitationID).Set(ctx, map[string]interface{}{
+		"usedBy":    uid,
+		"updatedAt": time.Now(),
+	}, firestore.MergeAll)
+	return err
+}
+
+// releaseInvitation returns a consumed invitation to pending when the
+// signup that consumed it could not be completed.
+func releaseInvitation(ctx context.Context, client *firestore.Client, invitationID string) {
+	_, err := client.Collection("invitations").Doc(invitationID).Set(ctx, map[string]interface{}{
+		"status":    "pending",
+		"usedAt":    nil,
+		"updatedAt": time.Now(),
+	}, firestore.MergeAll)
+	if err != nil {
+		log.Printf("Warning: failed to release invitation %s: %v", invitationID, err)
+	}
+}
@@ -0,0 +1,97 @@
+package routes
+
+import (
+	"context"
+	"sims-backend-go/models"
+	"testing"
+	"time"
+)
+
+func TestHashInvitationCode(t *testing.T) {
+	want := hashInvitationCode("ABCDEFGH")
+	for _, code := range []string{"abcdefgh", "ABCD-EFGH", " abcd efgh ", "AbCd-EfGh"} {
+		if got := hashInvitationCode(code); got != want {
+			t.Errorf("hashInvitationCode(%q) differs from ABCDEFGH", code)
+		}
+	}
+	if hashInvitationCode("ABCDEFGI") == want {
+		t.Error("different codes hash the same")
+	}
+
+	code, err := generateInvitationCode()
+	if err != nil || len(code) != 32 {
+		t.Errorf("generateInvitationCode = %q, %v", code, err)
+	}
+}
+
+func TestUseInvitation(t *testing.T) {
+	now := time.Date(2025, 1, 10, 8, 0, 0, 0, time.UTC)
+	pending := models.Invitation{Email: "Guru@Sekolah.sch.id", Role: "teacher", Status: "pending", ExpiresAt: now.Add(time.Hour)}
+
+	tests := []struct {
+		name   string
+		modify func(*models.Invitation)
+		email  string
+		valid  bool
+	}{
+		{"pending", func(*models.Invitation) {}, "guru@sekolah.sch.id", true},
+		{"other email", func(*models.Invitation) {}, "murid@sekolah.sch.id", false},
+		{"expired", func(i *models.Invitation) { i.ExpiresAt = now.Add(-time.Second) }, "guru@sekolah.sch.id", false},
+		{"already used", func(i *models.Invitation) { i.Status = "used" }, "guru@sekolah.sch.id", false},
+		{"revoked", func(i *models.Invitation) { i.Status = "revoked" }, "guru@sekolah.sch.id", false},
+	}
+	for _, tt := range tests {
+		invitation := pending
+		tt.modify(&invitation)
+		err := useInvitation(&invitation, tt.email, now)
+		if !tt.valid {
+			if err != errInvalidInvitation {
+				t.Errorf("%s: err = %v, want errInvalidInvitation", tt.name, err)
+			}
+			continue
+		}
+		if err != nil || invitation.Status != "used" || invitation.UsedAt == nil || !invitation.UsedAt.Equal(now) {
+			t.Errorf("%s: invitation = %+v, %v", tt.name, invitation, err)
+		}
+	}
+}
+
+func TestConsumeAndReleaseInvitation(t *testing.T) {
+	client := emulatorClient(t)
+	ctx := context.Background()
+
+	code := "TESTCODE-" + time.Now().Format("150405.000000")
+	ref := client.Collection("invitations").Doc(hashInvitationCode(code))
+	if _, err := ref.Set(ctx, models.Invitation{Email: "guru@sekolah.sch.id", Role: "teacher", Status: "pending", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ref.Delete(context.Background()) })
+
+	invitation, err := consumeInvitation(ctx, client, code, "guru@sekolah.sch.id")
+	if err != nil || invitation.Role != "teacher" {
+		t.Fatalf("consumeInvitation = %+v, %v", invitation, err)
+	}
+	// Single use
+	if _, err := consumeInvitation(ctx, client, code, "guru@sekolah.sch.id"); err != errInvalidInvitation {
+		t.Errorf("second consume: err = %v, want errInvalidInvitation", err)
+	}
+
+	// A failed signup gives the invitation back
+	releaseInvitation(ctx, client, invitation.ID)
+	if _, err := consumeInvitation(ctx, client, code, "guru@sekolah.sch.id"); err != nil {
+		t.Errorf("consume after release: %v", err)
+	}
+
+	if err := completeInvitation(ctx, client, invitation.ID, "uid-1"); err != nil {
+		t.Fatalf("completeInvitation: %v", err)
+	}
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored models.Invitation
+	doc.DataTo(&stored)
+	if stored.Status != "used" || stored.UsedBy != "uid-1" {
+		t.Errorf("stored invitation = %+v", stored)
+	}
+}
@@ -0,0 +1,550 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sims-backend-go/apperrors"
+	"sims-backend-go/config"
+	"sims-backend-go/models"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// lateFeePaymentType is the payment type of penalty payments. Late fees are
+// never charged on late fees.
+const lateFeePaymentType = "late_fee"
+
+func GetLateFeePolicies(c *gin.Context) {
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	policies, err := loadLateFeePolicies(ctx, client)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to fetch late fee policies"))
+		return
+	}
+
+	list := make([]models.LateFeePolicy, 0, len(policies))
+	for _, policy := range policies {
+		list = append(list, policy)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].PaymentType < list[j].PaymentType })
+
+	c.JSON(http.StatusOK, gin.H{"lateFeePolicies": list})
+}
+
+func GetLateFeePolicy(c *gin.Context) {
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	doc, err := client.Collection("late_fee_policies").Doc(c.Param("paymentType")).Get(ctx)
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Late fee policy not found", "Failed to fetch late fee policy"))
+		return
+	}
+
+	var policy models.LateFeePolicy
+	doc.DataTo(&policy)
+
+	setETag(c, doc)
+	c.JSON(http.StatusOK, gin.H{"lateFeePolicy": policy})
+}
+
+// PutLateFeePolicy creates or replaces the policy of a payment type. It
+// applies to payments that become overdue from the next assessment on;
+// late fees already charged are kept.
+func PutLateFeePolicy(c *gin.Context) {
+	paymentType := c.Param("paymentType")
+	if !feePeriodPattern.MatchString(paymentType) || paymentType == lateFeePaymentType {
+		c.Error(apperrors.BadRequest("Invalid payment type"))
+		return
+	}
+
+	var req models.LateFeePolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	currency, err := resolveCurrency(req.Currency)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	policy := models.LateFeePolicy{
+		PaymentType: paymentType,
+		Description: req.Description,
+		Type:        req.Type,
+		Currency:    currency,
+		GraceDays:   req.GraceDays,
+		MaxAmount:   req.MaxAmount,
+		IsActive:    req.IsActive == nil || *req.IsActive,
+		UpdatedBy:   token.UID,
+		UpdatedAt:   time.Now(),
+	}
+	if policy.Type == "flat" {
+		policy.Amount = req.Amount
+	} else {
+		policy.Percent = req.Percent
+	}
+
+	if _, err := client.Collection("late_fee_policies").Doc(paymentType).Set(ctx, policy); err != nil {
+		c.Error(apperrors.Internal(err, "Failed to save late fee policy"))
+		return
+	}
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "late_fee_policy.update",
+		TargetType: "late_fee_policy",
+		TargetID:   paymentType,
+		Details: map[string]interface{}{
+			"type":      policy.Type,
+			"amount":    policy.Amount,
+			"percent":   policy.Percent,
+			"graceDays": policy.GraceDays,
+			"maxAmount": policy.MaxAmount,
+			"isActive":  policy.IsActive,
+		},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"lateFeePolicy": policy})
+}
+
+func DeleteLateFeePolicy(c *gin.Context) {
+	paymentType := c.Param("paymentType")
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	if _, err := client.Collection("late_fee_policies").Doc(paymentType).Delete(ctx); err != nil {
+		c.Error(apperrors.Internal(err, "Failed to delete late fee policy"))
+		return
+	}
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "late_fee_policy.delete",
+		TargetType: "late_fee_policy",
+		TargetID:   paymentType,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Late fee policy deleted successfully"})
+}
+
+// PreviewLateFees shows what AssessLateFees would change without writing
+// anything.
+func PreviewLateFees(c *gin.Context) {
+	runLateFeeAssessment(c, true)
+}
+
+// AssessLateFees marks open payments past their due date as overdue and
+// charges a late fee for those past the grace period of their type's
+// policy. Each payment gets at most one late fee, so it is safe to run on a
+// schedule, e.g. daily with an API key.
+func AssessLateFees(c *gin.Context) {
+	runLateFeeAssessment(c, false)
+}
+
+func runLateFeeAssessment(c *gin.Context, dryRun bool) {
+	var req models.LateFeeAssessRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	asOf := time.Now()
+	if req.AsOf != nil {
+		if req.AsOf.After(asOf) {
+			c.Error(apperrors.ValidationFailed(apperrors.FieldError{Field: "asOf", Rule: "lte", Message: "cannot be in the future"}))
+			return
+		}
+		asOf = *req.AsOf
+	}
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	result, err := planLateFees(ctx, client, asOf)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to plan late fees"))
+		return
+	}
+	result.DryRun = dryRun
+
+	if dryRun {
+		c.JSON(http.StatusOK, gin.H{"assessment": result})
+		return
+	}
+
+	processedBy := ""
+	if user, exists := c.Get("user"); exists {
+		processedBy = user.(*auth.Token).UID
+	}
+
+	result.MarkedOverdue = 0
+	result.Charged = 0
+	now := time.Now()
+	for i := range result.Items {
+		item := &result.Items[i]
+		marked, charged, err := applyLateFee(ctx, client, item, asOf, processedBy, now)
+		if err != nil {
+			c.Error(apperrors.Internal(err, "Failed to assess late fees, retrying is safe"))
+			return
+		}
+		if marked {
+			result.MarkedOverdue++
+		}
+		if charged {
+			result.Charged++
+		}
+	}
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "late_fee.assess",
+		TargetType: "payment",
+		Details: map[string]interface{}{
+			"asOf":          asOf,
+			"markedOverdue": result.MarkedOverdue,
+			"charged":       result.Charged,
+		},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"assessment": result})
+}
+
+// planLateFees lists the open payments that are overdue as of asOf and the
+// late fees they are due for.
+func planLateFees(ctx context.Context, client *firestore.Client, asOf time.Time) (*models.LateFeeAssessment, error) {
+	policies, err := loadLateFeePolicies(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.LateFeeAssessment{
+		AsOf:  asOf,
+		Items: []models.LateFeeItem{},
+	}
+
+	iter := client.Collection("payments").Where("status", "in", openPaymentStatuses).Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		payment := paymentFromDoc(doc)
+		if payment.LateFeeFor != "" || payment.Balance <= 0 {
+			continue
+		}
+		dueDate := overdueSince(payment)
+		if !dueDate.Before(asOf) {
+			continue
+		}
+
+		item := models.LateFeeItem{
+			PaymentID:   payment.ID,
+			StudentID:   payment.StudentID,
+			PaymentType: payment.PaymentType,
+			DueDate:     dueDate,
+			Balance:     payment.Balance,
+			Currency:    payment.Currency,
+			MarkOverdue: payment.Status != "overdue",
+		}
+		if policy, ok := policies[payment.PaymentType]; ok && policy.IsActive && payment.LateFeeID == "" {
+			item.GraceUntil = dueDate.AddDate(0, 0, policy.GraceDays)
+			if asOf.After(item.GraceUntil) {
+				item.LateFeeAmount = lateFeeAmount(policy, payment)
+				if item.LateFeeAmount > 0 {
+					item.LateFeeID = lateFeePaymentID(payment.ID)
+				}
+			}
+		}
+		if !item.MarkOverdue && item.LateFeeID == "" {
+			continue
+		}
+
+		result.Items = append(result.Items, item)
+		if item.MarkOverdue {
+			result.MarkedOverdue++
+		}
+		if item.LateFeeID != "" {
+			result.Charged++
+		}
+	}
+
+	sort.Slice(result.Items, func(i, j int) bool {
+		return result.Items[i].DueDate.Before(result.Items[j].DueDate)
+	})
+	return result, nil
+}
+
+// applyLateFee marks the item's payment overdue and creates its late fee,
+// re-checking the payment in a transaction so concurrent runs and payments
+// recorded since planning are respected.
+func applyLateFee(ctx context.Context, client *firestore.Client, item *models.LateFeeItem, asOf time.Time, processedBy string, now time.Time) (bool, bool, error) {
+	ref := client.Collection("payments").Doc(item.PaymentID)
+	var marked, charged bool
+
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		marked, charged = false, false
+
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		payment := paymentFromDoc(doc)
+		if checkPaymentOpen(payment) != nil || payment.Balance <= 0 {
+			return nil
+		}
+
+		var penaltyRef *firestore.DocumentRef
+		if item.LateFeeID != "" && payment.LateFeeID == "" {
+			penaltyRef = client.Collection("payments").Doc(item.LateFeeID)
+			_, err := tx.Get(penaltyRef)
+			if err != nil && status.Code(err) != codes.NotFound {
+				return err
+			}
+			// Created by an earlier run that failed to link it
+			if err == nil {
+				return tx.Update(ref, []firestore.Update{
+					{Path: "status", Value: "overdue"},
+					{Path: "lateFeeId", Value: penaltyRef.ID},
+					{Path: "updatedAt", Value: now},
+				})
+			}
+		}
+
+		updates := []firestore.Update{{Path: "updatedAt", Value: now}}
+		if payment.Status != "overdue" {
+			updates = append(updates, firestore.Update{Path: "status", Value: "overdue"})
+			marked = true
+		}
+		if penaltyRef != nil {
+			penalty := models.Payment{
+				StudentID:    payment.StudentID,
+				Amount:       item.LateFeeAmount,
+				Currency:     payment.Currency,
+				Description:  "Late fee: " + payment.Description,
+				PaymentType:  lateFeePaymentType,
+				Status:       "pending",
+				DueDate:      asOf,
+				ProcessedBy:  processedBy,
+				AcademicYear: payment.AcademicYear,
+				Semester:     payment.Semester,
+				LateFeeFor:   payment.ID,
+				MinorUnits:   true,
+				CreatedAt:    now,
+				UpdatedAt:    now,
+			}
+			if err := tx.Create(penaltyRef, penalty); err != nil {
+				return err
+			}
+			updates = append(updates, firestore.Update{Path: "lateFeeId", Value: penaltyRef.ID})
+			charged = true
+		}
+		if !marked && !charged {
+			return nil
+		}
+		return tx.Update(ref, updates)
+	})
+	return marked, charged, err
+}
+
+// WaiveLateFee cancels the outstanding part of a late fee. The waiver is
+// recorded as approved by the caller and added to the penalty's
+// adjustments, like waivers approved by a second role.
+func WaiveLateFee(c *gin.Context) {
+	paymentID := c.Param("id")
+
+	var req models.LateFeeWaiveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+	role := config.TokenRole(token)
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	ref := client.Collection("payments").Doc(paymentID)
+	waiverRef := client.Collection("payment_waivers").NewDoc()
+	now := time.Now()
+	var waiver models.PaymentWaiver
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		payment := paymentFromDoc(doc)
+		if payment.LateFeeFor == "" {
+			return apperrors.BadRequest("Payment is not a late fee")
+		}
+		if err := checkWaivable(payment, payment.Balance); err != nil {
+			return err
+		}
+
+		waiver = models.PaymentWaiver{
+			ID:            waiverRef.ID,
+			PaymentID:     payment.ID,
+			StudentID:     payment.StudentID,
+			Amount:        payment.Balance,
+			Currency:      payment.Currency,
+			Reason:        req.Reason,
+			Status:        "approved",
+			RequestedBy:   token.UID,
+			RequestedRole: role,
+			ReviewedBy:    token.UID,
+			ReviewedRole:  role,
+			ReviewedAt:    &now,
+			CreatedAt:     now,
+		}
+		if err := waivePayment(tx, client, payment, waiver, now); err != nil {
+			return err
+		}
+		return tx.Create(waiverRef, waiver)
+	})
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Payment not found", "Failed to waive late fee"))
+		return
+	}
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "payment.late_fee_waive",
+		TargetType: "payment",
+		TargetID:   paymentID,
+		Details: map[string]interface{}{
+			"waiverId": waiver.ID,
+			"amount":   waiver.Amount,
+			"reason":   waiver.Reason,
+		},
+	})
+
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to fetch payment"))
+		return
+	}
+
+	setETag(c, doc)
+	c.JSON(http.StatusOK, gin.H{"waiver": waiver, "payment": paymentFromDoc(doc)})
+}
+
+func loadLateFeePolicies(ctx context.Context, client *firestore.Client) (map[string]models.LateFeePolicy, error) {
+	iter := client.Collection("late_fee_policies").Documents(ctx)
+	defer iter.Stop()
+
+	policies := make(map[string]models.LateFeePolicy)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var policy models.LateFeePolicy
+		doc.DataTo(&policy)
+		policy.PaymentType = doc.Ref.ID
+		policies[policy.PaymentType] = policy
+	}
+	return policies, nil
+}
+
+// overdueSince returns when a payment fell due: the earliest unpaid
+// installment of a plan, otherwise the payment's due date.
+func overdueSince(payment models.Payment) time.Time {
+	for _, installment := range payment.Installments {
+		if installment.Status != "paid" {
+			return installment.DueDate
+		}
+	}
+	return payment.DueDate
+}
+
+// lateFeeAmount is the penalty the policy charges for payment: a flat
+// amount in the policy's currency or a percentage of the outstanding
+// balance, rounded down, limited to the policy's cap.
+func lateFeeAmount(policy models.LateFeePolicy, payment models.Payment) int64 {
+	var amount int64
+	switch policy.Type {
+	case "flat":
+		// A flat amount cannot be converted to another currency
+		if policy.Currency != payment.Currency {
+			return 0
+		}
+		amount = policy.Amount
+	case "percentage":
+		amount = payment.Balance * int64(policy.Percent) / 100
+	}
+	if policy.MaxAmount > 0 && policy.Currency == payment.Currency {
+		amount = min(amount, policy.MaxAmount)
+	}
+	return amount
+}
+
+func lateFeePaymentID(paymentID string) string {
+	return "latefee_" + paymentID
+}
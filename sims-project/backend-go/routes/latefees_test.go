@@ -0,0 +1,59 @@
+package routes
+
+import (
+	"sims-backend-go/models"
+	"testing"
+	"time"
+)
+
+func TestLateFeeAmount(t *testing.T) {
+	idr := models.Payment{Currency: "IDR", Balance: 1000000}
+	usd := models.Payment{Currency: "USD", Balance: 1000000}
+
+	tests := []struct {
+		name    string
+		policy  models.LateFeePolicy
+		payment models.Payment
+		want    int64
+	}{
+		{"flat", models.LateFeePolicy{Type: "flat", Amount: 5000000, Currency: "IDR"}, idr, 5000000},
+		{"flat in another currency", models.LateFeePolicy{Type: "flat", Amount: 5000000, Currency: "IDR"}, usd, 0},
+		{"flat under cap", models.LateFeePolicy{Type: "flat", Amount: 5000000, Currency: "IDR", MaxAmount: 10000000}, idr, 5000000},
+		{"flat over cap", models.LateFeePolicy{Type: "flat", Amount: 5000000, Currency: "IDR", MaxAmount: 2500000}, idr, 2500000},
+		{"percentage", models.LateFeePolicy{Type: "percentage", Percent: 2, Currency: "IDR"}, idr, 20000},
+		{"percentage rounds down", models.LateFeePolicy{Type: "percentage", Percent: 2, Currency: "IDR"}, models.Payment{Currency: "IDR", Balance: 149}, 2},
+		{"percentage capped", models.LateFeePolicy{Type: "percentage", Percent: 5, Currency: "IDR", MaxAmount: 30000}, idr, 30000},
+		{"cap in another currency ignored", models.LateFeePolicy{Type: "percentage", Percent: 5, Currency: "IDR", MaxAmount: 30000}, usd, 50000},
+		{"nothing outstanding", models.LateFeePolicy{Type: "percentage", Percent: 5, Currency: "IDR"}, models.Payment{Currency: "IDR"}, 0},
+		{"unknown type", models.LateFeePolicy{Type: "daily", Amount: 1000, Currency: "IDR"}, idr, 0},
+	}
+	for _, tt := range tests {
+		if got := lateFeeAmount(tt.policy, tt.payment); got != tt.want {
+			t.Errorf("%s: lateFeeAmount = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOverdueSince(t *testing.T) {
+	due := date(2025, time.March, 10)
+	payment := models.Payment{DueDate: due}
+	if got := overdueSince(payment); !got.Equal(due) {
+		t.Errorf("without installments: %s, want %s", got, due)
+	}
+
+	payment.Installments = []models.Installment{
+		{Number: 1, DueDate: date(2025, time.January, 10), Status: "paid"},
+		{Number: 2, DueDate: date(2025, time.February, 10), Status: "partially_paid"},
+		{Number: 3, DueDate: due, Status: "pending"},
+	}
+	if got, want := overdueSince(payment), date(2025, time.February, 10); !got.Equal(want) {
+		t.Errorf("first unpaid installment: %s, want %s", got, want)
+	}
+
+	for i := range payment.Installments {
+		payment.Installments[i].Status = "paid"
+	}
+	if got := overdueSince(payment); !got.Equal(due) {
+		t.Errorf("all installments paid: %s, want %s", got, due)
+	}
+}
@@ -0,0 +1,613 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sims-backend-go/apperrors"
+	"sims-backend-go/config"
+	"sims-backend-go/models"
+	"sims-backend-go/services"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+)
+
+const ledgerDateFormat = "2006-01-02"
+
+// GetStudentLedger returns a student's account with a running balance,
+// optionally limited to ?from= and ?to= (YYYY-MM-DD, inclusive). Payments
+// in other currencies than ?currency= (the default currency unless given)
+// are left out.
+func GetStudentLedger(c *gin.Context) {
+	from, to, err := parseLedgerRange(c, nil, nil)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	ledger, ok := loadStudentLedger(c, from, to)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ledger": ledger})
+}
+
+// GetStudentStatement returns the ledger for a date range, the current
+// month by default, as JSON or with ?format=pdf as a downloadable PDF.
+func GetStudentStatement(c *gin.Context) {
+	now := time.Now().UTC()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	from, to, err := parseLedgerRange(c, &monthStart, &today)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "pdf" {
+		c.Error(apperrors.ValidationFailed(apperrors.FieldError{Field: "format", Rule: "oneof", Message: "must be json or pdf"}))
+		return
+	}
+
+	ledger, ok := loadStudentLedger(c, from, to)
+	if !ok {
+		return
+	}
+
+	if format == "json" {
+		c.JSON(http.StatusOK, gin.H{"statement": ledger})
+		return
+	}
+
+	name := fmt.Sprintf("statement-%s-%s-%s", ledger.StudentID, from.Format(ledgerDateFormat), to.Format(ledgerDateFormat))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, name))
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "application/pdf", renderStatement(ledger))
+}
+
+// GetMyAccounts lists the accounts the caller may view as a student or
+// parent, with what each still owes per currency.
+func GetMyAccounts(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	var students []models.User
+	switch config.TokenRole(token) {
+	case "student":
+		doc, err := client.Collection("users").Doc(token.UID).Get(ctx)
+		if err != nil {
+			c.Error(apperrors.FromFirestore(err, "User not found", "Failed to fetch user"))
+			return
+		}
+		var student models.User
+		doc.DataTo(&student)
+		student.ID = doc.Ref.ID
+		students = append(students, student)
+	case "parent":
+		iter := client.Collection("users").Where("parentId", "==", token.UID).Where("role", "==", "student").Documents(ctx)
+		for {
+			doc, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				c.Error(apperrors.Internal(err, "Failed to fetch children"))
+				return
+			}
+			var student models.User
+			doc.DataTo(&student)
+			student.ID = doc.Ref.ID
+			students = append(students, student)
+		}
+	}
+
+	accounts := []models.StudentAccount{}
+	for _, student := range students {
+		byCurrency := make(map[string]*models.StudentAccount)
+		iter := client.Collection("payments").Where("studentId", "==", student.ID).Where("status", "in", openPaymentStatuses).Documents(ctx)
+		for {
+			doc, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				c.Error(apperrors.Internal(err, "Failed to fetch payments"))
+				return
+			}
+
+			payment := paymentFromDoc(doc)
+			account, ok := byCurrency[payment.Currency]
+			if !ok {
+				account = &models.StudentAccount{StudentID: student.ID, StudentName: student.DisplayName, Currency: payment.Currency}
+				byCurrency[payment.Currency] = account
+			}
+			account.Payments++
+			account.Outstanding += payment.Balance
+			if payment.Status == "overdue" {
+				account.Overdue += payment.Balance
+			}
+		}
+
+		// Students without open payments are listed with nothing owed
+		if len(byCurrency) == 0 {
+			accounts = append(accounts, models.StudentAccount{StudentID: student.ID, StudentName: student.DisplayName, Currency: config.AppConfig.DefaultCurrency})
+			continue
+		}
+		for _, account := range byCurrency {
+			accounts = append(accounts, *account)
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		if accounts[i].StudentName != accounts[j].StudentName {
+			return accounts[i].StudentName < accounts[j].StudentName
+		}
+		return accounts[i].Currency < accounts[j].Currency
+	})
+
+	c.JSON(http.StatusOK, gin.H{"accounts": accounts})
+}
+
+// loadStudentLedger authorizes the caller and builds the ledger of the
+// student in the path, reporting errors on c.
+func loadStudentLedger(c *gin.Context, from, to *time.Time) (*models.StudentLedger, bool) {
+	currency, err := resolveCurrency(c.Query("currency"))
+	if err != nil {
+		c.Error(err)
+		return nil, false
+	}
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return nil, false
+	}
+	defer client.Close()
+
+	student, err := authorizeStudentAccount(c, client, c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return nil, false
+	}
+
+	ledger, err := buildStudentLedger(ctx, client, student, currency, from, to)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to build ledger"))
+		return nil, false
+	}
+	return ledger, true
+}
+
+// authorizeStudentAccount loads the student whose account is requested.
+// Students may view their own account and parents those of their
+// children; anyone else needs payments:read.
+func authorizeStudentAccount(c *gin.Context, client *firestore.Client, studentID string) (models.User, error) {
+	user, exists := c.Get("user")
+	if !exists {
+		return models.User{}, apperrors.Unauthorized("User not authenticated")
+	}
+
+	token := user.(*auth.Token)
+	permissions, err := config.PrincipalPermissions(c, token)
+	if err != nil {
+		return models.User{}, apperrors.Unavailable(err, "Unable to verify permissions")
+	}
+	staff := containsString(permissions, config.PermPaymentsRead)
+
+	doc, err := client.Collection("users").Doc(studentID).Get(c.Request.Context())
+	if err != nil {
+		// Only staff learn whether a student exists
+		if !staff {
+			return models.User{}, apperrors.Forbidden("Insufficient permissions").With("permission", config.PermPaymentsRead)
+		}
+		return models.User{}, apperrors.FromFirestore(err, "Student not found", "Failed to fetch student")
+	}
+
+	var student models.User
+	doc.DataTo(&student)
+	student.ID = doc.Ref.ID
+
+	// API keys act for machine clients, never as a student or parent
+	_, apiKey := c.Get("apiKey")
+	own := !apiKey && (token.UID == student.ID || (student.ParentID != "" && token.UID == student.ParentID))
+	switch {
+	case !staff && !own:
+		return models.User{}, apperrors.Forbidden("Insufficient permissions").With("permission", config.PermPaymentsRead)
+	case student.Role != "student":
+		return models.User{}, apperrors.NotFound("Student not found")
+	}
+	return student, nil
+}
+
+// parseLedgerRange reads ?from= and ?to= as dates, falling back to the
+// given defaults.
+func parseLedgerRange(c *gin.Context, from, to *time.Time) (*time.Time, *time.Time, error) {
+	for _, field := range []struct {
+		name   string
+		target **time.Time
+	}{{"from", &from}, {"to", &to}} {
+		value := c.Query(field.name)
+		if value == "" {
+			continue
+		}
+		date, err := time.Parse(ledgerDateFormat, value)
+		if err != nil {
+			return nil, nil, apperrors.ValidationFailed(apperrors.FieldError{Field: field.name, Rule: "format", Message: "must be a date in YYYY-MM-DD format"})
+		}
+		*field.target = &date
+	}
+
+	if from != nil && to != nil && to.Before(*from) {
+		return nil, nil, apperrors.ValidationFailed(apperrors.FieldError{Field: "to", Rule: "gtefield", Message: "must not be before from"})
+	}
+	return from, to, nil
+}
+
+// buildStudentLedger collects every payment of the student in currency
+// with its adjustments and transactions and computes the running balance.
+func buildStudentLedger(ctx context.Context, client *firestore.Client, student models.User, currency string, from, to *time.Time) (*models.StudentLedger, error) {
+	ledger := &models.StudentLedger{
+		StudentID:     student.ID,
+		StudentName:   student.DisplayName,
+		StudentNumber: student.StudentID,
+		Currency:      currency,
+		From:          from,
+		To:            to,
+		Entries:       []models.LedgerEntry{},
+		Outstanding:   []models.Payment{},
+		GeneratedAt:   time.Now(),
+	}
+
+	// Waiver adjustments are dated by their approval
+	waivedAt := make(map[string]time.Time)
+	waivers := client.Collection("payment_waivers").Where("studentId", "==", student.ID).Where("status", "==", "approved").Documents(ctx)
+	for {
+		doc, err := waivers.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var waiver models.PaymentWaiver
+		doc.DataTo(&waiver)
+		if waiver.ReviewedAt != nil {
+			waivedAt[doc.Ref.ID] = *waiver.ReviewedAt
+		}
+	}
+
+	var entries []models.LedgerEntry
+	iter := client.Collection("payments").Where("studentId", "==", student.ID).Where("currency", "==", currency).Documents(ctx)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		payment := paymentFromDoc(doc)
+
+		var transactions []models.PaymentTransaction
+		txIter := doc.Ref.Collection("transactions").OrderBy("receivedAt", firestore.Asc).Documents(ctx)
+		for {
+			txDoc, err := txIter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			var transaction models.PaymentTransaction
+			txDoc.DataTo(&transaction)
+			transaction.ID = txDoc.Ref.ID
+			transactions = append(transactions, transaction)
+		}
+
+		entries = append(entries, paymentLedgerEntries(payment, transactions, waivedAt)...)
+		if checkPaymentOpen(payment) == nil && payment.Balance > 0 {
+			ledger.Outstanding = append(ledger.Outstanding, payment)
+		}
+	}
+
+	sort.Slice(ledger.Outstanding, func(i, j int) bool {
+		return ledger.Outstanding[i].DueDate.Before(ledger.Outstanding[j].DueDate)
+	})
+
+	postLedgerEntries(ledger, entries)
+	return ledger, nil
+}
+
+// postLedgerEntries orders entries and adds them to the ledger with their
+// running balance. Entries before From only count towards the opening
+// balance and entries after To are left out.
+func postLedgerEntries(ledger *models.StudentLedger, entries []models.LedgerEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].Date.Equal(entries[j].Date) {
+			return entries[i].Date.Before(entries[j].Date)
+		}
+		return ledgerEntryRank(entries[i].Type) < ledgerEntryRank(entries[j].Type)
+	})
+
+	from, to := ledger.From, ledger.To
+	var end time.Time
+	if to != nil {
+		end = to.AddDate(0, 0, 1)
+	}
+	balance := int64(0)
+	for _, entry := range entries {
+		if to != nil && !entry.Date.Before(end) {
+			break
+		}
+		balance += entry.Debit - entry.Credit
+		entry.Balance = balance
+		if from != nil && entry.Date.Before(*from) {
+			ledger.OpeningBalance = balance
+			continue
+		}
+		ledger.TotalDebit += entry.Debit
+		ledger.TotalCredit += entry.Credit
+		ledger.Entries = append(ledger.Entries, entry)
+	}
+	ledger.ClosingBalance = balance
+}
+
+// paymentLedgerEntries turns a payment into ledger entries: the charge at
+// its gross amount, each adjustment, each receipt and refund, and a
+// cancellation of what is no longer owed once the payment is closed.
+func paymentLedgerEntries(payment models.Payment, transactions []models.PaymentTransaction, waivedAt map[string]time.Time) []models.LedgerEntry {
+	chargeType := "charge"
+	if payment.LateFeeFor != "" {
+		chargeType = "late_fee"
+	}
+	gross := payment.Amount
+	if len(payment.Adjustments) > 0 {
+		gross = payment.GrossAmount
+	}
+
+	entries := []models.LedgerEntry{{
+		Date:        payment.CreatedAt,
+		Type:        chargeType,
+		PaymentID:   payment.ID,
+		Description: payment.Description,
+		Debit:       gross,
+	}}
+
+	for _, adjustment := range payment.Adjustments {
+		date := payment.CreatedAt
+		if at, ok := waivedAt[adjustment.SourceID]; ok {
+			date = at
+		}
+		description := adjustment.Description
+		if description == "" {
+			description = adjustment.Kind
+		}
+		entries = append(entries, models.LedgerEntry{
+			Date:        date,
+			Type:        adjustment.Kind,
+			PaymentID:   payment.ID,
+			Description: description + " (" + payment.Description + ")",
+			Credit:      adjustment.Amount,
+		})
+	}
+
+	for _, transaction := range transactions {
+		entry := models.LedgerEntry{
+			Date:          transaction.ReceivedAt,
+			Type:          "receipt",
+			PaymentID:     payment.ID,
+			TransactionID: transaction.ID,
+			Description:   "Payment received: " + payment.Description,
+			Reference:     transaction.Reference,
+			Credit:        transaction.Amount,
+		}
+		if transaction.Kind == "refund" {
+			entry.Type = "refund"
+			entry.Description = "Refund: " + payment.Description
+			entry.Debit, entry.Credit = -transaction.Amount, 0
+		}
+		entries = append(entries, entry)
+	}
+
+	// Marked paid before transactions were recorded
+	if len(transactions) == 0 && payment.PaidAmount > 0 {
+		date := payment.UpdatedAt
+		if payment.PaidDate != nil {
+			date = *payment.PaidDate
+		}
+		entries = append(entries, models.LedgerEntry{
+			Date:        date,
+			Type:        "receipt",
+			PaymentID:   payment.ID,
+			Description: "Payment received: " + payment.Description,
+			Reference:   payment.Reference,
+			Credit:      payment.PaidAmount,
+		})
+	}
+
+	if payment.Status == "cancelled" || payment.Status == "refunded" {
+		entries = append(entries, models.LedgerEntry{
+			Date:        payment.UpdatedAt,
+			Type:        "cancellation",
+			PaymentID:   payment.ID,
+			Description: "Cancelled: " + payment.Description,
+			Credit:      payment.Balance,
+		})
+	}
+	return entries
+}
+
+// ledgerEntryRank orders entries of the same moment: charges before what
+// reduces them.
+func ledgerEntryRank(entryType string) int {
+	switch entryType {
+	case "charge", "late_fee":
+		return 0
+	case "receipt":
+		return 2
+	case "refund":
+		return 3
+	case "cancellation":
+		return 4
+	default:
+		return 1
+	}
+}
+
+// renderStatement lays out a statement of account over as many A4 pages
+// as its entries need.
+func renderStatement(ledger *models.StudentLedger) []byte {
+	const (
+		left        = 50.0
+		right       = services.A4Width - 50
+		debitRight  = 375.0
+		creditRight = 460.0
+		bottom      = services.A4Height - 60
+	)
+	school := config.AppConfig.School
+
+	pdf := services.NewPDF(services.A4Width, services.A4Height)
+	pdf.SetTitle("Statement " + ledger.StudentName)
+
+	period := "All entries"
+	switch {
+	case ledger.From != nil && ledger.To != nil:
+		period = ledger.From.Format("02 Jan 2006") + " - " + ledger.To.Format("02 Jan 2006")
+	case ledger.From != nil:
+		period = "From " + ledger.From.Format("02 Jan 2006")
+	case ledger.To != nil:
+		period = "Until " + ledger.To.Format("02 Jan 2006")
+	}
+
+	// School header and statement details
+	y := 70.0
+	pdf.Text(left, y, 18, true, school.Name)
+	pdf.TextRight(right, y, 16, true, "STATEMENT OF ACCOUNT")
+	y += 16
+	if school.Address != "" {
+		pdf.Text(left, y, 10, false, school.Address)
+	}
+	pdf.TextRight(right, y, 10, false, period)
+	y += 14
+	if school.Phone != "" {
+		pdf.Text(left, y, 10, false, "Phone: "+school.Phone)
+	}
+	pdf.TextRight(right, y, 10, false, "Amounts in "+ledger.Currency)
+	y += 14
+	pdf.Line(left, y, right, y, 1)
+
+	y += 26
+	pdf.Text(left, y, 10, true, "Student")
+	y += 15
+	pdf.Text(left, y, 11, false, ledger.StudentName)
+	if ledger.StudentNumber != "" {
+		y += 14
+		pdf.Text(left, y, 10, false, "Student ID: "+ledger.StudentNumber)
+	}
+
+	header := func() {
+		pdf.Text(left, y, 9, true, "Date")
+		pdf.Text(115, y, 9, true, "Description")
+		pdf.TextRight(debitRight, y, 9, true, "Charges")
+		pdf.TextRight(creditRight, y, 9, true, "Credits")
+		pdf.TextRight(right, y, 9, true, "Balance")
+		y += 6
+		pdf.Line(left, y, right, y, 0.5)
+	}
+	row := func() {
+		y += 15
+		if y > bottom {
+			pdf.AddPage()
+			y = 60
+			pdf.Text(left, y, 9, false, fmt.Sprintf("%s - %s (page %d)", ledger.StudentName, period, pdf.PageCount()))
+			y += 24
+			header()
+			y += 15
+		}
+	}
+
+	y += 30
+	header()
+	row()
+	pdf.Text(115, y, 9, true, "Opening balance")
+	pdf.TextRight(right, y, 9, true, groupAmount(ledger.OpeningBalance, ledger.Currency))
+	for _, entry := range ledger.Entries {
+		row()
+		pdf.Text(left, y, 9, false, entry.Date.Format("02 Jan 2006"))
+		pdf.Text(115, y, 9, false, fitText(entry.Description, debitRight-115-70, 9))
+		if entry.Debit != 0 {
+			pdf.TextRight(debitRight, y, 9, false, groupAmount(entry.Debit, ledger.Currency))
+		}
+		if entry.Credit != 0 {
+			pdf.TextRight(creditRight, y, 9, false, groupAmount(entry.Credit, ledger.Currency))
+		}
+		pdf.TextRight(right, y, 9, false, groupAmount(entry.Balance, ledger.Currency))
+	}
+	y += 8
+	pdf.Line(left, y, right, y, 0.5)
+	row()
+	pdf.Text(115, y, 9, true, "Closing balance")
+	pdf.TextRight(debitRight, y, 9, true, groupAmount(ledger.TotalDebit, ledger.Currency))
+	pdf.TextRight(creditRight, y, 9, true, groupAmount(ledger.TotalCredit, ledger.Currency))
+	pdf.TextRight(right, y, 9, true, groupAmount(ledger.ClosingBalance, ledger.Currency))
+
+	// What is still open today, whatever the statement's range
+	if len(ledger.Outstanding) > 0 {
+		y += 20
+		row()
+		pdf.Text(left, y, 10, true, "Outstanding payments")
+		row()
+		pdf.Text(left, y, 9, true, "Due date")
+		pdf.Text(115, y, 9, true, "Description")
+		pdf.Text(debitRight-40, y, 9, true, "Status")
+		pdf.TextRight(right, y, 9, true, "Balance")
+		y += 6
+		pdf.Line(left, y, right, y, 0.5)
+		for _, payment := range ledger.Outstanding {
+			row()
+			pdf.Text(left, y, 9, false, payment.DueDate.Format("02 Jan 2006"))
+			pdf.Text(115, y, 9, false, fitText(payment.Description, debitRight-40-115-10, 9))
+			pdf.Text(debitRight-40, y, 9, false, strings.ReplaceAll(payment.Status, "_", " "))
+			pdf.TextRight(right, y, 9, false, groupAmount(payment.Balance, payment.Currency))
+		}
+	}
+
+	y += 20
+	row()
+	pdf.Text(left, y, 9, false, "Generated "+ledger.GeneratedAt.Format("02 Jan 2006 15:04")+". This statement was generated electronically and is valid without a signature.")
+
+	return pdf.Bytes()
+}
+
+// fitText shortens s with an ellipsis so it fits width points.
+func fitText(s string, width, size float64) string {
+	if services.TextWidth(s, size) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && services.TextWidth(string(runes)+"...", size) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
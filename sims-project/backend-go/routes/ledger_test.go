@@ -0,0 +1,186 @@
+package routes
+
+import (
+	"context"
+	"sims-backend-go/models"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPaymentLedgerEntries(t *testing.T) {
+	created := date(2025, time.January, 1)
+	waived := date(2025, time.January, 5)
+	payment := models.Payment{
+		ID:          "p1",
+		Description: "SPP Januari",
+		GrossAmount: 1000000,
+		Amount:      800000,
+		Adjustments: []models.PaymentAdjustment{
+			{Kind: "discount", SourceID: "sibling", Description: "Sibling", Amount: 100000},
+			{Kind: "waiver", SourceID: "w1", Amount: 100000},
+		},
+		CreatedAt: created,
+	}
+	transactions := []models.PaymentTransaction{
+		{ID: "t1", Amount: 500000, Reference: "TRF-1", ReceivedAt: date(2025, time.January, 10)},
+		{ID: "t2", Kind: "refund", Amount: -100000, ReceivedAt: date(2025, time.January, 12)},
+	}
+
+	entries := paymentLedgerEntries(payment, transactions, map[string]time.Time{"w1": waived})
+	want := []models.LedgerEntry{
+		{Date: created, Type: "charge", PaymentID: "p1", Description: "SPP Januari", Debit: 1000000},
+		{Date: created, Type: "discount", PaymentID: "p1", Description: "Sibling (SPP Januari)", Credit: 100000},
+		{Date: waived, Type: "waiver", PaymentID: "p1", Description: "waiver (SPP Januari)", Credit: 100000},
+		{Date: date(2025, time.January, 10), Type: "receipt", PaymentID: "p1", TransactionID: "t1", Description: "Payment received: SPP Januari", Reference: "TRF-1", Credit: 500000},
+		{Date: date(2025, time.January, 12), Type: "refund", PaymentID: "p1", TransactionID: "t2", Description: "Refund: SPP Januari", Debit: 100000},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(entries), len(want), entries)
+	}
+	for i, entry := range entries {
+		if entry != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, entry, want[i])
+		}
+	}
+}
+
+func TestPaymentLedgerEntriesLegacy(t *testing.T) {
+	created := date(2025, time.January, 1)
+	paid := date(2025, time.January, 8)
+
+	// Paid before transactions were recorded
+	entries := paymentLedgerEntries(models.Payment{ID: "p1", Description: "Buku", Amount: 300000, PaidAmount: 300000, PaidDate: &paid, Status: "paid", CreatedAt: created}, nil, nil)
+	if len(entries) != 2 || entries[1].Type != "receipt" || entries[1].Credit != 300000 || !entries[1].Date.Equal(paid) {
+		t.Errorf("legacy paid: %+v", entries)
+	}
+
+	// A cancelled payment closes what was still owed
+	cancelled := date(2025, time.January, 20)
+	entries = paymentLedgerEntries(models.Payment{ID: "p2", Description: "Seragam", Amount: 400000, Balance: 400000, Status: "cancelled", CreatedAt: created, UpdatedAt: cancelled}, nil, nil)
+	if len(entries) != 2 || entries[1].Type != "cancellation" || entries[1].Credit != 400000 || !entries[1].Date.Equal(cancelled) {
+		t.Errorf("cancelled: %+v", entries)
+	}
+
+	entries = paymentLedgerEntries(models.Payment{ID: "p3", Amount: 25000, LateFeeFor: "p1", CreatedAt: created}, nil, nil)
+	if len(entries) != 1 || entries[0].Type != "late_fee" || entries[0].Debit != 25000 {
+		t.Errorf("late fee: %+v", entries)
+	}
+}
+
+func TestPostLedgerEntries(t *testing.T) {
+	jan1, jan10, feb1, feb10, mar1 := date(2025, time.January, 1), date(2025, time.January, 10), date(2025, time.February, 1), date(2025, time.February, 10), date(2025, time.March, 1)
+	// Out of order, with a receipt recorded at the same moment as its charge
+	entries := func() []models.LedgerEntry {
+		return []models.LedgerEntry{
+			{Date: feb1, Type: "receipt", PaymentID: "feb", Credit: 200000},
+			{Date: jan10, Type: "receipt", PaymentID: "jan", Credit: 1000000},
+			{Date: feb1, Type: "charge", PaymentID: "feb", Debit: 1000000},
+			{Date: jan1, Type: "charge", PaymentID: "jan", Debit: 1000000},
+			{Date: feb1, Type: "discount", PaymentID: "feb", Credit: 100000},
+			{Date: feb10, Type: "refund", PaymentID: "jan", Debit: 50000},
+			{Date: mar1, Type: "charge", PaymentID: "mar", Debit: 1000000},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		from, to *time.Time
+		types    []string
+		balances []int64
+		opening  int64
+		closing  int64
+		debit    int64
+		credit   int64
+	}{
+		{
+			"whole account", nil, nil,
+			[]string{"charge", "receipt", "charge", "discount", "receipt", "refund", "charge"},
+			[]int64{1000000, 0, 1000000, 900000, 700000, 750000, 1750000},
+			0, 1750000, 3050000, 1300000,
+		},
+		{
+			"February", &feb1, &feb10,
+			[]string{"charge", "discount", "receipt", "refund"},
+			[]int64{1000000, 900000, 700000, 750000},
+			0, 750000, 1050000, 300000,
+		},
+		{
+			"from mid January", &jan10, nil,
+			[]string{"receipt", "charge", "discount", "receipt", "refund", "charge"},
+			[]int64{0, 1000000, 900000, 700000, 750000, 1750000},
+			1000000, 1750000, 2050000, 1300000,
+		},
+		{
+			"to end of January", nil, &jan10,
+			[]string{"charge", "receipt"},
+			[]int64{1000000, 0},
+			0, 0, 1000000, 1000000,
+		},
+	}
+	for _, tt := range tests {
+		ledger := &models.StudentLedger{From: tt.from, To: tt.to}
+		postLedgerEntries(ledger, entries())
+
+		if len(ledger.Entries) != len(tt.types) {
+			t.Errorf("%s: got %d entries, want %d: %+v", tt.name, len(ledger.Entries), len(tt.types), ledger.Entries)
+			continue
+		}
+		for i, entry := range ledger.Entries {
+			if entry.Type != tt.types[i] || entry.Balance != tt.balances[i] {
+				t.Errorf("%s: entry %d = %s %d, want %s %d", tt.name, i, entry.Type, entry.Balance, tt.types[i], tt.balances[i])
+			}
+		}
+		if ledger.OpeningBalance != tt.opening || ledger.ClosingBalance != tt.closing {
+			t.Errorf("%s: balances %d..%d, want %d..%d", tt.name, ledger.OpeningBalance, ledger.ClosingBalance, tt.opening, tt.closing)
+		}
+		if ledger.TotalDebit != tt.debit || ledger.TotalCredit != tt.credit {
+			t.Errorf("%s: totals %d/%d, want %d/%d", tt.name, ledger.TotalDebit, ledger.TotalCredit, tt.debit, tt.credit)
+		}
+		// The closing balance is the opening balance plus the movements shown
+		if ledger.OpeningBalance+ledger.TotalDebit-ledger.TotalCredit != ledger.ClosingBalance {
+			t.Errorf("%s: ledger does not add up", tt.name)
+		}
+	}
+}
+
+func TestBuildStudentLedger(t *testing.T) {
+	client := emulatorClient(t)
+	ctx := context.Background()
+	studentID := "ledger-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	payments := map[string]models.Payment{
+		studentID + "-jan": {StudentID: studentID, Currency: "IDR", Description: "SPP Januari", Amount: 1000000, PaidAmount: 1000000, Status: "paid", CreatedAt: date(2025, time.January, 1), DueDate: date(2025, time.January, 10)},
+		studentID + "-feb": {StudentID: studentID, Currency: "IDR", Description: "SPP Februari", Amount: 1000000, PaidAmount: 400000, Status: "partially_paid", CreatedAt: date(2025, time.February, 1), DueDate: date(2025, time.February, 10)},
+		studentID + "-usd": {StudentID: studentID, Currency: "USD", Description: "Trip", Amount: 5000, Status: "pending", CreatedAt: date(2025, time.January, 1)},
+	}
+	for id, payment := range payments {
+		if _, err := client.Collection("payments").Doc(id).Set(ctx, payment); err != nil {
+			t.Fatal(err)
+		}
+		defer client.Collection("payments").Doc(id).Delete(ctx)
+	}
+	receipt := client.Collection("payments").Doc(studentID + "-feb").Collection("transactions").Doc("t1")
+	if _, err := receipt.Set(ctx, models.PaymentTransaction{Amount: 400000, ReceivedAt: date(2025, time.February, 5)}); err != nil {
+		t.Fatal(err)
+	}
+	defer receipt.Delete(ctx)
+
+	ledger, err := buildStudentLedger(ctx, client, models.User{ID: studentID}, "IDR", nil, nil)
+	if err != nil {
+		t.Fatalf("buildStudentLedger: %v", err)
+	}
+
+	balances := []int64{1000000, 0, 1000000, 600000}
+	if len(ledger.Entries) != len(balances) {
+		t.Fatalf("entries = %+v", ledger.Entries)
+	}
+	for i, entry := range ledger.Entries {
+		if entry.Balance != balances[i] {
+			t.Errorf("entry %d (%s %s) balance = %d, want %d", i, entry.Type, entry.Description, entry.Balance, balances[i])
+		}
+	}
+	if ledger.ClosingBalance != 600000 || len(ledger.Outstanding) != 1 || ledger.Outstanding[0].Balance != 600000 {
+		t.Errorf("closing = %d, outstanding = %+v", ledger.ClosingBalance, ledger.Outstanding)
+	}
+}
@@ -0,0 +1,526 @@
+package routes
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"sims-backend-go/apperrors"
+	"sims-backend-go/config"
+	"sims-backend-go/models"
+	"sims-backend-go/services"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const recoveryCodeCount = 10
+
+var (
+	errMFANotEnabled       = errors.New("two-factor authentication is not enabled")
+	errInvalidSecondFactor = errors.New("invalid two-factor code")
+)
+
+// generateRecoveryCodes returns codes formatted as XXXXX-XXXXX for display
+// and their hashes for storage.
+func generateRecoveryCodes() ([]string, []string, error) {
+	plain := make([]string, recoveryCodeCount)
+	hashed := make([]string, recoveryCodeCount)
+	for i := range plain {
+		buf := make([]byte, 7)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		code := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf)[:10]
+		plain[i] = code[:5] + "-" + code[5:]
+		hashed[i] = hashRecoveryCode(code)
+	}
+	return plain, hashed, nil
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func getMFAEnrollment(ctx context.Context, client *firestore.Client, uid string) (models.MFAEnrollment, error) {
+	var enrollment models.MFAEnrollment
+	doc, err := client.Collection("mfa").Doc(uid).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return models.MFAEnrollment{UserID: uid}, nil
+		}
+		return enrollment, err
+	}
+	doc.DataTo(&enrollment)
+	return enrollment, nil
+}
+
+// checkSecondFactor verifies an authenticator or recovery code for uid.
+// Authenticator codes cannot be replayed and recovery codes are single-use.
+func checkSecondFactor(ctx context.Context, client *firestore.Client, uid string, req models.MFAVerifyRequest) (int, error) {
+	docRef := client.Collection("mfa").Doc(uid)
+	remaining := 0
+
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(docRef)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return errMFANotEnabled
+			}
+			return err
+		}
+
+		var enrollment models.MFAEnrollment
+		doc.DataTo(&enrollment)
+		if !enrollment.Enabled {
+			return errMFANotEnabled
+		}
+
+		now := time.Now()
+		switch {
+		case req.Code != "":
+			secret, err := services.MFA.Encrypter.Decrypt(enrollment.Secret)
+			if err != nil {
+				return err
+			}
+			step, ok := services.ValidateTOTP(secret, req.Code, now)
+			if !ok || step <= enrollment.LastUsedStep {
+				return errInvalidSecondFactor
+			}
+			enrollment.LastUsedStep = step
+		case req.RecoveryCode != "":
+			hash := hashRecoveryCode(req.RecoveryCode)
+			found := false
+			for i, stored := range enrollment.RecoveryCodes {
+				if stored == hash {
+					enrollment.RecoveryCodes = append(enrollment.RecoveryCodes[:i], enrollment.RecoveryCodes[i+1:]...)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return errInvalidSecondFactor
+			}
+		default:
+			return errInvalidSecondFactor
+		}
+
+		enrollment.LastVerifiedAt = &now
+		enrollment.UpdatedAt = now
+		remaining = len(enrollment.RecoveryCodes)
+		return tx.Set(docRef, enrollment)
+	})
+	return remaining, err
+}
+
+// verifySecondFactor runs checkSecondFactor behind the per-user lockout and
+// writes the error response. It returns false when the request was aborted.
+func verifySecondFactor(c *gin.Context, client *firestore.Client, uid string, req models.MFAVerifyRequest) (int, bool) {
+	if config.MFALockout.AbortLocked(c, uid) {
+		return 0, false
+	}
+
+	remaining, err := checkSecondFactor(c.Request.Context(), client, uid, req)
+	switch err {
+	case nil:
+		config.MFALockout.Reset(uid)
+		return remaining, true
+	case errMFANotEnabled:
+		c.Error(apperrors.BadRequest("Two-factor authentication is not enabled"))
+	case errInvalidSecondFactor:
+		config.MFALockout.Fail(uid)
+		c.Error(apperrors.Forbidden("Invalid two-factor code"))
+	default:
+		c.Error(apperrors.Internal(err, "Failed to verify two-factor code"))
+	}
+	return 0, false
+}
+
+func GetMFAStatus(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+	role := config.TokenRole(token)
+
+	ctx := c.Request.Context()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	enrollment, err := getMFAEnrollment(ctx, client, token.UID)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to fetch two-factor status"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                enrollment.Enabled,
+		"required":               config.AppConfig.MFA.RequiredFor(role),
+		"recoveryCodesRemaining": len(enrollment.RecoveryCodes),
+		"enrolledAt":             enrollment.EnrolledAt,
+		"lastVerifiedAt":         enrollment.LastVerifiedAt,
+	})
+}
+
+// EnrollMFA starts enrollment by generating a secret for the authenticator
+// app. It only becomes active once ActivateMFA confirms a code.
+func EnrollMFA(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+
+	ctx := c.Request.Context()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	enrollment, err := getMFAEnrollment(ctx, client, token.UID)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to fetch two-factor status"))
+		return
+	}
+	if enrollment.Enabled {
+		c.Error(apperrors.Conflict("Two-factor authentication is already enabled"))
+		return
+	}
+
+	secret, err := services.GenerateTOTPSecret()
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to generate secret"))
+		return
+	}
+	encrypted, err := services.MFA.Encrypter.Encrypt(secret)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to generate secret"))
+		return
+	}
+
+	_, err = client.Collection("mfa").Doc(token.UID).Set(ctx, map[string]interface{}{
+		"userId":        token.UID,
+		"enabled":       false,
+		"pendingSecret": encrypted,
+		"updatedAt":     time.Now(),
+	}, firestore.MergeAll)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to start enrollment"))
+		return
+	}
+
+	account, _ := token.Claims["email"].(string)
+	if account == "" {
+		account = token.UID
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":     secret,
+		"otpauthUrl": services.TOTPURI(services.MFA.Issuer, account, secret),
+	})
+}
+
+// ActivateMFA confirms enrollment with a code from the authenticator app and
+// returns the recovery codes. They are only shown this once.
+func ActivateMFA(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+
+	var req models.MFAActivateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	if config.MFALockout.AbortLocked(c, token.UID) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	enrollment, err := getMFAEnrollment(ctx, client, token.UID)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to fetch two-factor status"))
+		return
+	}
+	if enrollment.Enabled {
+		c.Error(apperrors.Conflict("Two-factor authentication is already enabled"))
+		return
+	}
+	if enrollment.PendingSecret == "" {
+		c.Error(apperrors.BadRequest("Start enrollment first"))
+		return
+	}
+
+	secret, err := services.MFA.Encrypter.Decrypt(enrollment.PendingSecret)
+	if err != nil {
+		log.Printf("Failed to decrypt pending MFA secret for %s: %v", token.UID, err)
+		c.Error(apperrors.BadRequest("Enrollment expired, please start again"))
+		return
+	}
+
+	now := time.Now()
+	step, ok := services.ValidateTOTP(secret, req.Code, now)
+	if !ok {
+		config.MFALockout.Fail(token.UID)
+		c.Error(apperrors.Forbidden("Invalid two-factor code"))
+		return
+	}
+	config.MFALockout.Reset(token.UID)
+
+	recoveryCodes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to generate recovery codes"))
+		return
+	}
+
+	enrollment = models.MFAEnrollment{
+		UserID:         token.UID,
+		Enabled:        true,
+		Secret:         enrollment.PendingSecret,
+		RecoveryCodes:  hashes,
+		LastUsedStep:   step,
+		EnrolledAt:     &now,
+		LastVerifiedAt: &now,
+		UpdatedAt:      now,
+	}
+	if _, err := client.Collection("mfa").Doc(token.UID).Set(ctx, enrollment); err != nil {
+		c.Error(apperrors.Internal(err, "Failed to enable two-factor authentication"))
+		return
+	}
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "mfa.enable",
+		TargetType: "user",
+		TargetID:   token.UID,
+	})
+
+	stepUpToken, expiresAt, err := services.IssueStepUpToken(token.UID, now)
+	if err != nil {
+		log.Printf("Failed to issue step-up token for %s: %v", token.UID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Two-factor authentication enabled",
+		"recoveryCodes": recoveryCodes,
+		"stepUpToken":   stepUpToken,
+		"expiresAt":     expiresAt,
+	})
+}
+
+// VerifyMFA exchanges a second factor for a short-lived step-up token that
+// sensitive routes require in the X-Step-Up-Token header.
+func VerifyMFA(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+
+	var req models.MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	ctx := c.Request.Context()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	remaining, ok := verifySecondFactor(c, client, token.UID, req)
+	if !ok {
+		return
+	}
+
+	if req.RecoveryCode != "" {
+		recordAudit(ctx, client, c, models.AuditLog{
+			Action:     "mfa.recovery_code_use",
+			TargetType: "user",
+			TargetID:   token.UID,
+			Details:    map[string]interface{}{"remaining": remaining},
+		})
+	}
+
+	stepUpToken, expiresAt, err := services.IssueStepUpToken(token.UID, time.Now())
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to issue step-up token"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"stepUpToken":            stepUpToken,
+		"expiresAt":              expiresAt,
+		"recoveryCodesRemaining": remaining,
+	})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after a second factor
+// check.
+func RegenerateRecoveryCodes(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+
+	var req models.MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	ctx := c.Request.Context()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	if _, ok := verifySecondFactor(c, client, token.UID, req); !ok {
+		return
+	}
+
+	recoveryCodes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to generate recovery codes"))
+		return
+	}
+
+	_, err = client.Collection("mfa").Doc(token.UID).Set(ctx, map[string]interface{}{
+		"recoveryCodes": hashes,
+		"updatedAt":     time.Now(),
+	}, firestore.MergeAll)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to save recovery codes"))
+		return
+	}
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "mfa.recovery_codes_regenerate",
+		TargetType: "user",
+		TargetID:   token.UID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": recoveryCodes})
+}
+
+func DisableMFA(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+
+	var req models.MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	ctx := c.Request.Context()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	if _, ok := verifySecondFactor(c, client, token.UID, req); !ok {
+		return
+	}
+
+	if _, err := client.Collection("mfa").Doc(token.UID).Delete(ctx); err != nil {
+		c.Error(apperrors.Internal(err, "Failed to disable two-factor authentication"))
+		return
+	}
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "mfa.disable",
+		TargetType: "user",
+		TargetID:   token.UID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// ResetUserMFA removes another user's enrollment, e.g. after a lost device
+// with no recovery codes left. The user has to enroll again.
+func ResetUserMFA(c *gin.Context) {
+	userID := c.Param("id")
+
+	ctx := c.Request.Context()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	enrollment, err := getMFAEnrollment(ctx, client, userID)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to fetch two-factor status"))
+		return
+	}
+	if !enrollment.Enabled && enrollment.PendingSecret == "" {
+		c.Error(apperrors.NotFound("User has no two-factor enrollment"))
+		return
+	}
+
+	if _, err := client.Collection("mfa").Doc(userID).Delete(ctx); err != nil {
+		c.Error(apperrors.Internal(err, "Failed to reset two-factor authentication"))
+		return
+	}
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "mfa.reset",
+		TargetType: "user",
+		TargetID:   userID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset"})
+}
@@ -1,8 +1,13 @@
 package routes
 
 import (
+	"context"
 	"net/http"
+	"sims-backend-go/apperrors"
+	"sims-backend-go/config"
 	"sims-backend-go/models"
+	"sort"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/firestore"
@@ -14,7 +19,7 @@ func GetPayments(c *gin.Context) {
 	ctx := c.Request.Context()
 	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
 		return
 	}
 	defer client.Close()
@@ -29,30 +34,119 @@ func GetPayments(c *gin.Context) {
 			break
 		}
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payments"})
+			c.Error(apperrors.Internal(err, "Failed to fetch payments"))
 			return
 		}
 
-		var payment models.Payment
-		doc.DataTo(&payment)
-		payment.ID = doc.Ref.ID
-		payments = append(payments, payment)
+		payments = append(payments, paymentFromDoc(doc))
 	}
 
 	c.JSON(http.StatusOK, gin.H{"payments": payments})
 }
 
+// GetPaymentStats aggregates payments per currency, optionally for one
+// academic year and semester. Late fees are counted like other payments
+// and also broken out on their own.
+func GetPaymentStats(c *gin.Context) {
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	query := client.Collection("payments").Query
+	if year := c.Query("academicYear"); year != "" {
+		query = query.Where("academicYear", "==", year)
+	}
+	if semester := c.Query("semester"); semester != "" {
+		query = query.Where("semester", "==", semester)
+	}
+
+	byCurrency := make(map[string]*models.PaymentStats)
+	iter := query.Documents(ctx)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			c.Error(apperrors.Internal(err, "Failed to fetch payments"))
+			return
+		}
+
+		payment := paymentFromDoc(doc)
+		if payment.Status == "cancelled" {
+			continue
+		}
+
+		stats, ok := byCurrency[payment.Currency]
+		if !ok {
+			stats = &models.PaymentStats{Currency: payment.Currency}
+			byCurrency[payment.Currency] = stats
+		}
+
+		stats.RefundedAmount += payment.RefundedAmount
+		if payment.Status == "refunded" {
+			stats.RefundedPayments++
+			continue
+		}
+
+		stats.TotalPayments++
+		stats.TotalAmount += payment.Amount
+		stats.PaidAmount += payment.PaidAmount
+		if payment.LateFeeFor != "" {
+			stats.LateFeePayments++
+			stats.LateFeeAmount += payment.Amount
+			stats.LateFeePaidAmount += payment.PaidAmount
+			for _, adjustment := range payment.Adjustments {
+				if adjustment.Kind == "waiver" {
+					stats.LateFeeWaivedAmount += adjustment.Amount
+				}
+			}
+		}
+		switch payment.Status {
+		case "paid":
+			stats.PaidPayments++
+		case "overdue":
+			stats.OverduePayments++
+			stats.OverdueAmount += payment.Balance
+		default:
+			stats.PendingPayments++
+			stats.PendingAmount += payment.Balance
+			if payment.Status == "partially_paid" {
+				stats.PartiallyPaidPayments++
+			}
+		}
+	}
+
+	stats := make([]models.PaymentStats, 0, len(byCurrency))
+	for _, s := range byCurrency {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Currency < stats[j].Currency })
+
+	c.JSON(http.StatusOK, gin.H{"stats": stats})
+}
+
 func CreatePayment(c *gin.Context) {
 	var req models.PaymentCreateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	currency, err := resolveCurrency(req.Currency)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
 	ctx := c.Request.Context()
 	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
 		return
 	}
 	defer client.Close()
@@ -61,7 +155,7 @@ func CreatePayment(c *gin.Context) {
 	payment := models.Payment{
 		StudentID:     req.StudentID,
 		Amount:        req.Amount,
-		Currency:      "IDR",
+		Currency:      currency,
 		Description:   req.Description,
 		PaymentType:   req.PaymentType,
 		Status:        "pending",
@@ -69,17 +163,20 @@ func CreatePayment(c *gin.Context) {
 		PaymentMethod: req.PaymentMethod,
 		AcademicYear:  req.AcademicYear,
 		Semester:      req.Semester,
+		MinorUnits:    true,
 		CreatedAt:     time.Now(),
 		UpdatedAt:     time.Now(),
 	}
 
 	docRef, _, err := client.Collection("payments").Add(ctx, payment)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment"})
+		c.Error(apperrors.Internal(err, "Failed to create payment"))
 		return
 	}
 
 	payment.ID = docRef.ID
+	payment.Balance = payment.Outstanding()
+	setLocation(c, payment.ID)
 	c.JSON(http.StatusCreated, gin.H{"payment": payment})
 }
 
@@ -89,41 +186,46 @@ func GetPayment(c *gin.Context) {
 	ctx := c.Request.Context()
 	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
 		return
 	}
 	defer client.Close()
 
 	doc, err := client.Collection("payments").Doc(paymentID).Get(ctx)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		c.Error(apperrors.FromFirestore(err, "Payment not found", "Failed to fetch payment"))
 		return
 	}
 
-	var payment models.Payment
-	doc.DataTo(&payment)
-	payment.ID = doc.Ref.ID
+	payment := paymentFromDoc(doc)
 
+	setETag(c, doc)
 	c.JSON(http.StatusOK, gin.H{"payment": payment})
 }
 
 func UpdatePayment(c *gin.Context) {
-	paymentID := c.Param("id")
-
 	var req models.PaymentUpdateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperrors.Validation(err))
 		return
 	}
 
-	ctx := c.Request.Context()
-	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	applyPaymentUpdate(c, paymentUpdateData(req))
+}
+
+// PatchPayment applies a JSON Merge Patch; null removes an optional field.
+func PatchPayment(c *gin.Context) {
+	var req models.PaymentUpdateRequest
+	cleared, err := bindMergePatch(c, &req, models.PaymentCreateRequest{})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(err)
 		return
 	}
-	defer client.Close()
 
+	applyPaymentUpdate(c, withCleared(paymentUpdateData(req), cleared))
+}
+
+func paymentUpdateData(req models.PaymentUpdateRequest) map[string]interface{} {
 	// Prepare update data
 	updateData := map[string]interface{}{
 		"updatedAt": time.Now(),
@@ -138,12 +240,9 @@ func UpdatePayment(c *gin.Context) {
 	if req.PaymentType != nil {
 		updateData["paymentType"] = *req.PaymentType
 	}
+	// paid and partially_paid follow from recorded transactions
 	if req.Status != nil {
 		updateData["status"] = *req.Status
-		if *req.Status == "paid" {
-			now := time.Now()
-			updateData["paidDate"] = &now
-		}
 	}
 	if req.DueDate != nil {
 		updateData["dueDate"] = *req.DueDate
@@ -155,13 +254,118 @@ func UpdatePayment(c *gin.Context) {
 		updateData["reference"] = *req.Reference
 	}
 
-	_, err = client.Collection("payments").Doc(paymentID).Update(ctx, updateData)
+	return updateData
+}
+
+func applyPaymentUpdate(c *gin.Context, updateData map[string]interface{}) {
+	paymentID := c.Param("id")
+
+	preconditions, err := ifMatch(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update payment"})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Payment updated successfully"})
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	// Checked and written in one transaction so a receipt, refund or waiver
+	// landing in between cannot be overwritten with a stale status
+	ref := client.Collection("payments").Doc(paymentID)
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		current, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+
+		data, err := checkPaymentUpdate(paymentFromDoc(current), updateData)
+		if err != nil {
+			return err
+		}
+
+		updates := make([]firestore.Update, 0, len(data))
+		for path, value := range data {
+			updates = append(updates, firestore.Update{Path: path, Value: value})
+		}
+		return tx.Update(ref, updates, preconditions...)
+	})
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Payment not found", "Failed to update payment"))
+		return
+	}
+
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to fetch payment"))
+		return
+	}
+
+	setETag(c, doc)
+	c.JSON(http.StatusOK, gin.H{"payment": paymentFromDoc(doc)})
+}
+
+// checkPaymentUpdate validates a status or amount change against the
+// payment as stored and returns the fields to write, including the status
+// an amount change implies.
+func checkPaymentUpdate(existing models.Payment, updateData map[string]interface{}) (map[string]interface{}, error) {
+	data := make(map[string]interface{}, len(updateData)+3)
+	for path, value := range updateData {
+		data[path] = value
+	}
+
+	amount, amountChanged := data["amount"].(int64)
+	requested, statusChanged := data["status"]
+	if !amountChanged && !statusChanged {
+		return data, nil
+	}
+
+	// Cancelled and refunded payments are final
+	if existing.Status == "cancelled" || existing.Status == "refunded" {
+		return nil, checkPaymentOpen(existing)
+	}
+	if statusChanged {
+		status, ok := requested.(string)
+		if !ok {
+			return nil, apperrors.ValidationFailed(apperrors.FieldError{Field: "status", Rule: "required", Message: "cannot be removed"})
+		}
+		if err := checkStatusChange(existing, status); err != nil {
+			return nil, err
+		}
+	}
+
+	if amountChanged {
+		if len(existing.Installments) > 0 && amount != existing.Amount {
+			return nil, apperrors.Conflict("Remove the installment plan before changing the amount")
+		}
+		if amount < existing.PaidAmount {
+			return nil, apperrors.BadRequest("Amount cannot be less than the amount already paid").With("paidAmount", existing.PaidAmount)
+		}
+		// Adjustments stay, so the gross amount moves with the net amount
+		if len(existing.Adjustments) > 0 {
+			data["grossAmount"] = existing.GrossAmount + amount - existing.Amount
+		}
+
+		// Raising or lowering the amount can settle or reopen the payment
+		if !statusChanged && (existing.PaidAmount > 0 || existing.Status == "paid") {
+			existing.Amount = amount
+			if existing.Status == "paid" && existing.SettledStatus() == "pending" {
+				return nil, apperrors.Conflict("Payment was settled without money paid and cannot be reopened")
+			}
+			data["status"] = existing.SettledStatus()
+			if existing.SettledStatus() != "paid" {
+				data["paidDate"] = nil
+			} else if existing.PaidDate == nil {
+				now := time.Now()
+				data["paidDate"] = &now
+			}
+		}
+	}
+	return data, nil
 }
 
 func DeletePayment(c *gin.Context) {
@@ -170,16 +374,83 @@ func DeletePayment(c *gin.Context) {
 	ctx := c.Request.Context()
 	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
 		return
 	}
 	defer client.Close()
 
-	_, err = client.Collection("payments").Doc(paymentID).Delete(ctx)
+	ref := client.Collection("payments").Doc(paymentID)
+	doc, err := ref.Get(ctx)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete payment"})
+		c.Error(apperrors.FromFirestore(err, "Payment not found", "Failed to delete payment"))
+		return
+	}
+	if payment := paymentFromDoc(doc); payment.PaidAmount > 0 || payment.RefundedAmount > 0 {
+		c.Error(apperrors.Conflict("Payment has recorded transactions and cannot be deleted"))
+		return
+	}
+
+	_, err = ref.Delete(ctx, firestore.LastUpdateTime(doc.UpdateTime))
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Payment not found", "Failed to delete payment"))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Payment deleted successfully"})
 }
+
+// paymentFromDoc decodes a payment document and computes its balance.
+func paymentFromDoc(doc *firestore.DocumentSnapshot) models.Payment {
+	var payment models.Payment
+	doc.DataTo(&payment)
+	payment.ID = doc.Ref.ID
+	// Payments marked paid before transactions were recorded
+	if payment.Status == "paid" && payment.PaidAmount == 0 {
+		payment.PaidAmount = payment.Amount
+	}
+	payment.Balance = payment.Outstanding()
+	return payment
+}
+
+// checkStatusChange validates a status set by hand. Paid and partially
+// paid follow from transactions and refunded from an approved refund, so
+// only pending, overdue and cancelled can be requested.
+func checkStatusChange(payment models.Payment, status string) error {
+	if !models.CanTransitionPayment(payment.Status, status) {
+		return apperrors.Conflict("Payment cannot change from "+payment.Status+" to "+status).With("allowed", models.PaymentTransitions[payment.Status])
+	}
+	switch {
+	case status == "cancelled" && payment.PaidAmount > 0:
+		return apperrors.Conflict("Refund what was paid before cancelling the payment").With("paidAmount", payment.PaidAmount)
+	case status == "pending" && payment.PaidAmount > 0:
+		return apperrors.Conflict("Payment has money paid and cannot be pending").With("paidAmount", payment.PaidAmount)
+	}
+	return nil
+}
+
+// checkPaymentOpen rejects changes to payments that are settled or closed:
+// paid payments take no more money, cancelled and refunded ones are final.
+func checkPaymentOpen(payment models.Payment) error {
+	switch payment.Status {
+	case "cancelled":
+		return apperrors.Conflict("Payment is cancelled")
+	case "refunded":
+		return apperrors.Conflict("Payment is refunded")
+	case "paid":
+		return apperrors.Conflict("Payment is already fully paid")
+	}
+	return nil
+}
+
+// resolveCurrency applies the configured default to an empty currency and
+// rejects codes without a known minor unit.
+func resolveCurrency(code string) (string, error) {
+	if code == "" {
+		return config.AppConfig.DefaultCurrency, nil
+	}
+	code = strings.ToUpper(code)
+	if !models.IsValidCurrency(code) {
+		return "", apperrors.ValidationFailed(apperrors.FieldError{Field: "currency", Rule: "currency", Message: "must be a supported ISO 4217 currency code"})
+	}
+	return code, nil
+}
@@ -0,0 +1,90 @@
+package routes
+
+import (
+	"sims-backend-go/apperrors"
+	"sims-backend-go/models"
+	"testing"
+)
+
+func TestCheckStatusChange(t *testing.T) {
+	tests := []struct {
+		name    string
+		payment models.Payment
+		status  string
+		code    string
+	}{
+		{"pending to paid", models.Payment{Status: "pending"}, "paid", ""},
+		{"pending to cancelled", models.Payment{Status: "pending"}, "cancelled", ""},
+		{"overdue to pending", models.Payment{Status: "overdue"}, "pending", ""},
+		{"paid to refunded", models.Payment{Status: "paid", PaidAmount: 1000}, "refunded", ""},
+		{"paid to pending", models.Payment{Status: "paid", PaidAmount: 1000}, "pending", apperrors.CodeConflict},
+		{"paid to cancelled", models.Payment{Status: "paid", PaidAmount: 1000}, "cancelled", apperrors.CodeConflict},
+		{"paid to partially paid", models.Payment{Status: "paid", PaidAmount: 1000}, "partially_paid", apperrors.CodeConflict},
+		{"cancelled is final", models.Payment{Status: "cancelled"}, "pending", apperrors.CodeConflict},
+		{"cancel with money paid", models.Payment{Status: "overdue", PaidAmount: 500}, "cancelled", apperrors.CodeConflict},
+		{"pending with money paid", models.Payment{Status: "overdue", PaidAmount: 500}, "pending", apperrors.CodeConflict},
+	}
+	for _, tt := range tests {
+		if got := errorCode(checkStatusChange(tt.payment, tt.status)); got != tt.code {
+			t.Errorf("%s: error code %q, want %q", tt.name, got, tt.code)
+		}
+	}
+}
+
+func TestCheckPaymentUpdate(t *testing.T) {
+	paid := models.Payment{Status: "paid", Amount: 1000, PaidAmount: 1000}
+	waived := models.Payment{Status: "paid", Amount: 0, GrossAmount: 1000, Adjustments: []models.PaymentAdjustment{{Kind: "waiver", Amount: 1000}}}
+
+	tests := []struct {
+		name     string
+		existing models.Payment
+		update   map[string]interface{}
+		code     string
+		status   interface{} // status written, nil when unchanged
+	}{
+		{"description only", paid, map[string]interface{}{"description": "SPP"}, "", nil},
+		{"paid reset to pending", paid, map[string]interface{}{"status": "pending"}, apperrors.CodeConflict, nil},
+		{"paid cancelled", paid, map[string]interface{}{"status": "cancelled"}, apperrors.CodeConflict, nil},
+		{"status removed", models.Payment{Status: "pending", Amount: 1000}, map[string]interface{}{"status": nil}, apperrors.CodeValidation, nil},
+		{"amount raised reopens paid", paid, map[string]interface{}{"amount": int64(1500)}, "", "partially_paid"},
+		{"amount lowered settles", models.Payment{Status: "partially_paid", Amount: 1000, PaidAmount: 600}, map[string]interface{}{"amount": int64(600)}, "", "paid"},
+		{"amount below paid", paid, map[string]interface{}{"amount": int64(500)}, apperrors.CodeBadRequest, nil},
+		{"waived in full cannot reopen", waived, map[string]interface{}{"amount": int64(500)}, apperrors.CodeConflict, nil},
+		{"pending amount change", models.Payment{Status: "pending", Amount: 1000}, map[string]interface{}{"amount": int64(1200)}, "", nil},
+		{"refunded is final", models.Payment{Status: "refunded", Amount: 1000}, map[string]interface{}{"amount": int64(1200)}, apperrors.CodeConflict, nil},
+		{"installments block amount change", models.Payment{Status: "pending", Amount: 1000, Installments: []models.Installment{{Number: 1, Amount: 1000}}},
+			map[string]interface{}{"amount": int64(1200)}, apperrors.CodeConflict, nil},
+	}
+	for _, tt := range tests {
+		data, err := checkPaymentUpdate(tt.existing, tt.update)
+		if got := errorCode(err); got != tt.code {
+			t.Errorf("%s: error code %q, want %q (%v)", tt.name, got, tt.code, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if _, requested := tt.update["status"]; !requested && data["status"] != tt.status {
+			t.Errorf("%s: status = %v, want %v", tt.name, data["status"], tt.status)
+		}
+	}
+}
+
+func TestCheckPaymentUpdateKeepsInput(t *testing.T) {
+	update := map[string]interface{}{"amount": int64(1500)}
+	existing := models.Payment{Status: "paid", Amount: 1000, GrossAmount: 1200, PaidAmount: 1000, Adjustments: []models.PaymentAdjustment{{Amount: 200}}}
+
+	data, err := checkPaymentUpdate(existing, update)
+	if err != nil {
+		t.Fatalf("checkPaymentUpdate: %v", err)
+	}
+	if data["grossAmount"] != int64(1700) {
+		t.Errorf("grossAmount = %v, want 1700", data["grossAmount"])
+	}
+	if _, ok := data["paidDate"]; !ok || data["paidDate"] != nil {
+		t.Errorf("paidDate = %v, want cleared", data["paidDate"])
+	}
+	if len(update) != 1 {
+		t.Errorf("checkPaymentUpdate modified its input: %v", update)
+	}
+}
@@ -0,0 +1,392 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"sims-backend-go/apperrors"
+	"sims-backend-go/models"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+)
+
+// GetPaymentTransactions lists the receipts recorded against a payment,
+// oldest first.
+func GetPaymentTransactions(c *gin.Context) {
+	paymentID := c.Param("id")
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	ref := client.Collection("payments").Doc(paymentID)
+	if _, err := ref.Get(ctx); err != nil {
+		c.Error(apperrors.FromFirestore(err, "Payment not found", "Failed to fetch payment"))
+		return
+	}
+
+	iter := ref.Collection("transactions").OrderBy("receivedAt", firestore.Asc).Documents(ctx)
+	transactions := []models.PaymentTransaction{}
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			c.Error(apperrors.Internal(err, "Failed to fetch transactions"))
+			return
+		}
+
+		var transaction models.PaymentTransaction
+		doc.DataTo(&transaction)
+		transaction.ID = doc.Ref.ID
+		transactions = append(transactions, transaction)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"transactions": transactions})
+}
+
+// RecordPaymentTransaction records a (partial) receipt and updates the
+// payment's paid amount, status and installments in the same transaction.
+func RecordPaymentTransaction(c *gin.Context) {
+	paymentID := c.Param("id")
+
+	var req models.PaymentTransactionCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	now := time.Now()
+	receivedAt := now
+	if req.ReceivedAt != nil {
+		receivedAt = *req.ReceivedAt
+	}
+
+	ref := client.Collection("payments").Doc(paymentID)
+	txRef := ref.Collection("transactions").NewDoc()
+	transaction := models.PaymentTransaction{
+		ID:          txRef.ID,
+		PaymentID:   paymentID,
+		Amount:      req.Amount,
+		Method:      req.Method,
+		Reference:   req.Reference,
+		Note:        req.Note,
+		ProcessedBy: token.UID,
+		ReceivedAt:  receivedAt,
+		MinorUnits:  true,
+		CreatedAt:   now,
+	}
+
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		payment := paymentFromDoc(doc)
+
+		if err := checkPaymentOpen(payment); err != nil {
+			return err
+		}
+		if transaction.Amount > payment.Balance {
+			return apperrors.BadRequest("Amount exceeds the outstanding balance").With("balance", payment.Balance)
+		}
+
+		return applyTransaction(tx, client, payment, txRef, &transaction, now)
+	})
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Payment not found", "Failed to record transaction"))
+		return
+	}
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "payment.transaction",
+		TargetType: "payment",
+		TargetID:   paymentID,
+		Details: map[string]interface{}{
+			"transactionId": transaction.ID,
+			"amount":        transaction.Amount,
+			"method":        transaction.Method,
+		},
+	})
+
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to fetch payment"))
+		return
+	}
+
+	setETag(c, doc)
+	setLocation(c, transaction.ID)
+	c.JSON(http.StatusCreated, gin.H{"transaction": transaction, "payment": paymentFromDoc(doc)})
+}
+
+// applyTransaction records transaction against a payment read earlier in
+// the same Firestore transaction and updates the payment's paid amount,
+// status and installments. Settling the payment issues its receipt number,
+// which reads the counter, so callers must not have written anything yet.
+func applyTransaction(tx *firestore.Transaction, client *firestore.Client, payment models.Payment, txRef *firestore.DocumentRef, transaction *models.PaymentTransaction, now time.Time) error {
+	payment.PaidAmount += transaction.Amount
+	status := payment.SettledStatus()
+	// An overdue payment stays overdue until it is settled
+	if payment.Status == "overdue" && status != "paid" {
+		status = "overdue"
+	}
+
+	var receipt *models.Receipt
+	if status == "paid" && payment.ReceiptNumber == "" {
+		issued, err := issueReceipt(tx, client, payment.ID, payment.AcademicYear, now)
+		if err != nil {
+			return err
+		}
+		receipt = &issued
+	}
+
+	updates := []firestore.Update{
+		{Path: "paidAmount", Value: payment.PaidAmount},
+		{Path: "status", Value: status},
+		{Path: "paymentMethod", Value: transaction.Method},
+		{Path: "reference", Value: transaction.Reference},
+		{Path: "processedBy", Value: transaction.ProcessedBy},
+		{Path: "updatedAt", Value: now},
+	}
+	if status == "paid" {
+		updates = append(updates, firestore.Update{Path: "paidDate", Value: &transaction.ReceivedAt})
+	}
+	if len(payment.Installments) > 0 {
+		updates = append(updates, firestore.Update{Path: "installments", Value: allocateInstallments(payment.Installments, payment.PaidAmount)})
+	}
+	if receipt != nil {
+		updates = append(updates, firestore.Update{Path: "receiptNumber", Value: receipt.Number})
+		if err := tx.Create(client.Collection("receipts").Doc(payment.ID), *receipt); err != nil {
+			return err
+		}
+	}
+
+	transaction.StudentID = payment.StudentID
+	transaction.Currency = payment.Currency
+	if err := tx.Create(txRef, *transaction); err != nil {
+		return err
+	}
+	return tx.Update(client.Collection("payments").Doc(payment.ID), updates)
+}
+
+// SetInstallmentPlan splits a payment into scheduled parts, replacing any
+// existing plan. Amounts already paid are allocated to the new parts.
+func SetInstallmentPlan(c *gin.Context) {
+	paymentID := c.Param("id")
+
+	var req models.InstallmentPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	switch {
+	case len(req.Installments) > 0 && req.Count > 0:
+		c.Error(apperrors.ValidationFailed(apperrors.FieldError{Field: "count", Rule: "excluded_with", Message: "cannot be combined with installments"}))
+		return
+	case len(req.Installments) == 0 && req.Count == 0:
+		c.Error(apperrors.ValidationFailed(apperrors.FieldError{Field: "installments", Rule: "required_without", Message: "installments or count is required"}))
+		return
+	case req.Count > 0 && req.FirstDueDate == nil:
+		c.Error(apperrors.ValidationFailed(apperrors.FieldError{Field: "firstDueDate", Rule: "required_with", Message: "is required with count"}))
+		return
+	}
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	ref := client.Collection("payments").Doc(paymentID)
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		payment := paymentFromDoc(doc)
+
+		if err := checkPaymentOpen(payment); err != nil {
+			return err
+		}
+
+		installments, err := buildInstallments(payment.Amount, req)
+		if err != nil {
+			return err
+		}
+
+		return tx.Update(ref, []firestore.Update{
+			{Path: "installments", Value: allocateInstallments(installments, payment.PaidAmount)},
+			{Path: "dueDate", Value: installments[len(installments)-1].DueDate},
+			{Path: "updatedAt", Value: time.Now()},
+		})
+	})
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Payment not found", "Failed to save installment plan"))
+		return
+	}
+
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to fetch payment"))
+		return
+	}
+
+	setETag(c, doc)
+	c.JSON(http.StatusOK, gin.H{"payment": paymentFromDoc(doc)})
+}
+
+// DeleteInstallmentPlan turns the payment back into a single obligation.
+func DeleteInstallmentPlan(c *gin.Context) {
+	paymentID := c.Param("id")
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	doc, err := updateDocument(c, client.Collection("payments").Doc(paymentID), map[string]interface{}{
+		"installments": firestore.Delete,
+		"updatedAt":    time.Now(),
+	})
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Payment not found", "Failed to delete installment plan"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"payment": paymentFromDoc(doc)})
+}
+
+// buildInstallments turns the request into installments that add up to
+// amount. Equal parts are rounded down, the last part takes the remainder.
+func buildInstallments(amount int64, req models.InstallmentPlanRequest) ([]models.Installment, error) {
+	var installments []models.Installment
+
+	if req.Count > 0 {
+		if int64(req.Count) > amount {
+			return nil, apperrors.ValidationFailed(apperrors.FieldError{
+				Field:   "count",
+				Rule:    "lte",
+				Message: "must not exceed the payment amount " + strconv.FormatInt(amount, 10),
+			})
+		}
+		part := amount / int64(req.Count)
+		for i := 0; i < req.Count; i++ {
+			installments = append(installments, models.Installment{
+				Number:  i + 1,
+				Amount:  part,
+				DueDate: addMonths(*req.FirstDueDate, i),
+			})
+		}
+		installments[len(installments)-1].Amount = amount - part*int64(req.Count-1)
+		return installments, nil
+	}
+
+	var total int64
+	for i, part := range req.Installments {
+		if i > 0 && !part.DueDate.After(req.Installments[i-1].DueDate) {
+			return nil, apperrors.ValidationFailed(apperrors.FieldError{
+				Field:   "installments[" + strconv.Itoa(i) + "].dueDate",
+				Rule:    "gtfield",
+				Message: "must be after the previous installment",
+			})
+		}
+		total += part.Amount
+		installments = append(installments, models.Installment{
+			Number:  i + 1,
+			Amount:  part.Amount,
+			DueDate: part.DueDate,
+		})
+	}
+	if total != amount {
+		return nil, apperrors.ValidationFailed(apperrors.FieldError{
+			Field:   "installments",
+			Rule:    "sum",
+			Message: "must add up to the payment amount " + strconv.FormatInt(amount, 10),
+		})
+	}
+	return installments, nil
+}
+
+// addMonths moves t by months, keeping its day but clamping it to the end
+// of shorter months, so a plan starting on 31 January falls due on the last
+// day of February rather than in March.
+func addMonths(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	lastDay := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(t.Day(), lastDay)-1)
+}
+
+// allocateInstallments spreads the paid amount over the installments in
+// order and updates their status.
+func allocateInstallments(installments []models.Installment, paid int64) []models.Installment {
+	allocated := make([]models.Installment, len(installments))
+	for i, installment := range installments {
+		installment.PaidAmount = min(paid, installment.Amount)
+		paid -= installment.PaidAmount
+
+		switch {
+		case installment.PaidAmount >= installment.Amount:
+			installment.Status = "paid"
+		case installment.PaidAmount > 0:
+			installment.Status = "partially_paid"
+		default:
+			installment.Status = "pending"
+		}
+		allocated[i] = installment
+	}
+	return allocated
+}
+
+// reduceInstallments takes amount off the unpaid parts of a plan, last part
+// first. Parts reduced to nothing are dropped.
+func reduceInstallments(installments []models.Installment, amount int64) []models.Installment {
+	reduced := make([]models.Installment, len(installments))
+	copy(reduced, installments)
+	for i := len(reduced) - 1; i >= 0 && amount > 0; i-- {
+		cut := min(reduced[i].Amount-reduced[i].PaidAmount, amount)
+		reduced[i].Amount -= cut
+		amount -= cut
+	}
+
+	var kept []models.Installment
+	for _, installment := range reduced {
+		if installment.Amount > 0 {
+			installment.Number = len(kept) + 1
+			kept = append(kept, installment)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,146 @@
+package routes
+
+import (
+	"sims-backend-go/apperrors"
+	"sims-backend-go/models"
+	"testing"
+	"time"
+)
+
+func TestBuildInstallmentsCount(t *testing.T) {
+	first := date(2025, time.January, 31)
+	installments, err := buildInstallments(100000, models.InstallmentPlanRequest{Count: 3, FirstDueDate: &first})
+	if err != nil {
+		t.Fatalf("buildInstallments: %v", err)
+	}
+
+	wantAmounts := []int64{33333, 33333, 33334}
+	wantDates := []time.Time{date(2025, time.January, 31), date(2025, time.February, 28), date(2025, time.March, 31)}
+	if len(installments) != len(wantAmounts) {
+		t.Fatalf("got %d installments, want %d", len(installments), len(wantAmounts))
+	}
+	for i, installment := range installments {
+		if installment.Number != i+1 || installment.Amount != wantAmounts[i] || !installment.DueDate.Equal(wantDates[i]) {
+			t.Errorf("installment %d = {%d %d %s}, want {%d %d %s}", i, installment.Number, installment.Amount, installment.DueDate.Format("2006-01-02"),
+				i+1, wantAmounts[i], wantDates[i].Format("2006-01-02"))
+		}
+	}
+}
+
+func TestBuildInstallmentsCountAboveAmount(t *testing.T) {
+	first := date(2025, time.January, 10)
+	_, err := buildInstallments(3, models.InstallmentPlanRequest{Count: 4, FirstDueDate: &first})
+	if errorCode(err) != apperrors.CodeValidation {
+		t.Errorf("err = %v, want a validation error", err)
+	}
+
+	installments, err := buildInstallments(4, models.InstallmentPlanRequest{Count: 4, FirstDueDate: &first})
+	if err != nil || len(installments) != 4 || installments[3].Amount != 1 {
+		t.Errorf("count equal to amount: %v, %v", installments, err)
+	}
+}
+
+func TestBuildInstallmentsExplicit(t *testing.T) {
+	tests := []struct {
+		name  string
+		parts []models.InstallmentRequest
+		valid bool
+	}{
+		{
+			name:  "adds up",
+			parts: []models.InstallmentRequest{{Amount: 40000, DueDate: date(2025, 1, 10)}, {Amount: 60000, DueDate: date(2025, 2, 10)}},
+			valid: true,
+		},
+		{
+			name:  "short of the amount",
+			parts: []models.InstallmentRequest{{Amount: 40000, DueDate: date(2025, 1, 10)}, {Amount: 50000, DueDate: date(2025, 2, 10)}},
+		},
+		{
+			name:  "due dates out of order",
+			parts: []models.InstallmentRequest{{Amount: 40000, DueDate: date(2025, 2, 10)}, {Amount: 60000, DueDate: date(2025, 1, 10)}},
+		},
+		{
+			name:  "same due date",
+			parts: []models.InstallmentRequest{{Amount: 40000, DueDate: date(2025, 1, 10)}, {Amount: 60000, DueDate: date(2025, 1, 10)}},
+		},
+	}
+	for _, tt := range tests {
+		installments, err := buildInstallments(100000, models.InstallmentPlanRequest{Installments: tt.parts})
+		if tt.valid {
+			if err != nil || len(installments) != len(tt.parts) {
+				t.Errorf("%s: %v, %v", tt.name, installments, err)
+			}
+			continue
+		}
+		if errorCode(err) != apperrors.CodeValidation {
+			t.Errorf("%s: err = %v, want a validation error", tt.name, err)
+		}
+	}
+}
+
+func TestAddMonths(t *testing.T) {
+	tests := []struct {
+		from   time.Time
+		months int
+		want   time.Time
+	}{
+		{date(2025, time.January, 15), 1, date(2025, time.February, 15)},
+		{date(2025, time.January, 31), 1, date(2025, time.February, 28)},
+		{date(2024, time.January, 31), 1, date(2024, time.February, 29)},
+		{date(2025, time.January, 31), 3, date(2025, time.April, 30)},
+		{date(2025, time.August, 31), 6, date(2026, time.February, 28)},
+		{date(2025, time.November, 30), 3, date(2026, time.February, 28)},
+		{date(2025, time.March, 31), 0, date(2025, time.March, 31)},
+	}
+	for _, tt := range tests {
+		if got := addMonths(tt.from, tt.months); !got.Equal(tt.want) {
+			t.Errorf("addMonths(%s, %d) = %s, want %s", tt.from.Format("2006-01-02"), tt.months, got.Format("2006-01-02"), tt.want.Format("2006-01-02"))
+		}
+	}
+}
+
+func TestAllocateInstallments(t *testing.T) {
+	plan := []models.Installment{{Number: 1, Amount: 300}, {Number: 2, Amount: 300}, {Number: 3, Amount: 400}}
+
+	tests := []struct {
+		paid   int64
+		paidTo []int64
+		status []string
+	}{
+		{0, []int64{0, 0, 0}, []string{"pending", "pending", "pending"}},
+		{100, []int64{100, 0, 0}, []string{"partially_paid", "pending", "pending"}},
+		{300, []int64{300, 0, 0}, []string{"paid", "pending", "pending"}},
+		{450, []int64{300, 150, 0}, []string{"paid", "partially_paid", "pending"}},
+		{1000, []int64{300, 300, 400}, []string{"paid", "paid", "paid"}},
+	}
+	for _, tt := range tests {
+		allocated := allocateInstallments(plan, tt.paid)
+		for i, installment := range allocated {
+			if installment.PaidAmount != tt.paidTo[i] || installment.Status != tt.status[i] {
+				t.Errorf("paid %d, installment %d = {%d %s}, want {%d %s}", tt.paid, i+1, installment.PaidAmount, installment.Status, tt.paidTo[i], tt.status[i])
+			}
+		}
+	}
+	if plan[0].PaidAmount != 0 {
+		t.Error("allocateInstallments modified its input")
+	}
+}
+
+func TestReduceInstallments(t *testing.T) {
+	plan := []models.Installment{
+		{Number: 1, Amount: 300, PaidAmount: 300},
+		{Number: 2, Amount: 300, PaidAmount: 100},
+		{Number: 3, Amount: 400},
+	}
+
+	reduced := reduceInstallments(plan, 500)
+	if len(reduced) != 2 {
+		t.Fatalf("got %d installments, want 2", len(reduced))
+	}
+	if reduced[0].Amount != 300 || reduced[1].Amount != 200 || reduced[1].Number != 2 {
+		t.Errorf("reduced = %+v", reduced)
+	}
+	if plan[2].Amount != 400 {
+		t.Error("reduceInstallments modified its input")
+	}
+}
@@ -0,0 +1,190 @@
+package routes
+
+import (
+	"net/http"
+	"sims-backend-go/apperrors"
+	"sims-backend-go/config"
+	"sims-backend-go/models"
+	"sort"
+	"time"
+
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// GetMyPermissions lists the caller's effective permissions so the frontend
+// can hide what the user cannot do.
+func GetMyPermissions(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+	role := config.TokenRole(token)
+
+	permissions, err := config.PrincipalPermissions(c, token)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Unable to load permissions"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"role":        role,
+		"permissions": permissions,
+	})
+}
+
+// GetRolePermissions returns the permission registry and the mapping of
+// every role.
+func GetRolePermissions(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	registry := make([]gin.H, 0, len(config.Permissions))
+	for name, description := range config.Permissions {
+		registry = append(registry, gin.H{"name": name, "description": description})
+	}
+	sort.Slice(registry, func(i, j int) bool {
+		return registry[i]["name"].(string) < registry[j]["name"].(string)
+	})
+
+	roles := make([]gin.H, 0, len(models.ValidRoles))
+	for _, role := range models.ValidRoles {
+		permissions, custom, err := config.RolePermissionsFor(ctx, role)
+		if err != nil {
+			c.Error(apperrors.Unavailable(err, "Unable to load permissions"))
+			return
+		}
+		roles = append(roles, gin.H{
+			"role":        role,
+			"permissions": permissions,
+			"custom":      custom,
+			"editable":    role != config.SuperuserRole,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"permissions": registry,
+		"roles":       roles,
+	})
+}
+
+func UpdateRolePermissions(c *gin.Context) {
+	role := c.Param("role")
+	if !models.IsValidRole(role) {
+		c.Error(apperrors.NotFound("Unknown role"))
+		return
+	}
+	if role == config.SuperuserRole {
+		c.Error(apperrors.BadRequest("Permissions of the admin role cannot be changed"))
+		return
+	}
+
+	var req models.RolePermissionsUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	var unknown []string
+	seen := make(map[string]bool)
+	permissions := []string{}
+	for _, permission := range req.Permissions {
+		if !config.IsValidPermission(permission) {
+			unknown = append(unknown, permission)
+			continue
+		}
+		if !seen[permission] {
+			seen[permission] = true
+			permissions = append(permissions, permission)
+		}
+	}
+	if len(unknown) > 0 {
+		c.Error(apperrors.BadRequest("Unknown permissions").With("unknown", unknown))
+		return
+	}
+	sort.Strings(permissions)
+
+	user, _ := c.Get("user")
+	token := user.(*auth.Token)
+
+	ctx := c.Request.Context()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	previous, _, err := config.RolePermissionsFor(ctx, role)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Unable to load permissions"))
+		return
+	}
+
+	mapping := models.RolePermissions{
+		Role:        role,
+		Permissions: permissions,
+		UpdatedBy:   token.UID,
+		UpdatedAt:   time.Now(),
+	}
+	if _, err := client.Collection("role_permissions").Doc(role).Set(ctx, mapping); err != nil {
+		c.Error(apperrors.Internal(err, "Failed to update permissions"))
+		return
+	}
+	config.InvalidateRolePermissions()
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "permissions.update",
+		TargetType: "role",
+		TargetID:   role,
+		Details: map[string]interface{}{
+			"previous":    previous,
+			"permissions": permissions,
+		},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"role": mapping})
+}
+
+// ResetRolePermissions removes the stored mapping so the role falls back to
+// its defaults.
+func ResetRolePermissions(c *gin.Context) {
+	role := c.Param("role")
+	if !models.IsValidRole(role) {
+		c.Error(apperrors.NotFound("Unknown role"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	if _, err := client.Collection("role_permissions").Doc(role).Delete(ctx); err != nil {
+		c.Error(apperrors.Internal(err, "Failed to reset permissions"))
+		return
+	}
+	config.InvalidateRolePermissions()
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "permissions.reset",
+		TargetType: "role",
+		TargetID:   role,
+	})
+
+	permissions, _, err := config.RolePermissionsFor(ctx, role)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Unable to load permissions"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"role":        role,
+		"permissions": permissions,
+	})
+}
@@ -0,0 +1,501 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sims-backend-go/apperrors"
+	"sims-backend-go/config"
+	"sims-backend-go/models"
+	"sims-backend-go/services"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const receiptPrefix = "RCP"
+
+// receiptYearKey turns an academic year such as 2024/2025 into a document
+// ID and receipt number segment.
+func receiptYearKey(academicYear string) string {
+	key := strings.NewReplacer("/", "-", " ", "").Replace(strings.TrimSpace(academicYear))
+	if key == "" {
+		return "general"
+	}
+	return key
+}
+
+// issueReceipt takes the next receipt number of the academic year and
+// returns the receipt for the caller to store. It reads the counter, so it
+// must run before the transaction's writes; because the counter is only
+// advanced when the transaction commits, numbers have no gaps.
+func issueReceipt(tx *firestore.Transaction, client *firestore.Client, paymentID, academicYear string, now time.Time) (models.Receipt, error) {
+	key := receiptYearKey(academicYear)
+	counterRef := client.Collection("receipt_counters").Doc(key)
+
+	var counter models.ReceiptCounter
+	doc, err := tx.Get(counterRef)
+	switch {
+	case status.Code(err) == codes.NotFound:
+	case err != nil:
+		return models.Receipt{}, err
+	default:
+		doc.DataTo(&counter)
+	}
+
+	sequence := counter.Last + 1
+	if err := tx.Set(counterRef, models.ReceiptCounter{AcademicYear: academicYear, Last: sequence, UpdatedAt: now}); err != nil {
+		return models.Receipt{}, err
+	}
+
+	return models.Receipt{
+		PaymentID:    paymentID,
+		Number:       fmt.Sprintf("%s-%s-%06d", receiptPrefix, key, sequence),
+		AcademicYear: academicYear,
+		Sequence:     sequence,
+		IssuedAt:     now,
+	}, nil
+}
+
+// receiptOf reads the receipt of a paid payment in tx, issuing one for
+// payments paid before receipts were issued automatically; the caller must
+// then store it with storeIssuedReceipt. It reads, so it must run before
+// the transaction's other writes.
+func receiptOf(tx *firestore.Transaction, client *firestore.Client, payment *models.Payment, now time.Time) (models.Receipt, bool, error) {
+	doc, err := tx.Get(client.Collection("receipts").Doc(payment.ID))
+	switch {
+	case status.Code(err) == codes.NotFound:
+		receipt, err := issueReceipt(tx, client, payment.ID, payment.AcademicYear, now)
+		if err != nil {
+			return models.Receipt{}, false, err
+		}
+		payment.ReceiptNumber = receipt.Number
+		return receipt, true, nil
+	case err != nil:
+		return models.Receipt{}, false, err
+	}
+
+	var receipt models.Receipt
+	doc.DataTo(&receipt)
+	return receipt, false, nil
+}
+
+func storeIssuedReceipt(tx *firestore.Transaction, client *firestore.Client, receipt models.Receipt) error {
+	if err := tx.Create(client.Collection("receipts").Doc(receipt.PaymentID), receipt); err != nil {
+		return err
+	}
+	return tx.Update(client.Collection("payments").Doc(receipt.PaymentID), []firestore.Update{{Path: "receiptNumber", Value: receipt.Number}})
+}
+
+// GetPaymentReceipt renders the receipt of a paid payment without counting
+// a print, so previews and retries never use up the original. Until the
+// receipt has been printed it shows the original; afterwards a copy.
+// Payments paid before receipts were issued automatically get their number
+// here.
+func GetPaymentReceipt(c *gin.Context) {
+	paymentID := c.Param("id")
+
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	ref := client.Collection("payments").Doc(paymentID)
+
+	var payment models.Payment
+	var receipt models.Receipt
+	now := time.Now()
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		payment = paymentFromDoc(doc)
+		if payment.Status != "paid" {
+			return apperrors.Conflict("Only paid payments have a receipt")
+		}
+
+		var issued bool
+		receipt, issued, err = receiptOf(tx, client, &payment, now)
+		if err != nil || !issued {
+			return err
+		}
+		return storeIssuedReceipt(tx, client, receipt)
+	})
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Payment not found", "Failed to fetch receipt"))
+		return
+	}
+
+	data, err := loadReceiptData(ctx, client, payment)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to load receipt details"))
+		return
+	}
+	data.Receipt = receipt
+	data.Copy = receipt.Prints > 0
+	data.PrintedAt = now
+	data.PrintedBy = receiptPrintedBy(token)
+	pdf := renderReceipt(data)
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "payment.receipt_view",
+		TargetType: "payment",
+		TargetID:   paymentID,
+		Details: map[string]interface{}{
+			"receiptNumber": receipt.Number,
+			"copy":          data.Copy,
+		},
+	})
+
+	c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="%s.pdf"`, receipt.Number))
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
+
+// PrintPaymentReceipt renders a counted print of the receipt of a paid
+// payment: the first is the original, later ones are marked as copies. The
+// print is counted in the transaction that rendered it and audited after
+// it commits.
+func PrintPaymentReceipt(c *gin.Context) {
+	paymentID := c.Param("id")
+
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	ref := client.Collection("payments").Doc(paymentID)
+	receiptRef := client.Collection("receipts").Doc(paymentID)
+
+	// Transactions, student and class are loaded up front so the
+	// transaction only renders and counts
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Payment not found", "Failed to fetch payment"))
+		return
+	}
+	data, err := loadReceiptData(ctx, client, paymentFromDoc(doc))
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to load receipt details"))
+		return
+	}
+	data.PrintedBy = receiptPrintedBy(token)
+
+	var receipt models.Receipt
+	var pdf []byte
+	now := time.Now()
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		payment := paymentFromDoc(doc)
+		if payment.Status != "paid" {
+			return apperrors.Conflict("Only paid payments have a receipt")
+		}
+
+		var issued bool
+		receipt, issued, err = receiptOf(tx, client, &payment, now)
+		if err != nil {
+			return err
+		}
+
+		receipt.Prints++
+		receipt.LastPrintedAt = &now
+		receipt.LastPrintedBy = token.UID
+
+		data.Payment = payment
+		data.Receipt = receipt
+		data.Print = receipt.Prints
+		data.Copy = receipt.Prints > 1
+		data.PrintedAt = now
+		pdf = renderReceipt(data)
+
+		if issued {
+			return storeIssuedReceipt(tx, client, receipt)
+		}
+		return tx.Update(receiptRef, []firestore.Update{
+			{Path: "prints", Value: receipt.Prints},
+			{Path: "lastPrintedAt", Value: now},
+			{Path: "lastPrintedBy", Value: token.UID},
+		})
+	})
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Payment not found", "Failed to print receipt"))
+		return
+	}
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "payment.receipt_print",
+		TargetType: "payment",
+		TargetID:   paymentID,
+		Details: map[string]interface{}{
+			"receiptNumber": receipt.Number,
+			"print":         receipt.Prints,
+			"copy":          receipt.Prints > 1,
+		},
+	})
+
+	c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="%s.pdf"`, receipt.Number))
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
+
+// receiptPrintedBy names the caller on the receipt.
+func receiptPrintedBy(token *auth.Token) string {
+	if email, _ := token.Claims["email"].(string); email != "" {
+		return email
+	}
+	return token.UID
+}
+
+// receiptData is everything printed on a receipt.
+type receiptData struct {
+	Payment      models.Payment
+	Receipt      models.Receipt
+	Transactions []models.PaymentTransaction
+	StudentName  string
+	StudentID    string
+	ClassName    string
+	ProcessedBy  string
+	PrintedBy    string
+	PrintedAt    time.Time
+	Print        int // counted print number, 0 for a view
+	Copy         bool
+}
+
+func loadReceiptData(ctx context.Context, client *firestore.Client, payment models.Payment) (receiptData, error) {
+	data := receiptData{
+		Payment:     payment,
+		StudentName: payment.StudentID,
+		ProcessedBy: payment.ProcessedBy,
+	}
+
+	iter := client.Collection("payments").Doc(payment.ID).Collection("transactions").OrderBy("receivedAt", firestore.Asc).Documents(ctx)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return data, err
+		}
+
+		var transaction models.PaymentTransaction
+		doc.DataTo(&transaction)
+		transaction.ID = doc.Ref.ID
+		data.Transactions = append(data.Transactions, transaction)
+	}
+
+	// Names are best effort, the IDs are printed when a lookup fails
+	if doc, err := client.Collection("users").Doc(payment.StudentID).Get(ctx); err == nil {
+		var student models.User
+		doc.DataTo(&student)
+		data.StudentName = student.DisplayName
+		data.StudentID = student.StudentID
+		if student.ClassID != "" {
+			if doc, err := client.Collection("classes").Doc(student.ClassID).Get(ctx); err == nil {
+				var class models.Class
+				doc.DataTo(&class)
+				data.ClassName = class.Name
+			}
+		}
+	}
+	if payment.ProcessedBy != "" {
+		if doc, err := client.Collection("users").Doc(payment.ProcessedBy).Get(ctx); err == nil {
+			var processor models.User
+			doc.DataTo(&processor)
+			data.ProcessedBy = processor.DisplayName
+		}
+	}
+
+	return data, nil
+}
+
+// renderReceipt lays out an A4 receipt.
+func renderReceipt(data receiptData) []byte {
+	const (
+		left  = 50.0
+		right = services.A4Width - 50
+	)
+	payment := data.Payment
+	school := config.AppConfig.School
+
+	pdf := services.NewPDF(services.A4Width, services.A4Height)
+	pdf.SetTitle("Receipt " + data.Receipt.Number)
+	if data.Copy {
+		pdf.Watermark("COPY")
+	}
+
+	// School header and receipt number
+	y := 70.0
+	pdf.Text(left, y, 18, true, school.Name)
+	pdf.TextRight(right, y, 20, true, "RECEIPT")
+	y += 16
+	if school.Address != "" {
+		pdf.Text(left, y, 10, false, school.Address)
+	}
+	pdf.TextRight(right, y, 10, false, "No. "+data.Receipt.Number)
+	y += 14
+	if school.Phone != "" {
+		pdf.Text(left, y, 10, false, "Phone: "+school.Phone)
+	}
+	paidDate := payment.UpdatedAt
+	if payment.PaidDate != nil {
+		paidDate = *payment.PaidDate
+	}
+	pdf.TextRight(right, y, 10, false, "Date: "+paidDate.Format("02 Jan 2006"))
+	if data.Copy {
+		label := "COPY"
+		if data.Print > 0 {
+			label += " - print " + strconv.Itoa(data.Print)
+		}
+		y += 14
+		pdf.TextRight(right, y, 10, true, label)
+	}
+	y += 14
+	pdf.Line(left, y, right, y, 1)
+
+	// Student and payment details
+	y += 26
+	pdf.Text(left, y, 10, true, "Received from")
+	pdf.Text(300, y, 10, true, "For")
+	y += 15
+	pdf.Text(left, y, 11, false, data.StudentName)
+	pdf.Text(300, y, 11, false, payment.Description)
+	y += 14
+	if data.StudentID != "" {
+		pdf.Text(left, y, 10, false, "Student ID: "+data.StudentID)
+	}
+	pdf.Text(300, y, 10, false, "Type: "+payment.PaymentType)
+	y += 14
+	if data.ClassName != "" {
+		pdf.Text(left, y, 10, false, "Class: "+data.ClassName)
+	}
+	period := "Academic year: " + payment.AcademicYear
+	if payment.Semester != "" {
+		period += ", semester " + payment.Semester
+	}
+	pdf.Text(300, y, 10, false, period)
+	if payment.Period != "" {
+		y += 14
+		pdf.Text(300, y, 10, false, "Period: "+payment.Period)
+	}
+
+	// Line items
+	y += 32
+	pdf.Text(left, y, 10, true, "Description")
+	pdf.TextRight(right, y, 10, true, "Amount")
+	y += 6
+	pdf.Line(left, y, right, y, 0.5)
+	y += 16
+	pdf.Text(left, y, 10, false, payment.Description)
+	pdf.TextRight(right, y, 10, false, displayAmount(payment.Amount, payment.Currency))
+	y += 10
+	pdf.Line(left, y, right, y, 0.5)
+	y += 16
+	pdf.Text(left, y, 10, true, "Total")
+	pdf.TextRight(right, y, 10, true, displayAmount(payment.Amount, payment.Currency))
+
+	// Payments received
+	y += 32
+	pdf.Text(left, y, 10, true, "Date")
+	pdf.Text(140, y, 10, true, "Method")
+	pdf.Text(230, y, 10, true, "Reference")
+	pdf.TextRight(right, y, 10, true, "Received")
+	y += 6
+	pdf.Line(left, y, right, y, 0.5)
+	transactions := data.Transactions
+	if len(transactions) == 0 {
+		// Marked paid before transactions were recorded
+		transactions = []models.PaymentTransaction{{
+			Amount:     payment.PaidAmount,
+			Method:     payment.PaymentMethod,
+			Reference:  payment.Reference,
+			ReceivedAt: paidDate,
+		}}
+	}
+	for _, transaction := range transactions {
+		y += 16
+		pdf.Text(left, y, 10, false, transaction.ReceivedAt.Format("02 Jan 2006"))
+		pdf.Text(140, y, 10, false, transaction.Method)
+		pdf.Text(230, y, 10, false, transaction.Reference)
+		pdf.TextRight(right, y, 10, false, displayAmount(transaction.Amount, payment.Currency))
+	}
+	y += 10
+	pdf.Line(left, y, right, y, 0.5)
+	y += 16
+	pdf.Text(left, y, 10, true, "Total paid")
+	pdf.TextRight(right, y, 10, true, displayAmount(payment.PaidAmount, payment.Currency))
+	y += 14
+	pdf.Text(left, y, 10, false, "Balance")
+	pdf.TextRight(right, y, 10, false, displayAmount(payment.Balance, payment.Currency))
+
+	// Processor and print details
+	y += 48
+	pdf.Text(left, y, 10, false, "Processed by: "+data.ProcessedBy)
+	y += 14
+	pdf.Text(left, y, 9, false, fmt.Sprintf("Printed %s by %s", data.PrintedAt.Format("02 Jan 2006 15:04"), data.PrintedBy))
+	y += 12
+	pdf.Text(left, y, 9, false, "This receipt was generated electronically and is valid without a signature.")
+
+	return pdf.Bytes()
+}
+
+// displayAmount formats minor units for people, e.g. "IDR 150,000.00".
+func displayAmount(amount int64, currency string) string {
+	return currency + " " + groupAmount(amount, currency)
+}
+
+// groupAmount formats minor units with thousands separators, e.g.
+// "150,000.00".
+func groupAmount(amount int64, currency string) string {
+	formatted := models.FormatAmount(amount, currency)
+	sign := ""
+	if strings.HasPrefix(formatted, "-") {
+		sign, formatted = "-", formatted[1:]
+	}
+	whole, fraction, hasFraction := strings.Cut(formatted, ".")
+
+	var grouped strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(digit)
+	}
+	if hasFraction {
+		grouped.WriteString("." + fraction)
+	}
+	return sign + grouped.String()
+}
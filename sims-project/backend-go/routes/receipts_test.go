@@ -0,0 +1,201 @@
+package routes
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"io"
+	"sims-backend-go/config"
+	"sims-backend-go/models"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+func TestReceiptYearKey(t *testing.T) {
+	tests := []struct {
+		academicYear string
+		want         string
+	}{
+		{"2024/2025", "2024-2025"},
+		{" 2024 / 2025 ", "2024-2025"},
+		{"2025", "2025"},
+		{"", "general"},
+		{"  ", "general"},
+	}
+	for _, tt := range tests {
+		if got := receiptYearKey(tt.academicYear); got != tt.want {
+			t.Errorf("receiptYearKey(%q) = %q, want %q", tt.academicYear, got, tt.want)
+		}
+	}
+}
+
+func TestGroupAmount(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		currency string
+		want     string
+	}{
+		{15000000, "IDR", "150,000.00"},
+		{99, "IDR", "0.99"},
+		{123456789012, "IDR", "1,234,567,890.12"},
+		{-250000, "IDR", "-2,500.00"},
+		{150000, "JPY", "150,000"},
+	}
+	for _, tt := range tests {
+		if got := groupAmount(tt.amount, tt.currency); got != tt.want {
+			t.Errorf("groupAmount(%d, %s) = %q, want %q", tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
+
+// pdfContent inflates the content streams of a PDF.
+func pdfContent(t *testing.T, pdf []byte) string {
+	t.Helper()
+	var content strings.Builder
+	for {
+		start := bytes.Index(pdf, []byte("stream\n"))
+		if start < 0 {
+			return content.String()
+		}
+		pdf = pdf[start+len("stream\n"):]
+		end := bytes.Index(pdf, []byte("\nendstream"))
+		reader, err := zlib.NewReader(bytes.NewReader(pdf[:end]))
+		if err != nil {
+			t.Fatalf("inflating content stream: %v", err)
+		}
+		io.Copy(&content, reader)
+		pdf = pdf[end+len("\nendstream"):]
+	}
+}
+
+func TestRenderReceiptCopy(t *testing.T) {
+	defer func(cfg *config.Config) { config.AppConfig = cfg }(config.AppConfig)
+	config.AppConfig = &config.Config{}
+
+	paid := date(2025, time.January, 10)
+	data := receiptData{
+		Payment:   models.Payment{ID: "p1", Amount: 15000000, PaidAmount: 15000000, Currency: "IDR", Status: "paid", PaidDate: &paid},
+		Receipt:   models.Receipt{PaymentID: "p1", Number: "RCP-2024-2025-000001"},
+		PrintedAt: paid,
+	}
+
+	tests := []struct {
+		name  string
+		print int
+		copy  bool
+		want  string
+	}{
+		{"original view", 0, false, ""},
+		{"first print", 1, false, ""},
+		{"viewed after printing", 0, true, "(COPY)"},
+		{"reprint", 3, true, "(COPY - print 3)"},
+	}
+	for _, tt := range tests {
+		data.Print, data.Copy = tt.print, tt.copy
+		content := pdfContent(t, renderReceipt(data))
+		if !strings.Contains(content, "RCP-2024-2025-000001") {
+			t.Errorf("%s: receipt number missing", tt.name)
+		}
+		if marked := strings.Contains(content, "COPY"); marked != tt.copy {
+			t.Errorf("%s: marked as copy = %v, want %v", tt.name, marked, tt.copy)
+		}
+		if tt.want != "" && !strings.Contains(content, tt.want) {
+			t.Errorf("%s: label %s missing", tt.name, tt.want)
+		}
+	}
+}
+
+func TestIssueReceiptSequence(t *testing.T) {
+	client := emulatorClient(t)
+	ctx := context.Background()
+	academicYear := "2024/" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	key := receiptYearKey(academicYear)
+	defer client.Collection("receipt_counters").Doc(key).Delete(ctx)
+
+	now := time.Now().UTC()
+	for i := 1; i <= 3; i++ {
+		var receipt models.Receipt
+		err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			var err error
+			receipt, err = issueReceipt(tx, client, "p"+strconv.Itoa(i), academicYear, now)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("issueReceipt %d: %v", i, err)
+		}
+		if want := "RCP-" + key + "-00000" + strconv.Itoa(i); receipt.Number != want || receipt.Sequence != int64(i) {
+			t.Errorf("receipt %d = %s (%d), want %s", i, receipt.Number, receipt.Sequence, want)
+		}
+	}
+
+	// A failed transaction does not use up a number
+	client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if _, err := issueReceipt(tx, client, "p4", academicYear, now); err != nil {
+			return err
+		}
+		return context.Canceled
+	})
+	doc, err := client.Collection("receipt_counters").Doc(key).Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var counter models.ReceiptCounter
+	doc.DataTo(&counter)
+	if counter.Last != 3 {
+		t.Errorf("counter = %d after a rolled back issue, want 3", counter.Last)
+	}
+}
+
+func TestReceiptOfIssuesOnce(t *testing.T) {
+	client := emulatorClient(t)
+	ctx := context.Background()
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+	payment := models.Payment{ID: "receipt-test-" + suffix, AcademicYear: "2024/" + suffix, Status: "paid"}
+	if _, err := client.Collection("payments").Doc(payment.ID).Set(ctx, payment); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Collection("payments").Doc(payment.ID).Delete(ctx)
+	defer client.Collection("receipts").Doc(payment.ID).Delete(ctx)
+	defer client.Collection("receipt_counters").Doc(receiptYearKey(payment.AcademicYear)).Delete(ctx)
+
+	view := func() (models.Receipt, bool) {
+		var receipt models.Receipt
+		var issued bool
+		err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			current := payment
+			var err error
+			receipt, issued, err = receiptOf(tx, client, &current, time.Now())
+			if err != nil || !issued {
+				return err
+			}
+			return storeIssuedReceipt(tx, client, receipt)
+		})
+		if err != nil {
+			t.Fatalf("receiptOf: %v", err)
+		}
+		return receipt, issued
+	}
+
+	first, issued := view()
+	if !issued || first.Sequence != 1 {
+		t.Fatalf("first view: receipt = %+v, issued = %v", first, issued)
+	}
+	second, issued := view()
+	if issued || second.Number != first.Number {
+		t.Errorf("second view: receipt = %+v, issued = %v, want the stored %s", second, issued, first.Number)
+	}
+
+	doc, err := client.Collection("payments").Doc(payment.ID).Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored models.Payment
+	doc.DataTo(&stored)
+	if stored.ReceiptNumber != first.Number {
+		t.Errorf("payment receiptNumber = %q, want %q", stored.ReceiptNumber, first.Number)
+	}
+}
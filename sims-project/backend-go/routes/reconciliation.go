@@ -0,0 +1,799 @@
+package routes
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"sims-backend-go/apperrors"
+	"sims-backend-go/models"
+	"sims-backend-go/services"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const maxStatementBytes = 5 << 20
+
+// maxStatementLines keeps a statement and its lines within one Firestore
+// batch of 500 writes.
+const maxStatementLines = 499
+
+// Match scoring. A line is matched automatically when the best candidate
+// reaches matchThreshold and no other candidate comes close; otherwise
+// lines with candidates go to the review queue.
+const (
+	scoreReference   = 60
+	scoreStudentID   = 40
+	scoreStudentName = 20
+	scoreAmount      = 30
+	scoreInstallment = 20
+	matchThreshold   = 70
+	matchMargin      = 30
+	maxCandidates    = 5
+)
+
+// openPaymentStatuses are the statuses a transfer can still be applied to.
+var openPaymentStatuses = []string{"pending", "partially_paid", "overdue"}
+
+// ImportBankStatement reads a CSV or MT940 bank statement uploaded as the
+// multipart field "file", stores its incoming transfers and matches them
+// to open payments. Transfers already imported from an earlier statement
+// are skipped.
+func ImportBankStatement(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxStatementBytes)
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.Error(apperrors.ValidationFailed(apperrors.FieldError{Field: "file", Rule: "required", Message: "a statement file of at most 5 MB is required"}))
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.Error(apperrors.BadRequest("Failed to read statement file"))
+		return
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		c.Error(apperrors.BadRequest("Failed to read statement file"))
+		return
+	}
+
+	format := c.PostForm("format")
+	if format == "" {
+		format = services.DetectStatementFormat(data)
+	}
+	parsed, err := services.ParseBankStatement(format, data)
+	var statementErr *services.StatementError
+	switch {
+	case errors.Is(err, services.ErrUnknownStatementFormat):
+		c.Error(apperrors.ValidationFailed(apperrors.FieldError{Field: "format", Rule: "oneof", Message: "must be one of csv, mt940"}))
+		return
+	case errors.As(err, &statementErr):
+		c.Error(apperrors.BadRequest("Invalid bank statement: "+statementErr.Err).With("line", statementErr.Line))
+		return
+	case err != nil:
+		c.Error(apperrors.BadRequest("Invalid bank statement: " + err.Error()))
+		return
+	}
+
+	currency := parsed.Currency
+	if code := c.PostForm("currency"); code != "" {
+		currency = code
+	}
+	currency, err = resolveCurrency(currency)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	// Every entry is checked before anything is stored, so a bad line never
+	// leaves part of the statement behind
+	if len(parsed.Entries) > maxStatementLines {
+		c.Error(apperrors.BadRequest("Statement has too many transfers, split it into smaller files").With("max", maxStatementLines))
+		return
+	}
+	entries := make([]models.StatementLine, 0, len(parsed.Entries))
+	seen := make(map[string]int)
+	for _, entry := range parsed.Entries {
+		lineCurrency := currency
+		if entry.Currency != "" {
+			lineCurrency = entry.Currency
+		}
+		amount, err := models.ParseAmount(entry.Amount, lineCurrency)
+		if err != nil {
+			c.Error(apperrors.BadRequest("Invalid bank statement: "+err.Error()).With("line", entry.Line))
+			return
+		}
+
+		line := models.StatementLine{
+			LineNumber:  entry.Line,
+			Date:        entry.Date,
+			Amount:      amount,
+			Currency:    lineCurrency,
+			Reference:   entry.Reference,
+			Description: entry.Description,
+			Name:        entry.Name,
+			BankRef:     entry.BankRef,
+		}
+		// Identical transfers in one file are told apart by occurrence, which
+		// an overlapping statement repeats in the same order
+		fingerprint := statementLineFingerprint(parsed.Account, line)
+		seen[fingerprint]++
+		line.ID = statementLineID(fingerprint, seen[fingerprint])
+		entries = append(entries, line)
+	}
+
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	payments, students, err := loadOpenPayments(ctx, client)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to fetch payments"))
+		return
+	}
+
+	now := time.Now()
+	statementRef := client.Collection("bank_statements").NewDoc()
+	statement := models.BankStatement{
+		ID:         statementRef.ID,
+		FileName:   header.Filename,
+		Format:     parsed.Format,
+		Account:    parsed.Account,
+		Currency:   currency,
+		Debits:     parsed.Debits,
+		ImportedBy: token.UID,
+		ImportedAt: now,
+	}
+
+	// Transfers imported from an earlier statement are skipped
+	lineRefs := make([]*firestore.DocumentRef, len(entries))
+	for i, line := range entries {
+		lineRefs[i] = client.Collection("statement_lines").Doc(line.ID)
+	}
+	existing, err := client.GetAll(ctx, lineRefs)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to check statement lines"))
+		return
+	}
+
+	batch := client.Batch()
+	lines := []models.StatementLine{}
+	for i, line := range entries {
+		if existing[i].Exists() {
+			statement.Duplicates++
+			continue
+		}
+
+		line.StatementID = statement.ID
+		line.CreatedAt = now
+		line.Candidates = matchStatementLine(line, payments, students)
+		line.Status = matchStatus(line.Candidates)
+		if line.Status == "matched" {
+			line.PaymentID = line.Candidates[0].PaymentID
+		}
+
+		switch line.Status {
+		case "matched":
+			statement.Matched++
+		case "review":
+			statement.Review++
+		default:
+			statement.Unmatched++
+		}
+		statement.Lines++
+		lines = append(lines, line)
+		batch.Create(lineRefs[i], line)
+	}
+
+	// The statement and its lines are stored together or not at all
+	batch.Create(statementRef, statement)
+	if _, err := batch.Commit(ctx); err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			c.Error(apperrors.Conflict("Statement lines were imported meanwhile, upload the file again"))
+			return
+		}
+		c.Error(apperrors.Internal(err, "Failed to save bank statement"))
+		return
+	}
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "bank_statement.import",
+		TargetType: "bank_statement",
+		TargetID:   statement.ID,
+		Details: map[string]interface{}{
+			"fileName":   statement.FileName,
+			"format":     statement.Format,
+			"lines":      statement.Lines,
+			"duplicates": statement.Duplicates,
+			"matched":    statement.Matched,
+			"review":     statement.Review,
+		},
+	})
+
+	setLocation(c, statement.ID)
+	c.JSON(http.StatusCreated, gin.H{"statement": statement, "lines": lines})
+}
+
+func GetBankStatements(c *gin.Context) {
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	iter := client.Collection("bank_statements").OrderBy("importedAt", firestore.Desc).Limit(100).Documents(ctx)
+	statements := []models.BankStatement{}
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			c.Error(apperrors.Internal(err, "Failed to fetch bank statements"))
+			return
+		}
+
+		var statement models.BankStatement
+		doc.DataTo(&statement)
+		statement.ID = doc.Ref.ID
+		statements = append(statements, statement)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"statements": statements})
+}
+
+// GetBankStatement returns a statement with the lines imported from it.
+func GetBankStatement(c *gin.Context) {
+	statementID := c.Param("id")
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	doc, err := client.Collection("bank_statements").Doc(statementID).Get(ctx)
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Bank statement not found", "Failed to fetch bank statement"))
+		return
+	}
+
+	var statement models.BankStatement
+	doc.DataTo(&statement)
+	statement.ID = doc.Ref.ID
+
+	lines, err := queryStatementLines(ctx, client.Collection("statement_lines").Where("statementId", "==", statementID).OrderBy("lineNumber", firestore.Asc))
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to fetch statement lines"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"statement": statement, "lines": lines})
+}
+
+// GetStatementLines lists statement lines, oldest transfer first. Filter
+// with ?status=review for the review queue.
+func GetStatementLines(c *gin.Context) {
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	query := client.Collection("statement_lines").Query
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status", "==", status)
+	}
+	if statementID := c.Query("statementId"); statementID != "" {
+		query = query.Where("statementId", "==", statementID)
+	}
+
+	lines, err := queryStatementLines(ctx, query.OrderBy("date", firestore.Asc).Limit(500))
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to fetch statement lines"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"lines": lines})
+}
+
+// ConfirmStatementLine applies a transfer to a payment: the suggested match,
+// or the payment chosen by the reviewer.
+func ConfirmStatementLine(c *gin.Context) {
+	lineID := c.Param("id")
+
+	var req models.StatementLineConfirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	line, err := confirmStatementLine(ctx, client, c, lineID, req, token.UID)
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Statement line not found", "Failed to confirm statement line"))
+		return
+	}
+
+	doc, err := client.Collection("payments").Doc(line.PaymentID).Get(ctx)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to fetch payment"))
+		return
+	}
+
+	setETag(c, doc)
+	c.JSON(http.StatusOK, gin.H{"line": line, "payment": paymentFromDoc(doc)})
+}
+
+// ConfirmBankStatement confirms every automatically matched line of a
+// statement. Lines that can no longer be applied, e.g. because the payment
+// was settled meanwhile, are reported and left for review.
+func ConfirmBankStatement(c *gin.Context) {
+	statementID := c.Param("id")
+
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	if _, err := client.Collection("bank_statements").Doc(statementID).Get(ctx); err != nil {
+		c.Error(apperrors.FromFirestore(err, "Bank statement not found", "Failed to fetch bank statement"))
+		return
+	}
+
+	lines, err := queryStatementLines(ctx, client.Collection("statement_lines").Where("statementId", "==", statementID).Where("status", "==", "matched"))
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to fetch statement lines"))
+		return
+	}
+
+	confirmed := []models.StatementLine{}
+	failed := []gin.H{}
+	for _, line := range lines {
+		result, err := confirmStatementLine(ctx, client, c, line.ID, models.StatementLineConfirmRequest{}, token.UID)
+		if err != nil {
+			var appErr *apperrors.Error
+			if !errors.As(err, &appErr) {
+				c.Error(apperrors.Internal(err, "Failed to confirm statement line"))
+				return
+			}
+			// Send it to the review queue with the reason
+			client.Collection("statement_lines").Doc(line.ID).Update(ctx, []firestore.Update{
+				{Path: "status", Value: "review"},
+				{Path: "note", Value: appErr.Message},
+			})
+			failed = append(failed, gin.H{"lineId": line.ID, "error": appErr.Message})
+			continue
+		}
+		confirmed = append(confirmed, result)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"confirmed": confirmed, "failed": failed})
+}
+
+// IgnoreStatementLine takes a transfer that is not a school payment, such
+// as interest or a donation, out of the review queue.
+func IgnoreStatementLine(c *gin.Context) {
+	lineID := c.Param("id")
+
+	var req models.StatementLineIgnoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	ref := client.Collection("statement_lines").Doc(lineID)
+	now := time.Now()
+	var line models.StatementLine
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		doc.DataTo(&line)
+		if line.Status == "confirmed" {
+			return apperrors.Conflict("Statement line is already confirmed")
+		}
+
+		line.Status = "ignored"
+		line.Note = req.Note
+		line.ResolvedBy = token.UID
+		line.ResolvedAt = &now
+		return tx.Update(ref, []firestore.Update{
+			{Path: "status", Value: line.Status},
+			{Path: "note", Value: line.Note},
+			{Path: "resolvedBy", Value: line.ResolvedBy},
+			{Path: "resolvedAt", Value: line.ResolvedAt},
+		})
+	})
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Statement line not found", "Failed to ignore statement line"))
+		return
+	}
+	line.ID = lineID
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "statement_line.ignore",
+		TargetType: "statement_line",
+		TargetID:   lineID,
+		Details: map[string]interface{}{
+			"statementId": line.StatementID,
+			"amount":      line.Amount,
+			"note":        line.Note,
+		},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"line": line})
+}
+
+// confirmStatementLine records the transfer as a transaction of the payment
+// and marks the line confirmed in one Firestore transaction.
+func confirmStatementLine(ctx context.Context, client *firestore.Client, c *gin.Context, lineID string, req models.StatementLineConfirmRequest, uid string) (models.StatementLine, error) {
+	ref := client.Collection("statement_lines").Doc(lineID)
+	now := time.Now()
+
+	var line models.StatementLine
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		line = models.StatementLine{}
+		doc.DataTo(&line)
+		line.ID = doc.Ref.ID
+
+		switch line.Status {
+		case "confirmed":
+			return apperrors.Conflict("Statement line is already confirmed").With("paymentId", line.PaymentID)
+		case "ignored":
+			return apperrors.Conflict("Statement line is ignored")
+		}
+
+		paymentID := req.PaymentID
+		if paymentID == "" {
+			paymentID = line.PaymentID
+		}
+		if paymentID == "" {
+			return apperrors.ValidationFailed(apperrors.FieldError{Field: "paymentId", Rule: "required", Message: "is required for lines without a match"})
+		}
+
+		paymentDoc, err := tx.Get(client.Collection("payments").Doc(paymentID))
+		if status.Code(err) == codes.NotFound {
+			return apperrors.NotFound("Payment not found")
+		}
+		if err != nil {
+			return err
+		}
+		payment := paymentFromDoc(paymentDoc)
+
+		if err := checkPaymentOpen(payment); err != nil {
+			return err
+		}
+		switch {
+		case payment.Currency != line.Currency:
+			return apperrors.BadRequest("Transfer and payment currencies differ").With("currency", payment.Currency)
+		case line.Amount > payment.Balance:
+			return apperrors.BadRequest("Amount exceeds the outstanding balance").With("balance", payment.Balance)
+		}
+
+		reference := line.Reference
+		if reference == "" {
+			reference = line.BankRef
+		}
+		note := req.Note
+		if note == "" {
+			note = "Bank statement " + line.StatementID
+		}
+		txRef := client.Collection("payments").Doc(payment.ID).Collection("transactions").Doc("bank_" + line.ID)
+		transaction := models.PaymentTransaction{
+			ID:          txRef.ID,
+			PaymentID:   payment.ID,
+			Amount:      line.Amount,
+			Method:      "transfer",
+			Reference:   reference,
+			Note:        note,
+			ProcessedBy: uid,
+			ReceivedAt:  line.Date,
+			MinorUnits:  true,
+			CreatedAt:   now,
+		}
+		if err := applyTransaction(tx, client, payment, txRef, &transaction, now); err != nil {
+			return err
+		}
+
+		line.Status = "confirmed"
+		line.PaymentID = payment.ID
+		line.TransactionID = transaction.ID
+		line.ResolvedBy = uid
+		line.ResolvedAt = &now
+		if req.Note != "" {
+			line.Note = req.Note
+		}
+		if err := tx.Update(client.Collection("bank_statements").Doc(line.StatementID), []firestore.Update{
+			{Path: "confirmed", Value: firestore.Increment(1)},
+		}); err != nil {
+			return err
+		}
+		return tx.Update(ref, []firestore.Update{
+			{Path: "status", Value: line.Status},
+			{Path: "paymentId", Value: line.PaymentID},
+			{Path: "transactionId", Value: line.TransactionID},
+			{Path: "resolvedBy", Value: line.ResolvedBy},
+			{Path: "resolvedAt", Value: line.ResolvedAt},
+			{Path: "note", Value: line.Note},
+		})
+	})
+	if err != nil {
+		return line, err
+	}
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "statement_line.confirm",
+		TargetType: "payment",
+		TargetID:   line.PaymentID,
+		Details: map[string]interface{}{
+			"lineId":        line.ID,
+			"statementId":   line.StatementID,
+			"transactionId": line.TransactionID,
+			"amount":        line.Amount,
+			"suggested":     len(line.Candidates) > 0 && line.Candidates[0].PaymentID == line.PaymentID,
+		},
+	})
+	return line, nil
+}
+
+func queryStatementLines(ctx context.Context, query firestore.Query) ([]models.StatementLine, error) {
+	iter := query.Documents(ctx)
+	lines := []models.StatementLine{}
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var line models.StatementLine
+		doc.DataTo(&line)
+		line.ID = doc.Ref.ID
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// loadOpenPayments returns the payments transfers can be applied to and
+// the students they belong to.
+func loadOpenPayments(ctx context.Context, client *firestore.Client) ([]models.Payment, map[string]models.User, error) {
+	iter := client.Collection("payments").Where("status", "in", openPaymentStatuses).Documents(ctx)
+	var payments []models.Payment
+	var studentRefs []*firestore.DocumentRef
+	seen := make(map[string]bool)
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		payment := paymentFromDoc(doc)
+		payments = append(payments, payment)
+		if payment.StudentID != "" && !seen[payment.StudentID] {
+			seen[payment.StudentID] = true
+			studentRefs = append(studentRefs, client.Collection("users").Doc(payment.StudentID))
+		}
+	}
+
+	students := make(map[string]models.User)
+	if len(studentRefs) == 0 {
+		return payments, students, nil
+	}
+	docs, err := client.GetAll(ctx, studentRefs)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, doc := range docs {
+		if !doc.Exists() {
+			continue
+		}
+		var student models.User
+		doc.DataTo(&student)
+		students[doc.Ref.ID] = student
+	}
+	return payments, students, nil
+}
+
+// matchStatementLine scores the open payments of the line's currency. A
+// payment is only a candidate when the transfer names it, by reference or
+// by student; the amount alone matches too many payments to mean anything.
+func matchStatementLine(line models.StatementLine, payments []models.Payment, students map[string]models.User) []models.MatchCandidate {
+	text := matchText(line.Reference + " " + line.Description + " " + line.Name)
+
+	var candidates []models.MatchCandidate
+	for _, payment := range payments {
+		if payment.Currency != line.Currency || line.Amount > payment.Balance {
+			continue
+		}
+
+		candidate := models.MatchCandidate{
+			PaymentID: payment.ID,
+			StudentID: payment.StudentID,
+			Balance:   payment.Balance,
+		}
+		if containsToken(text, payment.ID, 6) || containsToken(text, payment.Reference, 4) {
+			candidate.Score += scoreReference
+			candidate.Reasons = append(candidate.Reasons, "reference")
+		}
+		if student, ok := students[payment.StudentID]; ok {
+			switch {
+			case containsToken(text, student.StudentID, 3):
+				candidate.Score += scoreStudentID
+				candidate.Reasons = append(candidate.Reasons, "student")
+			case containsToken(text, student.DisplayName, 4):
+				candidate.Score += scoreStudentName
+				candidate.Reasons = append(candidate.Reasons, "student")
+			}
+		}
+		if candidate.Score == 0 {
+			continue
+		}
+
+		switch {
+		case line.Amount == payment.Balance:
+			candidate.Score += scoreAmount
+			candidate.Reasons = append(candidate.Reasons, "amount")
+		case line.Amount == nextInstallmentDue(payment):
+			candidate.Score += scoreInstallment
+			candidate.Reasons = append(candidate.Reasons, "installment")
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		return candidates[i].PaymentID < candidates[j].PaymentID
+	})
+	if len(candidates) > maxCandidates {
+		candidates = candidates[:maxCandidates]
+	}
+	return candidates
+}
+
+func matchStatus(candidates []models.MatchCandidate) string {
+	switch {
+	case len(candidates) == 0:
+		return "unmatched"
+	case candidates[0].Score >= matchThreshold && (len(candidates) == 1 || candidates[0].Score-candidates[1].Score >= matchMargin):
+		return "matched"
+	default:
+		return "review"
+	}
+}
+
+// nextInstallmentDue is what is left of the first unpaid installment, or 0
+// without an installment plan.
+func nextInstallmentDue(payment models.Payment) int64 {
+	for _, installment := range payment.Installments {
+		if installment.PaidAmount < installment.Amount {
+			return installment.Amount - installment.PaidAmount
+		}
+	}
+	return 0
+}
+
+// matchText upper-cases s and reduces it to letters and digits separated
+// by single spaces, so references survive the formatting banks apply.
+func matchText(s string) string {
+	return " " + strings.Join(strings.FieldsFunc(strings.ToUpper(s), func(r rune) bool {
+		return !(r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}), " ") + " "
+}
+
+// containsToken reports whether needle occurs in text as whole words.
+// Needles shorter than minLength are too likely to match by accident.
+func containsToken(text, needle string, minLength int) bool {
+	needle = matchText(needle)
+	if len(strings.TrimSpace(needle)) < minLength {
+		return false
+	}
+	return strings.Contains(text, needle)
+}
+
+// statementLineFingerprint identifies a transfer independently of the file
+// it was imported from.
+func statementLineFingerprint(account string, line models.StatementLine) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		account,
+		line.Date.Format("2006-01-02"),
+		strconv.FormatInt(line.Amount, 10),
+		line.Currency,
+		line.Reference,
+		line.Description,
+		line.Name,
+		line.BankRef,
+	}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+func statementLineID(fingerprint string, occurrence int) string {
+	return fingerprint[:32] + "-" + strconv.Itoa(occurrence)
+}
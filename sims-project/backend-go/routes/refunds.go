@@ -0,0 +1,418 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sims-backend-go/apperrors"
+	"sims-backend-go/config"
+	"sims-backend-go/models"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+)
+
+// GetPaymentRefunds lists the refunds requested for a payment.
+func GetPaymentRefunds(c *gin.Context) {
+	listRefunds(c, c.Param("id"))
+}
+
+// GetRefunds lists refunds across payments, newest first. Filter with
+// ?status=pending for the approval queue.
+func GetRefunds(c *gin.Context) {
+	listRefunds(c, "")
+}
+
+func listRefunds(c *gin.Context, paymentID string) {
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	query := client.Collection("payment_refunds").Query
+	if paymentID != "" {
+		query = query.Where("paymentId", "==", paymentID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status", "==", status)
+	}
+	if studentID := c.Query("studentId"); studentID != "" {
+		query = query.Where("studentId", "==", studentID)
+	}
+
+	iter := query.OrderBy("createdAt", firestore.Desc).Limit(500).Documents(ctx)
+	refunds := []models.PaymentRefund{}
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			c.Error(apperrors.Internal(err, "Failed to fetch refunds"))
+			return
+		}
+
+		var refund models.PaymentRefund
+		doc.DataTo(&refund)
+		refund.ID = doc.Ref.ID
+		refunds = append(refunds, refund)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"refunds": refunds})
+}
+
+// RequestPaymentRefund asks for money received for a payment to be paid
+// back. Nothing changes on the payment until the refund is approved.
+func RequestPaymentRefund(c *gin.Context) {
+	paymentID := c.Param("id")
+
+	var req models.PaymentRefundCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	ref := client.Collection("payments").Doc(paymentID)
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Payment not found", "Failed to fetch payment"))
+		return
+	}
+	payment := paymentFromDoc(doc)
+
+	refund := models.PaymentRefund{
+		PaymentID:     payment.ID,
+		StudentID:     payment.StudentID,
+		Amount:        req.Amount,
+		Currency:      payment.Currency,
+		Method:        req.Method,
+		Account:       req.Account,
+		Reason:        req.Reason,
+		TransactionID: req.TransactionID,
+		CancelPayment: req.CancelPayment,
+		Status:        "pending",
+		RequestedBy:   token.UID,
+		RequestedRole: config.TokenRole(token),
+		CreatedAt:     time.Now(),
+	}
+	if refund.CancelPayment && refund.Amount == 0 {
+		refund.Amount = payment.PaidAmount
+	}
+	if err := checkRefundable(payment, refund); err != nil {
+		c.Error(err)
+		return
+	}
+
+	if refund.TransactionID != "" {
+		txDoc, err := ref.Collection("transactions").Doc(refund.TransactionID).Get(ctx)
+		if err != nil {
+			c.Error(apperrors.FromFirestore(err, "Transaction not found", "Failed to fetch transaction"))
+			return
+		}
+		if err := checkRefundedTransaction(txDoc, refund.Amount); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	docRef, _, err := client.Collection("payment_refunds").Add(ctx, refund)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to request refund"))
+		return
+	}
+	refund.ID = docRef.ID
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "payment.refund_request",
+		TargetType: "payment",
+		TargetID:   payment.ID,
+		Details: map[string]interface{}{
+			"refundId":      refund.ID,
+			"amount":        refund.Amount,
+			"method":        refund.Method,
+			"cancelPayment": refund.CancelPayment,
+			"reason":        refund.Reason,
+		},
+	})
+
+	setLocation(c, refund.ID)
+	c.JSON(http.StatusCreated, gin.H{"refund": refund})
+}
+
+// ApproveRefund records a pending refund: a refund entry with a negative
+// amount is added to the payment's transactions and its paid amount and
+// status follow. The approver must be another user with a different role
+// than the requester.
+func ApproveRefund(c *gin.Context) {
+	refundID := c.Param("id")
+
+	var req models.PaymentRefundReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+	role := config.TokenRole(token)
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	ref := client.Collection("payment_refunds").Doc(refundID)
+	now := time.Now()
+	var refund models.PaymentRefund
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		refund = models.PaymentRefund{}
+		doc.DataTo(&refund)
+		refund.ID = doc.Ref.ID
+
+		switch {
+		case refund.Status != "pending":
+			return apperrors.Conflict("Refund is already " + refund.Status)
+		case refund.RequestedBy == token.UID:
+			return apperrors.Forbidden("Refunds must be approved by someone other than the requester")
+		case refund.RequestedRole == role:
+			return apperrors.Forbidden("Refunds must be approved by a different role than the requester's").With("requestedRole", refund.RequestedRole)
+		}
+
+		paymentRef := client.Collection("payments").Doc(refund.PaymentID)
+		paymentDoc, err := tx.Get(paymentRef)
+		if err != nil {
+			return err
+		}
+		payment := paymentFromDoc(paymentDoc)
+		if err := checkRefundable(payment, refund); err != nil {
+			return err
+		}
+		if refund.TransactionID != "" {
+			txDoc, err := tx.Get(paymentRef.Collection("transactions").Doc(refund.TransactionID))
+			if err != nil {
+				return err
+			}
+			if err := checkRefundedTransaction(txDoc, refund.Amount); err != nil {
+				return err
+			}
+		}
+
+		payment.PaidAmount -= refund.Amount
+		status := "refunded"
+		if !refund.CancelPayment {
+			status = payment.SettledStatus()
+			if payment.Status == "overdue" && status != "paid" {
+				status = "overdue"
+			}
+		}
+		// Short of closing the payment, its status follows what is left paid
+		if status == "refunded" && !models.CanTransitionPayment(payment.Status, status) {
+			return apperrors.Conflict("Payment cannot change from " + payment.Status + " to " + status)
+		}
+
+		reversalRef := paymentRef.Collection("transactions").Doc("refund_" + refund.ID)
+		reversal := models.PaymentTransaction{
+			ID:          reversalRef.ID,
+			PaymentID:   payment.ID,
+			StudentID:   payment.StudentID,
+			Kind:        "refund",
+			Amount:      -refund.Amount,
+			Reverses:    refund.TransactionID,
+			RefundID:    refund.ID,
+			Currency:    payment.Currency,
+			Method:      refund.Method,
+			Reference:   refund.Account,
+			Note:        refund.Reason,
+			ProcessedBy: token.UID,
+			ReceivedAt:  now,
+			MinorUnits:  true,
+			CreatedAt:   now,
+		}
+		if err := tx.Create(reversalRef, reversal); err != nil {
+			return err
+		}
+
+		updates := []firestore.Update{
+			{Path: "paidAmount", Value: payment.PaidAmount},
+			{Path: "refundedAmount", Value: payment.RefundedAmount + refund.Amount},
+			{Path: "status", Value: status},
+			{Path: "updatedAt", Value: now},
+		}
+		if status != "paid" {
+			updates = append(updates, firestore.Update{Path: "paidDate", Value: nil})
+		}
+		if len(payment.Installments) > 0 {
+			updates = append(updates, firestore.Update{Path: "installments", Value: allocateInstallments(payment.Installments, payment.PaidAmount)})
+		}
+		if err := tx.Update(paymentRef, updates); err != nil {
+			return err
+		}
+
+		refund.Status = "approved"
+		refund.ReviewedBy = token.UID
+		refund.ReviewedRole = role
+		refund.ReviewNote = req.Note
+		refund.ReviewedAt = &now
+		refund.ReversalID = reversal.ID
+		return tx.Set(ref, refund)
+	})
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Refund not found", "Failed to approve refund"))
+		return
+	}
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "payment.refund_approve",
+		TargetType: "payment",
+		TargetID:   refund.PaymentID,
+		Details: map[string]interface{}{
+			"refundId":      refund.ID,
+			"amount":        refund.Amount,
+			"method":        refund.Method,
+			"cancelPayment": refund.CancelPayment,
+			"requestedBy":   refund.RequestedBy,
+		},
+	})
+
+	doc, err := client.Collection("payments").Doc(refund.PaymentID).Get(ctx)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to fetch payment"))
+		return
+	}
+
+	setETag(c, doc)
+	c.JSON(http.StatusOK, gin.H{"refund": refund, "payment": paymentFromDoc(doc)})
+}
+
+// RejectRefund closes a pending refund without touching the payment.
+func RejectRefund(c *gin.Context) {
+	refundID := c.Param("id")
+
+	var req models.PaymentRefundReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	ref := client.Collection("payment_refunds").Doc(refundID)
+	now := time.Now()
+	var refund models.PaymentRefund
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		refund = models.PaymentRefund{}
+		doc.DataTo(&refund)
+		refund.ID = doc.Ref.ID
+		if refund.Status != "pending" {
+			return apperrors.Conflict("Refund is already " + refund.Status)
+		}
+
+		refund.Status = "rejected"
+		refund.ReviewedBy = token.UID
+		refund.ReviewedRole = config.TokenRole(token)
+		refund.ReviewNote = req.Note
+		refund.ReviewedAt = &now
+		return tx.Set(ref, refund)
+	})
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Refund not found", "Failed to reject refund"))
+		return
+	}
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "payment.refund_reject",
+		TargetType: "payment",
+		TargetID:   refund.PaymentID,
+		Details: map[string]interface{}{
+			"refundId": refund.ID,
+			"note":     refund.ReviewNote,
+		},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"refund": refund})
+}
+
+// checkRefundable rejects refunds of closed payments and of more than was
+// paid. Cancelling refunds everything paid, which must not have changed
+// since the refund was requested.
+func checkRefundable(payment models.Payment, refund models.PaymentRefund) error {
+	switch {
+	case payment.Status == "cancelled" || payment.Status == "refunded":
+		return checkPaymentOpen(payment)
+	case payment.PaidAmount <= 0:
+		return apperrors.Conflict("Nothing has been paid for this payment")
+	case refund.Amount > payment.PaidAmount:
+		return apperrors.BadRequest("Amount exceeds the amount paid").With("paidAmount", payment.PaidAmount)
+	case refund.CancelPayment && refund.Amount != payment.PaidAmount:
+		return apperrors.Conflict("Cancelling refunds everything paid").With("paidAmount", payment.PaidAmount)
+	}
+	return nil
+}
+
+// checkRefundedTransaction rejects refunds referring to a refund entry or
+// paying back more than the receipt they refer to.
+func checkRefundedTransaction(doc *firestore.DocumentSnapshot, amount int64) error {
+	var transaction models.PaymentTransaction
+	doc.DataTo(&transaction)
+	switch {
+	case transaction.Kind == "refund":
+		return apperrors.BadRequest("Refund entries cannot be refunded")
+	case amount > transaction.Amount:
+		return apperrors.BadRequest("Amount exceeds the referenced transaction").With("transactionAmount", transaction.Amount)
+	}
+	return nil
+}
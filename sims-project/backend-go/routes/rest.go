@@ -0,0 +1,109 @@
+package routes
+
+import (
+	"encoding/json"
+	"path"
+	"reflect"
+	"sims-backend-go/apperrors"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+const mergePatchContentType = "application/merge-patch+json"
+
+// setLocation points the Location header of a create response at the new
+// resource, e.g. /api/grades/{id}.
+func setLocation(c *gin.Context, id string) {
+	c.Header("Location", path.Join(c.Request.URL.Path, id))
+}
+
+// jsonNames returns the JSON field names of a struct, optionally only those
+// marked binding:"required".
+func jsonNames(v interface{}, requiredOnly bool) map[string]bool {
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	names := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		if requiredOnly && !strings.Contains(field.Tag.Get("binding"), "required") {
+			continue
+		}
+		names[name] = true
+	}
+	return names
+}
+
+// bindMergePatch decodes a JSON Merge Patch (RFC 7396) body into req, an
+// update request with pointer fields, and returns the fields the patch
+// removes by setting them to null. Fields required by the create request
+// cannot be removed.
+func bindMergePatch(c *gin.Context, req interface{}, create interface{}) ([]string, error) {
+	switch c.ContentType() {
+	case mergePatchContentType, binding.MIMEJSON:
+	default:
+		return nil, apperrors.UnsupportedMediaType("PATCH requires Content-Type " + mergePatchContentType)
+	}
+
+	var body interface{}
+	if err := json.NewDecoder(c.Request.Body).Decode(&body); err != nil {
+		return nil, apperrors.Validation(err)
+	}
+	patch, ok := body.(map[string]interface{})
+	if !ok {
+		return nil, apperrors.BadRequest("Merge patch must be a JSON object")
+	}
+
+	updatable := jsonNames(req, false)
+	required := jsonNames(create, true)
+
+	var cleared []string
+	var invalid []apperrors.FieldError
+	for name, value := range patch {
+		switch {
+		case !updatable[name]:
+			invalid = append(invalid, apperrors.FieldError{Field: name, Rule: "unknown", Message: "cannot be updated"})
+		case value == nil && required[name]:
+			invalid = append(invalid, apperrors.FieldError{Field: name, Rule: "required", Message: "cannot be removed"})
+		case value == nil:
+			cleared = append(cleared, name)
+			delete(patch, name)
+		}
+	}
+	if len(invalid) > 0 {
+		sort.Slice(invalid, func(i, j int) bool { return invalid[i].Field < invalid[j].Field })
+		return nil, apperrors.ValidationFailed(invalid...)
+	}
+
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return nil, apperrors.BadRequest("Invalid merge patch")
+	}
+	if err := json.Unmarshal(data, req); err != nil {
+		return nil, apperrors.Validation(err)
+	}
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		return nil, apperrors.Validation(err)
+	}
+
+	sort.Strings(cleared)
+	return cleared, nil
+}
+
+// withCleared removes the cleared fields from the stored document.
+func withCleared(updateData map[string]interface{}, cleared []string) map[string]interface{} {
+	for _, name := range cleared {
+		updateData[name] = firestore.Delete
+	}
+	return updateData
+}
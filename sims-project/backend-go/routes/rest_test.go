@@ -0,0 +1,115 @@
+package routes
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"sims-backend-go/apperrors"
+	"sims-backend-go/models"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+)
+
+func TestBindMergePatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		cleared     []string
+		code        string
+		fields      []string
+	}{
+		{"merge patch", mergePatchContentType, `{"room": "B-2"}`, nil, "", nil},
+		{"plain JSON", "application/json; charset=utf-8", `{"room": "B-2"}`, nil, "", nil},
+		{"null clears optional fields", mergePatchContentType, `{"room": null, "schedule": null, "name": "7B"}`, []string{"room", "schedule"}, "", nil},
+		{"null on a required field", mergePatchContentType, `{"name": null}`, nil, apperrors.CodeValidation, []string{"name"}},
+		{"unknown fields", mergePatchContentType, `{"id": "x", "createdAt": null}`, nil, apperrors.CodeValidation, []string{"createdAt", "id"}},
+		{"wrong type", mergePatchContentType, `{"isActive": "yes"}`, nil, apperrors.CodeValidation, []string{"isActive"}},
+		{"not an object", mergePatchContentType, `["room"]`, nil, apperrors.CodeBadRequest, nil},
+		{"malformed", mergePatchContentType, `{"room":`, nil, apperrors.CodeBadRequest, nil},
+		{"form body", "application/x-www-form-urlencoded", `room=B-2`, nil, apperrors.CodeMediaType, nil},
+	}
+	for _, tt := range tests {
+		c, _ := testContext("PATCH", "/api/classes/c1", "admin-1", "admin")
+		c.Request.Body = io.NopCloser(strings.NewReader(tt.body))
+		c.Request.Header.Set("Content-Type", tt.contentType)
+
+		var req models.ClassUpdateRequest
+		cleared, err := bindMergePatch(c, &req, models.ClassCreateRequest{})
+		if code := errorCode(err); code != tt.code {
+			t.Errorf("%s: error = %v, want code %q", tt.name, err, tt.code)
+			continue
+		}
+		if !reflect.DeepEqual(cleared, tt.cleared) {
+			t.Errorf("%s: cleared = %v, want %v", tt.name, cleared, tt.cleared)
+		}
+		if tt.fields != nil {
+			var appErr *apperrors.Error
+			errors.As(err, &appErr)
+			var fields []string
+			for _, field := range appErr.Fields {
+				fields = append(fields, field.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("%s: invalid fields = %v, want %v", tt.name, fields, tt.fields)
+			}
+		}
+	}
+}
+
+func TestBindMergePatchValues(t *testing.T) {
+	c, _ := testContext("PATCH", "/api/payments/p1", "admin-1", "admin")
+	c.Request.Body = io.NopCloser(strings.NewReader(`{"amount": 2500000, "reference": null}`))
+	c.Request.Header.Set("Content-Type", mergePatchContentType)
+
+	var req models.PaymentUpdateRequest
+	cleared, err := bindMergePatch(c, &req, models.PaymentCreateRequest{})
+	if err != nil {
+		t.Fatalf("bindMergePatch: %v", err)
+	}
+	if req.Amount == nil || *req.Amount != 2500000 || req.Description != nil || req.Reference != nil {
+		t.Errorf("req = %+v", req)
+	}
+	if !reflect.DeepEqual(cleared, []string{"reference"}) {
+		t.Errorf("cleared = %v", cleared)
+	}
+
+	// Binding rules of the update request still apply
+	for _, body := range []string{`{"amount": 0}`, `{"status": "paid"}`} {
+		c, _ := testContext("PATCH", "/api/payments/p1", "admin-1", "admin")
+		c.Request.Body = io.NopCloser(strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", mergePatchContentType)
+		var req models.PaymentUpdateRequest
+		if _, err := bindMergePatch(c, &req, models.PaymentCreateRequest{}); errorCode(err) != apperrors.CodeValidation {
+			t.Errorf("%s: err = %v, want %s", body, err, apperrors.CodeValidation)
+		}
+	}
+}
+
+func TestWithCleared(t *testing.T) {
+	data := withCleared(map[string]interface{}{"name": "7B"}, []string{"room", "schedule"})
+	want := map[string]interface{}{"name": "7B", "room": firestore.Delete, "schedule": firestore.Delete}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("withCleared = %v, want %v", data, want)
+	}
+}
+
+func TestSetLocation(t *testing.T) {
+	c, w := testContext("POST", "/api/grades", "teacher-1", "teacher")
+	setLocation(c, "g1")
+	if got := w.Header().Get("Location"); got != "/api/grades/g1" {
+		t.Errorf("Location = %q", got)
+	}
+}
+
+func TestUpdateDocumentMissing(t *testing.T) {
+	client := emulatorClient(t)
+	c, _ := testContext("PATCH", "/api/classes/missing", "admin-1", "admin")
+
+	_, err := updateDocument(c, client.Collection("classes").Doc("missing-class"), map[string]interface{}{"room": "B-2"})
+	if code := apperrors.FromFirestore(err, "Class not found", "Failed to update class").Code; code != apperrors.CodeNotFound {
+		t.Errorf("err = %v, want %s", err, apperrors.CodeNotFound)
+	}
+}
@@ -0,0 +1,55 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"sims-backend-go/apperrors"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// errorCode returns the apperrors code of err, or "" when err is nil or not
+// an *apperrors.Error.
+func errorCode(err error) string {
+	var appErr *apperrors.Error
+	if errors.As(err, &appErr) {
+		return appErr.Code
+	}
+	return ""
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// testContext returns a gin context for a request by a user with uid and
+// role, as AuthMiddleware would leave it.
+func testContext(method, target, uid, role string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, target, nil)
+	c.Set("user", &auth.Token{UID: uid, Claims: map[string]interface{}{"role": role}})
+	return c, w
+}
+
+// emulatorClient connects to the Firestore emulator, skipping the test when
+// FIRESTORE_EMULATOR_HOST is not set (gcloud emulators firestore start).
+func emulatorClient(t *testing.T) *firestore.Client {
+	t.Helper()
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST not set")
+	}
+	client, err := firestore.NewClient(context.Background(), "sims-test")
+	if err != nil {
+		t.Fatalf("connecting to the Firestore emulator: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
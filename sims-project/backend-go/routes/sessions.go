@@ -0,0 +1,93 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+	"sims-backend-go/apperrors"
+	"sims-backend-go/config"
+	"sims-backend-go/models"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+)
+
+// RevokeSessions force-logs out a single user or every user with a role.
+func RevokeSessions(c *gin.Context) {
+	var req models.RevokeSessionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	if (req.UserID == "") == (req.Role == "") {
+		c.Error(apperrors.BadRequest("Specify either userId or role"))
+		return
+	}
+	if req.Role != "" && !models.IsValidRole(req.Role) {
+		c.Error(apperrors.BadRequest("Invalid role"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	if req.UserID != "" {
+		if err := config.RevokeSessions(ctx, req.UserID); err != nil {
+			c.Error(apperrors.Internal(err, "Failed to revoke sessions"))
+			return
+		}
+
+		recordAudit(ctx, client, c, models.AuditLog{
+			Action:     "session.revoke",
+			TargetType: "user",
+			TargetID:   req.UserID,
+		})
+
+		c.JSON(http.StatusOK, gin.H{"message": "Sessions revoked", "revoked": 1})
+		return
+	}
+
+	iter := client.Collection("users").Where("role", "==", req.Role).Documents(ctx)
+	revoked := 0
+	var failed []string
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			c.Error(apperrors.Internal(err, "Failed to fetch users"))
+			return
+		}
+
+		if err := config.RevokeSessions(ctx, doc.Ref.ID); err != nil {
+			log.Printf("Warning: failed to revoke sessions for %s: %v", doc.Ref.ID, err)
+			failed = append(failed, doc.Ref.ID)
+			continue
+		}
+		revoked++
+	}
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "session.revoke_role",
+		TargetType: "role",
+		TargetID:   req.Role,
+		Details: map[string]interface{}{
+			"revoked": revoked,
+			"failed":  failed,
+		},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Sessions revoked",
+		"revoked": revoked,
+		"failed":  failed,
+	})
+}
@@ -1,7 +1,9 @@
 package routes
 
 import (
+	"log"
 	"net/http"
+	"sims-backend-go/apperrors"
 	"sims-backend-go/config"
 	"sims-backend-go/models"
 	"time"
@@ -16,7 +18,7 @@ func GetUsers(c *gin.Context) {
 	ctx := c.Request.Context()
 	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
 		return
 	}
 	defer client.Close()
@@ -31,7 +33,7 @@ func GetUsers(c *gin.Context) {
 			break
 		}
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+			c.Error(apperrors.Internal(err, "Failed to fetch users"))
 			return
 		}
 
@@ -47,14 +49,23 @@ func GetUsers(c *gin.Context) {
 func CreateUser(c *gin.Context) {
 	var req models.UserCreateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	if !models.IsValidRole(req.Role) {
+		c.Error(apperrors.BadRequest("Invalid role"))
+		return
+	}
+	if err := checkRoleGrant(c, "", req.Role); err != nil {
+		c.Error(err)
 		return
 	}
 
 	ctx := c.Request.Context()
 	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
 		return
 	}
 	defer client.Close()
@@ -67,37 +78,64 @@ func CreateUser(c *gin.Context) {
 
 	userRecord, err := config.AuthClient.CreateUser(ctx, params)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create Firebase user"})
+		c.Error(apperrors.Internal(err, "Failed to create Firebase user"))
 		return
 	}
 
 	// Create user document in Firestore
 	user := models.User{
-		ID:                userRecord.UID,
-		Email:             req.Email,
-		DisplayName:       req.DisplayName,
-		Role:              req.Role,
-		Phone:             req.Phone,
-		Address:           req.Address,
-		EmergencyContact:  req.EmergencyContact,
-		DateOfBirth:       req.DateOfBirth,
-		Gender:            req.Gender,
-		StudentID:         req.StudentID,
-		ClassID:           req.ClassID,
-		ParentID:          req.ParentID,
-		IsActive:          true,
-		LastLogin:         nil,
-		CreatedAt:         time.Now(),
-		UpdatedAt:         time.Now(),
+		ID:               userRecord.UID,
+		Email:            req.Email,
+		DisplayName:      req.DisplayName,
+		Role:             req.Role,
+		Phone:            req.Phone,
+		Address:          req.Address,
+		EmergencyContact: req.EmergencyContact,
+		DateOfBirth:      req.DateOfBirth,
+		Gender:           req.Gender,
+		StudentID:        req.StudentID,
+		ClassID:          req.ClassID,
+		ParentID:         req.ParentID,
+		IsActive:         true,
+		LastLogin:        nil,
+		CreatedAt:        time.Now(),
+		UpdatedAt:        time.Now(),
 	}
 
 	_, err = client.Collection("users").Doc(userRecord.UID).Set(ctx, user)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user profile"})
+		config.AuthClient.DeleteUser(ctx, userRecord.UID)
+		c.Error(apperrors.Internal(err, "Failed to create user profile"))
+		return
+	}
+
+	// RequirePermission reads the role from the ID token claims; without
+	// the claim the account would act as a student
+	if _, _, err := config.SetUserRole(ctx, userRecord.UID, req.Role); err != nil {
+		client.Collection("users").Doc(userRecord.UID).Delete(ctx)
+		config.AuthClient.DeleteUser(ctx, userRecord.UID)
+		c.Error(apperrors.Internal(err, "Failed to assign user role"))
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"user": user})
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "user.create",
+		TargetType: "user",
+		TargetID:   userRecord.UID,
+		Details: map[string]interface{}{
+			"role": req.Role,
+		},
+	})
+
+	// The account has no password yet; mail a link to set one
+	setupEmailSent := true
+	if err := sendAccountSetupEmail(ctx, client, userRecord.UID, req.Email, req.DisplayName); err != nil {
+		log.Printf("Warning: failed to send account setup email to %s: %v", userRecord.UID, err)
+		setupEmailSent = false
+	}
+
+	setLocation(c, user.ID)
+	c.JSON(http.StatusCreated, gin.H{"user": user, "setupEmailSent": setupEmailSent})
 }
 
 func GetUser(c *gin.Context) {
@@ -106,14 +144,14 @@ func GetUser(c *gin.Context) {
 	ctx := c.Request.Context()
 	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
 		return
 	}
 	defer client.Close()
 
 	doc, err := client.Collection("users").Doc(userID).Get(ctx)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		c.Error(apperrors.FromFirestore(err, "User not found", "Failed to fetch user"))
 		return
 	}
 
@@ -121,26 +159,33 @@ func GetUser(c *gin.Context) {
 	doc.DataTo(&user)
 	user.ID = doc.Ref.ID
 
+	setETag(c, doc)
 	c.JSON(http.StatusOK, gin.H{"user": user})
 }
 
 func UpdateUser(c *gin.Context) {
-	userID := c.Param("id")
-
 	var req models.UserUpdateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apperrors.Validation(err))
 		return
 	}
 
-	ctx := c.Request.Context()
-	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	applyUserUpdate(c, userUpdateData(req))
+}
+
+// PatchUser applies a JSON Merge Patch; null removes an optional field.
+func PatchUser(c *gin.Context) {
+	var req models.UserUpdateRequest
+	cleared, err := bindMergePatch(c, &req, models.UserCreateRequest{})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(err)
 		return
 	}
-	defer client.Close()
 
+	applyUserUpdate(c, withCleared(userUpdateData(req), cleared))
+}
+
+func userUpdateData(req models.UserUpdateRequest) map[string]interface{} {
 	// Prepare update data
 	updateData := map[string]interface{}{
 		"updatedAt": time.Now(),
@@ -183,13 +228,92 @@ func UpdateUser(c *gin.Context) {
 		updateData["isActive"] = *req.IsActive
 	}
 
-	_, err = client.Collection("users").Doc(userID).Update(ctx, updateData)
+	return updateData
+}
+
+func applyUserUpdate(c *gin.Context, updateData map[string]interface{}) {
+	userID := c.Param("id")
+
+	role, roleSet := updateData["role"].(string)
+	if roleSet && !models.IsValidRole(role) {
+		c.Error(apperrors.BadRequest("Invalid role"))
+		return
+	}
+	if roleSet {
+		if err := checkRoleGrant(c, userID, role); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	doc, err := updateDocument(c, client.Collection("users").Doc(userID), updateData)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		c.Error(apperrors.FromFirestore(err, "User not found", "Failed to update user"))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
+	// The claim is compared rather than the stored role so a retry
+	// applies a role that was saved but not yet in the claims
+	if roleSet {
+		previous, changed, err := config.SetUserRole(ctx, userID, role)
+		if err != nil {
+			c.Error(apperrors.Unavailable(err, "Role saved but not yet applied; retry the update"))
+			return
+		}
+		if changed {
+			recordAudit(ctx, client, c, models.AuditLog{
+				Action:     "user.role_change",
+				TargetType: "user",
+				TargetID:   userID,
+				Details: map[string]interface{}{
+					"from": previous,
+					"to":   role,
+				},
+			})
+		}
+	}
+
+	var user models.User
+	doc.DataTo(&user)
+	user.ID = doc.Ref.ID
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+// checkRoleGrant stops callers from raising privileges through user
+// accounts: nobody may change their own role, and a role can only be given
+// by someone holding all of its permissions. userID is empty for new users.
+func checkRoleGrant(c *gin.Context, userID, role string) error {
+	user, exists := c.Get("user")
+	if !exists {
+		return apperrors.Unauthorized("User not authenticated")
+	}
+	token := user.(*auth.Token)
+
+	if userID == token.UID && role != config.TokenRole(token) {
+		return apperrors.Forbidden("You cannot change your own role")
+	}
+
+	permissions, err := config.PrincipalPermissions(c, token)
+	if err != nil {
+		return apperrors.Unavailable(err, "Unable to verify permissions")
+	}
+	granted, err := config.CanGrantRole(c.Request.Context(), permissions, role)
+	if err != nil {
+		return apperrors.Unavailable(err, "Unable to verify permissions")
+	}
+	if !granted {
+		return apperrors.Forbidden("You cannot grant a role with permissions you do not hold").With("role", role)
+	}
+	return nil
 }
 
 func DeleteUser(c *gin.Context) {
@@ -198,7 +322,7 @@ func DeleteUser(c *gin.Context) {
 	ctx := c.Request.Context()
 	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
 		return
 	}
 	defer client.Close()
@@ -206,7 +330,7 @@ func DeleteUser(c *gin.Context) {
 	// Delete from Firestore
 	_, err = client.Collection("users").Doc(userID).Delete(ctx)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		c.Error(apperrors.Internal(err, "Failed to delete user"))
 		return
 	}
 
@@ -0,0 +1,54 @@
+package routes
+
+import (
+	"net/http"
+	"sims-backend-go/apperrors"
+	"testing"
+)
+
+func TestCheckRoleGrantPermissions(t *testing.T) {
+	tests := []struct {
+		name   string
+		caller string
+		role   string
+		code   string
+	}{
+		{"admin grants admin", "admin", "admin", ""},
+		{"admin grants treasurer", "admin", "treasurer", ""},
+		{"vice principal grants admin", "vice_principal", "admin", apperrors.CodeForbidden},
+		{"vice principal grants treasurer", "vice_principal", "treasurer", apperrors.CodeForbidden},
+		{"vice principal grants vice principal", "vice_principal", "vice_principal", ""},
+		{"vice principal grants student", "vice_principal", "student", ""},
+		{"teacher grants teacher", "teacher", "teacher", ""},
+	}
+	for _, tt := range tests {
+		c, _ := testContext(http.MethodPost, "/api/users", "caller", tt.caller)
+		if got := errorCode(checkRoleGrant(c, "", tt.role)); got != tt.code {
+			t.Errorf("%s: error code %q, want %q", tt.name, got, tt.code)
+		}
+		c, _ = testContext(http.MethodPut, "/api/users/other", "caller", tt.caller)
+		if got := errorCode(checkRoleGrant(c, "other", tt.role)); got != tt.code {
+			t.Errorf("%s on update: error code %q, want %q", tt.name, got, tt.code)
+		}
+	}
+}
+
+func TestCheckRoleGrantOwnRole(t *testing.T) {
+	tests := []struct {
+		name   string
+		caller string
+		role   string
+		code   string
+	}{
+		{"vice principal promotes self", "vice_principal", "admin", apperrors.CodeForbidden},
+		{"vice principal demotes self", "vice_principal", "student", apperrors.CodeForbidden},
+		{"admin demotes self", "admin", "teacher", apperrors.CodeForbidden},
+		{"unchanged role", "vice_principal", "vice_principal", ""},
+	}
+	for _, tt := range tests {
+		c, _ := testContext(http.MethodPut, "/api/users/caller", "caller", tt.caller)
+		if got := errorCode(checkRoleGrant(c, "caller", tt.role)); got != tt.code {
+			t.Errorf("%s: error code %q, want %q", tt.name, got, tt.code)
+		}
+	}
+}
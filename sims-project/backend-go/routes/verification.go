@@ -0,0 +1,258 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"sims-backend-go/apperrors"
+	"sims-backend-go/config"
+	"sims-backend-go/models"
+	"sims-backend-go/services"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+)
+
+// actionCodeSettings points Firebase action links back to the frontend when
+// a continue URL is configured.
+func actionCodeSettings() *auth.ActionCodeSettings {
+	if config.AppConfig.Mail.ActionURL == "" {
+		return nil
+	}
+	return &auth.ActionCodeSettings{URL: config.AppConfig.Mail.ActionURL}
+}
+
+func passwordResetLink(ctx context.Context, email string) (string, error) {
+	if settings := actionCodeSettings(); settings != nil {
+		return config.AuthClient.PasswordResetLinkWithSettings(ctx, email, settings)
+	}
+	return config.AuthClient.PasswordResetLink(ctx, email)
+}
+
+func emailVerificationLink(ctx context.Context, email string) (string, error) {
+	if settings := actionCodeSettings(); settings != nil {
+		return config.AuthClient.EmailVerificationLinkWithSettings(ctx, email, settings)
+	}
+	return config.AuthClient.EmailVerificationLink(ctx, email)
+}
+
+// trackPendingVerification records that uid still has to verify email.
+func trackPendingVerification(ctx context.Context, client *firestore.Client, uid, email string, sent bool) error {
+	now := time.Now()
+	data := map[string]interface{}{
+		"userId":    uid,
+		"email":     email,
+		"status":    "pending",
+		"updatedAt": now,
+	}
+	if sent {
+		data["sendCount"] = firestore.Increment(1)
+		data["lastSentAt"] = now
+	}
+
+	_, err := client.Collection("email_verifications").Doc(uid).Set(ctx, data, firestore.MergeAll)
+	return err
+}
+
+func markVerified(ctx context.Context, client *firestore.Client, uid string) error {
+	now := time.Now()
+	_, err := client.Collection("email_verifications").Doc(uid).Set(ctx, map[string]interface{}{
+		"status":     "verified",
+		"verifiedAt": now,
+		"updatedAt":  now,
+	}, firestore.MergeAll)
+	return err
+}
+
+// sendVerificationEmail generates a verification link for the user, mails
+// it and tracks the verification as pending.
+func sendVerificationEmail(ctx context.Context, client *firestore.Client, uid, email string) error {
+	link, err := emailVerificationLink(ctx, email)
+	if err != nil {
+		return err
+	}
+	if err := services.Mail.Send(ctx, services.EmailVerificationMessage(email, link)); err != nil {
+		return err
+	}
+	return trackPendingVerification(ctx, client, uid, email, true)
+}
+
+// sendAccountSetupEmail mails a password setup link to a user created
+// without a password, so the account can actually be used.
+func sendAccountSetupEmail(ctx context.Context, client *firestore.Client, uid, email, displayName string) error {
+	link, err := passwordResetLink(ctx, email)
+	if err != nil {
+		return err
+	}
+	if err := services.Mail.Send(ctx, services.AccountSetupMessage(email, displayName, link)); err != nil {
+		return err
+	}
+	return trackPendingVerification(ctx, client, uid, email, false)
+}
+
+func RequestPasswordReset(c *gin.Context) {
+	var req models.PasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	// Same response whether or not the account exists
+	response := gin.H{"message": "If the account exists, a password reset email has been sent"}
+
+	ctx := c.Request.Context()
+	link, err := passwordResetLink(ctx, req.Email)
+	if auth.IsUserNotFound(err) {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to send password reset email"))
+		return
+	}
+
+	if err := services.Mail.Send(ctx, services.PasswordResetMessage(req.Email, link)); err != nil {
+		c.Error(apperrors.Internal(err, "Failed to send password reset email"))
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func SendVerification(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+
+	ctx := c.Request.Context()
+	record, err := config.AuthClient.GetUser(ctx, token.UID)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to load account"))
+		return
+	}
+
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	if record.EmailVerified {
+		markVerified(ctx, client, token.UID)
+		c.JSON(http.StatusOK, gin.H{"message": "Email already verified", "emailVerified": true})
+		return
+	}
+
+	if err := sendVerificationEmail(ctx, client, token.UID, record.Email); err != nil {
+		c.Error(apperrors.Internal(err, "Failed to send verification email"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent", "emailVerified": false})
+}
+
+// GetVerificationStatus reads the verification state from Firebase Auth and
+// updates the tracked record once the user has verified.
+func GetVerificationStatus(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+
+	ctx := c.Request.Context()
+	record, err := config.AuthClient.GetUser(ctx, token.UID)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to load account"))
+		return
+	}
+
+	if record.EmailVerified {
+		client, err := config.FirebaseApp.Firestore(ctx)
+		if err == nil {
+			markVerified(ctx, client, token.UID)
+			client.Close()
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"email": record.Email, "emailVerified": record.EmailVerified})
+}
+
+// GetPendingVerifications lists users that have not verified their email,
+// reconciling each entry with Firebase Auth first.
+func GetPendingVerifications(c *gin.Context) {
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	iter := client.Collection("email_verifications").Where("status", "==", "pending").Documents(ctx)
+	var pending []models.EmailVerification
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			c.Error(apperrors.Internal(err, "Failed to fetch verifications"))
+			return
+		}
+
+		var verification models.EmailVerification
+		doc.DataTo(&verification)
+		verification.ID = doc.Ref.ID
+
+		record, err := config.AuthClient.GetUser(ctx, verification.UserID)
+		if err == nil && record.EmailVerified {
+			markVerified(ctx, client, verification.UserID)
+			continue
+		}
+
+		pending = append(pending, verification)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"verifications": pending})
+}
+
+// SendAccountSetupLink re-sends the password setup email for a user, e.g.
+// when the first link expired.
+func SendAccountSetupLink(c *gin.Context) {
+	userID := c.Param("id")
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	doc, err := client.Collection("users").Doc(userID).Get(ctx)
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "User not found", "Failed to fetch user"))
+		return
+	}
+
+	var user models.User
+	doc.DataTo(&user)
+
+	if err := sendAccountSetupEmail(ctx, client, userID, user.Email, user.DisplayName); err != nil {
+		c.Error(apperrors.Internal(err, "Failed to send account setup email"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account setup email sent"})
+}
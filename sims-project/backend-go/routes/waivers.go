@@ -0,0 +1,372 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sims-backend-go/apperrors"
+	"sims-backend-go/config"
+	"sims-backend-go/models"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+)
+
+// GetPaymentWaivers lists the waivers requested for a payment.
+func GetPaymentWaivers(c *gin.Context) {
+	listWaivers(c, c.Param("id"))
+}
+
+// GetWaivers lists waivers across payments, newest first. Filter with
+// ?status=pending for the approval queue.
+func GetWaivers(c *gin.Context) {
+	listWaivers(c, "")
+}
+
+func listWaivers(c *gin.Context, paymentID string) {
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	query := client.Collection("payment_waivers").Query
+	if paymentID != "" {
+		query = query.Where("paymentId", "==", paymentID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status", "==", status)
+	}
+	if studentID := c.Query("studentId"); studentID != "" {
+		query = query.Where("studentId", "==", studentID)
+	}
+
+	iter := query.OrderBy("createdAt", firestore.Desc).Limit(500).Documents(ctx)
+	waivers := []models.PaymentWaiver{}
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			c.Error(apperrors.Internal(err, "Failed to fetch waivers"))
+			return
+		}
+
+		var waiver models.PaymentWaiver
+		doc.DataTo(&waiver)
+		waiver.ID = doc.Ref.ID
+		waivers = append(waivers, waiver)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"waivers": waivers})
+}
+
+// RequestPaymentWaiver asks for part of a payment to be waived. Nothing
+// changes on the payment until the waiver is approved.
+func RequestPaymentWaiver(c *gin.Context) {
+	paymentID := c.Param("id")
+
+	var req models.PaymentWaiverCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	doc, err := client.Collection("payments").Doc(paymentID).Get(ctx)
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Payment not found", "Failed to fetch payment"))
+		return
+	}
+	payment := paymentFromDoc(doc)
+
+	if err := checkWaivable(payment, req.Amount); err != nil {
+		c.Error(err)
+		return
+	}
+
+	waiver := models.PaymentWaiver{
+		PaymentID:     payment.ID,
+		StudentID:     payment.StudentID,
+		Amount:        req.Amount,
+		Currency:      payment.Currency,
+		Reason:        req.Reason,
+		Status:        "pending",
+		RequestedBy:   token.UID,
+		RequestedRole: config.TokenRole(token),
+		CreatedAt:     time.Now(),
+	}
+
+	docRef, _, err := client.Collection("payment_waivers").Add(ctx, waiver)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to request waiver"))
+		return
+	}
+	waiver.ID = docRef.ID
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "payment.waiver_request",
+		TargetType: "payment",
+		TargetID:   payment.ID,
+		Details: map[string]interface{}{
+			"waiverId": waiver.ID,
+			"amount":   waiver.Amount,
+			"reason":   waiver.Reason,
+		},
+	})
+
+	setLocation(c, waiver.ID)
+	c.JSON(http.StatusCreated, gin.H{"waiver": waiver})
+}
+
+// ApproveWaiver applies a pending waiver: the payment's amount is reduced
+// and the waiver is added to its adjustments. The approver must be another
+// user with a different role than the requester.
+func ApproveWaiver(c *gin.Context) {
+	waiverID := c.Param("id")
+
+	var req models.PaymentWaiverReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+	role := config.TokenRole(token)
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	ref := client.Collection("payment_waivers").Doc(waiverID)
+	now := time.Now()
+	var waiver models.PaymentWaiver
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		waiver = models.PaymentWaiver{}
+		doc.DataTo(&waiver)
+		waiver.ID = doc.Ref.ID
+
+		switch {
+		case waiver.Status != "pending":
+			return apperrors.Conflict("Waiver is already " + waiver.Status)
+		case waiver.RequestedBy == token.UID:
+			return apperrors.Forbidden("Waivers must be approved by someone other than the requester")
+		case waiver.RequestedRole == role:
+			return apperrors.Forbidden("Waivers must be approved by a different role than the requester's").With("requestedRole", waiver.RequestedRole)
+		}
+
+		paymentRef := client.Collection("payments").Doc(waiver.PaymentID)
+		paymentDoc, err := tx.Get(paymentRef)
+		if err != nil {
+			return err
+		}
+		payment := paymentFromDoc(paymentDoc)
+		if err := checkWaivable(payment, waiver.Amount); err != nil {
+			return err
+		}
+
+		if err := waivePayment(tx, client, payment, waiver, now); err != nil {
+			return err
+		}
+
+		waiver.Status = "approved"
+		waiver.ReviewedBy = token.UID
+		waiver.ReviewedRole = role
+		waiver.ReviewNote = req.Note
+		waiver.ReviewedAt = &now
+		return tx.Set(ref, waiver)
+	})
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Waiver not found", "Failed to approve waiver"))
+		return
+	}
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "payment.waiver_approve",
+		TargetType: "payment",
+		TargetID:   waiver.PaymentID,
+		Details: map[string]interface{}{
+			"waiverId":    waiver.ID,
+			"amount":      waiver.Amount,
+			"requestedBy": waiver.RequestedBy,
+		},
+	})
+
+	doc, err := client.Collection("payments").Doc(waiver.PaymentID).Get(ctx)
+	if err != nil {
+		c.Error(apperrors.Internal(err, "Failed to fetch payment"))
+		return
+	}
+
+	setETag(c, doc)
+	c.JSON(http.StatusOK, gin.H{"waiver": waiver, "payment": paymentFromDoc(doc)})
+}
+
+// RejectWaiver closes a pending waiver without touching the payment.
+func RejectWaiver(c *gin.Context) {
+	waiverID := c.Param("id")
+
+	var req models.PaymentWaiverReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.Error(apperrors.Validation(err))
+		return
+	}
+
+	user, exists := c.Get("user")
+	if !exists {
+		c.Error(apperrors.Unauthorized("User not authenticated"))
+		return
+	}
+
+	token := user.(*auth.Token)
+
+	ctx := c.Request.Context()
+	client, err := firestore.NewClient(ctx, firestore.DetectProjectID)
+	if err != nil {
+		c.Error(apperrors.Unavailable(err, "Failed to connect to database"))
+		return
+	}
+	defer client.Close()
+
+	ref := client.Collection("payment_waivers").Doc(waiverID)
+	now := time.Now()
+	var waiver models.PaymentWaiver
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		waiver = models.PaymentWaiver{}
+		doc.DataTo(&waiver)
+		waiver.ID = doc.Ref.ID
+		if waiver.Status != "pending" {
+			return apperrors.Conflict("Waiver is already " + waiver.Status)
+		}
+
+		waiver.Status = "rejected"
+		waiver.ReviewedBy = token.UID
+		waiver.ReviewedRole = config.TokenRole(token)
+		waiver.ReviewNote = req.Note
+		waiver.ReviewedAt = &now
+		return tx.Set(ref, waiver)
+	})
+	if err != nil {
+		c.Error(apperrors.FromFirestore(err, "Waiver not found", "Failed to reject waiver"))
+		return
+	}
+
+	recordAudit(ctx, client, c, models.AuditLog{
+		Action:     "payment.waiver_reject",
+		TargetType: "payment",
+		TargetID:   waiver.PaymentID,
+		Details: map[string]interface{}{
+			"waiverId": waiver.ID,
+			"note":     waiver.ReviewNote,
+		},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"waiver": waiver})
+}
+
+// waivePayment reduces a payment read earlier in the same Firestore
+// transaction by an approved waiver. Settling the payment issues its
+// receipt number, so callers must not have written anything yet.
+func waivePayment(tx *firestore.Transaction, client *firestore.Client, payment models.Payment, waiver models.PaymentWaiver, now time.Time) error {
+	gross := payment.GrossAmount
+	if len(payment.Adjustments) == 0 {
+		gross = payment.Amount
+	}
+	payment.Amount -= waiver.Amount
+	adjustments := append(payment.Adjustments, models.PaymentAdjustment{
+		Kind:        "waiver",
+		SourceID:    waiver.ID,
+		Description: waiver.Reason,
+		Amount:      waiver.Amount,
+	})
+
+	status := payment.SettledStatus()
+	if payment.Status == "overdue" && status != "paid" {
+		status = "overdue"
+	}
+
+	updates := []firestore.Update{
+		{Path: "amount", Value: payment.Amount},
+		{Path: "grossAmount", Value: gross},
+		{Path: "adjustments", Value: adjustments},
+		{Path: "status", Value: status},
+		{Path: "updatedAt", Value: now},
+	}
+	if len(payment.Installments) > 0 {
+		installments := allocateInstallments(reduceInstallments(payment.Installments, waiver.Amount), payment.PaidAmount)
+		if len(installments) > 0 {
+			updates = append(updates, firestore.Update{Path: "installments", Value: installments})
+		} else {
+			updates = append(updates, firestore.Update{Path: "installments", Value: firestore.Delete})
+		}
+	}
+
+	// What was paid before the waiver settles the payment
+	if status == "paid" {
+		updates = append(updates, firestore.Update{Path: "paidDate", Value: &now})
+		if payment.PaidAmount > 0 && payment.ReceiptNumber == "" {
+			receipt, err := issueReceipt(tx, client, payment.ID, payment.AcademicYear, now)
+			if err != nil {
+				return err
+			}
+			updates = append(updates, firestore.Update{Path: "receiptNumber", Value: receipt.Number})
+			if err := tx.Create(client.Collection("receipts").Doc(payment.ID), receipt); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Update(client.Collection("payments").Doc(payment.ID), updates)
+}
+
+// checkWaivable rejects waivers of settled or closed payments and of more
+// than is still owed.
+func checkWaivable(payment models.Payment, amount int64) error {
+	if err := checkPaymentOpen(payment); err != nil {
+		return err
+	}
+	if amount > payment.Balance {
+		return apperrors.BadRequest("Amount exceeds the outstanding balance").With("balance", payment.Balance)
+	}
+	return nil
+}
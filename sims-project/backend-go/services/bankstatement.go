@@ -0,0 +1,359 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Supported bank statement formats.
+const (
+	StatementCSV   = "csv"
+	StatementMT940 = "mt940"
+)
+
+var ErrUnknownStatementFormat = errors.New("unknown bank statement format")
+
+// StatementEntry is one incoming transfer on a bank statement. Debits are
+// not returned.
+type StatementEntry struct {
+	Line        int // record number in the file, for error messages
+	Date        time.Time
+	Amount      string // major units with a '.' decimal separator, e.g. 150000.00
+	Currency    string // empty when the file does not say
+	Reference   string
+	Description string
+	Name        string // sender, when the bank provides it
+	BankRef     string // the bank's own transaction reference
+}
+
+type BankStatement struct {
+	Format   string
+	Account  string
+	Currency string
+	Entries  []StatementEntry
+	Debits   int // lines skipped because money went out
+}
+
+// StatementError points at the record of the file that could not be read.
+type StatementError struct {
+	Line int
+	Err  string
+}
+
+func (e *StatementError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+// DetectStatementFormat guesses the format from the content.
+func DetectStatementFormat(data []byte) string {
+	if bytes.Contains(data, []byte(":20:")) && bytes.Contains(data, []byte(":61:")) {
+		return StatementMT940
+	}
+	return StatementCSV
+}
+
+// ParseBankStatement reads a CSV export or an MT940 statement.
+func ParseBankStatement(format string, data []byte) (*BankStatement, error) {
+	switch format {
+	case StatementCSV:
+		return parseStatementCSV(data)
+	case StatementMT940:
+		return parseMT940(data)
+	default:
+		return nil, ErrUnknownStatementFormat
+	}
+}
+
+// csvColumns maps the header names used by Indonesian and international
+// bank exports to the fields of StatementEntry.
+var csvColumns = map[string]string{
+	"date":             "date",
+	"transaction date": "date",
+	"posting date":     "date",
+	"value date":       "date",
+	"tanggal":          "date",
+	"tgl":              "date",
+	"amount":           "amount",
+	"jumlah":           "amount",
+	"nominal":          "amount",
+	"mutasi":           "amount",
+	"credit":           "credit",
+	"kredit":           "credit",
+	"cr":               "credit",
+	"debit":            "debit",
+	"db":               "debit",
+	"currency":         "currency",
+	"mata uang":        "currency",
+	"reference":        "reference",
+	"referensi":        "reference",
+	"ref":              "reference",
+	"berita":           "reference",
+	"remark":           "reference",
+	"remarks":          "reference",
+	"description":      "description",
+	"keterangan":       "description",
+	"deskripsi":        "description",
+	"narrative":        "description",
+	"name":             "name",
+	"nama":             "name",
+	"sender":           "name",
+	"pengirim":         "name",
+	"counterparty":     "name",
+	"bank reference":   "bankRef",
+	"transaction id":   "bankRef",
+	"no. referensi":    "bankRef",
+}
+
+var statementDateLayouts = []string{
+	"2006-01-02",
+	"02/01/2006",
+	"02-01-2006",
+	"2006/01/02",
+	"02/01/06",
+	"2 Jan 2006",
+	"02 Jan 2006",
+}
+
+func parseStatementCSV(data []byte) (*BankStatement, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	// Exports with a decimal comma separate fields with semicolons
+	header, _, _ := bytes.Cut(data, []byte("\n"))
+	reader := csv.NewReader(bytes.NewReader(data))
+	if bytes.Count(header, []byte(";")) > bytes.Count(header, []byte(",")) {
+		reader.Comma = ';'
+	}
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	record, err := reader.Read()
+	if err != nil {
+		return nil, &StatementError{Line: 1, Err: "missing header row"}
+	}
+	columns := make(map[string]int)
+	for i, name := range record {
+		if field, ok := csvColumns[strings.ToLower(strings.TrimSpace(name))]; ok {
+			if _, seen := columns[field]; !seen {
+				columns[field] = i
+			}
+		}
+	}
+	_, hasAmount := columns["amount"]
+	_, hasCredit := columns["credit"]
+	if _, ok := columns["date"]; !ok || (!hasAmount && !hasCredit) {
+		return nil, &StatementError{Line: 1, Err: "header must name a date column and an amount or credit column"}
+	}
+
+	statement := &BankStatement{Format: StatementCSV}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, &StatementError{Line: parseErr.Line, Err: parseErr.Err.Error()}
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Blank lines are skipped by the reader, so ask it where we are
+		line, _ := reader.FieldPos(0)
+		get := func(field string) string {
+			if i, ok := columns[field]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		if strings.Join(record, "") == "" {
+			continue
+		}
+
+		date, err := parseStatementDate(get("date"))
+		if err != nil {
+			return nil, &StatementError{Line: line, Err: err.Error()}
+		}
+
+		raw := get("credit")
+		if !hasCredit {
+			raw = get("amount")
+		}
+		amount, credit, err := parseStatementAmount(raw)
+		if err != nil {
+			return nil, &StatementError{Line: line, Err: err.Error()}
+		}
+		if !credit || amount == "" || strings.Trim(amount, "0.") == "" {
+			statement.Debits++
+			continue
+		}
+
+		statement.Entries = append(statement.Entries, StatementEntry{
+			Line:        line,
+			Date:        date,
+			Amount:      amount,
+			Currency:    strings.ToUpper(get("currency")),
+			Reference:   get("reference"),
+			Description: get("description"),
+			Name:        get("name"),
+			BankRef:     get("bankRef"),
+		})
+	}
+	return statement, nil
+}
+
+func parseStatementDate(s string) (time.Time, error) {
+	for _, layout := range statementDateLayouts {
+		if date, err := time.Parse(layout, s); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q", s)
+}
+
+// parseStatementAmount normalizes amounts such as "1.500.000,00",
+// "1,500,000.00 CR" or "-250000" and reports whether money came in. When
+// only one kind of separator is used, it is the decimal separator if it
+// occurs once and is followed by one or two digits.
+func parseStatementAmount(s string) (string, bool, error) {
+	credit := true
+	s = strings.ToUpper(strings.TrimSpace(s))
+	switch {
+	case s == "":
+		return "", true, nil
+	case strings.HasSuffix(s, "DB"), strings.HasSuffix(s, "D"):
+		credit = false
+		s = strings.TrimRight(s, "DB ")
+	case strings.HasSuffix(s, "CR"), strings.HasSuffix(s, "C"):
+		s = strings.TrimRight(s, "CR ")
+	}
+	s = strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(s, "IDR"), "RP"))
+	if strings.HasPrefix(s, "-") || (strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")")) {
+		credit = false
+		s = strings.Trim(s, "-() ")
+	}
+	s = strings.TrimPrefix(s, "+")
+
+	decimal := byte(0)
+	lastDot, lastComma := strings.LastIndexByte(s, '.'), strings.LastIndexByte(s, ',')
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		decimal = s[max(lastDot, lastComma)]
+	case lastDot >= 0 && strings.Count(s, ".") == 1 && len(s)-lastDot <= 3:
+		decimal = '.'
+	case lastComma >= 0 && strings.Count(s, ",") == 1 && len(s)-lastComma <= 3:
+		decimal = ','
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case ch >= '0' && ch <= '9':
+			b.WriteByte(ch)
+		case ch == decimal:
+			b.WriteByte('.')
+		case ch == '.' || ch == ',' || ch == ' ':
+			// thousands separator
+		default:
+			return "", false, fmt.Errorf("invalid amount %q", s)
+		}
+	}
+	if b.Len() == 0 {
+		return "", false, fmt.Errorf("invalid amount %q", s)
+	}
+	return b.String(), credit, nil
+}
+
+// mt940Statement matches the :61: statement line: value date, optional
+// entry date, debit/credit mark, optional funds code, amount, transaction
+// type, customer reference and optional bank reference.
+var mt940Statement = regexp.MustCompile(`^(\d{6})(\d{4})?(RC|RD|C|D)([A-Z])?(\d+,\d*)([NFS][A-Z0-9]{3})([^/]*)(?://(.*))?`)
+
+func parseMT940(data []byte) (*BankStatement, error) {
+	type field struct {
+		tag   string
+		value string
+		line  int
+	}
+
+	// Fields start with :tag: and continue on the following lines
+	var fields []field
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r ")
+		if text == "" || text == "-" || strings.HasPrefix(text, "{") {
+			continue
+		}
+		if strings.HasPrefix(text, ":") {
+			if tag, value, ok := strings.Cut(text[1:], ":"); ok && len(tag) <= 3 {
+				fields = append(fields, field{tag: tag, value: value, line: line})
+				continue
+			}
+		}
+		if len(fields) > 0 {
+			fields[len(fields)-1].value += "\n" + text
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	statement := &BankStatement{Format: StatementMT940}
+	var current *StatementEntry
+	for _, f := range fields {
+		switch f.tag {
+		case "25":
+			statement.Account = strings.TrimSpace(f.value)
+		case "60F", "60M":
+			// C240801IDR1000000,00
+			if len(f.value) >= 10 {
+				statement.Currency = f.value[7:10]
+			}
+		case "61":
+			current = nil
+			first, supplementary, _ := strings.Cut(f.value, "\n")
+			m := mt940Statement.FindStringSubmatch(first)
+			if m == nil {
+				return nil, &StatementError{Line: f.line, Err: "malformed :61: statement line"}
+			}
+			// Reversals of debits bring money back in
+			if m[3] != "C" && m[3] != "RD" {
+				statement.Debits++
+				continue
+			}
+			date, err := time.Parse("060102", m[1])
+			if err != nil {
+				return nil, &StatementError{Line: f.line, Err: "invalid value date " + m[1]}
+			}
+			reference := strings.TrimSpace(m[7])
+			if reference == "NONREF" {
+				reference = ""
+			}
+			statement.Entries = append(statement.Entries, StatementEntry{
+				Line:        f.line,
+				Date:        date,
+				Amount:      strings.TrimSuffix(strings.Replace(m[5], ",", ".", 1), "."),
+				Currency:    statement.Currency,
+				Reference:   reference,
+				Description: strings.TrimSpace(supplementary),
+				BankRef:     strings.TrimSpace(m[8]),
+			})
+			current = &statement.Entries[len(statement.Entries)-1]
+		case "86":
+			// Information to account owner belongs to the preceding line
+			if current != nil {
+				narrative := strings.Join(strings.Fields(f.value), " ")
+				current.Description = strings.TrimSpace(current.Description + " " + narrative)
+			}
+			current = nil
+		}
+	}
+	return statement, nil
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseStatementCSV(t *testing.T) {
+	data := "\xef\xbb\xbfTanggal,Keterangan,Berita,Mutasi,Nama\n" +
+		"10/01/2025,TRSF E-BANKING,INV-001,\"1,500,000.00 CR\",BUDI\n" +
+		"11/01/2025,BIAYA ADM,,\"15,000.00 DB\",\n" +
+		"\n" +
+		"12/01/2025,SETORAN,INV-002,250000,SITI\n"
+
+	statement, err := ParseBankStatement(StatementCSV, []byte(data))
+	if err != nil {
+		t.Fatalf("ParseBankStatement: %v", err)
+	}
+	if statement.Debits != 1 {
+		t.Errorf("Debits = %d, want 1", statement.Debits)
+	}
+	want := []StatementEntry{
+		{Line: 2, Date: time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC), Amount: "1500000.00", Reference: "INV-001", Description: "TRSF E-BANKING", Name: "BUDI"},
+		{Line: 5, Date: time.Date(2025, 1, 12, 0, 0, 0, 0, time.UTC), Amount: "250000", Reference: "INV-002", Description: "SETORAN", Name: "SITI"},
+	}
+	if len(statement.Entries) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(statement.Entries), len(want), statement.Entries)
+	}
+	for i, entry := range statement.Entries {
+		if entry != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, entry, want[i])
+		}
+	}
+}
+
+func TestParseStatementCSVSemicolon(t *testing.T) {
+	data := "Date;Credit;Debit;Currency;Reference\n" +
+		"2025-01-10;1.500.000,00;;idr;INV-001\n" +
+		"2025-01-11;;15.000,00;idr;FEE\n"
+
+	statement, err := ParseBankStatement(StatementCSV, []byte(data))
+	if err != nil {
+		t.Fatalf("ParseBankStatement: %v", err)
+	}
+	if len(statement.Entries) != 1 || statement.Debits != 1 {
+		t.Fatalf("entries = %+v, debits = %d", statement.Entries, statement.Debits)
+	}
+	if entry := statement.Entries[0]; entry.Amount != "1500000.00" || entry.Currency != "IDR" || entry.Reference != "INV-001" {
+		t.Errorf("entry = %+v", entry)
+	}
+}
+
+func TestParseStatementCSVErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		line int
+	}{
+		{"empty file", "", 1},
+		{"no amount column", "Date,Reference\n2025-01-10,INV-001\n", 1},
+		{"no date column", "Amount,Reference\n100,INV-001\n", 1},
+		{"bad date", "Date,Amount\n2025-01-10,100\n31/31/2025,100\n", 3},
+		{"bad amount", "Date,Amount\n2025-01-10,12abc\n", 2},
+	}
+	for _, tt := range tests {
+		_, err := ParseBankStatement(StatementCSV, []byte(tt.data))
+		var statementErr *StatementError
+		if !errors.As(err, &statementErr) {
+			t.Errorf("%s: err = %v, want a StatementError", tt.name, err)
+			continue
+		}
+		if statementErr.Line != tt.line {
+			t.Errorf("%s: error on line %d, want %d", tt.name, statementErr.Line, tt.line)
+		}
+	}
+}
+
+func TestParseStatementAmount(t *testing.T) {
+	tests := []struct {
+		input  string
+		want   string
+		credit bool
+	}{
+		{"1.500.000,00", "1500000.00", true},
+		{"1,500,000.00", "1500000.00", true},
+		{"1.500.000", "1500000", true},
+		{"1,500,000", "1500000", true},
+		{"1500000,5", "1500000.5", true},
+		{"150000.00 CR", "150000.00", true},
+		{"150000.00 DB", "150000.00", false},
+		{"-250000", "250000", false},
+		{"(250000)", "250000", false},
+		{"+250000", "250000", true},
+		{"Rp 250.000", "250000", true},
+		{"IDR 250,000.00", "250000.00", true},
+	}
+	for _, tt := range tests {
+		got, credit, err := parseStatementAmount(tt.input)
+		if err != nil || got != tt.want || credit != tt.credit {
+			t.Errorf("parseStatementAmount(%q) = %q, %v, %v, want %q, %v", tt.input, got, credit, err, tt.want, tt.credit)
+		}
+	}
+	for _, input := range []string{"abc", "12x", "-"} {
+		if _, _, err := parseStatementAmount(input); err == nil {
+			t.Errorf("parseStatementAmount(%q) accepted", input)
+		}
+	}
+}
+
+const mt940Sample = `{1:F01BANKIDJAXXXX0000000000}{4:
+:20:STMT250110
+:25:1234567890
+:28C:00001/001
+:60F:C250109IDR1000000,00
+:61:2501100110C1500000,00NTRFINV-001//BR25011001
+TRANSFER MASUK
+:86:BUDI SANTOSO
+ SPP JANUARI
+:61:250110D15000,00NCHGNONREF//BR25011002
+:86:BIAYA ADMIN
+:61:250111RD250000,NTRFNONREF
+:86:PEMBATALAN DEBET
+:62F:C250111IDR2735000,00
+-}`
+
+func TestParseMT940(t *testing.T) {
+	if format := DetectStatementFormat([]byte(mt940Sample)); format != StatementMT940 {
+		t.Fatalf("DetectStatementFormat = %s, want %s", format, StatementMT940)
+	}
+	statement, err := ParseBankStatement(StatementMT940, []byte(mt940Sample))
+	if err != nil {
+		t.Fatalf("ParseBankStatement: %v", err)
+	}
+	if statement.Account != "1234567890" || statement.Currency != "IDR" || statement.Debits != 1 {
+		t.Errorf("statement = {%s %s %d}", statement.Account, statement.Currency, statement.Debits)
+	}
+	want := []StatementEntry{
+		{Line: 6, Date: time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC), Amount: "1500000.00", Currency: "IDR", Reference: "INV-001",
+			Description: "TRANSFER MASUK BUDI SANTOSO SPP JANUARI", BankRef: "BR25011001"},
+		{Line: 12, Date: time.Date(2025, 1, 11, 0, 0, 0, 0, time.UTC), Amount: "250000", Currency: "IDR",
+			Description: "PEMBATALAN DEBET"},
+	}
+	if len(statement.Entries) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(statement.Entries), len(want), statement.Entries)
+	}
+	for i, entry := range statement.Entries {
+		if entry != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, entry, want[i])
+		}
+	}
+}
+
+func TestParseMT940Errors(t *testing.T) {
+	data := ":20:STMT\n:25:1234567890\n:61:garbage\n"
+	_, err := ParseBankStatement(StatementMT940, []byte(data))
+	var statementErr *StatementError
+	if !errors.As(err, &statementErr) || statementErr.Line != 3 {
+		t.Errorf("err = %v, want a StatementError on line 3", err)
+	}
+
+	if _, err := ParseBankStatement("ofx", nil); !errors.Is(err, ErrUnknownStatementFormat) {
+		t.Errorf("unknown format: err = %v", err)
+	}
+	if format := DetectStatementFormat([]byte("Date,Amount\n")); format != StatementCSV {
+		t.Errorf("DetectStatementFormat(csv) = %s", format)
+	}
+}
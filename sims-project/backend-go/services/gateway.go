@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrInvalidSignature   = errors.New("invalid webhook signature")
+	ErrUnsupportedCharge  = errors.New("charge not supported by the payment gateway")
+	ErrGatewayUnavailable = errors.New("payment gateway unavailable")
+)
+
+// Charge methods offered to payers.
+const (
+	ChargeLink           = "link"
+	ChargeVirtualAccount = "virtual_account"
+)
+
+// Normalized charge and event statuses.
+const (
+	ChargePending = "pending"
+	ChargePaid    = "paid"
+	ChargeExpired = "expired"
+	ChargeFailed  = "failed"
+)
+
+// ChargeRequest asks the gateway for a payment link or virtual account.
+type ChargeRequest struct {
+	OrderID       string
+	Amount        int64 // minor units
+	Currency      string
+	Method        string // link, virtual_account
+	Bank          string // virtual accounts only, e.g. bca, bni, bri
+	Description   string
+	CustomerName  string
+	CustomerEmail string
+	ExpiresAt     time.Time
+}
+
+// Charge is what the payer uses to pay: a hosted page or a virtual account
+// number.
+type Charge struct {
+	ProviderRef string
+	PaymentURL  string
+	VANumber    string
+	Bank        string
+	ExpiresAt   time.Time
+}
+
+// GatewayEvent is a verified, provider independent notification.
+type GatewayEvent struct {
+	// EventID identifies the notification; redeliveries share it
+	EventID     string
+	OrderID     string
+	ProviderRef string
+	Status      string // pending, paid, expired, failed
+	Amount      int64  // minor units
+	Currency    string
+	Method      string
+	OccurredAt  time.Time
+}
+
+// PaymentGateway creates charges at an online payment provider and
+// verifies the webhooks it sends back. FakeGateway serves development and
+// tests.
+type PaymentGateway interface {
+	Name() string
+	CreateCharge(ctx context.Context, req ChargeRequest) (*Charge, error)
+	// ParseWebhook verifies the notification's signature and decodes it.
+	ParseWebhook(header http.Header, body []byte) (*GatewayEvent, error)
+}
+
+// Gateway is the provider used by the handlers, set up in main. It is nil
+// when no gateway is configured.
+var Gateway PaymentGateway
+
+// FakeGatewaySignatureHeader carries the hex HMAC-SHA256 of the body.
+const FakeGatewaySignatureHeader = "X-Fake-Signature"
+
+// FakeGateway pretends to be a payment provider. Charges are never paid by
+// themselves; post a webhook signed with Sign to simulate the payer.
+type FakeGateway struct {
+	Secret string
+}
+
+// fakeWebhook is the notification format accepted by FakeGateway.
+type fakeWebhook struct {
+	EventID  string    `json:"eventId"`
+	OrderID  string    `json:"orderId"`
+	Status   string    `json:"status"`
+	Amount   int64     `json:"amount"`
+	Currency string    `json:"currency"`
+	PaidAt   time.Time `json:"paidAt"`
+}
+
+func (g *FakeGateway) Name() string {
+	return "fake"
+}
+
+func (g *FakeGateway) CreateCharge(ctx context.Context, req ChargeRequest) (*Charge, error) {
+	charge := &Charge{
+		ProviderRef: "fake-" + req.OrderID,
+		ExpiresAt:   req.ExpiresAt,
+	}
+	switch req.Method {
+	case ChargeLink:
+		charge.PaymentURL = "https://fake-gateway.invalid/pay/" + req.OrderID
+	case ChargeVirtualAccount:
+		// A stable 16 digit number derived from the order
+		sum := sha256.Sum256([]byte(req.OrderID))
+		charge.VANumber = fmt.Sprintf("8808%012d", binary.BigEndian.Uint64(sum[:8])%1e12)
+		charge.Bank = req.Bank
+	default:
+		return nil, ErrUnsupportedCharge
+	}
+	return charge, nil
+}
+
+func (g *FakeGateway) ParseWebhook(header http.Header, body []byte) (*GatewayEvent, error) {
+	signature, err := hex.DecodeString(header.Get(FakeGatewaySignatureHeader))
+	if err != nil || !hmac.Equal(signature, g.mac(body)) {
+		return nil, ErrInvalidSignature
+	}
+
+	var notification fakeWebhook
+	if err := json.Unmarshal(body, &notification); err != nil {
+		return nil, err
+	}
+	if notification.EventID == "" || notification.OrderID == "" || notification.Currency == "" {
+		return nil, errors.New("eventId, orderId and currency are required")
+	}
+	switch notification.Status {
+	case ChargePending, ChargePaid, ChargeExpired, ChargeFailed:
+	default:
+		return nil, fmt.Errorf("unknown status %q", notification.Status)
+	}
+
+	return &GatewayEvent{
+		EventID:     notification.EventID,
+		OrderID:     notification.OrderID,
+		ProviderRef: "fake-" + notification.OrderID,
+		Status:      notification.Status,
+		Amount:      notification.Amount,
+		Currency:    notification.Currency,
+		Method:      "fake",
+		OccurredAt:  notification.PaidAt,
+	}, nil
+}
+
+// Sign returns the signature header value for a webhook body.
+func (g *FakeGateway) Sign(body []byte) string {
+	return hex.EncodeToString(g.mac(body))
+}
+
+func (g *FakeGateway) mac(body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(g.Secret))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFakeGatewaySignAndVerify(t *testing.T) {
+	g := &FakeGateway{Secret: "webhook-secret"}
+	body := []byte(`{"eventId":"evt-1","orderId":"order-1","status":"paid","amount":15000000,"currency":"IDR","paidAt":"2025-01-10T08:00:00Z"}`)
+
+	header := http.Header{}
+	header.Set(FakeGatewaySignatureHeader, g.Sign(body))
+	event, err := g.ParseWebhook(header, body)
+	if err != nil {
+		t.Fatalf("ParseWebhook: %v", err)
+	}
+	want := GatewayEvent{
+		EventID:     "evt-1",
+		OrderID:     "order-1",
+		ProviderRef: "fake-order-1",
+		Status:      ChargePaid,
+		Amount:      15000000,
+		Currency:    "IDR",
+		Method:      "fake",
+		OccurredAt:  time.Date(2025, 1, 10, 8, 0, 0, 0, time.UTC),
+	}
+	if *event != want {
+		t.Errorf("event = %+v, want %+v", *event, want)
+	}
+
+	tests := []struct {
+		name      string
+		signature string
+		body      []byte
+	}{
+		{"missing signature", "", body},
+		{"not hex", "zz", body},
+		{"other secret", (&FakeGateway{Secret: "other"}).Sign(body), body},
+		{"tampered body", g.Sign(body), []byte(strings.Replace(string(body), "15000000", "15000001", 1))},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		header.Set(FakeGatewaySignatureHeader, tt.signature)
+		if _, err := g.ParseWebhook(header, tt.body); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: err = %v, want ErrInvalidSignature", tt.name, err)
+		}
+	}
+}
+
+func TestFakeGatewayRejectsIncompleteWebhooks(t *testing.T) {
+	g := &FakeGateway{Secret: "webhook-secret"}
+	for _, body := range []string{
+		`{"orderId":"order-1","status":"paid","amount":1,"currency":"IDR"}`,
+		`{"eventId":"evt-1","status":"paid","amount":1,"currency":"IDR"}`,
+		`{"eventId":"evt-1","orderId":"order-1","status":"paid","amount":1}`,
+		`{"eventId":"evt-1","orderId":"order-1","status":"refunded","amount":1,"currency":"IDR"}`,
+		`not json`,
+	} {
+		header := http.Header{}
+		header.Set(FakeGatewaySignatureHeader, g.Sign([]byte(body)))
+		if _, err := g.ParseWebhook(header, []byte(body)); err == nil || errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: err = %v, want a decoding error", body, err)
+		}
+	}
+}
+
+func TestFakeGatewayCreateCharge(t *testing.T) {
+	g := &FakeGateway{Secret: "webhook-secret"}
+	ctx := context.Background()
+
+	link, err := g.CreateCharge(ctx, ChargeRequest{OrderID: "order-1", Method: ChargeLink})
+	if err != nil || link.PaymentURL == "" || link.ProviderRef != "fake-order-1" {
+		t.Errorf("link charge = %+v, %v", link, err)
+	}
+
+	va, err := g.CreateCharge(ctx, ChargeRequest{OrderID: "order-1", Method: ChargeVirtualAccount, Bank: "bca"})
+	if err != nil || len(va.VANumber) != 16 || va.Bank != "bca" {
+		t.Fatalf("virtual account charge = %+v, %v", va, err)
+	}
+	again, _ := g.CreateCharge(ctx, ChargeRequest{OrderID: "order-1", Method: ChargeVirtualAccount, Bank: "bca"})
+	if again.VANumber != va.VANumber {
+		t.Errorf("virtual account number not stable: %s, %s", va.VANumber, again.VANumber)
+	}
+
+	if _, err := g.CreateCharge(ctx, ChargeRequest{OrderID: "order-1", Method: "card"}); !errors.Is(err, ErrUnsupportedCharge) {
+		t.Errorf("unknown method: err = %v, want ErrUnsupportedCharge", err)
+	}
+}
@@ -0,0 +1,245 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidCredentials  = errors.New("invalid email or password")
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrUserDisabled        = errors.New("user account is disabled")
+	ErrTooManyAttempts     = errors.New("too many attempts, try again later")
+	ErrProviderUnavailable = errors.New("identity provider unavailable")
+)
+
+// SignInResult is returned by a successful password sign-in.
+type SignInResult struct {
+	UID          string
+	Email        string
+	IDToken      string
+	RefreshToken string
+	ExpiresIn    time.Duration
+}
+
+// IdentityProvider verifies user credentials. Firebase Auth is used in
+// production; StubIdentityProvider serves development and tests.
+type IdentityProvider interface {
+	SignInWithPassword(ctx context.Context, email, password string) (*SignInResult, error)
+	RefreshIDToken(ctx context.Context, refreshToken string) (*SignInResult, error)
+}
+
+// Identity is the provider used by the handlers, set up in main.
+var Identity IdentityProvider = NewStubIdentityProvider()
+
+const (
+	firebaseSignInURL  = "https://identitytoolkit.googleapis.com/v1/accounts:signInWithPassword"
+	firebaseRefreshURL = "https://securetoken.googleapis.com/v1/token"
+)
+
+// FirebaseIdentityProvider signs in through the Firebase Auth REST API using
+// the project's Web API key.
+type FirebaseIdentityProvider struct {
+	APIKey     string
+	HTTPClient *http.Client
+	SignInURL  string
+	RefreshURL string
+}
+
+func NewFirebaseIdentityProvider(apiKey string) *FirebaseIdentityProvider {
+	return &FirebaseIdentityProvider{
+		APIKey:     apiKey,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		SignInURL:  firebaseSignInURL,
+		RefreshURL: firebaseRefreshURL,
+	}
+}
+
+type firebaseSignInResponse struct {
+	LocalID      string `json:"localId"`
+	Email        string `json:"email"`
+	IDToken      string `json:"idToken"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    string `json:"expiresIn"`
+}
+
+type firebaseRefreshResponse struct {
+	UserID       string `json:"user_id"`
+	IDToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    string `json:"expires_in"`
+}
+
+type firebaseErrorResponse struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// mapFirebaseError converts REST API error messages such as
+// "INVALID_PASSWORD" or "TOO_MANY_ATTEMPTS_TRY_LATER : ..." to sentinel errors.
+func mapFirebaseError(message string) error {
+	code, _, _ := strings.Cut(message, " ")
+	switch code {
+	case "EMAIL_NOT_FOUND", "INVALID_PASSWORD", "INVALID_LOGIN_CREDENTIALS", "INVALID_EMAIL", "MISSING_PASSWORD":
+		return ErrInvalidCredentials
+	case "TOKEN_EXPIRED", "INVALID_REFRESH_TOKEN", "USER_NOT_FOUND", "MISSING_REFRESH_TOKEN", "INVALID_GRANT_TYPE":
+		return ErrInvalidRefreshToken
+	case "USER_DISABLED":
+		return ErrUserDisabled
+	case "TOO_MANY_ATTEMPTS_TRY_LATER":
+		return ErrTooManyAttempts
+	default:
+		return fmt.Errorf("%w: %s", ErrProviderUnavailable, message)
+	}
+}
+
+// postJSON sends payload to url and decodes a successful response into out,
+// mapping Firebase REST errors to sentinel errors.
+func (p *FirebaseIdentityProvider) postJSON(ctx context.Context, url string, payload interface{}, out interface{}) error {
+	if p.APIKey == "" {
+		return fmt.Errorf("%w: Firebase Web API key is not configured", ErrProviderUnavailable)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url+"?key="+p.APIKey, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrProviderUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp firebaseErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+			return fmt.Errorf("%w: status %d", ErrProviderUnavailable, resp.StatusCode)
+		}
+		return mapFirebaseError(errResp.Error.Message)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (p *FirebaseIdentityProvider) SignInWithPassword(ctx context.Context, email, password string) (*SignInResult, error) {
+	payload := map[string]interface{}{
+		"email":             email,
+		"password":          password,
+		"returnSecureToken": true,
+	}
+
+	var out firebaseSignInResponse
+	if err := p.postJSON(ctx, p.SignInURL, payload, &out); err != nil {
+		return nil, err
+	}
+
+	expiresIn, _ := time.ParseDuration(out.ExpiresIn + "s")
+	return &SignInResult{
+		UID:          out.LocalID,
+		Email:        out.Email,
+		IDToken:      out.IDToken,
+		RefreshToken: out.RefreshToken,
+		ExpiresIn:    expiresIn,
+	}, nil
+}
+
+func (p *FirebaseIdentityProvider) RefreshIDToken(ctx context.Context, refreshToken string) (*SignInResult, error) {
+	payload := map[string]interface{}{
+		"grant_type":    "refresh_token",
+		"refresh_token": refreshToken,
+	}
+
+	var out firebaseRefreshResponse
+	if err := p.postJSON(ctx, p.RefreshURL, payload, &out); err != nil {
+		return nil, err
+	}
+
+	expiresIn, _ := time.ParseDuration(out.ExpiresIn + "s")
+	return &SignInResult{
+		UID:          out.UserID,
+		IDToken:      out.IDToken,
+		RefreshToken: out.RefreshToken,
+		ExpiresIn:    expiresIn,
+	}, nil
+}
+
+type stubAccount struct {
+	uid      string
+	password string
+}
+
+// StubIdentityProvider keeps accounts in memory. It is used when Firebase is
+// disabled and by tests; tokens it returns are opaque placeholders.
+type StubIdentityProvider struct {
+	mu       sync.RWMutex
+	accounts map[string]stubAccount
+}
+
+func NewStubIdentityProvider() *StubIdentityProvider {
+	return &StubIdentityProvider{accounts: make(map[string]stubAccount)}
+}
+
+// AddAccount registers or replaces the credentials for email.
+func (p *StubIdentityProvider) AddAccount(uid, email, password string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.accounts[strings.ToLower(email)] = stubAccount{uid: uid, password: password}
+}
+
+func (p *StubIdentityProvider) SignInWithPassword(ctx context.Context, email, password string) (*SignInResult, error) {
+	p.mu.RLock()
+	account, ok := p.accounts[strings.ToLower(email)]
+	p.mu.RUnlock()
+
+	if !ok || account.password != password {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &SignInResult{
+		UID:          account.uid,
+		Email:        strings.ToLower(email),
+		IDToken:      "stub-id-token-" + account.uid,
+		RefreshToken: "stub-refresh-token-" + account.uid,
+		ExpiresIn:    time.Hour,
+	}, nil
+}
+
+func (p *StubIdentityProvider) RefreshIDToken(ctx context.Context, refreshToken string) (*SignInResult, error) {
+	uid, ok := strings.CutPrefix(refreshToken, "stub-refresh-token-")
+	if !ok {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for email, account := range p.accounts {
+		if account.uid == uid {
+			return &SignInResult{
+				UID:          uid,
+				Email:        email,
+				IDToken:      "stub-id-token-" + uid,
+				RefreshToken: refreshToken,
+				ExpiresIn:    time.Hour,
+			}, nil
+		}
+	}
+	return nil, ErrInvalidRefreshToken
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStubIdentityProvider(t *testing.T) {
+	ctx := context.Background()
+	p := NewStubIdentityProvider()
+	p.AddAccount("uid-1", "Teacher@Example.com", "Secret123")
+
+	result, err := p.SignInWithPassword(ctx, "teacher@example.com", "Secret123")
+	if err != nil {
+		t.Fatalf("SignInWithPassword: %v", err)
+	}
+	if result.UID != "uid-1" || result.Email != "teacher@example.com" {
+		t.Errorf("got %+v", result)
+	}
+
+	if _, err := p.SignInWithPassword(ctx, "teacher@example.com", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong password: err = %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := p.SignInWithPassword(ctx, "nobody@example.com", "Secret123"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("unknown email: err = %v, want ErrInvalidCredentials", err)
+	}
+
+	refreshed, err := p.RefreshIDToken(ctx, result.RefreshToken)
+	if err != nil || refreshed.UID != "uid-1" {
+		t.Errorf("RefreshIDToken = %+v, %v", refreshed, err)
+	}
+	if _, err := p.RefreshIDToken(ctx, "stub-refresh-token-unknown"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("unknown refresh token: err = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestMapFirebaseError(t *testing.T) {
+	tests := []struct {
+		message string
+		want    error
+	}{
+		{"INVALID_PASSWORD", ErrInvalidCredentials},
+		{"EMAIL_NOT_FOUND", ErrInvalidCredentials},
+		{"INVALID_LOGIN_CREDENTIALS", ErrInvalidCredentials},
+		{"TOKEN_EXPIRED", ErrInvalidRefreshToken},
+		{"INVALID_REFRESH_TOKEN", ErrInvalidRefreshToken},
+		{"USER_DISABLED", ErrUserDisabled},
+		{"TOO_MANY_ATTEMPTS_TRY_LATER : Access to this account has been temporarily disabled", ErrTooManyAttempts},
+		{"INTERNAL_ERROR", ErrProviderUnavailable},
+	}
+	for _, tt := range tests {
+		if err := mapFirebaseError(tt.message); !errors.Is(err, tt.want) {
+			t.Errorf("mapFirebaseError(%q) = %v, want %v", tt.message, err, tt.want)
+		}
+	}
+}
+
+func TestFirebaseIdentityProviderSignIn(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != "web-key" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"code":400,"message":"API_KEY_INVALID"}}`))
+			return
+		}
+
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["password"] != "Secret123" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"code":400,"message":"INVALID_PASSWORD"}}`))
+			return
+		}
+		w.Write([]byte(`{"localId":"uid-1","email":"teacher@example.com","idToken":"id","refreshToken":"refresh","expiresIn":"3600"}`))
+	}))
+	defer server.Close()
+
+	p := NewFirebaseIdentityProvider("web-key")
+	p.SignInURL = server.URL
+
+	result, err := p.SignInWithPassword(context.Background(), "teacher@example.com", "Secret123")
+	if err != nil {
+		t.Fatalf("SignInWithPassword: %v", err)
+	}
+	if result.UID != "uid-1" || result.IDToken != "id" || result.ExpiresIn != time.Hour {
+		t.Errorf("got %+v", result)
+	}
+
+	if _, err := p.SignInWithPassword(context.Background(), "teacher@example.com", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong password: err = %v, want ErrInvalidCredentials", err)
+	}
+
+	p.APIKey = "other-key"
+	if _, err := p.SignInWithPassword(context.Background(), "teacher@example.com", "Secret123"); !errors.Is(err, ErrProviderUnavailable) {
+		t.Errorf("bad API key: err = %v, want ErrProviderUnavailable", err)
+	}
+
+	p.APIKey = ""
+	if _, err := p.SignInWithPassword(context.Background(), "teacher@example.com", "Secret123"); !errors.Is(err, ErrProviderUnavailable) {
+		t.Errorf("missing API key: err = %v, want ErrProviderUnavailable", err)
+	}
+}
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	tests := []struct {
+		password string
+		email    string
+		valid    bool
+	}{
+		{"Secret123", "", true},
+		{"Sec123", "", false},
+		{"secret123", "", false},
+		{"SECRET123", "", false},
+		{"SecretSecret", "", false},
+		{"Teacher1@example.com", "teacher1@EXAMPLE.com", false},
+	}
+	for _, tt := range tests {
+		err := DefaultPasswordPolicy.Validate(tt.password, tt.email)
+		if (err == nil) != tt.valid {
+			t.Errorf("Validate(%q, %q) = %v, want valid %v", tt.password, tt.email, err, tt.valid)
+		}
+	}
+
+	symbols := PasswordPolicy{MinLength: 6, RequireSymbol: true}
+	if err := symbols.Validate("abcdef", ""); err == nil {
+		t.Error("RequireSymbol accepted a password without a symbol")
+	}
+	if err := symbols.Validate("abc-def", ""); err != nil {
+		t.Errorf("RequireSymbol rejected %q: %v", "abc-def", err)
+	}
+}
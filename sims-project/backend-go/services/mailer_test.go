@@ -0,0 +1,142 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFormatMessage(t *testing.T) {
+	data := string(formatMessage("SIMS <no-reply@sekolah.sch.id>", MailMessage{To: "guru@sekolah.sch.id", Subject: "Halo", Body: "line 1\nline 2\n"}))
+	for _, want := range []string{
+		"From: SIMS <no-reply@sekolah.sch.id>\r\n",
+		"To: guru@sekolah.sch.id\r\n",
+		"Subject: Halo\r\n",
+		"Content-Type: text/plain; charset=UTF-8\r\n",
+		"\r\n\r\nline 1\r\nline 2\r\n",
+	} {
+		if !strings.Contains(data, want) {
+			t.Errorf("message missing %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestLogMailerWritesFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	mailer := &LogMailer{Dir: dir, From: "SIMS <no-reply@localhost>"}
+	if err := mailer.Send(context.Background(), PasswordResetMessage("guru/../x@sekolah.sch.id", "https://example.com/reset?oob=1")); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("files = %v, %v", files, err)
+	}
+	if name := files[0].Name(); !strings.HasSuffix(name, "-guru_.._x@sekolah.sch.id.eml") {
+		t.Errorf("file name %q not sanitized", name)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	if !strings.Contains(string(data), "https://example.com/reset?oob=1") {
+		t.Error("message does not contain the reset link")
+	}
+}
+
+func TestMessagesContainLink(t *testing.T) {
+	link := "https://sims.example.com/action?oobCode=abc"
+	for _, msg := range []MailMessage{
+		PasswordResetMessage("a@example.com", link),
+		AccountSetupMessage("a@example.com", "Budi", link),
+		EmailVerificationMessage("a@example.com", link),
+	} {
+		if msg.To != "a@example.com" || msg.Subject == "" || !strings.Contains(msg.Body, link) {
+			t.Errorf("message %+v", msg)
+		}
+	}
+}
+
+// fakeSMTPServer accepts one message and sends it to received.
+func fakeSMTPServer(t *testing.T) (string, int, <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		reply("220 localhost ESMTP")
+		var transcript strings.Builder
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			transcript.WriteString(line)
+			switch command := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case command == "DATA":
+				reply("354 go ahead")
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					transcript.WriteString(line)
+				}
+				reply("250 queued")
+			case command == "QUIT":
+				reply("221 bye")
+				received <- transcript.String()
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	return host, portNumber, received
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	host, port, received := fakeSMTPServer(t)
+	mailer := &SMTPMailer{Host: host, Port: port, From: "no-reply@sekolah.sch.id"}
+
+	if err := mailer.Send(context.Background(), EmailVerificationMessage("guru@sekolah.sch.id", "https://example.com/verify")); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	transcript := <-received
+	for _, want := range []string{"MAIL FROM:<no-reply@sekolah.sch.id>", "RCPT TO:<guru@sekolah.sch.id>", "Subject: Verify your SIMS email address", "https://example.com/verify"} {
+		if !strings.Contains(transcript, want) {
+			t.Errorf("transcript missing %q:\n%s", want, transcript)
+		}
+	}
+}
+
+func TestSMTPMailerRejectsHeaderInjection(t *testing.T) {
+	mailer := &SMTPMailer{Host: "127.0.0.1", Port: 1, From: "no-reply@sekolah.sch.id"}
+	for _, msg := range []MailMessage{
+		{To: "guru@sekolah.sch.id\r\nBcc: all@example.com", Subject: "Halo"},
+		{To: "guru@sekolah.sch.id", Subject: "Halo\nBcc: all@example.com"},
+	} {
+		if err := mailer.Send(context.Background(), msg); err == nil || !strings.Contains(err.Error(), "invalid header") {
+			t.Errorf("Send(%q, %q) = %v, want an invalid header error", msg.To, msg.Subject, err)
+		}
+	}
+}
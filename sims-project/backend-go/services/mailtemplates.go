@@ -0,0 +1,49 @@
+package services
+
+import "fmt"
+
+func PasswordResetMessage(to, link string) MailMessage {
+	return MailMessage{
+		To:      to,
+		Subject: "Reset your SIMS password",
+		Body: fmt.Sprintf(`Hello,
+
+We received a request to reset the password for your SIMS account.
+Open the link below to choose a new password:
+
+%s
+
+If you did not request this, you can ignore this email.
+`, link),
+	}
+}
+
+func AccountSetupMessage(to, displayName, link string) MailMessage {
+	return MailMessage{
+		To:      to,
+		Subject: "Your SIMS account is ready",
+		Body: fmt.Sprintf(`Hello %s,
+
+An account has been created for you in the School Information
+Management System. Open the link below to set your password:
+
+%s
+
+The link expires after a short time. Ask the school administrator for a
+new one if it no longer works.
+`, displayName, link),
+	}
+}
+
+func EmailVerificationMessage(to, link string) MailMessage {
+	return MailMessage{
+		To:      to,
+		Subject: "Verify your SIMS email address",
+		Body: fmt.Sprintf(`Hello,
+
+Please confirm your email address by opening the link below:
+
+%s
+`, link),
+	}
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const midtransTestServerKey = "SB-Mid-server-test"
+
+// midtransBody builds a notification signed with the test server key.
+func midtransBody(t *testing.T, fields map[string]string) []byte {
+	t.Helper()
+	sum := sha512.Sum512([]byte(fields["order_id"] + fields["status_code"] + fields["gross_amount"] + midtransTestServerKey))
+	if _, ok := fields["signature_key"]; !ok {
+		fields["signature_key"] = hex.EncodeToString(sum[:])
+	}
+	body, err := json.Marshal(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func settlement(grossAmount string) map[string]string {
+	return map[string]string{
+		"transaction_id":     "tx-1",
+		"order_id":           "order-1",
+		"status_code":        "200",
+		"gross_amount":       grossAmount,
+		"transaction_status": "settlement",
+		"payment_type":       "bank_transfer",
+		"transaction_time":   "2025-01-10 14:59:00",
+		"settlement_time":    "2025-01-10 15:00:00",
+	}
+}
+
+func TestMidtransParseWebhook(t *testing.T) {
+	g := NewMidtransGateway(midtransTestServerKey, false)
+
+	event, err := g.ParseWebhook(http.Header{}, midtransBody(t, settlement("150000.00")))
+	if err != nil {
+		t.Fatalf("ParseWebhook: %v", err)
+	}
+	if event.EventID != "tx-1:settlement" || event.OrderID != "order-1" || event.ProviderRef != "tx-1" {
+		t.Errorf("event ids = %+v", event)
+	}
+	if event.Status != ChargePaid || event.Amount != 15000000 || event.Currency != "IDR" || event.Method != "bank_transfer" {
+		t.Errorf("event = %+v", event)
+	}
+	if want := time.Date(2025, 1, 10, 8, 0, 0, 0, time.UTC); !event.OccurredAt.Equal(want) {
+		t.Errorf("OccurredAt = %v, want %v", event.OccurredAt, want)
+	}
+}
+
+func TestMidtransParseWebhookGrossAmount(t *testing.T) {
+	g := NewMidtransGateway(midtransTestServerKey, false)
+
+	tests := []struct {
+		gross string
+		want  int64
+	}{
+		{"150000.00", 15000000},
+		{"150000", 15000000},
+		{"0.29", 29},
+		{"1.13", 113},
+		{"19999.99", 1999999},
+	}
+	for _, tt := range tests {
+		event, err := g.ParseWebhook(http.Header{}, midtransBody(t, settlement(tt.gross)))
+		if err != nil {
+			t.Errorf("%s: %v", tt.gross, err)
+			continue
+		}
+		if event.Amount != tt.want {
+			t.Errorf("gross_amount %s: Amount = %d, want %d", tt.gross, event.Amount, tt.want)
+		}
+	}
+
+	if _, err := g.ParseWebhook(http.Header{}, midtransBody(t, settlement("abc"))); err == nil {
+		t.Error("invalid gross_amount accepted")
+	}
+}
+
+func TestMidtransParseWebhookSignature(t *testing.T) {
+	g := NewMidtransGateway(midtransTestServerKey, false)
+
+	forged := settlement("150000.00")
+	forged["signature_key"] = hex.EncodeToString(make([]byte, 64))
+	if _, err := g.ParseWebhook(http.Header{}, midtransBody(t, forged)); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("forged signature: err = %v, want ErrInvalidSignature", err)
+	}
+
+	// Changing a signed field after signing breaks the signature
+	body := midtransBody(t, settlement("150000.00"))
+	var fields map[string]string
+	json.Unmarshal(body, &fields)
+	fields["gross_amount"] = "1.00"
+	tampered, _ := json.Marshal(fields)
+	if _, err := g.ParseWebhook(http.Header{}, tampered); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered amount: err = %v, want ErrInvalidSignature", err)
+	}
+
+	other := NewMidtransGateway("another-key", false)
+	if _, err := other.ParseWebhook(http.Header{}, midtransBody(t, settlement("150000.00"))); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("other server key: err = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestMidtransParseWebhookStatus(t *testing.T) {
+	g := NewMidtransGateway(midtransTestServerKey, false)
+
+	tests := []struct {
+		status string
+		fraud  string
+		want   string
+	}{
+		{"settlement", "", ChargePaid},
+		{"capture", "accept", ChargePaid},
+		{"capture", "challenge", ChargePending},
+		{"pending", "", ChargePending},
+		{"expire", "", ChargeExpired},
+		{"deny", "", ChargeFailed},
+		{"cancel", "", ChargeFailed},
+		{"refund", "", ChargeFailed},
+	}
+	for _, tt := range tests {
+		fields := settlement("150000.00")
+		fields["transaction_status"] = tt.status
+		fields["fraud_status"] = tt.fraud
+		event, err := g.ParseWebhook(http.Header{}, midtransBody(t, fields))
+		if err != nil {
+			t.Errorf("%s/%s: %v", tt.status, tt.fraud, err)
+			continue
+		}
+		if event.Status != tt.want {
+			t.Errorf("%s/%s: Status = %s, want %s", tt.status, tt.fraud, event.Status, tt.want)
+		}
+	}
+}
+
+func TestMidtransCreateCharge(t *testing.T) {
+	var received map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, _, _ := r.BasicAuth(); user != midtransTestServerKey {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Write([]byte(`{"status_code":"201","transaction_id":"tx-1","va_numbers":[{"bank":"bca","va_number":"12345678901"}]}`))
+	}))
+	defer server.Close()
+
+	g := NewMidtransGateway(midtransTestServerKey, false)
+	g.ChargeURL = server.URL
+	ctx := context.Background()
+
+	charge, err := g.CreateCharge(ctx, ChargeRequest{
+		OrderID:   "order-1",
+		Amount:    15000000,
+		Currency:  "IDR",
+		Method:    ChargeVirtualAccount,
+		Bank:      "bca",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("CreateCharge: %v", err)
+	}
+	if charge.ProviderRef != "tx-1" || charge.VANumber != "12345678901" || charge.Bank != "bca" {
+		t.Errorf("charge = %+v", charge)
+	}
+	details, _ := received["transaction_details"].(map[string]interface{})
+	if details["gross_amount"] != float64(150000) {
+		t.Errorf("gross_amount sent = %v, want whole rupiah 150000", details["gross_amount"])
+	}
+
+	for _, req := range []ChargeRequest{
+		{OrderID: "order-2", Amount: 1250, Currency: "USD", Method: ChargeLink},
+		{OrderID: "order-3", Amount: 15000050, Currency: "IDR", Method: ChargeLink},
+	} {
+		if _, err := g.CreateCharge(ctx, req); !errors.Is(err, ErrUnsupportedCharge) {
+			t.Errorf("%s %d: err = %v, want ErrUnsupportedCharge", req.Currency, req.Amount, err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type PasswordPolicy struct {
+	MinLength     int  `yaml:"minLength" json:"minLength"`
+	RequireUpper  bool `yaml:"requireUpper" json:"requireUpper"`
+	RequireLower  bool `yaml:"requireLower" json:"requireLower"`
+	RequireDigit  bool `yaml:"requireDigit" json:"requireDigit"`
+	RequireSymbol bool `yaml:"requireSymbol" json:"requireSymbol"`
+}
+
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:    8,
+	RequireUpper: true,
+	RequireLower: true,
+	RequireDigit: true,
+}
+
+// Passwords is the policy enforced by the handlers, set up in main.
+var Passwords = DefaultPasswordPolicy
+
+// Validate returns an error describing every rule the password breaks.
+// email is rejected as a password to stop the most common weak choice.
+func (p PasswordPolicy) Validate(password, email string) error {
+	var problems []string
+
+	if len(password) < p.MinLength {
+		problems = append(problems, fmt.Sprintf("at least %d characters", p.MinLength))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+
+	if p.RequireUpper && !hasUpper {
+		problems = append(problems, "an uppercase letter")
+	}
+	if p.RequireLower && !hasLower {
+		problems = append(problems, "a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		problems = append(problems, "a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		problems = append(problems, "a symbol")
+	}
+
+	if len(problems) > 0 {
+		return errors.New("password must contain " + strings.Join(problems, ", "))
+	}
+
+	if email != "" && strings.EqualFold(password, email) {
+		return errors.New("password must not be the same as the email address")
+	}
+
+	return nil
+}
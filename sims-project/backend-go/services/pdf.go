@@ -0,0 +1,174 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// A4 page size in points.
+const (
+	A4Width  = 595.28
+	A4Height = 841.89
+)
+
+// helveticaWidths are the glyph widths of Helvetica for ASCII 32-126, in
+// 1/1000 of the font size.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// PDF draws pages with the standard Helvetica fonts, which every viewer
+// provides, so no font files are embedded. Coordinates are in points from
+// the top-left corner of the current page.
+type PDF struct {
+	width, height float64
+	title         string
+	pages         []*bytes.Buffer
+	content       *bytes.Buffer
+}
+
+// NewPDF returns a document with one empty page.
+func NewPDF(width, height float64) *PDF {
+	p := &PDF{width: width, height: height}
+	p.AddPage()
+	return p
+}
+
+// AddPage starts a new page; everything drawn afterwards goes on it.
+func (p *PDF) AddPage() {
+	p.content = &bytes.Buffer{}
+	p.pages = append(p.pages, p.content)
+}
+
+// PageCount returns the number of pages started so far.
+func (p *PDF) PageCount() int {
+	return len(p.pages)
+}
+
+// SetTitle sets the document title shown by viewers.
+func (p *PDF) SetTitle(title string) {
+	p.title = title
+}
+
+// Text draws s with its baseline at (x, y).
+func (p *PDF) Text(x, y, size float64, bold bool, s string) {
+	fmt.Fprintf(p.content, "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n", fontName(bold), size, x, p.height-y, pdfString(s))
+}
+
+// TextRight draws s so that it ends at x. Bold text is measured with the
+// regular widths, which is exact for digits.
+func (p *PDF) TextRight(x, y, size float64, bold bool, s string) {
+	p.Text(x-TextWidth(s, size), y, size, bold, s)
+}
+
+// Line draws a line of the given width.
+func (p *PDF) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(p.content, "%.2f w %.2f %.2f m %.2f %.2f l S\n", width, x1, p.height-y1, x2, p.height-y2)
+}
+
+// Watermark draws large light grey text diagonally across the current
+// page. Call
+// it first so the rest of the page is drawn on top.
+func (p *PDF) Watermark(s string) {
+	const size = 96
+	angle := math.Atan2(p.height, p.width)
+	cos, sin := math.Cos(angle), math.Sin(angle)
+	half := TextWidth(s, size) / 2
+	x := p.width/2 - half*cos
+	y := p.height/2 - half*sin
+	fmt.Fprintf(p.content, "q 0.88 g BT /F2 %d Tf %.4f %.4f %.4f %.4f %.2f %.2f Tm (%s) Tj ET Q\n", size, cos, sin, -sin, cos, x, y, pdfString(s))
+}
+
+// Bytes renders the document.
+func (p *PDF) Bytes() []byte {
+	// Catalog, page tree and fonts come first, then each page and its
+	// content stream, then the document info
+	kids := make([]string, len(p.pages))
+	for i := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+	}
+	for i, content := range p.pages {
+		var stream bytes.Buffer
+		zw := zlib.NewWriter(&stream)
+		zw.Write(content.Bytes())
+		zw.Close()
+
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", p.width, p.height, 6+2*i),
+			fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", stream.Len(), stream.Bytes()),
+		)
+	}
+	objects = append(objects, fmt.Sprintf("<< /Title (%s) /Producer (SIMS) >>", pdfString(p.title)))
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, len(objects), xref)
+	return out.Bytes()
+}
+
+// TextWidth returns the width of s in Helvetica at size points.
+func TextWidth(s string, size float64) float64 {
+	total := 0
+	for _, r := range s {
+		if r >= 32 && r <= 126 {
+			total += helveticaWidths[r-32]
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+func fontName(bold bool) string {
+	if bold {
+		return "F2"
+	}
+	return "F1"
+}
+
+// pdfString escapes s for a literal string in WinAnsi encoding. Characters
+// outside Latin-1 are replaced with "?".
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n' || r == '\r' || r == '\t':
+			b.WriteByte(' ')
+		case r < 32 || r > 255 || (r >= 127 && r < 160):
+			b.WriteByte('?')
+		case r > 126:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"crypto/sha256"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const stepUpAudience = "sims-step-up"
+
+var (
+	ErrMFANotConfigured   = errors.New("two-factor authentication is not configured")
+	ErrInvalidStepUpToken = errors.New("invalid or expired step-up token")
+)
+
+// MFA holds what the two-factor handlers need, set up in main.
+var MFA struct {
+	Encrypter *Encrypter
+	Issuer    string
+	StepUpTTL time.Duration
+	signKey   []byte
+}
+
+// ConfigureMFA derives the step-up signing key from the encryption key so
+// only one secret has to be managed.
+func ConfigureMFA(key []byte, issuer string, stepUpTTL time.Duration) error {
+	enc, err := NewEncrypter(key)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(append([]byte("step-up:"), key...))
+	MFA.Encrypter = enc
+	MFA.Issuer = issuer
+	MFA.StepUpTTL = stepUpTTL
+	MFA.signKey = sum[:]
+	return nil
+}
+
+// IssueStepUpToken returns a short-lived token proving uid passed a second
+// factor check.
+func IssueStepUpToken(uid string, now time.Time) (string, time.Time, error) {
+	if MFA.signKey == nil {
+		return "", time.Time{}, ErrMFANotConfigured
+	}
+
+	expiresAt := now.Add(MFA.StepUpTTL)
+	claims := jwt.RegisteredClaims{
+		Subject:   uid,
+		Audience:  jwt.ClaimStrings{stepUpAudience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(MFA.signKey)
+	return signed, expiresAt, err
+}
+
+func VerifyStepUpToken(tokenString, uid string) error {
+	if MFA.signKey == nil {
+		return ErrMFANotConfigured
+	}
+
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (interface{}, error) {
+		return MFA.signKey, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithAudience(stepUpAudience),
+		jwt.WithSubject(uid),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return ErrInvalidStepUpToken
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors,
+// "12345678901234567890", in base32.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTPVectors(t *testing.T) {
+	// RFC 6238 appendix B, truncated to six digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		step, ok := ValidateTOTP(rfc6238Secret, tt.code, time.Unix(tt.unix, 0))
+		if !ok {
+			t.Errorf("ValidateTOTP at %d rejected %s", tt.unix, tt.code)
+			continue
+		}
+		if want := tt.unix / totpPeriod; step != want {
+			t.Errorf("ValidateTOTP at %d: step = %d, want %d", tt.unix, step, want)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code := "005924"
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want bool
+	}{
+		{"same step", now, true},
+		{"one step later", now.Add(totpPeriod * time.Second), true},
+		{"one step earlier", now.Add(-totpPeriod * time.Second), true},
+		{"two steps later", now.Add(2 * totpPeriod * time.Second), false},
+		{"two steps earlier", now.Add(-2 * totpPeriod * time.Second), false},
+	}
+	for _, tt := range tests {
+		if _, ok := ValidateTOTP(rfc6238Secret, code, tt.at); ok != tt.want {
+			t.Errorf("%s: ok = %v, want %v", tt.name, ok, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTPInput(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		want   bool
+	}{
+		{"spaces", rfc6238Secret, "005 924", true},
+		{"lowercase secret", strings.ToLower(rfc6238Secret), "005924", true},
+		{"wrong code", rfc6238Secret, "005925", false},
+		{"short code", rfc6238Secret, "05924", false},
+		{"long code", rfc6238Secret, "0059240", false},
+		{"invalid secret", "not base32!", "005924", false},
+	}
+	for _, tt := range tests {
+		if _, ok := ValidateTOTP(tt.secret, tt.code, now); ok != tt.want {
+			t.Errorf("%s: ok = %v, want %v", tt.name, ok, tt.want)
+		}
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %v", err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("secret %q decodes to %d bytes, err %v", secret, len(key), err)
+	}
+
+	now := time.Now()
+	code := totpCode(key, now.Unix()/totpPeriod)
+	if _, ok := ValidateTOTP(secret, code, now); !ok {
+		t.Error("generated secret does not validate its own code")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("SIMS", "admin@example.com", rfc6238Secret)
+	for _, part := range []string{"otpauth://totp/SIMS:admin@example.com?", "secret=" + rfc6238Secret, "issuer=SIMS", "digits=6", "period=30"} {
+		if !strings.Contains(uri, part) {
+			t.Errorf("TOTPURI = %q, missing %q", uri, part)
+		}
+	}
+}